@@ -26,6 +26,10 @@ import (
 const usage = `choiceimp loads choice lists into the collector's storage service for use by
 other services.
 
+If the election has multiple questions, then the choice list must contain the
+choices of each configured question in "Questions", which maps question
+identifiers to maps from district identifiers to choices.
+
 The choice list container must have an extension corresponding to the container
 type it is, e.g., choicelist.bdoc.`
 
@@ -120,8 +124,9 @@ func choiceimpmain() (code int) {
 }
 
 type choicelist struct {
-	Election string
-	Choices  map[string]json.RawMessage
+	Election  string
+	Choices   map[string]json.RawMessage
+	Questions map[string]map[string]json.RawMessage
 }
 
 // choiceimp parses the list of choices and uploads them to the storage
@@ -139,20 +144,45 @@ func choiceimp(ctx context.Context, until int, c *conf.C, s *storage.Client,
 		return ElectionIDMismatchError{Conf: c.Election.Identifier, List: l.Election}
 	}
 
+	// Ensure that multi-question elections have choices for exactly the
+	// configured questions.
+	if len(c.Election.Questions) > 1 || len(l.Questions) > 0 {
+		if len(l.Questions) != len(c.Election.Questions) {
+			return QuestionCountMismatchError{
+				Conf: len(c.Election.Questions),
+				List: len(l.Questions),
+			}
+		}
+		for _, question := range c.Election.Questions {
+			if _, ok := l.Questions[question]; !ok {
+				return MissingQuestionChoicesError{Question: question}
+			}
+		}
+	}
+
 	if until >= command.Execute {
 		// Convert map[string]json.RawMessage to map[string][]byte.
 		choices := make(map[string][]byte)
 		for id, list := range l.Choices {
 			choices[id] = list
 		}
+		count := len(choices)
+		questions := make(map[string]map[string][]byte)
+		for question, lists := range l.Questions {
+			questions[question] = make(map[string][]byte)
+			for id, list := range lists {
+				questions[question][id] = list
+			}
+			count += len(lists)
+		}
 
-		log.Log(ctx, ImportingChoices{Count: len(choices)})
-		progress.Static(fmt.Sprintf("Importing %d choices:", len(choices)))
-		addprogress := progress.Percent(uint64(len(choices)), true)
+		log.Log(ctx, ImportingChoices{Count: count})
+		progress.Static(fmt.Sprintf("Importing %d choices:", count))
+		addprogress := progress.Percent(uint64(count), true)
 		progress.Redraw()
 		defer progress.Keep()
 
-		if err := s.PutChoices(ctx, version, choices, addprogress); err != nil {
+		if err := s.PutChoices(ctx, version, choices, questions, addprogress); err != nil {
 			return PutChoicesError{Err: err}
 		}
 	}
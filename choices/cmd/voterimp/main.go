@@ -7,6 +7,13 @@ System and contains Estonian strings, so the format is very specific to
 Estonia. voterimp checks the raw ECDSA signature with SHA-256 digest, parses
 the contents of the voter list, and adds a new version of voter information
 into the storage service.
+
+Voter entries may optionally contain the date of birth of the voter, which is
+stored along with the voter entry and can be used to check the voter's age.
+
+The voter list container may additionally contain a list of pre-registered
+WebAuthn credentials of voters signed with the voter list key, which are
+imported for use by the webauthn authentication verifier.
 */
 package main
 
@@ -16,6 +23,7 @@ import (
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -25,6 +33,7 @@ import (
 	"strings"
 	"time"
 
+	"ivxv.ee/common/collector/auth/webauthn"
 	"ivxv.ee/common/collector/command"
 	"ivxv.ee/common/collector/command/exit"
 	"ivxv.ee/common/collector/command/status"
@@ -44,6 +53,22 @@ voter list signature. The key for the voter list can be anything, but the key
 for the signature must be the list key with a ".signature" suffix. E.g.,
 "voter.list" and "voter.list.signature".
 
+A signed voter list container can additionally contain the list of WebAuthn
+credentials registered by voters, with the list key suffixed with
+".credentials" instead of ".signature", and the credentials list signature
+with the ".credentials" key additionally suffixed with ".signature". The
+credentials list must be signed the same way and with the same key as the
+voter list. The credentials list is JSON-encoded:
+
+    [
+        {
+            "id": "<base64url-encoded credential identifier>",
+            "voter": "<voter identifier>",
+            "name": "<voter name>",
+            "publickey": "<base64-encoded SubjectPublicKeyInfo>"
+        }
+    ]
+
 The voter list container must have an extension corresponding to the container
 type it is, e.g., voterlist.bdoc. voterimp additionally supports unsigned ZIP
 containers with metadata stored in the archive comment.`
@@ -129,11 +154,15 @@ func voterimpmain() (code int) {
 	}
 
 	// Get the contents of the container.
-	list, sig, err := containerData(cnt.Data())
+	list, sig, creds, credsSig, err := containerData(cnt.Data())
 	if err != nil {
 		return c.Error(exit.DataErr, ContainerDataError{Err: err},
 			"failed to find expected data from container:", err)
 	}
+	if creds != nil && len(signatures) == 0 {
+		return c.Error(exit.DataErr, UnsignedCredentialsError{Container: path},
+			"credentials in unsigned voter list container")
+	}
 
 	// Check the signature.
 	if err = verifyECDSA(c.Conf.Election.VoterList.Key, list, sig); err != nil {
@@ -141,6 +170,17 @@ func voterimpmain() (code int) {
 			"failed to verify voter list signature:", err)
 	}
 
+	// Check the signature of the credentials: the container signature
+	// only shows who submitted the container, but credentials must be
+	// authorized by the holder of the voter list signing key just like
+	// the voter list itself.
+	if creds != nil {
+		if err = verifyECDSA(c.Conf.Election.VoterList.Key, creds, credsSig); err != nil {
+			return c.Error(exit.DataErr, VerifyCredentialsSignatureError{Err: err},
+				"failed to verify credentials list signature:", err)
+		}
+	}
+
 	// Get the current voter list version.
 	oldver, err := c.Storage.GetVotersListVersion(c.Ctx)
 	switch {
@@ -154,12 +194,36 @@ func voterimpmain() (code int) {
 	}
 
 	// Parse the voter list and preprocess into a map of changes.
-	voters, newver, err := preprocess(c.Ctx, list, oldver, c.Conf.Election.Identifier, c.Storage)
+	voters, dobs, newver, err := preprocess(c.Ctx, list, oldver, c.Conf.Election.Identifier, c.Storage)
 	if err != nil {
 		return c.Error(exit.DataErr, PreprocessVotersError{Err: err},
 			"failed to preprocess voter list:", err)
 	}
 
+	// Parse the credentials list.
+	var credentials map[string][]byte
+	if creds != nil {
+		if credentials, err = parseCredentials(c.Ctx, creds, voters, oldver, c.Storage); err != nil {
+			return c.Error(exit.DataErr, ParseCredentialsError{Err: err},
+				"failed to parse credentials list:", err)
+		}
+	}
+
+	// Store the credentials before the new list, so that they are
+	// available as soon as the list is.
+	if c.Until >= command.Execute && len(credentials) > 0 {
+		log.Log(c.Ctx, ImportingCredentials{Count: len(credentials)})
+		progress.Static(fmt.Sprintf("Importing %d credentials:", len(credentials)))
+		addprogress := progress.Percent(uint64(len(credentials)), true)
+		progress.Redraw()
+		err := c.Storage.PutCredentials(c.Ctx, credentials, addprogress)
+		progress.Keep()
+		if err != nil {
+			return c.Error(exit.Unavailable, PutCredentialsError{Err: err},
+				"failed to import credentials:", err)
+		}
+	}
+
 	// Store the new list.
 	if c.Until >= command.Execute {
 		log.Log(c.Ctx, ImportingVoters{Version: newver, Count: len(voters)})
@@ -168,7 +232,7 @@ func voterimpmain() (code int) {
 		progress.Redraw()
 		defer progress.Keep()
 
-		if err := c.Storage.PutVoters(c.Ctx, cversion, voters,
+		if err := c.Storage.PutVoters(c.Ctx, cversion, voters, dobs,
 			oldver, newver, addprogress); err != nil {
 
 			return c.Error(exit.Unavailable, PutVotersError{Err: err},
@@ -178,9 +242,13 @@ func voterimpmain() (code int) {
 	return exit.OK
 }
 
-// containerData returns voter list and signature contents from container data.
-func containerData(data map[string][]byte) (list, signature []byte, err error) {
-	// The container data should have exactly two keys: *.utf and *.sig.
+// containerData returns voter list, signature, and optional credentials list
+// and signature contents from container data.
+func containerData(data map[string][]byte) (list, signature, credentials, credSignature []byte,
+	err error) {
+
+	// The container data should have exactly two keys: *.utf and *.sig,
+	// and optionally two more keys: *.credentials and *.credentials.sig.
 	// Although the files are usually named more specifically
 	//
 	//   <election_identifier>-voters-<changeset>.{utf,sig},
@@ -188,9 +256,10 @@ func containerData(data map[string][]byte) (list, signature []byte, err error) {
 	// do not enforce this.
 	const utf = ".utf"
 	const sig = ".sig"
+	const cred = ".credentials"
 
-	if len(data) != 2 {
-		return nil, nil, KeyCountError{Count: len(data)}
+	if len(data) != 2 && len(data) != 4 {
+		return nil, nil, nil, nil, KeyCountError{Count: len(data)}
 	}
 	var utfKey, sigKey string
 	for key, content := range data {
@@ -202,14 +271,74 @@ func containerData(data map[string][]byte) (list, signature []byte, err error) {
 		}
 	}
 	if len(utfKey) == 0 {
-		return nil, nil, MissingUTFKeyError{}
+		return nil, nil, nil, nil, MissingUTFKeyError{}
 	}
 	signature, ok := data[sigKey]
 	if !ok {
-		return nil, nil, MissingSigKeyError{Expected: sigKey}
+		return nil, nil, nil, nil, MissingSigKeyError{Expected: sigKey}
+	}
+	if len(data) == 4 {
+		credKey := utfKey[:len(utfKey)-len(utf)] + cred
+		if credentials, ok = data[credKey]; !ok {
+			return nil, nil, nil, nil, MissingCredentialsKeyError{Expected: credKey}
+		}
+		if credSignature, ok = data[credKey+sig]; !ok {
+			return nil, nil, nil, nil, MissingCredentialsSigKeyError{Expected: credKey + sig}
+		}
+	}
+
+	return list, signature, credentials, credSignature, nil
+}
+
+// credentialEntry is an entry in the JSON-encoded credentials list.
+type credentialEntry struct {
+	ID string `json:"id"`
+	webauthn.Credential
+}
+
+// parseCredentials parses the credentials list and encodes the credentials
+// for storage. All credentials must belong to voters who are on the new voter
+// list version, i.e., either added in voters or existing in version and not
+// removed in voters.
+func parseCredentials(ctx context.Context, encoded []byte, voters map[string][]byte,
+	version string, s *storage.Client) (credentials map[string][]byte, err error) {
+
+	var entries []credentialEntry
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(&entries); err != nil {
+		return nil, DecodeCredentialsError{Err: err}
 	}
 
-	return list, signature, nil
+	credentials = make(map[string][]byte, len(entries))
+	for i, entry := range entries {
+		if _, err = base64.RawURLEncoding.DecodeString(entry.ID); err != nil ||
+			len(entry.ID) == 0 {
+
+			return nil, CredentialIDError{Index: i, ID: entry.ID, Err: err}
+		}
+		if _, ok := credentials[entry.ID]; ok {
+			return nil, DuplicateCredentialError{Index: i, ID: entry.ID}
+		}
+
+		encoded, err := entry.Marshal()
+		if err != nil {
+			return nil, MarshalCredentialError{Index: i, Err: err}
+		}
+		if _, err = webauthn.ParseCredential(encoded); err != nil {
+			return nil, InvalidCredentialError{Index: i, ID: entry.ID, Err: err}
+		}
+
+		if value, ok := voters[entry.Voter]; ok {
+			if value == nil {
+				return nil, CredentialVoterRemovedError{Index: i}
+			}
+		} else if _, _, err = s.GetVoter(ctx, version, entry.Voter); err != nil {
+			return nil, CredentialVoterError{Index: i, Err: err}
+		}
+		credentials[entry.ID] = encoded
+	}
+	return credentials, nil
 }
 
 // verifyECDSA parses an ECDSA public key from a PEM-encoded X.509 structure
@@ -245,24 +374,25 @@ const (
 )
 
 // linefunc is the type of functions used to process voter lines. Given a
-// voter, action, administrative unit code and district number, it reports any
-// problems or if there were none, adds an entry for voter into voters.
-// previousErrors indicates if there were previous lines with errors for this
-// voter. version is the currently applied voter list version.
-type linefunc func(ctx context.Context, voter, action, adminCode, district string,
-	voters map[string][]byte, previousErrors bool, version string, s *storage.Client) (
+// voter, action, administrative unit code, district number, and optional date
+// of birth, it reports any problems or if there were none, adds an entry for
+// voter into voters and their date of birth into dobs. previousErrors
+// indicates if there were previous lines with errors for this voter. version
+// is the currently applied voter list version.
+type linefunc func(ctx context.Context, voter, action, adminCode, district, dob string,
+	voters, dobs map[string][]byte, previousErrors bool, version string, s *storage.Client) (
 	errs []error)
 
 // preprocess parses the list and preprocesses the changes for storage.
 func preprocess(ctx context.Context, list []byte, version, election string, s *storage.Client) (
-	voters map[string][]byte, newver string, err error) {
+	voters, dobs map[string][]byte, newver string, err error) {
 
 	b := bytes.NewBuffer(list)
 
 	// Parse the header to determine list version and type.
 	newver, lf, err := header(b, election, version)
 	if err != nil {
-		return nil, "", err
+		return nil, nil, "", err
 	}
 
 	// Loop over all list entries, calling lf for each. Report progress of
@@ -275,6 +405,7 @@ func preprocess(ctx context.Context, list []byte, version, election string, s *s
 	defer progress.Keep()
 
 	voters = make(map[string][]byte)
+	dobs = make(map[string][]byte)
 	withErrors := make(map[string]struct{}) // Voters with previous errors.
 	var errcount int
 
@@ -284,13 +415,13 @@ loop:
 		// Check if preprocessing was cancelled.
 		select {
 		case <-ctx.Done():
-			return nil, "", PreprocessVoterListCanceled{Err: ctx.Err()}
+			return nil, nil, "", PreprocessVoterListCanceled{Err: ctx.Err()}
 		default:
 		}
 
 		// Read the next line.
 		line++
-		action, voter, adminCode, district, err := next(b)
+		action, voter, adminCode, district, dob, err := next(b)
 		switch {
 		case err == nil:
 		case err == io.EOF:
@@ -307,7 +438,8 @@ loop:
 
 		// Call lf for the line.
 		_, previous := withErrors[voter]
-		errs := lf(ctx, voter, action, adminCode, district, voters, previous, version, s)
+		errs := lf(ctx, voter, action, adminCode, district, dob,
+			voters, dobs, previous, version, s)
 		if len(errs) > 0 {
 			withErrors[voter] = struct{}{}
 		}
@@ -321,9 +453,9 @@ loop:
 		stepadd(ctx, addcount, 0, 0)
 	}
 	if errcount > 0 {
-		return nil, "", PreprocessVoterListError{ErrorCount: errcount}
+		return nil, nil, "", PreprocessVoterListError{ErrorCount: errcount}
 	}
-	return voters, newver, nil
+	return voters, dobs, newver, nil
 }
 
 func header(b *bytes.Buffer, election, oldver string) (newver string, lf linefunc, err error) {
@@ -395,8 +527,8 @@ func header(b *bytes.Buffer, election, oldver string) (newver string, lf linefun
 	return newver, lf, nil
 }
 
-func initial(_ context.Context, voter, action, adminCode, district string,
-	voters map[string][]byte, _ bool, _ string, _ *storage.Client) (
+func initial(_ context.Context, voter, action, adminCode, district, dob string,
+	voters, dobs map[string][]byte, _ bool, _ string, _ *storage.Client) (
 	errs []error) {
 
 	// Skip duplicate checking if there are relevant errors. We want to
@@ -418,6 +550,10 @@ func initial(_ context.Context, voter, action, adminCode, district string,
 	if len(district) == 0 {
 		errs = append(errs, InitialEmptyDistrictNumberError{})
 	}
+	encodedDOB, err := parseDOB(dob)
+	if err != nil {
+		errs = append(errs, InitialDOBError{Err: err})
+	}
 	if !skip {
 		if _, ok := voters[voter]; ok {
 			errs = append(errs, InitialAddDuplicateVoterError{Voter: voter})
@@ -426,12 +562,15 @@ func initial(_ context.Context, voter, action, adminCode, district string,
 		// adminCode or district errors) since then we will error
 		// anyway and the map values are not used during preprocessing.
 		voters[voter] = storage.EncodeAdminDistrict(adminCode, district)
+		if encodedDOB != nil {
+			dobs[voter] = encodedDOB
+		}
 	}
 	return
 }
 
-func changes(ctx context.Context, voter, action, adminCode, district string,
-	voters map[string][]byte, previousErrors bool, version string, s *storage.Client) (
+func changes(ctx context.Context, voter, action, adminCode, district, dob string,
+	voters, dobs map[string][]byte, previousErrors bool, version string, s *storage.Client) (
 	errs []error) {
 
 	if len(voter) == 0 {
@@ -474,11 +613,19 @@ func changes(ctx context.Context, voter, action, adminCode, district string,
 			errs = append(errs, ChangesEmptyDistrictNumberError{})
 			previousErrors = true
 		}
+		encodedDOB, err := parseDOB(dob)
+		if err != nil {
+			errs = append(errs, ChangesDOBError{Err: err})
+			previousErrors = true
+		}
 		if !previousErrors {
 			if voterExists {
 				errs = append(errs, ChangesAddDuplicateVoterError{Voter: voter})
 			}
 			voters[voter] = storage.EncodeAdminDistrict(adminCode, district)
+			if encodedDOB != nil {
+				dobs[voter] = encodedDOB
+			}
 		}
 
 	case "kustutamine":
@@ -490,6 +637,7 @@ func changes(ctx context.Context, voter, action, adminCode, district string,
 				errs = append(errs, ChangesRemoveAddedVoterError{Voter: voter})
 			}
 			voters[voter] = nil // nil to distinguish from unchanged voters.
+			delete(dobs, voter)
 		}
 
 	default:
@@ -507,8 +655,24 @@ func stepadd(ctx context.Context, add status.Add, count, step uint64) {
 	}
 }
 
+// parseDOB checks that dob is a date of birth in the format YYYY-MM-DD and
+// returns it encoded for storage. Returns nil if dob is empty.
+func parseDOB(dob string) (encoded []byte, err error) {
+	if len(dob) == 0 {
+		return nil, nil
+	}
+	parsed, err := time.Parse("2006-01-02", dob)
+	if err != nil {
+		return nil, ParseDOBError{Err: err}
+	}
+	if parsed.After(time.Now()) {
+		return nil, FutureDOBError{DOB: dob}
+	}
+	return storage.EncodeVoterDOB(parsed), nil
+}
+
 // next reads and parses the next voter line from b.
-func next(b *bytes.Buffer) (action, voter, adminCode, district string, err error) {
+func next(b *bytes.Buffer) (action, voter, adminCode, district, dob string, err error) {
 	line, err := readString(b, delim)
 	if err != nil {
 		if err != io.EOF || len(line) > 0 {
@@ -517,13 +681,15 @@ func next(b *bytes.Buffer) (action, voter, adminCode, district string, err error
 		return
 	}
 
-	// Split on tabs and expect five fields or two fields when 'kustutamine':
+	// Split on tabs and expect five or six fields or two fields when
+	// 'kustutamine':
 	//
 	//	0. action,
 	//	1. voter ID,
 	//	2. voter name (ignored),
-	//	3. administrative unit code, and
-	//	4. district number.
+	//	3. administrative unit code,
+	//	4. district number, and
+	//	5. optional date of birth.
 	//
 	//	0. action,
 	//	1. voter ID,
@@ -533,9 +699,11 @@ func next(b *bytes.Buffer) (action, voter, adminCode, district string, err error
 	fields := strings.Split(line, string(sep))
 	switch len(fields) {
 	case 2:
-		return fields[0], fields[1], "", "", nil
+		return fields[0], fields[1], "", "", "", nil
 	case 5:
-		return fields[0], fields[1], fields[3], fields[4], nil
+		return fields[0], fields[1], fields[3], fields[4], "", nil
+	case 6:
+		return fields[0], fields[1], fields[3], fields[4], fields[5], nil
 	default:
 		err = FieldCountError{Fields: len(fields)}
 		return
@@ -1,6 +1,16 @@
 package main
 
-import "testing"
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"ivxv.ee/common/collector/errors"
+)
 
 func TestZIPVersion(t *testing.T) {
 	const comment = `Version: start of text
@@ -25,3 +35,62 @@ Version: end of text`
 		t.Errorf("unexpected ZIP version: got %s, want %s", version, expected)
 	}
 }
+
+func TestContainerData(t *testing.T) {
+	data := map[string][]byte{
+		"voters.utf":             []byte("list"),
+		"voters.sig":             []byte("list signature"),
+		"voters.credentials":     []byte("credentials"),
+		"voters.credentials.sig": []byte("credentials signature"),
+	}
+	list, sig, creds, credsSig, err := containerData(data)
+	if err != nil {
+		t.Fatal("failed to get container data:", err)
+	}
+	if string(list) != "list" || string(sig) != "list signature" ||
+		string(creds) != "credentials" || string(credsSig) != "credentials signature" {
+
+		t.Errorf("unexpected container data: %q, %q, %q, %q", list, sig, creds, credsSig)
+	}
+
+	// Credentials without a signature are rejected.
+	delete(data, "voters.credentials.sig")
+	data["voters.other"] = nil
+	if _, _, _, _, err = containerData(data); errors.CausedBy(err, new(MissingCredentialsSigKeyError)) == nil {
+		t.Errorf("unexpected error: %v, want MissingCredentialsSigKeyError", err)
+	}
+	delete(data, "voters.other")
+	if _, _, _, _, err = containerData(data); errors.CausedBy(err, new(KeyCountError)) == nil {
+		t.Errorf("unexpected error: %v, want KeyCountError", err)
+	}
+}
+
+func TestVerifyCredentialsSignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal("failed to marshal public key:", err)
+	}
+	pub := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	list, creds := []byte("list"), []byte("credentials")
+	sign := func(data []byte) []byte {
+		hashed := sha256.Sum256(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, key, hashed[:])
+		if err != nil {
+			t.Fatal("failed to sign:", err)
+		}
+		return sig
+	}
+	if err = verifyECDSA(pub, creds, sign(creds)); err != nil {
+		t.Error("failed to verify credentials signature:", err)
+	}
+
+	// The voter list signature does not cover the credentials.
+	if err = verifyECDSA(pub, creds, sign(list)); errors.CausedBy(err, new(ECDSASignatureVerificationError)) == nil {
+		t.Errorf("unexpected error: %v, want ECDSASignatureVerificationError", err)
+	}
+}
@@ -21,13 +21,18 @@ const (
 	// This should be a StatusReadResp.Caller value for Web eID
 	Token = "RPC.Token"
 
-	// This should be a StatusUpdateReq.Caller value for ID card/Mobile-ID/Smart-ID/Web eID
+	// This should be a StatusUpdateReq.Caller value for WebAuthn and a
+	// StatusReadResp.Caller value when calling RPC.VoterChoices
+	WebAuthnChallenge = "RPC.WebAuthnChallenge"
+
+	// This should be a StatusUpdateReq.Caller value for ID card/Mobile-ID/Smart-ID/Web eID/WebAuthn
 	VoterChoices = "RPC.VoterChoices"
 )
 
 const exitCodeOK = 0
 
 type RPC struct {
+	authTTL   int64
 	choiceTTL int64
 	client    client.TLSDialer
 }
@@ -40,10 +45,11 @@ func NewClient(c *command.C) (client.Verifier, int) {
 		return nil, errCode
 	}
 
-	return &RPC{
+	return status.Traced(&RPC{
 		client:    tlsDialer,
+		authTTL:   c.Conf.Technical.Status.Session.AuthTTL,
 		choiceTTL: c.Conf.Technical.Status.Session.ChoiceTTL,
-	}, exitCodeOK
+	}), exitCodeOK
 }
 
 func (r *RPC) Verify(dto interface{}) (bool, error) {
@@ -75,13 +81,17 @@ func (r *RPC) Verify(dto interface{}) (bool, error) {
 //
 // Note, that here serviceMethod is the RPC method that calls this function.
 func (r *RPC) verifyAndUpdateSessionStatus(serviceMethod string, h server.Header) (bool, error) {
-	// Extract authentication method from a header.Ctx
-	authFilter, err := server.AuthMethod(h.Ctx)
-	if err != nil {
-		return false, AuthMethodFromCtxError{Err: err}
-	}
-	if authFilter == "" {
-		return false, AuthMethodIsEmptyError{AuthFilter: authFilter}
+	// Extract authentication method from a header.Ctx, except for
+	// RPC.WebAuthnChallenge, which is called before the voter authenticates
+	var authFilter string
+	if serviceMethod != WebAuthnChallenge {
+		var err error
+		if authFilter, err = server.AuthMethod(h.Ctx); err != nil {
+			return false, AuthMethodFromCtxError{Err: err}
+		}
+		if authFilter == "" {
+			return false, AuthMethodIsEmptyError{AuthFilter: authFilter}
+		}
 	}
 
 	// Create new session read status request
@@ -111,12 +121,18 @@ func (r *RPC) verifyAndUpdateSessionStatus(serviceMethod string, h server.Header
 		WithResponse(respReadRPC.Response).
 		Build()
 
+	handler := voterChoicesHandler
 	ttl := strconv.FormatInt(r.choiceTTL, 10)
+	if serviceMethod == WebAuthnChallenge {
+		handler = webAuthnChallengeHandler
+		ttl = strconv.FormatInt(r.authTTL, 10)
+	}
+
 	// Reset the LeaseID
 	respRead.Lease = ""
 
 	// NB! Most important part, that prevents any attack on SessionID
-	ok, err := verifyStatusReadResp(&respRead, voterChoicesHandler)
+	ok, err := verifyStatusReadResp(&respRead, handler)
 	if err != nil || !ok {
 		return false, VerifyStatusReadRespError{Err: err}
 	}
@@ -194,6 +210,25 @@ func verifyStatusReadResp(r *api.StatusReadResp,
 	return h(r)
 }
 
+// webAuthnChallengeHandler performs filter operation on StatusReadResp r to
+// detect invalid SessionID in a client RPC.WebAuthnChallenge request.
+func webAuthnChallengeHandler(r *api.StatusReadResp) (bool, error) {
+	// RPC.WebAuthnChallenge is the very first client request to IVXV,
+	// so IVXV requires no previous interactions
+	firstTime := r.Caller == Empty && r.Auth == client.NoAuth
+
+	if !(firstTime) {
+		return false, WebAuthnChallengeInvalidCallerOrAuthForSessionID{
+			Method: WebAuthnChallenge,
+			Caller: r.Caller,
+			Auth:   r.Auth,
+		}
+	}
+
+	r.Auth = client.WebAuthnAuth
+	return true, nil
+}
+
 // voterChoicesHandler performs filter operation on StatusReadResp r to
 // detect invalid SessionID in a client RPC.VoterChoices request.
 func voterChoicesHandler(r *api.StatusReadResp) (bool, error) {
@@ -212,8 +247,12 @@ func voterChoicesHandler(r *api.StatusReadResp) (bool, error) {
 	// has previously interacted with IVXV using RPC.Token method
 	widAuth := r.Caller == Token && r.Auth == client.WebeIDAuth
 
+	// When authenticating with WebAuthn, then IVXV requires that client
+	// has previously interacted with IVXV using RPC.WebAuthnChallenge method
+	waAuth := r.Caller == WebAuthnChallenge && r.Auth == client.WebAuthnAuth
+
 	// All conditions must satisfy simultaneously!
-	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) {
+	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) && !(waAuth) {
 		return false, VoterChoicesInvalidCallerOrAuthForSessionID{
 			Method: VoterChoices,
 			Caller: r.Caller,
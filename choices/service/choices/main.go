@@ -9,6 +9,8 @@ import (
 	"time"
 
 	internal "ivxv.ee/choices/internal/client/sessionstatus/rpc"
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/auth/webauthn"
 	"ivxv.ee/common/collector/command"
 	"ivxv.ee/common/collector/command/exit"
 	"ivxv.ee/common/collector/conf"
@@ -29,6 +31,14 @@ type RPC struct {
 	storage     *storage.Client
 	forceList   string // If set, VoterChoices always returns this list.
 	foreignCode string // Administrative unit code for foreign voters.
+
+	// questions are the identifiers of the questions of a multi-question
+	// election. Empty for single-question elections.
+	questions []string
+
+	// challenger issues WebAuthn challenges. Nil if WebAuthn
+	// authentication is not configured.
+	challenger *webauthn.Challenger
 }
 
 // ChoicesArgs are the arguments provided to a call of RPC.Choices.
@@ -50,6 +60,31 @@ type Response struct {
 	Choices string // Identifier of the requested choices.
 	List    []byte // The requested choices.
 	Voted   bool   `json:",omitempty"` // Has the voter voted already?
+
+	// Questions are the choices of each question in multi-question
+	// elections, in the order of configured questions. List is empty if
+	// Questions is used.
+	Questions []QuestionList `json:",omitempty"`
+}
+
+// ChallengeArgs are the arguments provided to a call of
+// RPC.WebAuthnChallenge. There are none, because the challenge is bound to the
+// session.
+type ChallengeArgs struct {
+	server.Header
+}
+
+// ChallengeResponse is the response returned by RPC.WebAuthnChallenge.
+type ChallengeResponse struct {
+	server.Header
+	Challenge []byte // The challenge to use in the WebAuthn assertion.
+}
+
+// QuestionList is the choices list of a single question.
+type QuestionList struct {
+	Question string // Identifier of the question.
+	Choices  string // Identifier of the choices.
+	List     []byte // The choices.
 }
 
 // Deprecated: Choices RPC endpoint is not used by IVXV backend anymore.
@@ -73,6 +108,43 @@ func (r *RPC) Choices(args ChoicesArgs, resp *Response) (err error) {
 	return
 }
 
+// WebAuthnChallenge is the remote procedure call performed by voting clients
+// to start a session which is authenticated using WebAuthn. The returned
+// challenge must be used in the assertion passed as the authentication token
+// in all following calls of the session.
+func (r *RPC) WebAuthnChallenge(args ChallengeArgs, resp *ChallengeResponse) (err error) {
+	log.Log(args.Ctx, WebAuthnChallengeReq{})
+
+	if r.challenger == nil {
+		log.Error(args.Ctx, WebAuthnNotConfiguredError{})
+		return server.ErrBadRequest
+	}
+
+	// Build up VerifyReq for session status service
+	verifyReq := status.NewVerifyReqBuilder().
+		WithServiceMethod(internal.WebAuthnChallenge).
+		WithRequest(args.Header).
+		Build()
+
+	// SessionID security check
+	ok, err := r.status.Verify(&verifyReq)
+	if err != nil {
+		log.Error(args.Ctx, WebAuthnChallengeVerifySessionIDError{Err: err})
+		return server.ErrBadRequest
+	}
+	if !ok {
+		log.Error(args.Ctx, WebAuthnChallengeUpdateSessionIDError{})
+		return server.ErrBadRequest
+	}
+
+	if resp.Challenge, err = r.challenger.Create(args.SessionID); err != nil {
+		log.Error(args.Ctx, CreateWebAuthnChallengeError{Err: err})
+		return server.ErrInternal
+	}
+	log.Log(args.Ctx, WebAuthnChallengeResp{Challenge: resp.Challenge})
+	return
+}
+
 // VoterChoices is the remote procedure call performed by voting clients to
 // retrieve the choices list for a voter.
 func (r *RPC) VoterChoices(args VoterArgs, resp *Response) (err error) {
@@ -118,7 +190,24 @@ func (r *RPC) VoterChoices(args VoterArgs, resp *Response) (err error) {
 	}
 	log.Log(args.Ctx, VoterChoices{Choices: resp.Choices})
 
-	if resp.List, err = r.storage.GetChoices(args.Ctx, resp.Choices); err != nil {
+	if len(r.questions) > 0 {
+		resp.Questions = make([]QuestionList, len(r.questions))
+		for i, question := range r.questions {
+			list, err := r.storage.GetQuestionChoices(args.Ctx, question, resp.Choices)
+			if err != nil {
+				log.Error(args.Ctx, GetVoterQuestionChoicesError{
+					Question: question,
+					Err:      log.Alert(err),
+				})
+				return server.ErrInternal
+			}
+			resp.Questions[i] = QuestionList{
+				Question: question,
+				Choices:  resp.Choices,
+				List:     list,
+			}
+		}
+	} else if resp.List, err = r.storage.GetChoices(args.Ctx, resp.Choices); err != nil {
 		log.Error(args.Ctx, GetVoterChoicesError{Err: log.Alert(err)})
 		return server.ErrInternal
 	}
@@ -130,6 +219,12 @@ func (r *RPC) VoterChoices(args VoterArgs, resp *Response) (err error) {
 
 	// The choices are not actually sensitive, but just really large.
 	log.Log(args.Ctx, VoterChoicesResp{List: log.Sensitive(resp.List)})
+	for _, q := range resp.Questions {
+		log.Log(args.Ctx, VoterQuestionChoicesResp{
+			Question: q.Question,
+			List:     log.Sensitive(q.List),
+		})
+	}
 	return
 }
 
@@ -172,14 +267,25 @@ func choicesmain() (code int) {
 
 		// Parse client-authentication configuration.
 		if authConf, err = server.NewAuthConf(
-			elec.Auth, elec.Identity, &elec.Age); err != nil {
+			elec.Auth, elec.Identity, &elec.Age, c.Storage); err != nil {
 
 			return c.Error(exit.Config, ServerAuthConfError{Err: err},
 				"failed to configure client authentication:", err)
 		}
 
+		// Issue WebAuthn challenges if voters can authenticate with it.
+		if _, ok := elec.Auth[auth.WebAuthn]; ok {
+			if rpc.challenger, err = webauthn.NewChallengerFromSystem(); err != nil {
+				return c.Error(exit.Config, WebAuthnChallengerError{Err: err},
+					"failed to configure WebAuthn challenges:", err)
+			}
+		}
+
 		rpc.forceList = strings.TrimSpace(elec.IgnoreVoterList)
 		rpc.foreignCode = strings.TrimSpace(elec.VoterForeignEHAKDefault())
+		if len(elec.Questions) > 1 {
+			rpc.questions = elec.Questions
+		}
 	}
 
 	var s *server.S
@@ -188,12 +294,14 @@ func choicesmain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)
@@ -14,16 +14,24 @@ class ChoicesListSchema(Model):
     """Validating schema for choices list."""
     election = ElectionIdType(required=True)
     choices = DictType(DictType(DictType(StringType)))
+    questions = DictType(DictType(DictType(DictType(StringType))))
 
     def validate(self, partial=False, convert=True, app_data=None, **kwargs):
         """Validate model."""
         super().validate(partial, convert, app_data, **kwargs)
 
-        choices = []
-        for district_choices in self.choices.values():
-            for choice in district_choices.values():
-                for choice_id in choice.keys():
-                    if choice_id in choices:
-                        raise DataError(
-                            {'choices': f'Duplicate choice ID: {choice_id}'})
-                    choices.append(choice_id)
+        check_duplicate_choices('choices', self.choices or {})
+        for question, districts in (self.questions or {}).items():
+            check_duplicate_choices(f'questions.{question}', districts)
+
+
+def check_duplicate_choices(field, districts):
+    """Check that choice IDs are unique across districts."""
+    choices = []
+    for district_choices in districts.values():
+        for choice in district_choices.values():
+            for choice_id in choice.keys():
+                if choice_id in choices:
+                    raise DataError(
+                        {field: f'Duplicate choice ID: {choice_id}'})
+                choices.append(choice_id)
@@ -19,7 +19,31 @@ from schematics.types import (
 )
 
 from .fields import CertificateType, ElectionIdType, PublicKeyType
-from .schemas import ContainerSchema, OCSPSchema, TSPSchema, protocol_cfg
+from .schemas import (
+    CertificateConstraintsSchema,
+    ContainerSchema,
+    OCSPSchema,
+    TSPSchema,
+    protocol_cfg,
+)
+
+
+class RateLimitWindowSchema(Model):
+    """Validating schema for sliding window rate limit config."""
+    count = IntType(default=0, min_value=0)
+    minutes = IntType(default=0, min_value=0)
+
+    def validate_minutes(self, data, value):
+        """Validate window length."""
+        if data.get('count') and not value:
+            raise ValidationError('count set, but window is empty')
+        return value
+
+
+class RateLimitBucketSchema(Model):
+    """Validating schema for token bucket rate limit config."""
+    rate = IntType(default=0, min_value=0)
+    burst = IntType(default=0, min_value=0)
 
 
 class ElectionConfigSchema(Model):
@@ -32,6 +56,23 @@ class ElectionConfigSchema(Model):
         count = IntType(required=True, min_value=0)
         minutes = IntType(required=True, min_value=0)
         latestonly = BooleanType(default=False)
+        ticket = BooleanType(default=False)
+
+        class ProbingSchema(Model):
+            """Validating schema for vote ID probing detection config."""
+            failures = IntType(default=0, min_value=0)
+            minutes = IntType(default=0, min_value=0)
+            blockminutes = IntType(default=0, min_value=0)
+
+            def validate_blockminutes(self, data, value):
+                """Validate window and block duration."""
+                if data.get('failures') and not (data.get('minutes')
+                                                 and value):
+                    raise ValidationError(
+                        'failures set, but minutes or blockminutes is 0')
+                return value
+
+        probing = ModelType(ProbingSchema)
 
     verification = ModelType(ElectionVerificationSchema, required=True)
 
@@ -39,6 +80,15 @@ class ElectionConfigSchema(Model):
         """Validating schema for election voting config."""
         ratelimitstart = IntType(default=0, min_value=0)
         ratelimitminutes = IntType(default=0, min_value=0)
+        concurrentqualification = BooleanType(default=False)
+
+        class RateLimitSchema(Model):
+            """Validating schema for rate limiting policies config."""
+            voter = ModelType(RateLimitWindowSchema)
+            address = ModelType(RateLimitWindowSchema)
+            instance = ModelType(RateLimitBucketSchema)
+
+        ratelimit = ModelType(RateLimitSchema)
 
         def validate_ratelimitminutes(self, data, value):
             """Validate rate limit."""
@@ -71,6 +121,12 @@ class ElectionConfigSchema(Model):
 
     voterlist = ModelType(VoterListSchema, required=True)
 
+    class CancellationSchema(Model):
+        """Validating schema for vote cancellation config."""
+        operators = ListType(CertificateType, min_size=1, required=True)
+
+    cancellation = ModelType(CancellationSchema)
+
     class VisSchema(Model):
         """Validating schema for VIS service config."""
 
@@ -100,17 +156,28 @@ class ElectionConfigSchema(Model):
             roots = ListType(CertificateType, required=True)
             intermediates = ListType(CertificateType)
             ocsp = ModelType(OCSPSchema)
+            constraints = ModelType(CertificateConstraintsSchema)
 
         tls = ModelType(TLSAuthSchema)
 
+        class WebAuthnAuthSchema(Model):
+            """Validating schema for WebAuthn authentication config."""
+            rpid = StringType(required=True)
+            origins = ListType(URLType, required=True, min_size=1)
+            challengeage = IntType(required=True, min_value=1)
+            userverification = BooleanType()
+
+        webauthn = ModelType(WebAuthnAuthSchema)
+
     auth = ModelType(AuthSchema, required=True)
 
     identity = StringType(
-        required=True, choices=['commonname', 'serialnumber', 'pnoee'])
+        required=True,
+        regex=r'^(commonname|serialnumber|pnoee|etsi|(pno|idc|pas)[a-z]{2})$')
 
     class AgeSchema(Model):
         """Validating schema for voters age check config."""
-        method = StringType(required=True, choices=['estpic'])
+        method = StringType(required=True, choices=['estpic', 'certdob', 'voterlist'])
         timezone = StringType(required=True)
         limit = IntType(required=True, min_value=16)
 
@@ -171,6 +238,10 @@ class ElectionConfigSchema(Model):
             "ocsptm": OCSPSchema,
             "tsp": TSPSchema,
             "tspreg": TSPSchema,
+        }, fields={
+            "timeout": IntType(min_value=0),
+            "after": ListType(StringType(
+                choices=["ocsp", "ocsptm", "tsp", "tspreg"])),
         }))
 
     class StatsSchema(Model):
@@ -15,7 +15,7 @@ from .fields import CertificateType
 # fields can  be missing from the conf, type constrainments are ignored,
 # without raising any errors (e.g missing storage.conf.ca,
 # invalid URL in qualification.*.url)
-def protocol_cfg(mapping, **kwargs):
+def protocol_cfg(mapping, fields=None, **kwargs):
     """
     Return an alternative protocol configuration type.
 
@@ -30,6 +30,8 @@ def protocol_cfg(mapping, **kwargs):
     which cannot be done with this construction. So create a new wrapper model
     for each protocol configuration model which also includes the "protocol"
     field and let PolyModelType choose from those.
+
+    fields can contain additional fields to include in each wrapper model.
     """
 
     models = []
@@ -38,7 +40,8 @@ def protocol_cfg(mapping, **kwargs):
             f"{model.__name__}Wrapper", (Model, ), {
                 "protocol": StringType(required=True, choices=[protocol]),
                 "conf": ModelType(model, required=True),
-                "ordertimeout": IntType(required=False, min_value=1)
+                "ordertimeout": IntType(required=False, min_value=1),
+                **(fields or {}),
             })
         mapping[protocol] = wrapper
         models.append(wrapper)
@@ -54,14 +57,29 @@ class DummySchema(Model):
     trusted = ListType(StringType)
 
 
+class BreakerSchema(Model):
+    """Validating schema for circuit breaker config."""
+    failurethreshold = IntType(default=0, min_value=0)
+    cooldown = IntType(default=30, min_value=0)  # 30 seconds
+
+
+class OCSPEndpointSchema(Model):
+    """Validating schema for additional OCSP server config."""
+    url = URLType(required=True)
+    responders = ListType(CertificateType)
+
+
 class OCSPSchema(Model):
     """Validating schema for OCSP config."""
     url = URLType(required=True)
     responders = ListType(CertificateType)
+    endpoints = ListType(ModelType(OCSPEndpointSchema))
+    breaker = ModelType(BreakerSchema)
     retry = IntType(default=0, min_value=0)
     maxSkew = IntType(default=300, min_value=0)  # 300 milliseconds
     maxAge = IntType(default=1, min_value=0)  # 1 minute
     maxAge = IntType(default=1, min_value=0)  # 1 minute
+    cachesize = IntType(default=0, min_value=0)
 
 
 class OCSPSchemaNoURL(Model):
@@ -71,10 +89,18 @@ class OCSPSchemaNoURL(Model):
     maxAge = IntType(default=1, min_value=0)  # 1 minute
 
 
+class TSPEndpointSchema(Model):
+    """Validating schema for additional timestamp protocol server config."""
+    url = URLType(required=True)
+    signers = ListType(CertificateType, required=True)
+
+
 class TSPSchema(Model):
     """Validating schema for timestamp protocol config."""
     url = URLType(required=True)
     signers = ListType(CertificateType, required=True)
+    endpoints = ListType(ModelType(TSPEndpointSchema))
+    breaker = ModelType(BreakerSchema)
     delaytime = IntType(required=True, min_value=0)
     retry = IntType(default=0, min_value=0)
     maxSkew = IntType(default=2, min_value=0)  # 2 seconds
@@ -89,6 +115,19 @@ class TSPSchemaNoURL(Model):
     maxAge = IntType(default=1, min_value=0)  # 1 minute
 
 
+class KeyAlgorithmSchema(Model):
+    """Validating schema for allowed certificate key algorithm config."""
+    algorithm = StringType(required=True, choices=['rsa', 'ecdsa', 'ed25519'])
+    minsize = IntType(default=0, min_value=0)
+
+
+class CertificateConstraintsSchema(Model):
+    """Validating schema for certificate constraints config."""
+    policies = ListType(StringType(regex=r'^[0-9]+(\.[0-9]+)+$'))
+    extkeyusages = ListType(StringType(regex=r'^[0-9]+(\.[0-9]+)+$'))
+    keyalgorithms = ListType(ModelType(KeyAlgorithmSchema))
+
+
 class BDocSchema(Model):
     """Validating schema for BDoc config."""
     bdocsize = IntType(required=True, min_value=1)
@@ -99,6 +138,7 @@ class BDocSchema(Model):
     ocsp = ModelType(OCSPSchemaNoURL)
     tsp = ModelType(TSPSchemaNoURL)
     tsdelaytime = IntType(default=0, min_value=0)
+    constraints = ModelType(CertificateConstraintsSchema)
 
     def validate_tsp(self, data, value):
         """Check that tsp exists if profile is TS."""
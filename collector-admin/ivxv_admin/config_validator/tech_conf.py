@@ -7,11 +7,11 @@ import re
 
 from schematics.exceptions import ValidationError
 from schematics.models import Model
-from schematics.types import (BooleanType, IntType, ListType, ModelType,
-                              StringType)
+from schematics.types import (BaseType, BooleanType, IntType, ListType,
+                              ModelType, StringType)
 
 from .fields import CertificateType
-from .schemas import protocol_cfg
+from .schemas import CertificateConstraintsSchema, OCSPSchema, protocol_cfg
 
 
 class ServicesSchema(Model):
@@ -28,6 +28,8 @@ class ServicesSchema(Model):
         address = StringType(regex=r'.+:[0-9]+', required=True)
         peeraddress = StringType(regex=r'.+:[0-9]+')
         origin = StringType(regex=r'.+:[0-9]+')
+        metricsaddress = StringType(regex=r'.+:[0-9]+')
+        tracefile = StringType(regex=r'/.+')
 
     proxy = ListType(ModelType(ServiceSchema))
     mid = ListType(ModelType(ServiceSchema))
@@ -101,11 +103,39 @@ class CollectorTechnicalConfigSchema(Model):
         """Validating schema for status servers config."""
         class SessionServiceSchema(Model):
             name = StringType(required=True)
+            embedded = BooleanType(default=False)
             servername = StringType(required=True)
             authttl = IntType(required=True)
             choicettl = IntType(required=True)
             votettl = IntType(required=True)
             verifyttl = IntType(required=True)
+            maxconns = IntType(min_value=0)
+            keepalive = IntType(min_value=0)
+            idletimeout = IntType(min_value=0)
+            healthcheck = IntType(min_value=0)
+            calltimeout = IntType(min_value=0)
+            historyttl = IntType(min_value=0)
+
+            class AdminSchema(Model):
+                """Validating schema for operator access config."""
+                class AuthSchema(Model):
+                    """Validating schema for operator authentication config."""
+                    class TLSAuthSchema(Model):
+                        """Validating schema for TLS authentication config."""
+                        roots = ListType(CertificateType, required=True)
+                        intermediates = ListType(CertificateType)
+                        ocsp = ModelType(OCSPSchema)
+                        constraints = ModelType(CertificateConstraintsSchema)
+
+                    tls = ModelType(TLSAuthSchema, required=True)
+
+                auth = ModelType(AuthSchema, required=True)
+                identity = StringType(
+                    required=True,
+                    regex=r'^(commonname|serialnumber|pnoee|etsi)$')
+                operators = ListType(StringType, required=True, min_size=1)
+
+            admin = ModelType(AdminSchema)
         session = ModelType(SessionServiceSchema)
 
     status = ModelType(StatusServerSchema, required=True)
@@ -125,10 +155,24 @@ class CollectorTechnicalConfigSchema(Model):
         snapshotcount = IntType(required=False)
         heartbeattimeout = IntType(required=False)
         electiontimeout = IntType(required=False)
+    class BoltStorageServiceSchema(Model):
+        """Validating schema for bolt storage service config."""
+        path = StringType(required=True)
+        optimeout = IntType(min_value=0)
+
+    class JournalStorageServiceSchema(Model):
+        """Validating schema for journal storage service config."""
+        dir = StringType(required=True)
+        protocol = StringType(required=True, choices=["file", "etcd", "bolt"])
+        # Configuration of the wrapped protocol, checked by the collector.
+        conf = BaseType(required=True)
+
     storage = protocol_cfg(
         {
             "file": FileStorageServiceSchema,
             "etcd": EtcdStorageServiceSchema,
+            "bolt": BoltStorageServiceSchema,
+            "journal": JournalStorageServiceSchema,
         },
         required=True)
 
@@ -1,6 +1,7 @@
 # IVXV Internet voting framework
 """Voters list validator."""
 
+import datetime
 import re
 
 import dateutil.parser
@@ -93,8 +94,8 @@ def parse_voters_list(list_content):
 def validate_voter_record(fields, is_original_list):
     """Validate voter record in voters list."""
     # field count
-    if len(fields) == 5:
-        action, voter_personalcode, voter_name, adminunit_code, no_district = fields
+    if len(fields) in (5, 6):
+        action, voter_personalcode, voter_name, adminunit_code, no_district = fields[:5]
         if not voter_name:
             raise ValueError("voter-name is empty")
         if action != "lisamine":
@@ -115,6 +116,9 @@ def validate_voter_record(fields, is_original_list):
         # no-district = 1*10DIGIT
         if not re.match(r"[0-9]{1,10}$", no_district):
             raise ValueError(f"Invalid no-district {no_district!r}")
+        # date-of-birth = 4DIGIT "-" 2DIGIT "-" 2DIGIT, optional
+        if len(fields) == 6 and fields[5]:
+            validate_date_of_birth(fields[5])
 
     elif len(fields) == 2:
         action, voter_personalcode = fields
@@ -129,4 +133,17 @@ def validate_voter_record(fields, is_original_list):
             raise ValueError(f"Action {action!r} is not allowed in initial list")
 
     else:
-        raise ValueError(f"Invalid field count {len(fields)}, expected 2 or 5 fields")
+        raise ValueError(
+            f"Invalid field count {len(fields)}, expected 2, 5 or 6 fields")
+
+
+def validate_date_of_birth(date_of_birth):
+    """Validate voter date of birth in voters list."""
+    if not re.match(r"[0-9]{4}-[0-9]{2}-[0-9]{2}$", date_of_birth):
+        raise ValueError(f"Invalid date-of-birth {date_of_birth!r}")
+    try:
+        parsed = datetime.date.fromisoformat(date_of_birth)
+    except ValueError:
+        raise ValueError(f"Invalid date-of-birth {date_of_birth!r}")
+    if parsed > datetime.date.today():
+        raise ValueError(f"date-of-birth {date_of_birth!r} is in the future")
@@ -12,6 +12,9 @@ also acts as a registry for methods to get a voter's date of birth.
 package age
 
 import (
+	"context"
+	"crypto/x509"
+	"encoding/asn1"
 	"regexp"
 	"strconv"
 	"sync"
@@ -23,18 +26,35 @@ type Method string
 
 // Enumeration of date of birth methods.
 const (
-	EstPIC Method = "estpic" // Estonian personal identification code. Built-in.
+	EstPIC    Method = "estpic"    // Estonian personal identification code. Built-in.
+	CertDOB   Method = "certdob"   // Date of birth in the client certificate. Built-in.
+	VoterList Method = "voterlist" // Date of birth from the voter list. Requires a Store.
 )
 
 // Getter is the type of functions that get a voter's date of birth given their
 // identity. Only the year, month, and day of the returned time will be used.
 type Getter func(voter string) (dob time.Time, err error)
 
+// CertificateGetter is the type of functions that get a voter's date of birth
+// given their authentication certificate. Only the year, month, and day of the
+// returned time will be used.
+type CertificateGetter func(cert *x509.Certificate) (dob time.Time, err error)
+
+// Store is the interface for looking up voters' dates of birth imported with
+// the voter list, e.g., the storage client. It is used by the VoterList
+// method.
+type Store interface {
+	GetVoterDOB(ctx context.Context, voter string) (dob time.Time, err error)
+}
+
 var (
 	reglock  sync.RWMutex
 	registry = map[Method]Getter{
 		EstPIC: estpic,
 	}
+	certRegistry = map[Method]CertificateGetter{
+		CertDOB: certdob,
+	}
 )
 
 // Register registers a date of birth method. It is intended to be called from
@@ -45,6 +65,15 @@ func Register(m Method, g Getter) {
 	registry[m] = g
 }
 
+// RegisterCertificate registers a date of birth method which uses the voter's
+// authentication certificate. It is intended to be called from init functions
+// of packages that implement date of birth methods.
+func RegisterCertificate(m Method, g CertificateGetter) {
+	reglock.Lock()
+	defer reglock.Unlock()
+	certRegistry[m] = g
+}
+
 // Conf is the age checker configuration.
 type Conf struct {
 	Method   Method // The method used to get a voters date of birth.
@@ -55,35 +84,64 @@ type Conf struct {
 // Checker gets the voter's age using a configured method and checks it againt
 // the limit.
 type Checker struct {
-	get   Getter
-	loc   *time.Location
-	limit int
-	now   func() time.Time // Returns the current time, can be replaced for testing.
+	get     Getter
+	getCert CertificateGetter // If set, then used instead of get.
+	store   Store             // If set, then used instead of get and getCert.
+	loc     *time.Location
+	limit   int
+	now     func() time.Time // Returns the current time, can be replaced for testing.
 }
 
 // New initializes a new voter age checker with the provided configuration.
-func New(c *Conf) (checker *Checker, err error) {
-	reglock.RLock()
-	defer reglock.RUnlock()
-	g, ok := registry[c.Method]
-	if !ok {
-		return nil, UnlinkedMethodError{Method: c.Method}
-	}
+// store is used by the VoterList method and can be nil for other methods.
+func New(c *Conf, store Store) (checker *Checker, err error) {
 	loc, err := time.LoadLocation(c.TimeZone)
 	if err != nil {
 		return nil, LocationError{Err: err}
 	}
-	return &Checker{g, loc, int(c.Limit), time.Now}, nil
+	checker = &Checker{loc: loc, limit: int(c.Limit), now: time.Now}
+
+	if c.Method == VoterList {
+		if store == nil {
+			return nil, VoterListWithoutStoreError{}
+		}
+		checker.store = store
+		return checker, nil
+	}
+
+	reglock.RLock()
+	defer reglock.RUnlock()
+	var ok, certOK bool
+	checker.get, ok = registry[c.Method]
+	checker.getCert, certOK = certRegistry[c.Method]
+	if !ok && !certOK {
+		return nil, UnlinkedMethodError{Method: c.Method}
+	}
+	return checker, nil
 }
 
 // Check gets the voters's date of birth, calculates their age in the
 // configured location, and ensures it is at least the configured lower limit.
-func (c *Checker) Check(voter string) (err error) {
+//
+// cert is the voter's authentication certificate, if available. It is only
+// used by methods registered with RegisterCertificate, which fail if it is
+// nil. ctx is only used by the VoterList method to query the Store.
+func (c *Checker) Check(ctx context.Context, voter string, cert *x509.Certificate) (err error) {
 	if c.limit == 0 {
 		return nil
 	}
 
-	dob, err := c.get(voter)
+	var dob time.Time
+	switch {
+	case c.store != nil:
+		dob, err = c.store.GetVoterDOB(ctx, voter)
+	case c.getCert == nil:
+		dob, err = c.get(voter)
+	case cert == nil:
+		err = NoCertificateError{}
+	default:
+		dob, err = c.getCert(cert)
+	}
 	if err != nil {
 		return GetAgeError{Err: err}
 	}
@@ -116,3 +174,57 @@ func estpic(voter string) (dob time.Time, err error) {
 	}
 	return
 }
+
+var (
+	// oidSubjectDirectoryAttributes is the object identifier of the subject
+	// directory attributes certificate extension, see RFC 5280 section
+	// 4.2.1.8.
+	oidSubjectDirectoryAttributes = asn1.ObjectIdentifier{2, 5, 29, 9}
+
+	// oidDateOfBirth is the object identifier of the date of birth
+	// attribute, see RFC 3739 section 3.2.2.
+	oidDateOfBirth = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 1}
+)
+
+// attribute is an X.501 attribute with its values left unparsed.
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// certdob returns the date of birth from the subject directory attributes
+// extension of the voter's certificate. This is used by qualified certificate
+// profiles of several countries where the date of birth cannot be derived
+// from the personal identifier.
+func certdob(cert *x509.Certificate) (dob time.Time, err error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidSubjectDirectoryAttributes) {
+			continue
+		}
+
+		var attrs []attribute
+		rest, err := asn1.Unmarshal(ext.Value, &attrs)
+		if err != nil {
+			return dob, CertDOBUnmarshalAttributesError{Err: err}
+		}
+		if len(rest) > 0 {
+			return dob, CertDOBAttributesTrailingDataError{Rest: rest}
+		}
+		for _, attr := range attrs {
+			if !attr.Type.Equal(oidDateOfBirth) {
+				continue
+			}
+			if len(attr.Values) != 1 {
+				return dob, CertDOBValueCountError{Count: len(attr.Values)}
+			}
+			if _, err = asn1.UnmarshalWithParams(
+				attr.Values[0].FullBytes, &dob, "generalized"); err != nil {
+
+				return dob, CertDOBUnmarshalDateError{Err: err}
+			}
+			return dob, nil
+		}
+		break
+	}
+	return dob, CertDOBMissingError{}
+}
@@ -1,6 +1,10 @@
 package age
 
 import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
 	"fmt"
 	"testing"
 	"time"
@@ -48,7 +52,7 @@ func TestCheck(t *testing.T) {
 			}
 			c.limit = test.limit
 
-			err := c.Check(test.dob)
+			err := c.Check(context.Background(), test.dob, nil)
 			if test.ok && err != nil {
 				t.Error("unexpected error:", err)
 			}
@@ -87,3 +91,82 @@ func TestEstPIC(t *testing.T) {
 		})
 	}
 }
+
+func TestCertDOB(t *testing.T) {
+	exp := time.Date(1991, time.August, 20, 0, 0, 0, 0, time.UTC)
+	date, err := asn1.MarshalWithParams(exp, "generalized")
+	if err != nil {
+		t.Fatal("failed to marshal date of birth:", err)
+	}
+	gender, err := asn1.Marshal("M")
+	if err != nil {
+		t.Fatal("failed to marshal gender:", err)
+	}
+	attrs, err := asn1.Marshal([]attribute{
+		{Type: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 9, 3}, // Gender.
+			Values: []asn1.RawValue{{FullBytes: gender}}},
+		{Type: oidDateOfBirth, Values: []asn1.RawValue{{FullBytes: date}}},
+	})
+	if err != nil {
+		t.Fatal("failed to marshal attributes:", err)
+	}
+
+	cert := &x509.Certificate{Extensions: []pkix.Extension{
+		{Id: oidSubjectDirectoryAttributes, Value: attrs},
+	}}
+	got, err := certdob(cert)
+	if err != nil {
+		t.Fatal("failed to get voter DOB:", err)
+	}
+	if !exp.Equal(got) {
+		t.Errorf("unexpected DOB: got %s, want %s", got, exp)
+	}
+
+	if _, err = certdob(new(x509.Certificate)); errors.CausedBy(err, new(CertDOBMissingError)) == nil {
+		t.Errorf("unexpected error: got %v, want CertDOBMissingError", err)
+	}
+
+	c := &Checker{getCert: certdob, loc: time.UTC, limit: 18, now: time.Now}
+	if err = c.Check(context.Background(), "", nil); errors.CausedBy(err, new(NoCertificateError)) == nil {
+		t.Errorf("unexpected error: got %v, want NoCertificateError", err)
+	}
+	if err = c.Check(context.Background(), "", cert); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+// store is a Store which returns dates of birth from a map.
+type store map[string]time.Time
+
+func (s store) GetVoterDOB(_ context.Context, voter string) (time.Time, error) {
+	dob, ok := s[voter]
+	if !ok {
+		return dob, fmt.Errorf("no date of birth for %s", voter)
+	}
+	return dob, nil
+}
+
+func TestVoterList(t *testing.T) {
+	conf := &Conf{Method: VoterList, Limit: 16}
+	if _, err := New(conf, nil); errors.CausedBy(err, new(VoterListWithoutStoreError)) == nil {
+		t.Errorf("unexpected error: got %v, want VoterListWithoutStoreError", err)
+	}
+
+	now := time.Now()
+	c, err := New(conf, store{
+		"adult": now.AddDate(-16, 0, 0),
+		"minor": now.AddDate(-16, 0, 1),
+	})
+	if err != nil {
+		t.Fatal("failed to create checker:", err)
+	}
+	if err = c.Check(context.Background(), "adult", nil); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if err = c.Check(context.Background(), "minor", nil); errors.CausedBy(err, new(TooYoungError)) == nil {
+		t.Errorf("unexpected error: got %v, want TooYoungError", err)
+	}
+	if err = c.Check(context.Background(), "unknown", nil); errors.CausedBy(err, new(GetAgeError)) == nil {
+		t.Errorf("unexpected error: got %v, want GetAgeError", err)
+	}
+}
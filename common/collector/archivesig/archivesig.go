@@ -0,0 +1,92 @@
+/*
+Package archivesig implements the signing of manifests which describe ZIP
+archives created by collector tools, e.g., vote exports and storage backups.
+
+A manifest is signed with a PKCS #1 v1.5 RSA signature of the SHA-256 hash of
+its encoding. The signing key is a PEM-encoded PKCS #1 RSA private key and the
+signature is verified using the public key of a PEM-encoded certificate.
+*/
+package archivesig
+
+import (
+	"archive/zip"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"os"
+	"time"
+
+	"ivxv.ee/common/collector/cryptoutil"
+)
+
+// ReadKey reads a PEM-encoded PKCS #1 RSA private key from path.
+func ReadKey(path string) (*rsa.PrivateKey, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ReadKeyError{Path: path, Err: err}
+	}
+	der, err := cryptoutil.PEMDecode(string(encoded), "RSA PRIVATE KEY")
+	if err != nil {
+		return nil, DecodeKeyError{Path: path, Err: err}
+	}
+	key, err := x509.ParsePKCS1PrivateKey(der)
+	if err != nil {
+		return nil, ParseKeyError{Path: path, Err: err}
+	}
+	return key, nil
+}
+
+// ReadCertificate reads a PEM-encoded certificate from path and returns its
+// RSA public key.
+func ReadCertificate(path string) (*rsa.PublicKey, error) {
+	encoded, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ReadCertificateError{Path: path, Err: err}
+	}
+	cert, err := cryptoutil.PEMCertificate(string(encoded))
+	if err != nil {
+		return nil, ParseCertificateError{Path: path, Err: err}
+	}
+	pub, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return nil, CertificateNotRSAError{Subject: cert.Subject.String()}
+	}
+	return pub, nil
+}
+
+// Sign signs the manifest encoding with key.
+func Sign(key *rsa.PrivateKey, encoded []byte) ([]byte, error) {
+	hash := sha256.Sum256(encoded)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return nil, SignError{Err: err}
+	}
+	return signature, nil
+}
+
+// Verify verifies the signature of the manifest encoding with pub.
+func Verify(pub *rsa.PublicKey, encoded, signature []byte) error {
+	hash := sha256.Sum256(encoded)
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, hash[:], signature); err != nil {
+		return VerifyError{Err: err}
+	}
+	return nil
+}
+
+// AddFile adds a file with the provided contents to the archive.
+func AddFile(w *zip.Writer, mod time.Time, name string, value []byte) error {
+	f, err := w.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mod,
+	})
+	if err != nil {
+		return AddFileCreateError{Name: name, Err: err}
+	}
+	if _, err := f.Write(value); err != nil {
+		return AddFileWriteError{Name: name, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package archivesig
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+)
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}),
+		0600); err != nil {
+
+		t.Fatal("failed to write PEM file:", err)
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	dir := t.TempDir()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "archivesig"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	keypath := filepath.Join(dir, "sign.key")
+	certpath := filepath.Join(dir, "sign.pem")
+	writePEM(t, keypath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	writePEM(t, certpath, "CERTIFICATE", der)
+
+	read, err := ReadKey(keypath)
+	if err != nil {
+		t.Fatal("failed to read key:", err)
+	}
+	if !read.Equal(key) {
+		t.Error("read a different key")
+	}
+	pub, err := ReadCertificate(certpath)
+	if err != nil {
+		t.Fatal("failed to read certificate:", err)
+	}
+	if _, err = ReadKey(certpath); errors.CausedBy(err, new(DecodeKeyError)) == nil {
+		t.Errorf("unexpected error reading certificate as key: %v", err)
+	}
+
+	manifest := []byte(`{"Version":1}`)
+	signature, err := Sign(read, manifest)
+	if err != nil {
+		t.Fatal("failed to sign:", err)
+	}
+	if err = Verify(pub, manifest, signature); err != nil {
+		t.Error("failed to verify:", err)
+	}
+	if err = Verify(pub, []byte(`{"Version":2}`), signature); errors.CausedBy(err,
+		new(VerifyError)) == nil {
+
+		t.Errorf("unexpected error with modified manifest: %v", err)
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	mod := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := AddFile(w, mod, "data/000001.jsonl", []byte("contents")); err != nil {
+		t.Fatal("failed to add file:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("failed to close archive:", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal("failed to open archive:", err)
+	}
+	if len(r.File) != 1 || r.File[0].Name != "data/000001.jsonl" ||
+		!r.File[0].Modified.Equal(mod) {
+
+		t.Fatalf("unexpected archive entries: %+v", r.File)
+	}
+	rc, err := r.File[0].Open()
+	if err != nil {
+		t.Fatal("failed to open file:", err)
+	}
+	defer rc.Close()
+	if data, err := io.ReadAll(rc); err != nil || string(data) != "contents" {
+		t.Errorf("unexpected file contents: %q, %v", data, err)
+	}
+}
@@ -17,9 +17,10 @@ type Type string
 
 // Enumeration of authentication verifiers.
 const (
-	Dummy  Type = "dummy"
-	TLS    Type = "tls"
-	Ticket Type = "ticket"
+	Dummy    Type = "dummy"
+	TLS      Type = "tls"
+	Ticket   Type = "ticket"
+	WebAuthn Type = "webauthn"
 )
 
 // Here we "declare" errors that authentication modules should use for wrapping
@@ -73,6 +74,21 @@ type TokenData interface {
 	TokenData(token []byte) (data []byte, err error)
 }
 
+// Store is the interface for looking up data imported into the storage
+// service, e.g., pre-registered credentials. It is implemented by the storage
+// client.
+type Store interface {
+	GetCredential(ctx context.Context, id string) (credential []byte, err error)
+	UseCredential(ctx context.Context, id string, count uint32, challenge []byte) error
+}
+
+// StoreUser is an optional additional interface that Verifiers can implement.
+// If a Verifier is also a StoreUser, then it requires a Store, which must be
+// provided using Auther.UseStore before verifying tokens.
+type StoreUser interface {
+	UseStore(store Store)
+}
+
 // NewFunc is the type of functions that an authentication verifier with a
 // specified configuration.
 type NewFunc func(yaml.Node) (Verifier, error)
@@ -126,6 +142,15 @@ func Configure(c Conf) (a Auther, err error) {
 	return
 }
 
+// UseStore provides store to all configured verifiers which are StoreUsers.
+func (a Auther) UseStore(store Store) {
+	for _, v := range a {
+		if user, ok := v.(StoreUser); ok {
+			user.UseStore(store)
+		}
+	}
+}
+
 // Verify dispatches the authentication token to the verifier of type t and
 // returns the authenticated client's name.
 //
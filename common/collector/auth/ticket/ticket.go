@@ -32,6 +32,10 @@ func init() {
 	})
 }
 
+// SystemKeyPath is the path of the key shared by collector services for
+// authentication tickets.
+const SystemKeyPath = "/var/lib/ivxv/service/ticket.key"
+
 // Conf is the ticket authentication method configuration.
 type Conf struct {
 	Key cookie.Key
@@ -54,7 +58,7 @@ func New(key cookie.Key) (t *T, err error) {
 // NewFromSystem creates a new ticket manager with the key read from the
 // filesystem.
 func NewFromSystem() (t *T, err error) {
-	key, err := os.ReadFile("/var/lib/ivxv/service/ticket.key")
+	key, err := os.ReadFile(SystemKeyPath)
 	if err != nil {
 		return nil, ReadKeyError{Err: err}
 	}
@@ -67,7 +71,7 @@ func NewFromSystem() (t *T, err error) {
 // NewFromSystemAsCookie returns a cookie, which is used as a shared secret,
 // any implementation can build additional encryption logic on top.
 func NewFromSystemAsCookie() (*cookie.C, error) {
-	key, err := os.ReadFile("/var/lib/ivxv/service/ticket.key")
+	key, err := os.ReadFile(SystemKeyPath)
 	if err != nil {
 		return nil, ReadSharedSecretForCookieError{Err: err}
 	}
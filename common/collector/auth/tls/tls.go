@@ -43,6 +43,10 @@ type Conf struct {
 	Roots         []string   // PEM-encoded client certificate verification roots.
 	Intermediates []string   // PEM-encoded client certificate verification intermediates.
 	OCSP          *ocsp.Conf // Optional OCSP-checking configuration.
+
+	// Constraints are optional allow-lists of certificate policies,
+	// extended key usages, and key algorithms for client certificates.
+	Constraints cryptoutil.CertificateConstraints
 }
 
 // V is an auth.Verifier which checks TLS authentication.
@@ -50,6 +54,7 @@ type V struct {
 	rpool *x509.CertPool
 	ipool *x509.CertPool
 	ocsp  *ocsp.Client
+	check *cryptoutil.CertificateChecker
 }
 
 // New returns a new TLS authentication verifier with the provided configuration.
@@ -70,6 +75,9 @@ func New(c *Conf) (v *V, err error) {
 			return nil, OCSPClientError{Err: err}
 		}
 	}
+	if v.check, err = cryptoutil.NewCertificateChecker(&c.Constraints); err != nil {
+		return nil, ConstraintsError{Err: err}
+	}
 	return
 }
 
@@ -104,12 +112,21 @@ func (v *V) Verify(ctx context.Context, token []byte) (*pkix.Name, error) {
 		}
 	}
 
+	if err = v.check.Check(cert); err != nil {
+		return nil, auth.CertificateError{
+			Err: CertificateConstraintsError{
+				Certificate: cert.Raw,
+				Err:         err,
+			},
+		}
+	}
+
 	if v.ocsp != nil {
 		issuer := cert
 		if len(chains[0]) > 1 { // At least one chain is guaranteed.
 			issuer = chains[0][1]
 		}
-		status, err := v.ocsp.Check(ctx, cert, issuer, nil)
+		status, err := v.ocsp.CheckCached(ctx, cert, issuer)
 		if err != nil {
 			return nil, CheckCertificateStatusError{
 				Certificate: cert,
@@ -0,0 +1,447 @@
+/*
+Package webauthn implements voter authentication using WebAuthn assertions.
+
+Voters authenticate with platform authenticators, e.g., security keys or
+biometric authenticators built into their devices, using credentials which are
+registered before the election and imported with the voter list. The
+authentication token is a JSON-encoded assertion created with the Web
+Authentication API navigator.credentials.get call:
+
+	{
+		"credentialId": "<base64url-encoded credential identifier>",
+		"authenticatorData": "<base64-encoded authenticator data>",
+		"clientDataJSON": "<base64-encoded client data JSON>",
+		"signature": "<base64-encoded assertion signature>"
+	}
+
+The challenge of the assertion must be issued by the choices service with the
+RPC.WebAuthnChallenge call, which is the first call of the session. The
+challenge is a cookie which contains the session identifier and the time it
+was issued, so the assertion is accepted only in the same session and only for
+the configured duration after the challenge was issued. Same as with other
+authentication tokens, an assertion can be reused until it expires.
+
+The signature counter of the authenticator must increase with each new
+assertion, which is checked against the last counter stored in the storage
+service. This detects replayed assertions and cloned authenticators. Only
+authenticators which do not support counters, i.e., always report zero, are
+exempt from this check.
+*/
+package webauthn
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/auth/ticket"
+	"ivxv.ee/common/collector/cookie"
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/yaml"
+)
+
+func init() {
+	auth.Register(auth.WebAuthn, func(n yaml.Node) (auth.Verifier, error) {
+		c := new(Conf)
+		if err := yaml.Apply(n, c); err != nil {
+			return nil, ConfigurationError{Err: err}
+		}
+		key, err := os.ReadFile(ticket.SystemKeyPath)
+		if err != nil {
+			return nil, ReadSystemKeyError{Err: err}
+		}
+		v, err := New(c, key)
+		if err != nil {
+			return nil, err
+		}
+		return v, nil
+	})
+}
+
+// Conf is the WebAuthn authentication verifier configuration.
+type Conf struct {
+	// RPID is the relying party identifier which the credentials are
+	// scoped to, i.e., the domain of the voting application.
+	RPID string
+
+	// Origins are the allowed origins of the voting application.
+	Origins []string
+
+	// ChallengeAge is the number of seconds for which an assertion is
+	// accepted after its challenge was issued.
+	ChallengeAge uint64
+
+	// UserVerification requires that the authenticator verified the voter,
+	// e.g., using a PIN or biometrics, instead of only testing their
+	// presence.
+	UserVerification bool
+}
+
+// V is an auth.Verifier which checks WebAuthn assertions.
+type V struct {
+	challenger *Challenger
+	rpIDHash   [sha256.Size]byte
+	origins    map[string]struct{}
+	age        time.Duration
+	uv         bool
+	store      auth.Store
+	now        func() time.Time // Returns the current time, can be replaced for testing.
+}
+
+// New returns a new WebAuthn authentication verifier with the provided
+// configuration. key is the key shared with the choices service, which is
+// used to open challenges issued by a Challenger.
+func New(c *Conf, key cookie.Key) (v *V, err error) {
+	if len(c.RPID) == 0 {
+		return nil, UnconfiguredRPIDError{}
+	}
+	if len(c.Origins) == 0 {
+		return nil, UnconfiguredOriginsError{}
+	}
+	if c.ChallengeAge == 0 {
+		return nil, UnconfiguredChallengeAgeError{}
+	}
+
+	challenger, err := NewChallenger(key)
+	if err != nil {
+		return nil, err
+	}
+
+	v = &V{
+		challenger: challenger,
+		rpIDHash:   sha256.Sum256([]byte(c.RPID)),
+		origins:    make(map[string]struct{}),
+		age:        time.Duration(c.ChallengeAge) * time.Second,
+		uv:         c.UserVerification,
+		now:        time.Now,
+	}
+	for _, origin := range c.Origins {
+		v.origins[origin] = struct{}{}
+	}
+	return v, nil
+}
+
+// UseStore implements the auth.StoreUser interface. The store is used to look
+// up pre-registered credentials and to check their signature counters.
+func (v *V) UseStore(store auth.Store) {
+	v.store = store
+}
+
+// Assertion is the WebAuthn authentication token.
+type Assertion struct {
+	CredentialID      string `json:"credentialId"`
+	AuthenticatorData []byte `json:"authenticatorData"`
+	ClientDataJSON    []byte `json:"clientDataJSON"`
+	Signature         []byte `json:"signature"`
+}
+
+// clientData contains the fields of the client data JSON which are checked.
+type clientData struct {
+	Type      string `json:"type"`
+	Challenge string `json:"challenge"`
+	Origin    string `json:"origin"`
+}
+
+const (
+	// authDataMinLen is the length of the authenticator data without
+	// attested credential data and extensions: RP ID hash, flags, and
+	// signature counter.
+	authDataMinLen = sha256.Size + 1 + 4
+
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+
+	// nonceLen is the number of random bytes in a challenge.
+	nonceLen = 16
+
+	// clockSkew is the allowed difference between the challenge time and
+	// the current time when the challenge time is in the future, e.g.,
+	// when the challenge was issued by another server.
+	clockSkew = time.Minute
+
+	// challengePurpose is used to derive the challenge key from the shared
+	// key, so that challenges cannot be used as other cookies and vice
+	// versa.
+	challengePurpose = "ivxv.ee/common/collector/auth/webauthn"
+)
+
+// challenge is the data contained in an issued challenge.
+type challenge struct {
+	SessionID string
+	Created   int64 // Unix time in seconds.
+	Nonce     []byte
+}
+
+// Challenger issues challenges for WebAuthn assertions.
+type Challenger struct {
+	cookie *cookie.C
+	now    func() time.Time // Returns the current time, can be replaced for testing.
+}
+
+// NewChallenger returns a new challenger which issues challenges that can be
+// opened by verifiers with the same key.
+func NewChallenger(key cookie.Key) (c *Challenger, err error) {
+	c = &Challenger{now: time.Now}
+	if c.cookie, err = cookie.New(cookie.Derive(key, challengePurpose)); err != nil {
+		return nil, ChallengeCookieError{Err: err}
+	}
+	return c, nil
+}
+
+// NewChallengerFromSystem returns a new challenger with the key read from the
+// filesystem.
+func NewChallengerFromSystem() (c *Challenger, err error) {
+	key, err := os.ReadFile(ticket.SystemKeyPath)
+	if err != nil {
+		return nil, ReadChallengerKeyError{Err: err}
+	}
+	return NewChallenger(key)
+}
+
+// Create issues a new challenge for the session with identifier sessionID.
+func (c *Challenger) Create(sessionID string) ([]byte, error) {
+	ch := challenge{
+		SessionID: sessionID,
+		Created:   c.now().Unix(),
+		Nonce:     make([]byte, nonceLen),
+	}
+	if _, err := rand.Read(ch.Nonce); err != nil {
+		return nil, ChallengeNonceError{Err: err}
+	}
+	data, err := asn1.Marshal(ch)
+	if err != nil {
+		return nil, MarshalChallengeError{Err: err}
+	}
+	return c.cookie.Create(data), nil
+}
+
+// Verify implements the auth.Verifier interface. The token must be a
+// JSON-encoded Assertion.
+func (v *V) Verify(ctx context.Context, token []byte) (*pkix.Name, error) {
+	if v.store == nil {
+		return nil, NoStoreError{}
+	}
+
+	var a Assertion
+	if err := json.Unmarshal(token, &a); err != nil {
+		return nil, auth.MalformedTokenError{Err: UnmarshalAssertionError{Err: err}}
+	}
+	if len(a.CredentialID) == 0 {
+		return nil, auth.MalformedTokenError{Err: MissingCredentialIDError{}}
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(a.CredentialID); err != nil {
+		return nil, auth.MalformedTokenError{Err: DecodeCredentialIDError{Err: err}}
+	}
+
+	challenge, err := v.checkClientData(a.ClientDataJSON)
+	if err != nil {
+		return nil, auth.MalformedTokenError{Err: err}
+	}
+	if err = v.checkChallenge(ctx, challenge); err != nil {
+		return nil, auth.UnauthorizedError{Err: err}
+	}
+	if err := v.checkAuthenticatorData(a.AuthenticatorData); err != nil {
+		return nil, auth.MalformedTokenError{Err: err}
+	}
+
+	// Look up the pre-registered credential.
+	encoded, err := v.store.GetCredential(ctx, a.CredentialID)
+	if err != nil {
+		if errors.CausedBy(err, new(storage.NotExistError)) != nil {
+			return nil, auth.UnauthorizedError{
+				Err: UnregisteredCredentialError{ID: a.CredentialID},
+			}
+		}
+		return nil, GetCredentialError{ID: a.CredentialID, Err: err}
+	}
+	cred, err := ParseCredential(encoded)
+	if err != nil {
+		return nil, ParseStoredCredentialError{ID: a.CredentialID, Err: err}
+	}
+
+	// The signature is over the authenticator data and the hash of the
+	// client data JSON.
+	clientDataHash := sha256.Sum256(a.ClientDataJSON)
+	signed := make([]byte, 0, len(a.AuthenticatorData)+len(clientDataHash))
+	signed = append(signed, a.AuthenticatorData...)
+	signed = append(signed, clientDataHash[:]...)
+	if err = verify(cred.key, signed, a.Signature); err != nil {
+		return nil, auth.CertificateError{Err: VerifyAssertionError{
+			ID:  a.CredentialID,
+			Err: err,
+		}}
+	}
+
+	// Only check the signature counter of verified assertions, so that
+	// forged assertions cannot advance it.
+	count := binary.BigEndian.Uint32(a.AuthenticatorData[sha256.Size+1:])
+	if err = v.store.UseCredential(ctx, a.CredentialID, count, challenge); err != nil {
+		if errors.CausedBy(err, new(storage.CredentialCounterError)) != nil {
+			return nil, auth.UnauthorizedError{Err: err}
+		}
+		return nil, UseCredentialError{ID: a.CredentialID, Err: err}
+	}
+
+	return &pkix.Name{
+		CommonName:   cred.Name,
+		SerialNumber: cred.Voter,
+	}, nil
+}
+
+// checkClientData checks the type and origin of the client data and returns
+// the decoded challenge.
+func (v *V) checkClientData(clientDataJSON []byte) (challenge []byte, err error) {
+	var cd clientData
+	if err = json.Unmarshal(clientDataJSON, &cd); err != nil {
+		return nil, UnmarshalClientDataError{Err: err}
+	}
+	if cd.Type != "webauthn.get" {
+		return nil, ClientDataTypeError{Type: cd.Type}
+	}
+	if _, ok := v.origins[cd.Origin]; !ok {
+		return nil, ClientDataOriginError{Origin: cd.Origin}
+	}
+	if challenge, err = base64.RawURLEncoding.DecodeString(cd.Challenge); err != nil {
+		return nil, DecodeChallengeError{Err: err}
+	}
+	return challenge, nil
+}
+
+// checkChallenge checks that the challenge was issued by a Challenger to the
+// session of ctx and has not expired.
+func (v *V) checkChallenge(ctx context.Context, encoded []byte) error {
+	data, err := v.challenger.cookie.Open(encoded)
+	if err != nil {
+		return OpenChallengeError{Err: err}
+	}
+	var ch challenge
+	rest, err := asn1.Unmarshal(data, &ch)
+	if err != nil {
+		return UnmarshalChallengeError{Err: err}
+	}
+	if len(rest) > 0 {
+		return ChallengeExcessBytesError{Len: len(rest)}
+	}
+
+	if sessionID := server.SessionID(ctx); ch.SessionID != sessionID {
+		return ChallengeSessionMismatchError{Challenge: ch.SessionID, Session: sessionID}
+	}
+	created := time.Unix(ch.Created, 0)
+	now := v.now()
+	if created.After(now.Add(clockSkew)) {
+		return ChallengeFromFutureError{Created: created, Now: now}
+	}
+	if now.After(created.Add(v.age)) {
+		return ChallengeExpiredError{Created: created, Now: now}
+	}
+	return nil
+}
+
+// checkAuthenticatorData checks the relying party identifier hash and flags of
+// the authenticator data.
+func (v *V) checkAuthenticatorData(authData []byte) error {
+	if len(authData) < authDataMinLen {
+		return AuthenticatorDataLengthError{Length: len(authData), Min: authDataMinLen}
+	}
+	if !bytes.Equal(authData[:sha256.Size], v.rpIDHash[:]) {
+		return RPIDHashMismatchError{Hash: authData[:sha256.Size]}
+	}
+	flags := authData[sha256.Size]
+	if flags&flagUserPresent == 0 {
+		return UserNotPresentError{}
+	}
+	if v.uv && flags&flagUserVerified == 0 {
+		return UserNotVerifiedError{}
+	}
+	return nil
+}
+
+// verify verifies the assertion signature on signed using key. The signature
+// algorithms correspond to the COSE algorithms ES256, EdDSA, and RS256.
+func verify(key crypto.PublicKey, signed, signature []byte) error {
+	hashed := sha256.Sum256(signed)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, hashed[:], signature) {
+			return ECDSASignatureVerificationError{}
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, signed, signature) {
+			return Ed25519SignatureVerificationError{}
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, hashed[:], signature); err != nil {
+			return RSASignatureVerificationError{Err: err}
+		}
+	default:
+		return UnsupportedKeyTypeError{Type: fmt.Sprintf("%T", key)}
+	}
+	return nil
+}
+
+// Credential is a pre-registered WebAuthn credential.
+type Credential struct {
+	// Voter is the unique identifier of the voter who registered the
+	// credential, returned as the SerialNumber of the authenticated name.
+	Voter string `json:"voter"`
+
+	// Name is the name of the voter, returned as the CommonName of the
+	// authenticated name.
+	Name string `json:"name"`
+
+	// PublicKey is the DER-encoded SubjectPublicKeyInfo of the credential
+	// public key.
+	PublicKey []byte `json:"publickey"`
+
+	key crypto.PublicKey
+}
+
+// ParseCredential parses and checks a JSON-encoded credential.
+func ParseCredential(encoded []byte) (cred *Credential, err error) {
+	cred = new(Credential)
+	if err = json.Unmarshal(encoded, cred); err != nil {
+		return nil, UnmarshalCredentialError{Err: err}
+	}
+	if len(cred.Voter) == 0 {
+		return nil, CredentialMissingVoterError{}
+	}
+	if cred.key, err = x509.ParsePKIXPublicKey(cred.PublicKey); err != nil {
+		return nil, ParseCredentialKeyError{Err: err}
+	}
+	switch k := cred.key.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, CredentialRSAKeyTooShortError{Bits: k.N.BitLen()}
+		}
+	default:
+		return nil, UnsupportedCredentialKeyTypeError{Type: fmt.Sprintf("%T", cred.key)}
+	}
+	return cred, nil
+}
+
+// Marshal JSON-encodes the credential for storage.
+func (c *Credential) Marshal() ([]byte, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return nil, MarshalCredentialError{Err: err}
+	}
+	return encoded, nil
+}
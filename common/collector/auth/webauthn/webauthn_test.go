@@ -0,0 +1,228 @@
+package webauthn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+const (
+	rpID    = "valimised.ee"
+	origin  = "https://valimised.ee"
+	session = "0101e9342abab1577b8b2844d6a1d317"
+)
+
+var key = []byte("0123456789abcdef")
+
+// store is an auth.Store which returns credentials from a map and checks
+// signature counters using the storage client.
+type store struct {
+	*storage.Client
+	creds map[string][]byte
+}
+
+func newStore() *store {
+	return &store{
+		Client: storage.NewWithProtocol(memory.New(nil)),
+		creds:  make(map[string][]byte),
+	}
+}
+
+func (s *store) GetCredential(_ context.Context, id string) ([]byte, error) {
+	cred, ok := s.creds[id]
+	if !ok {
+		var err storage.NotExistError
+		err.Key = id
+		return nil, err
+	}
+	return cred, nil
+}
+
+// authenticator is a software authenticator with a single credential.
+type authenticator struct {
+	id     string
+	signer crypto.Signer
+	count  byte
+}
+
+func newAuthenticator(t *testing.T, id string, signer crypto.Signer, s *store) *authenticator {
+	pub, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatal("failed to marshal public key:", err)
+	}
+	encoded, err := (&Credential{Voter: "38001085718", Name: id, PublicKey: pub}).Marshal()
+	if err != nil {
+		t.Fatal("failed to marshal credential:", err)
+	}
+	a := &authenticator{id: base64.RawURLEncoding.EncodeToString([]byte(id)), signer: signer}
+	s.creds[a.id] = encoded
+	return a
+}
+
+// issue issues a challenge for session at time created.
+func issue(t *testing.T, session string, created time.Time) []byte {
+	c, err := NewChallenger(key)
+	if err != nil {
+		t.Fatal("failed to create challenger:", err)
+	}
+	c.now = func() time.Time { return created }
+	ch, err := c.Create(session)
+	if err != nil {
+		t.Fatal("failed to create challenge:", err)
+	}
+	return ch
+}
+
+// assert creates an assertion token for challenge. The signature counter is
+// incremented before each assertion.
+func (a *authenticator) assert(t *testing.T, challenge []byte, flags byte, origin string) []byte {
+	a.count++
+	clientDataJSON, err := json.Marshal(map[string]string{
+		"type":      "webauthn.get",
+		"challenge": base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":    origin,
+	})
+	if err != nil {
+		t.Fatal("failed to marshal client data:", err)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	authData := append(rpIDHash[:], flags, 0, 0, 0, a.count)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authData...), clientDataHash[:]...)
+	digest, opts := signed, crypto.Hash(0)
+	if _, ok := a.signer.(*ecdsa.PrivateKey); ok {
+		hashed := sha256.Sum256(signed)
+		digest, opts = hashed[:], crypto.SHA256
+	}
+	signature, err := a.signer.Sign(rand.Reader, digest, opts)
+	if err != nil {
+		t.Fatal("failed to sign assertion:", err)
+	}
+
+	token, err := json.Marshal(Assertion{
+		CredentialID:      a.id,
+		AuthenticatorData: authData,
+		ClientDataJSON:    clientDataJSON,
+		Signature:         signature,
+	})
+	if err != nil {
+		t.Fatal("failed to marshal assertion:", err)
+	}
+	return token
+}
+
+func TestVerify(t *testing.T) {
+	v, err := New(&Conf{
+		RPID:             rpID,
+		Origins:          []string{origin},
+		ChallengeAge:     60,
+		UserVerification: true,
+	}, key)
+	if err != nil {
+		t.Fatal("failed to create verifier:", err)
+	}
+	now := time.Now()
+	v.now = func() time.Time { return now }
+	ctx := server.WithSessionID(log.TestContext(context.Background()), session)
+
+	if _, err = v.Verify(ctx, nil); errors.CausedBy(err, new(NoStoreError)) == nil {
+		t.Errorf("unexpected error without store: %v, want NoStoreError", err)
+	}
+
+	s := newStore()
+	v.UseStore(s)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate ECDSA key:", err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate Ed25519 key:", err)
+	}
+	ec := newAuthenticator(t, "ecdsa", ecKey, s)
+	ed := newAuthenticator(t, "ed25519", edKey, s)
+
+	const uv = flagUserPresent | flagUserVerified
+	for _, a := range []*authenticator{ec, ed} {
+		token := a.assert(t, issue(t, session, now), uv, origin)
+		name, err := v.Verify(ctx, token)
+		if err != nil {
+			t.Fatal("failed to verify assertion:", err)
+		}
+		if name.SerialNumber != "38001085718" {
+			t.Errorf("unexpected serial number: %q", name.SerialNumber)
+		}
+
+		// The same assertion can be reused in the session.
+		if _, err = v.Verify(ctx, token); err != nil {
+			t.Error("failed to verify reused assertion:", err)
+		}
+	}
+
+	// Credential registered to a different key.
+	unregistered := &authenticator{id: ec.id, signer: edKey}
+
+	// An assertion which was already superseded by a newer one.
+	replayed := ec.assert(t, issue(t, session, now), uv, origin)
+	if _, err = v.Verify(ctx, ec.assert(t, issue(t, session, now), uv, origin)); err != nil {
+		t.Fatal("failed to verify assertion:", err)
+	}
+
+	// An assertion from a clone of the authenticator with a lagging
+	// signature counter.
+	clone := *ec
+	clone.count -= 2
+
+	valid := issue(t, session, now)
+	for _, test := range []struct {
+		name     string
+		token    []byte
+		expected error
+	}{
+		{"malformed", []byte("{"), new(auth.MalformedTokenError)},
+		{"expired", ec.assert(t, issue(t, session, now.Add(-2*time.Minute)), uv, origin),
+			new(ChallengeExpiredError)},
+		{"future", ec.assert(t, issue(t, session, now.Add(2*time.Minute)), uv, origin),
+			new(ChallengeFromFutureError)},
+		{"other session", ec.assert(t, issue(t, "02a0e9342abab1577b8b2844d6a1d317", now),
+			uv, origin), new(ChallengeSessionMismatchError)},
+		{"not issued", ec.assert(t, []byte("0123456789abcdef0123456789abcdef0123456789"),
+			uv, origin), new(OpenChallengeError)},
+		{"origin", ec.assert(t, valid, uv, "https://example.com"),
+			new(ClientDataOriginError)},
+		{"unverified", ec.assert(t, valid, flagUserPresent, origin),
+			new(UserNotVerifiedError)},
+		{"unregistered", (&authenticator{id: "dW5rbm93bg", signer: ecKey}).
+			assert(t, valid, uv, origin), new(auth.UnauthorizedError)},
+		{"wrong key", unregistered.assert(t, valid, uv, origin),
+			new(auth.CertificateError)},
+		{"replayed", replayed, new(storage.CredentialCounterError)},
+		{"cloned", clone.assert(t, valid, uv, origin), new(storage.CredentialCounterError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := v.Verify(ctx, test.token)
+			if errors.CausedBy(err, test.expected) == nil {
+				t.Errorf("unexpected error: %v, want %T", err, test.expected)
+			}
+		})
+	}
+}
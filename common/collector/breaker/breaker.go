@@ -0,0 +1,125 @@
+/*
+Package breaker provides failover across an ordered list of endpoints of an
+external service with a circuit breaker per endpoint.
+
+The circuit breaker of an endpoint opens after a configured number of
+consecutive failures, after which the endpoint is skipped for a cooldown
+period. Once the cooldown has passed, a single request is let through to probe
+the endpoint: if it succeeds, then the breaker closes, otherwise it opens for
+another cooldown period.
+*/
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"ivxv.ee/common/collector/metrics"
+)
+
+var trips = metrics.NewCounter("ivxv_circuit_breaker_trips_total",
+	"Number of times a circuit breaker opened, by endpoint.", "endpoint")
+
+// Conf contains the configurable options for the circuit breakers.
+type Conf struct {
+	// FailureThreshold is the number of consecutive failures after which
+	// the breaker of an endpoint opens. If 0, then breakers never open and
+	// endpoints are always tried in order.
+	FailureThreshold uint64
+
+	// Cooldown is the number of seconds that an endpoint is skipped for
+	// after its breaker opens. If 0, then defaults to 30 seconds.
+	Cooldown uint64
+}
+
+const defaultCooldown = 30 * time.Second
+
+type state int
+
+const (
+	closed state = iota
+	open
+	halfOpen
+)
+
+// Breaker tracks the health of an endpoint.
+type Breaker struct {
+	name      string
+	threshold uint64
+	cooldown  time.Duration
+
+	lock     sync.Mutex
+	state    state
+	failures uint64
+	opened   time.Time
+}
+
+// New creates a closed breaker for the endpoint with the given name, which is
+// used to label metrics.
+func New(conf Conf, name string) *Breaker {
+	b := &Breaker{
+		name:      name,
+		threshold: conf.FailureThreshold,
+		cooldown:  time.Duration(conf.Cooldown) * time.Second,
+	}
+	if conf.Cooldown == 0 {
+		b.cooldown = defaultCooldown
+	}
+	return b
+}
+
+// Name returns the name of the endpoint.
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// Allow reports if a request should be made to the endpoint. If it returns
+// true, then the outcome of the request must be reported using Success or
+// Failure.
+func (b *Breaker) Allow() bool {
+	return b.allow(time.Now())
+}
+
+func (b *Breaker) allow(now time.Time) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	switch b.state {
+	case open:
+		if now.Sub(b.opened) < b.cooldown {
+			return false
+		}
+		b.state = halfOpen // Let a single probe through.
+		return true
+	case halfOpen:
+		return false // Probe in progress.
+	default:
+		return true
+	}
+}
+
+// Success reports a successful request to the endpoint.
+func (b *Breaker) Success() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.state = closed
+	b.failures = 0
+}
+
+// Failure reports a failed request to the endpoint.
+func (b *Breaker) Failure() {
+	b.failure(time.Now())
+}
+
+func (b *Breaker) failure(now time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.failures++
+	if b.threshold == 0 {
+		return
+	}
+	if b.state == halfOpen || b.failures >= b.threshold && b.state == closed {
+		b.state = open
+		b.opened = now
+		trips.Inc(b.name)
+	}
+}
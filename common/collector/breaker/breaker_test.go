@@ -0,0 +1,56 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := New(Conf{FailureThreshold: 2, Cooldown: 10}, "test")
+
+	b.failure(now)
+	if !b.allow(now) {
+		t.Fatal("opened before threshold")
+	}
+	b.failure(now)
+	if b.allow(now) {
+		t.Fatal("not opened after threshold")
+	}
+
+	// After the cooldown only a single probe is allowed.
+	now = now.Add(10 * time.Second)
+	if !b.allow(now) {
+		t.Fatal("no probe after cooldown")
+	}
+	if b.allow(now) {
+		t.Fatal("concurrent probe allowed")
+	}
+
+	// A failed probe opens the breaker again.
+	b.failure(now)
+	if b.allow(now.Add(time.Second)) {
+		t.Fatal("not reopened after failed probe")
+	}
+
+	// A successful probe closes the breaker.
+	now = now.Add(10 * time.Second)
+	if !b.allow(now) {
+		t.Fatal("no probe after second cooldown")
+	}
+	b.Success()
+	b.failure(now)
+	if !b.allow(now) {
+		t.Fatal("failure count not reset on success")
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := New(Conf{}, "test")
+	for i := 0; i < 10; i++ {
+		b.Failure()
+	}
+	if !b.Allow() {
+		t.Error("disabled breaker opened")
+	}
+}
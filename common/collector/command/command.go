@@ -204,15 +204,8 @@ func newC(tag string, usage string, withStorage bool, args ...string) (c *C) {
 	}
 
 	if withStorage && c.Conf.Technical != nil {
-		var servers []string
-		for _, s := range c.Conf.Technical.Services(c.Network).Storage {
-			servers = append(servers, s.Address)
-		}
 		if c.Storage, err = storage.New(&c.Conf.Technical.Storage,
-			&storage.Services{
-				Sensitive: conf.Sensitive(c.Service.ID),
-				Servers:   servers,
-			}); err != nil {
+			c.StorageServices()); err != nil {
 
 			os.Exit(c.Error(exit.Config, StorageConfigurationError{Err: err},
 				"failed to configure storage client:", err))
@@ -221,6 +214,23 @@ func newC(tag string, usage string, withStorage bool, args ...string) (c *C) {
 	return
 }
 
+// StorageServices returns the storage service instance information for this
+// service instance. It can be used by applications which need to create
+// storage protocol clients themselves, e.g., with storage.NewProtocol.
+//
+// Must only be called if c.Conf.Technical is non-nil.
+func (c *C) StorageServices() *storage.Services {
+	var servers []string
+	for _, s := range c.Conf.Technical.Services(c.Network).Storage {
+		servers = append(servers, s.Address)
+	}
+	return &storage.Services{
+		ID:        c.Service.ID,
+		Sensitive: conf.Sensitive(c.Service.ID),
+		Servers:   servers,
+	}
+}
+
 // Cleanup cancels the context to clean up resources and closes the logger.
 // code is the exit code that the caller is exiting with: if it is OK, then it
 // may be replaced by Cleanup if an error occurs, otherwise it is returned
@@ -24,6 +24,7 @@ import (
 	"ivxv.ee/common/collector/log"
 	"ivxv.ee/common/collector/mid"
 	"ivxv.ee/common/collector/q11n"
+	"ivxv.ee/common/collector/ratelimit"
 	"ivxv.ee/common/collector/server"
 	"ivxv.ee/common/collector/smartid"
 	"ivxv.ee/common/collector/status"
@@ -57,12 +58,33 @@ type Election struct {
 	Voting struct {
 		RateLimitStart   uint64 // After how many votes do we rate limit submissions? 0 means immediately.
 		RateLimitMinutes uint64 // How many minutes between submission when limiting? 0 disables rate limiting.
+
+		// ConcurrentQualification enables requesting independent
+		// qualifying properties concurrently, see q11n.Conf.After.
+		ConcurrentQualification bool
+
+		// RateLimit configures additional vote submission rate
+		// limiting policies.
+		RateLimit ratelimit.Conf
 	}
 
 	Verification struct {
 		Count      uint64 // How many times a vote can be verified? 0 means unlimited.
 		Minutes    uint64 // How much time is given to verify a vote? 0 means unlimited.
 		LatestOnly bool   // If true, then only the latest vote of a voter can be verified.
+
+		// Ticket enables verification tickets: the voting service
+		// issues a ticket for each stored vote and the verification
+		// service only accepts requests with a valid ticket.
+		Ticket bool
+
+		// Probing configures detection of vote identifier probing:
+		// sources with too many failed lookups are blocked.
+		Probing struct {
+			Failures     uint64 // Failed lookups in window before blocking. 0 disables detection.
+			Minutes      uint64 // Length of the failed lookup counting window in minutes.
+			BlockMinutes uint64 // How many minutes is a source blocked for?
+		}
 	}
 
 	// VoterForeignEHAK specifies the administrative unit code (EHAK) to
@@ -81,6 +103,12 @@ type Election struct {
 		Key string // PEM-encoding of the public key used to verify voter list signatures.
 	}
 
+	Cancellation struct {
+		// Operators are the PEM-encoded certificates of operators who
+		// are allowed to sign vote cancellation lists.
+		Operators []string
+	}
+
 	XRoad struct {
 		CA string // PEM-encoded authentication certificate.
 	}
@@ -177,6 +205,14 @@ type Service struct {
 	Address     string // The host:port to listen on for requests.
 	PeerAddress string // The host:port to listen on for peer messages.
 	Origin      string // In case of proxy, this is an FQDN that client sees.
+
+	// MetricsAddress is the local host:port to serve metrics on. Metrics
+	// are not served if it is empty.
+	MetricsAddress string
+
+	// TraceFile is the path of the file to export request trace spans to.
+	// Requests are not traced if it is empty.
+	TraceFile string
 }
 
 // Service finds the network and configuration for a service instance with id.
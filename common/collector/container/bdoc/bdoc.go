@@ -98,18 +98,23 @@ type Conf struct {
 	// TSDelayTime is the maximum time in seconds that the timestamp and
 	// the OCSP response can differ if Profile is TS.
 	TSDelayTime int64
+
+	// Constraints are optional allow-lists of certificate policies,
+	// extended key usages, and key algorithms for signer certificates.
+	Constraints cryptoutil.CertificateConstraints
 }
 
 // Opener is a configured BDOC container opener.
 type Opener struct {
-	bdocSize int64
-	fileSize int64
-	rpool    *x509.CertPool
-	ipool    *x509.CertPool
-	ocsp     *ocsp.Client
-	tsp      *tsp.Client
-	profile  Profile
-	tsdelay  time.Duration
+	bdocSize    int64
+	fileSize    int64
+	rpool       *x509.CertPool
+	ipool       *x509.CertPool
+	ocsp        *ocsp.Client
+	tsp         *tsp.Client
+	profile     Profile
+	tsdelay     time.Duration
+	constraints *cryptoutil.CertificateChecker
 }
 
 // New returns a new BDOC container opener.
@@ -138,6 +143,9 @@ func New(c *Conf) (*Opener, error) {
 	if o.ipool, err = cryptoutil.PEMCertificatePool(c.Intermediates...); err != nil {
 		return nil, IntermediatesParseError{Err: err}
 	}
+	if o.constraints, err = cryptoutil.NewCertificateChecker(&c.Constraints); err != nil {
+		return nil, ConstraintsError{Err: err}
+	}
 
 	switch c.Profile {
 	case TS:
@@ -681,6 +689,9 @@ func (o *Opener) verifyCertificate(c *x509.Certificate, time time.Time) (
 			KeyUsage: c.KeyUsage,
 		}
 	}
+	if err = o.constraints.Check(c); err != nil {
+		return nil, SignerConstraintsError{Err: err}
+	}
 
 	opts := x509.VerifyOptions{
 		Roots:         o.rpool,
@@ -11,13 +11,28 @@ package cookie
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"sync"
 )
 
 // Key is the type of the shared secret used to create and access cookies.
 type Key []byte
 
+// Derive derives a key for a specific purpose from key, so that cookies
+// created with the derived key cannot be opened with key or with keys derived
+// for other purposes. The derived key is HMAC-SHA256 over purpose, truncated to
+// the length of key.
+func Derive(key Key, purpose string) Key {
+	if len(key) > sha256.Size {
+		return key // Invalid for AES, let New report it.
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)[:len(key)]
+}
+
 // C is a cookie manager which can create or open cookies.
 type C struct {
 	aead  cipher.AEAD // Authenticated encryption state.
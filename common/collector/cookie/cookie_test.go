@@ -71,3 +71,22 @@ func TestIncrementNonce(t *testing.T) {
 		})
 	}
 }
+
+func TestDerive(t *testing.T) {
+	key := make([]byte, 16)
+	derived := Derive(key, "purpose")
+	if len(derived) != len(key) || bytes.Equal(derived, key) {
+		t.Fatalf("unexpected derived key: %x", derived)
+	}
+	if bytes.Equal(Derive(key, "other"), derived) {
+		t.Error("same key derived for different purposes")
+	}
+
+	c, err := New(derived)
+	if err != nil {
+		t.Fatal("new with derived key failed:", err)
+	}
+	if _, err = zero(t).Open(c.Create(data)); err == nil {
+		t.Error("cookie created with derived key opened with original key")
+	}
+}
@@ -0,0 +1,191 @@
+package cryptoutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Enumeration of public key algorithms for KeyAlgorithm.
+const (
+	RSA     = "rsa"
+	ECDSA   = "ecdsa"
+	Ed25519 = "ed25519"
+)
+
+// KeyAlgorithm is an allowed public key algorithm with a minimum key size.
+type KeyAlgorithm struct {
+	Algorithm string // One of RSA, ECDSA, or Ed25519.
+	MinSize   uint64 // Minimum key size in bits. Not checked for Ed25519.
+}
+
+// CertificateConstraints contains allow-lists which certificates must satisfy
+// in addition to chaining to trusted roots, e.g., to only accept personal
+// certificates and not organization certificates issued by the same
+// certification authority. Empty allow-lists are not checked.
+type CertificateConstraints struct {
+	// Policies are the dotted-decimal object identifiers of allowed
+	// certificate policies. The certificate must assert at least one.
+	Policies []string
+
+	// ExtKeyUsages are the dotted-decimal object identifiers of allowed
+	// extended key usages. The certificate must contain at least one.
+	ExtKeyUsages []string
+
+	// KeyAlgorithms are the allowed public key algorithms.
+	KeyAlgorithms []KeyAlgorithm
+}
+
+// CertificateChecker checks certificates against parsed
+// CertificateConstraints. A nil CertificateChecker accepts all certificates.
+type CertificateChecker struct {
+	policies []asn1.ObjectIdentifier
+	ekus     []asn1.ObjectIdentifier
+	keys     map[string]int // Map from algorithm to minimum size.
+}
+
+// oidExtKeyUsage is the object identifier of the extended key usage
+// certificate extension.
+var oidExtKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+
+// NewCertificateChecker parses c and returns a checker for it. If c contains
+// no constraints, then the returned checker is nil.
+func NewCertificateChecker(c *CertificateConstraints) (checker *CertificateChecker, err error) {
+	if c == nil || len(c.Policies)+len(c.ExtKeyUsages)+len(c.KeyAlgorithms) == 0 {
+		return nil, nil
+	}
+
+	checker = new(CertificateChecker)
+	if checker.policies, err = parseOIDs(c.Policies); err != nil {
+		return nil, ParsePolicyError{Err: err}
+	}
+	if checker.ekus, err = parseOIDs(c.ExtKeyUsages); err != nil {
+		return nil, ParseExtKeyUsageError{Err: err}
+	}
+	if len(c.KeyAlgorithms) > 0 {
+		checker.keys = make(map[string]int)
+		for _, k := range c.KeyAlgorithms {
+			switch k.Algorithm {
+			case RSA, ECDSA, Ed25519:
+			default:
+				return nil, UnsupportedKeyAlgorithmError{Algorithm: k.Algorithm}
+			}
+			if _, ok := checker.keys[k.Algorithm]; ok {
+				return nil, DuplicateKeyAlgorithmError{Algorithm: k.Algorithm}
+			}
+			checker.keys[k.Algorithm] = int(k.MinSize)
+		}
+	}
+	return checker, nil
+}
+
+// parseOIDs parses dotted-decimal object identifiers.
+func parseOIDs(dotted []string) (oids []asn1.ObjectIdentifier, err error) {
+	for _, d := range dotted {
+		arcs := strings.Split(d, ".")
+		if len(arcs) < 2 {
+			return nil, OIDArcCountError{OID: d}
+		}
+		oid := make(asn1.ObjectIdentifier, len(arcs))
+		for i, arc := range arcs {
+			if oid[i], err = strconv.Atoi(arc); err != nil || oid[i] < 0 {
+				return nil, ParseOIDError{OID: d, Err: err}
+			}
+		}
+		oids = append(oids, oid)
+	}
+	return
+}
+
+// Check checks that cert satisfies the constraints.
+func (c *CertificateChecker) Check(cert *x509.Certificate) error {
+	if c == nil {
+		return nil
+	}
+
+	if len(c.policies) > 0 && !containsAny(cert.PolicyIdentifiers, c.policies) {
+		return PolicyNotAllowedError{Policies: oidStrings(cert.PolicyIdentifiers)}
+	}
+
+	if len(c.ekus) > 0 {
+		ekus, err := extKeyUsages(cert)
+		if err != nil {
+			return err
+		}
+		if !containsAny(ekus, c.ekus) {
+			return ExtKeyUsageNotAllowedError{ExtKeyUsages: oidStrings(ekus)}
+		}
+	}
+
+	if c.keys != nil {
+		algorithm, size := keyAlgorithm(cert)
+		minSize, ok := c.keys[algorithm]
+		if !ok {
+			return KeyAlgorithmNotAllowedError{Algorithm: algorithm}
+		}
+		if algorithm != Ed25519 && size < minSize {
+			return KeySizeTooSmallError{Algorithm: algorithm, Size: size, Min: minSize}
+		}
+	}
+	return nil
+}
+
+// extKeyUsages returns the object identifiers of the extended key usages of
+// cert. The raw extension is used, because x509.Certificate only lists
+// unknown extended key usages as object identifiers.
+func extKeyUsages(cert *x509.Certificate) (ekus []asn1.ObjectIdentifier, err error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidExtKeyUsage) {
+			continue
+		}
+		rest, err := asn1.Unmarshal(ext.Value, &ekus)
+		if err != nil {
+			return nil, UnmarshalExtKeyUsageError{Err: err}
+		}
+		if len(rest) > 0 {
+			return nil, ExtKeyUsageTrailingDataError{Rest: rest}
+		}
+		break
+	}
+	return
+}
+
+// keyAlgorithm returns the public key algorithm and size in bits of cert.
+func keyAlgorithm(cert *x509.Certificate) (algorithm string, size int) {
+	switch k := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return RSA, k.N.BitLen()
+	case *ecdsa.PublicKey:
+		return ECDSA, k.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		return Ed25519, 256
+	default:
+		return fmt.Sprintf("%T", k), 0
+	}
+}
+
+// containsAny checks if any of oids is in allowed.
+func containsAny(oids, allowed []asn1.ObjectIdentifier) bool {
+	for _, oid := range oids {
+		for _, a := range allowed {
+			if oid.Equal(a) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// oidStrings returns the dotted-decimal strings of oids.
+func oidStrings(oids []asn1.ObjectIdentifier) []string {
+	strs := make([]string, len(oids))
+	for i, oid := range oids {
+		strs[i] = oid.String()
+	}
+	return strs
+}
@@ -0,0 +1,109 @@
+package cryptoutil
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+)
+
+// certificate creates a self-signed certificate with the policies and
+// extended key usages.
+func certificate(t *testing.T, key crypto.Signer, policies []asn1.ObjectIdentifier,
+	ekus []x509.ExtKeyUsage) *x509.Certificate {
+
+	template := &x509.Certificate{
+		SerialNumber:      big.NewInt(1),
+		NotBefore:         time.Now(),
+		NotAfter:          time.Now().Add(time.Hour),
+		PolicyIdentifiers: policies,
+		ExtKeyUsage:       ekus,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("failed to parse certificate:", err)
+	}
+	return cert
+}
+
+func TestCertificateChecker(t *testing.T) {
+	if checker, err := NewCertificateChecker(&CertificateConstraints{}); err != nil || checker != nil {
+		t.Fatalf("unexpected checker for empty constraints: %v, %v", checker, err)
+	}
+
+	checker, err := NewCertificateChecker(&CertificateConstraints{
+		Policies:     []string{"1.3.6.1.4.1.51361.1.1.1"},
+		ExtKeyUsages: []string{"1.3.6.1.5.5.7.3.2"}, // Client authentication.
+		KeyAlgorithms: []KeyAlgorithm{
+			{Algorithm: ECDSA, MinSize: 384},
+			{Algorithm: Ed25519},
+		},
+	})
+	if err != nil {
+		t.Fatal("failed to create checker:", err)
+	}
+
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate P-384 key:", err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate P-256 key:", err)
+	}
+	_, ed, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate Ed25519 key:", err)
+	}
+
+	personal := []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 51361, 1, 1, 1}, {0, 4, 0, 2042, 1, 2}}
+	organization := []asn1.ObjectIdentifier{{1, 3, 6, 1, 4, 1, 51361, 1, 2, 1}}
+	clientAuth := []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	emailProtection := []x509.ExtKeyUsage{x509.ExtKeyUsageEmailProtection}
+
+	for _, test := range []struct {
+		name     string
+		cert     *x509.Certificate
+		expected error // nil if the certificate is accepted.
+	}{
+		{"ecdsa", certificate(t, p384, personal, clientAuth), nil},
+		{"ed25519", certificate(t, ed, personal, clientAuth), nil},
+		{"policy", certificate(t, p384, organization, clientAuth), new(PolicyNotAllowedError)},
+		{"no policy", certificate(t, p384, nil, clientAuth), new(PolicyNotAllowedError)},
+		{"eku", certificate(t, p384, personal, emailProtection), new(ExtKeyUsageNotAllowedError)},
+		{"key size", certificate(t, p256, personal, clientAuth), new(KeySizeTooSmallError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := checker.Check(test.cert)
+			switch {
+			case test.expected == nil && err != nil:
+				t.Error("unexpected error:", err)
+			case test.expected != nil && errors.CausedBy(err, test.expected) == nil:
+				t.Errorf("unexpected error: %v, want %T", err, test.expected)
+			}
+		})
+	}
+
+	for _, bad := range []CertificateConstraints{
+		{Policies: []string{"1"}},
+		{ExtKeyUsages: []string{"1.3.a"}},
+		{KeyAlgorithms: []KeyAlgorithm{{Algorithm: "dsa"}}},
+		{KeyAlgorithms: []KeyAlgorithm{{Algorithm: RSA}, {Algorithm: RSA}}},
+	} {
+		if _, err := NewCertificateChecker(&bad); err == nil {
+			t.Errorf("unexpected success for constraints %+v", bad)
+		}
+	}
+}
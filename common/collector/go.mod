@@ -3,6 +3,7 @@ module ivxv.ee/common/collector
 go 1.21
 
 require (
+	go.etcd.io/bbolt v1.3.8
 	go.etcd.io/etcd/api/v3 v3.5.9
 	go.etcd.io/etcd/client/v3 v3.5.9
 	google.golang.org/grpc v1.58.2
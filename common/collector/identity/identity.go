@@ -6,6 +6,7 @@ package identity
 
 import (
 	"crypto/x509/pkix"
+	"regexp"
 	"strings"
 	"sync"
 )
@@ -18,8 +19,13 @@ const (
 	CommonName   Type = "commonname"   // Built-in.
 	SerialNumber Type = "serialnumber" // Built-in.
 	PNOEE        Type = "pnoee"        // Built-in.
+	ETSI         Type = "etsi"         // Built-in.
 )
 
+// In addition to the enumerated types, Get also accepts types consisting of a
+// natural person semantics identifier type and country code, e.g., "pnolv" or
+// "idcde", which extract identifiers with that prefix. See semantics.
+
 // Identifier is the type of functions that extract unique identifiers from
 // Distinguished Names. Identifier must be safe for concurrent use.
 type Identifier func(*pkix.Name) (string, error)
@@ -30,6 +36,7 @@ var (
 		CommonName:   commonName,
 		SerialNumber: serialNumber,
 		PNOEE:        pnoee,
+		ETSI:         etsi,
 	}
 )
 
@@ -47,7 +54,9 @@ func Get(t Type) (i Identifier, err error) {
 	defer reglock.RUnlock()
 	i, ok := registry[t]
 	if !ok {
-		return nil, UnlinkedTypeError{Type: t}
+		if i, ok = semantics(t); !ok {
+			return nil, UnlinkedTypeError{Type: t}
+		}
 	}
 	return i, nil
 }
@@ -86,3 +95,53 @@ func pnoee(name *pkix.Name) (id string, err error) {
 	id, err = serialNumber(name)
 	return strings.TrimPrefix(id, "PNOEE-"), err
 }
+
+// etsire matches natural person semantics identifiers in accordance with ETSI
+// EN 319 412-1 section 5.1.3: a three character identity type reference, a
+// two character ISO 3166 country code, a hyphen, and the identifier.
+var etsire = regexp.MustCompile(`^(PNO|IDC|PAS)([A-Z]{2})-(.+)$`)
+
+// etsi returns the SerialNumber from a Distinguished Name after checking that
+// it is a natural person semantics identifier based on a national personal
+// number (PNO), national identity card number (IDC), or passport number (PAS)
+// from any country. The whole semantics identifier is returned, so that
+// identifiers from different countries and documents do not collide.
+func etsi(name *pkix.Name) (id string, err error) {
+	if name == nil {
+		return "", ETSIEmptyDNError{}
+	}
+	if id, err = serialNumber(name); err != nil {
+		return "", err
+	}
+	if !etsire.MatchString(id) {
+		return "", ETSIInvalidFormatError{}
+	}
+	return id, nil
+}
+
+// semanticsre matches identity types of semantics identifiers with a fixed
+// identity type reference and country code.
+var semanticsre = regexp.MustCompile(`^(pno|idc|pas)[a-z]{2}$`)
+
+// semantics returns an Identifier for type t if it consists of a natural
+// person semantics identifier type reference and country code, e.g., "pnolv".
+// The Identifier requires the SerialNumber to have the corresponding prefix,
+// e.g., "PNOLV-", and returns the SerialNumber with the prefix removed.
+func semantics(t Type) (i Identifier, ok bool) {
+	if !semanticsre.MatchString(string(t)) {
+		return nil, false
+	}
+	prefix := strings.ToUpper(string(t)) + "-"
+	return func(name *pkix.Name) (id string, err error) {
+		if name == nil {
+			return "", SemanticsEmptyDNError{Prefix: prefix}
+		}
+		if id, err = serialNumber(name); err != nil {
+			return "", err
+		}
+		if !strings.HasPrefix(id, prefix) || len(id) == len(prefix) {
+			return "", SemanticsPrefixError{Prefix: prefix}
+		}
+		return strings.TrimPrefix(id, prefix), nil
+	}, true
+}
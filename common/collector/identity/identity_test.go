@@ -0,0 +1,55 @@
+package identity
+
+import (
+	"crypto/x509/pkix"
+	"testing"
+)
+
+func TestSemantics(t *testing.T) {
+	tests := []struct {
+		t      Type
+		serial string
+		id     string // Empty if extraction must fail.
+	}{
+		{ETSI, "PNOLV-010190-12345", "PNOLV-010190-12345"},
+		{ETSI, "IDCBE-590330101", "IDCBE-590330101"},
+		{ETSI, "PASFI-XP8271602", "PASFI-XP8271602"},
+		{ETSI, "TINDE-123456789", ""},
+		{ETSI, "PNOlv-010190-12345", ""},
+		{ETSI, "PNOLV-", ""},
+		{ETSI, "38001085718", ""},
+
+		{"pnolv", "PNOLV-010190-12345", "010190-12345"},
+		{"pnolv", "PNOLT-38001085718", ""},
+		{"pnolv", "PNOLV-", ""},
+		{"idcbe", "IDCBE-590330101", "590330101"},
+		{"pasfi", "PASFI-XP8271602", "XP8271602"},
+
+		{PNOEE, "PNOEE-38001085718", "38001085718"},
+		{PNOEE, "38001085718", "38001085718"},
+	}
+
+	for _, test := range tests {
+		t.Run(string(test.t)+" "+test.serial, func(t *testing.T) {
+			i, err := Get(test.t)
+			if err != nil {
+				t.Fatal("failed to get identifier:", err)
+			}
+			id, err := i(&pkix.Name{SerialNumber: test.serial})
+			switch {
+			case len(test.id) == 0 && err == nil:
+				t.Errorf("unexpected identifier %q, want error", id)
+			case len(test.id) > 0 && err != nil:
+				t.Error("unexpected error:", err)
+			case id != test.id:
+				t.Errorf("unexpected identifier: got %q, want %q", id, test.id)
+			}
+		})
+	}
+
+	for _, bad := range []Type{"pno", "pnolva", "tinee", "PNOLV"} {
+		if _, err := Get(bad); err == nil {
+			t.Errorf("unexpected identifier for type %q", bad)
+		}
+	}
+}
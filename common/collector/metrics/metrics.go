@@ -0,0 +1,291 @@
+/*
+Package metrics provides counters and histograms which are exposed in the
+Prometheus text exposition format.
+
+Metrics are created with NewCounter and NewHistogram, which register them in a
+process-wide registry. They are intended to be created once during package
+initialization, e.g., as package-level variables. All registered metrics are
+written out by Write or served over HTTP by Handler.
+*/
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// metric is a registered metric family.
+type metric interface {
+	// write writes the metric family in the text exposition format.
+	write(w *bufio.Writer)
+}
+
+var (
+	reglock  sync.Mutex
+	registry = make(map[string]metric)
+)
+
+// register registers m with name. It panics if the name is already taken,
+// since that is a programmer error.
+func register(name string, m metric) {
+	reglock.Lock()
+	defer reglock.Unlock()
+	if _, ok := registry[name]; ok {
+		panic("metrics: duplicate metric " + name)
+	}
+	registry[name] = m
+}
+
+// family contains the fields common to all metric families.
+type family struct {
+	name   string
+	help   string
+	labels []string
+}
+
+// key returns the map key for the label values. It panics if the number of
+// values does not match the number of labels, since that is a programmer
+// error.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values",
+			f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// header writes the HELP and TYPE lines of the family.
+func (f *family) header(w *bufio.Writer, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, typ)
+}
+
+// sample writes a single sample line. extra are additional label name-value
+// pairs appended after the family labels.
+func (f *family) sample(w *bufio.Writer, suffix string, values []string, value float64,
+	extra ...string) {
+
+	w.WriteString(f.name)
+	w.WriteString(suffix)
+	if len(values)+len(extra) > 0 {
+		w.WriteByte('{')
+		sep := ""
+		write := func(name, value string) {
+			fmt.Fprintf(w, `%s%s="%s"`, sep, name, escapeValue(value))
+			sep = ","
+		}
+		for i, label := range f.labels {
+			write(label, values[i])
+		}
+		for i := 0; i+1 < len(extra); i += 2 {
+			write(extra[i], extra[i+1])
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+// Counter is a family of monotonically increasing counters partitioned by
+// label values.
+type Counter struct {
+	family
+	lock   sync.Mutex
+	values map[string]*counterValue
+}
+
+type counterValue struct {
+	labels []string
+	count  uint64
+}
+
+// NewCounter creates and registers a new counter family with the given name,
+// help text, and label names.
+func NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{
+		family: family{name: name, help: help, labels: labels},
+		values: make(map[string]*counterValue),
+	}
+	register(name, c)
+	return c
+}
+
+// Inc increments the counter with the given label values by one. The number
+// of values must match the number of labels of the family.
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter with the given label values by n.
+func (c *Counter) Add(n uint64, values ...string) {
+	key := c.key(values)
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	v, ok := c.values[key]
+	if !ok {
+		v = &counterValue{labels: append([]string(nil), values...)}
+		c.values[key] = v
+	}
+	v.count += n
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.header(w, "counter")
+	for _, key := range sortedKeys(c.values) {
+		v := c.values[key]
+		c.sample(w, "", v.labels, float64(v.count))
+	}
+}
+
+// DefaultBuckets are the default histogram bucket upper bounds in seconds.
+// They cover both fast local operations and slow external requests.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// Histogram is a family of histograms partitioned by label values.
+type Histogram struct {
+	family
+	buckets []float64
+	lock    sync.Mutex
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	labels []string
+	counts []uint64 // Non-cumulative counts per bucket.
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram creates and registers a new histogram family with the given
+// name, help text, bucket upper bounds, and label names. If buckets is nil,
+// then DefaultBuckets are used.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: unsorted buckets for " + name)
+	}
+	h := &Histogram{
+		family:  family{name: name, help: help, labels: labels},
+		buckets: buckets,
+		values:  make(map[string]*histogramValue),
+	}
+	register(name, h)
+	return h
+}
+
+// Observe adds an observation to the histogram with the given label values.
+func (h *Histogram) Observe(value float64, values ...string) {
+	key := h.key(values)
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{
+			labels: append([]string(nil), values...),
+			counts: make([]uint64, len(h.buckets)),
+		}
+		h.values[key] = v
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		v.counts[i]++
+	}
+	v.count++
+	v.sum += value
+}
+
+// Since observes the number of seconds elapsed since start. It is intended to
+// be deferred at the start of the measured operation.
+func (h *Histogram) Since(start time.Time, values ...string) {
+	h.Observe(time.Since(start).Seconds(), values...)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.header(w, "histogram")
+	for _, key := range sortedKeys(h.values) {
+		v := h.values[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += v.counts[i]
+			h.sample(w, "_bucket", v.labels, float64(cumulative), "le", formatFloat(bound))
+		}
+		h.sample(w, "_bucket", v.labels, float64(v.count), "le", "+Inf")
+		h.sample(w, "_sum", v.labels, v.sum)
+		h.sample(w, "_count", v.labels, float64(v.count))
+	}
+}
+
+// Write writes all registered metrics to w in the Prometheus text exposition
+// format, ordered by name.
+func Write(w io.Writer) error {
+	reglock.Lock()
+	names := sortedKeys(registry)
+	metrics := make([]metric, len(names))
+	for i, name := range names {
+		metrics[i] = registry[name]
+	}
+	reglock.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler returns a HTTP handler which serves all registered metrics.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Write(w) //nolint:errcheck // Nothing to do if the client went away.
+	})
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	valueEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeValue(s string) string { return valueEscaper.Replace(s) }
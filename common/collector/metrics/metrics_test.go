@@ -0,0 +1,50 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests\nhandled.", "method", "error")
+	c.Inc("Vote", "")
+	c.Inc("Vote", "")
+	c.Add(3, "Verify", `BAD "REQUEST"`)
+
+	h := NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 1}, "method")
+	h.Observe(0.05, "Vote")
+	h.Observe(0.5, "Vote")
+	h.Observe(5, "Vote")
+
+	var b bytes.Buffer
+	if err := Write(&b); err != nil {
+		t.Fatal("write error:", err)
+	}
+
+	expected := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{method="Vote",le="0.1"} 1
+test_duration_seconds_bucket{method="Vote",le="1"} 2
+test_duration_seconds_bucket{method="Vote",le="+Inf"} 3
+test_duration_seconds_sum{method="Vote"} 5.55
+test_duration_seconds_count{method="Vote"} 3
+# HELP test_requests_total Requests\nhandled.
+# TYPE test_requests_total counter
+test_requests_total{method="Verify",error="BAD \"REQUEST\""} 3
+test_requests_total{method="Vote",error=""} 2
+`
+	if got := b.String(); !strings.Contains(got, expected) {
+		t.Errorf("unexpected output:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestLabelCountMismatch(t *testing.T) {
+	c := NewCounter("test_mismatch_total", "Mismatch.", "a")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic on label count mismatch")
+		}
+	}()
+	c.Inc("a", "b")
+}
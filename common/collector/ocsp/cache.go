@@ -0,0 +1,160 @@
+package ocsp
+
+import (
+	"container/list"
+	"context"
+	"crypto/x509"
+	"sync"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/metrics"
+)
+
+var (
+	cacheLookups = metrics.NewCounter("ivxv_ocsp_cache_lookups_total",
+		"Number of OCSP response cache lookups, by result.", "result")
+	cachePrefetches = metrics.NewCounter("ivxv_ocsp_cache_prefetches_total",
+		"Number of OCSP responses pre-fetched to refresh cached responses, by result.",
+		"result")
+)
+
+// cache is a bounded least-recently-used cache of OCSP responses keyed by the
+// certificate identifier.
+type cache struct {
+	size   int
+	maxAge time.Duration
+
+	lock    sync.Mutex
+	order   *list.List // Of *cacheEntry, most recently used first.
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	key        string
+	status     *LiveCertStatus
+	refreshing bool // Is a pre-fetch for this entry in progress?
+}
+
+func newCache(size uint64, maxAge time.Duration) *cache {
+	return &cache{
+		size:    int(size),
+		maxAge:  maxAge,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// cacheKey returns the cache key for the certificate identifier.
+func cacheKey(id *certID) string {
+	return string(id.IssuerNameHash) + "\x00" + string(id.IssuerKeyHash) +
+		"\x00" + id.SerialNumber.Text(16)
+}
+
+// get returns the cached status for key if it is still fresh at now. If the
+// status is older than half of the maximum age and no pre-fetch is in progress
+// yet, then prefetch is also true and the caller should refresh the status.
+func (c *cache) get(key string, now time.Time) (status *LiveCertStatus, prefetch bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	age := now.Sub(entry.status.ThisUpdate)
+	if age > c.maxAge {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	if age > c.maxAge/2 && !entry.refreshing {
+		entry.refreshing = true
+		prefetch = true
+	}
+	return entry.status, prefetch
+}
+
+// put stores status for key, evicting the least recently used entry if the
+// cache is full.
+func (c *cache) put(key string, status *LiveCertStatus) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = &cacheEntry{key: key, status: status}
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cacheEntry{key: key, status: status})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// refreshed marks a pre-fetch for key as finished without updating the entry.
+func (c *cache) refreshed(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*cacheEntry).refreshing = false
+	}
+}
+
+// CheckCached checks the status of the certificate like Check without a nonce,
+// but if the client has a response cache configured, then it reuses cached
+// responses which are still within the maximum age. Responses which are older
+// than half of the maximum age are refreshed in the background.
+//
+// CheckCached must only be used where a fresh response is not required, e.g.,
+// for checking authentication certificates: qualifying properties for votes
+// must always be requested using Check.
+func (c *Client) CheckCached(ctx context.Context, cert, issuer *x509.Certificate) (
+	status *LiveCertStatus, err error) {
+
+	if c.cache == nil {
+		return c.Check(ctx, cert, issuer, nil)
+	}
+
+	reqCert, err := newCertID(cert)
+	if err != nil {
+		return nil, CacheCertIDCreateError{Err: err}
+	}
+	key := cacheKey(reqCert)
+
+	status, prefetch := c.cache.get(key, time.Now())
+	if status == nil {
+		cacheLookups.Inc("miss")
+		if status, err = c.Check(ctx, cert, issuer, nil); err != nil {
+			return nil, err
+		}
+		c.cache.put(key, status)
+		return status, nil
+	}
+
+	cacheLookups.Inc("hit")
+	log.Log(ctx, CachedResponse{
+		Serial:     reqCert.SerialNumber,
+		ThisUpdate: status.ThisUpdate,
+	})
+	if prefetch {
+		// Do not cancel the pre-fetch when the current request ends.
+		go c.prefetch(context.WithoutCancel(ctx), key, cert, issuer)
+	}
+	return status, nil
+}
+
+// prefetch refreshes the cached status for key.
+func (c *Client) prefetch(ctx context.Context, key string, cert, issuer *x509.Certificate) {
+	status, err := c.Check(ctx, cert, issuer, nil)
+	if err != nil {
+		cachePrefetches.Inc("error")
+		log.Error(ctx, PrefetchError{Err: err})
+		c.cache.refreshed(key)
+		return
+	}
+	cachePrefetches.Inc("ok")
+	c.cache.put(key, status)
+}
@@ -0,0 +1,48 @@
+package ocsp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Now()
+	c := newCache(2, time.Minute)
+	status := func(age time.Duration) *LiveCertStatus {
+		return &LiveCertStatus{CertStatus: CertStatus{ThisUpdate: now.Add(-age)}}
+	}
+
+	c.put("fresh", status(0))
+	c.put("old", status(45*time.Second))
+	if s, prefetch := c.get("fresh", now); s == nil || prefetch {
+		t.Errorf("fresh: unexpected status %v or prefetch %t", s, prefetch)
+	}
+
+	// Only the first lookup of an old response must request a pre-fetch.
+	if s, prefetch := c.get("old", now); s == nil || !prefetch {
+		t.Errorf("old: unexpected status %v or prefetch %t", s, prefetch)
+	}
+	if _, prefetch := c.get("old", now); prefetch {
+		t.Error("old: duplicate prefetch")
+	}
+	c.refreshed("old")
+	if _, prefetch := c.get("old", now); !prefetch {
+		t.Error("old: no prefetch after failed refresh")
+	}
+
+	// Expired responses must not be returned.
+	if s, _ := c.get("old", now.Add(time.Minute)); s != nil {
+		t.Error("old: expired response returned")
+	}
+
+	// Least recently used responses must be evicted.
+	c.put("old", status(0))
+	c.get("fresh", now)
+	c.put("new", status(0))
+	if s, _ := c.get("old", now); s != nil {
+		t.Error("old: not evicted")
+	}
+	if s, _ := c.get("fresh", now); s == nil {
+		t.Error("fresh: evicted")
+	}
+}
@@ -17,6 +17,7 @@ import (
 	"strings"
 	"time"
 
+	"ivxv.ee/common/collector/breaker"
 	"ivxv.ee/common/collector/cryptoutil"
 	"ivxv.ee/common/collector/errors"
 	"ivxv.ee/common/collector/log"
@@ -57,6 +58,14 @@ type Conf struct {
 	URL        string
 	Responders []string
 
+	// Endpoints are additional OCSP servers which requests fail over to,
+	// in the listed order, if requests to URL fail.
+	Endpoints []Endpoint
+
+	// Breaker configures the circuit breakers used for skipping failing
+	// OCSP servers.
+	Breaker breaker.Conf
+
 	// Retry is the amount of times an OCSP request is retried in case of
 	// network or responder errors.
 	Retry uint64
@@ -66,21 +75,38 @@ type Conf struct {
 
 	// MaxAge in minutes, if 0 then defaults to 1 minute.
 	MaxAge uint64
+
+	// CacheSize is the maximum number of responses cached for reuse by
+	// CheckCached. If 0, then responses are not cached.
+	CacheSize uint64
 }
 
-// Client is used for performing OCSP requests and checking responses.
-type Client struct {
+// Endpoint is the configuration of an additional OCSP server.
+type Endpoint struct {
+	URL        string
+	Responders []string // Responder certificates of this server.
+}
+
+// endpoint is a configured OCSP server.
+type endpoint struct {
 	url        string
 	responders []*x509.Certificate
+	breaker    *breaker.Breaker
+}
+
+// Client is used for performing OCSP requests and checking responses.
+type Client struct {
+	endpoints  []*endpoint
+	responders []*x509.Certificate // Responders of all endpoints.
 	retry      uint64
 	maxSkew    time.Duration
 	maxAge     time.Duration
+	cache      *cache
 }
 
 // New returns a new OCSP client with the provided configuration.
 func New(conf *Conf) (c *Client, err error) {
 	c = &Client{
-		url:     conf.URL,
 		retry:   conf.Retry,
 		maxSkew: time.Duration(conf.MaxSkew) * time.Millisecond,
 		maxAge:  time.Duration(conf.MaxAge) * time.Minute,
@@ -91,8 +117,29 @@ func New(conf *Conf) (c *Client, err error) {
 	if conf.MaxAge <= 0 {
 		c.maxAge = maxAge
 	}
-	if c.responders, err = cryptoutil.PEMCertificates(conf.Responders...); err != nil {
-		return nil, ResponderParsingError{Err: err}
+	if conf.CacheSize > 0 {
+		c.cache = newCache(conf.CacheSize, c.maxAge)
+	}
+	endpoints := append([]Endpoint{{URL: conf.URL, Responders: conf.Responders}},
+		conf.Endpoints...)
+	for i, e := range endpoints {
+		responders, err := cryptoutil.PEMCertificates(e.Responders...)
+		if err != nil {
+			return nil, ResponderParsingError{Endpoint: i, Err: err}
+		}
+		c.responders = append(c.responders, responders...)
+
+		if len(e.URL) == 0 {
+			if i > 0 {
+				return nil, UnconfiguredEndpointURLError{Endpoint: i}
+			}
+			continue // Only checking stored responses with responders.
+		}
+		c.endpoints = append(c.endpoints, &endpoint{
+			url:        e.URL,
+			responders: responders,
+			breaker:    breaker.New(conf.Breaker, e.URL),
+		})
 	}
 	return
 }
@@ -101,6 +148,7 @@ func New(conf *Conf) (c *Client, err error) {
 // relevant information about the OCSP response.
 type CertStatus struct {
 	ProducedAt       time.Time // The time this response was produced at.
+	ThisUpdate       time.Time // The time at which the status was known to be correct.
 	Nonce            []byte    // The nonce used in the response
 	Good             bool      // Is the status of the requested certificate good?
 	Unknown          bool      // Is the status of the certificate unknown
@@ -116,11 +164,15 @@ type LiveCertStatus struct {
 
 // Check checks the status of the certificate against the configured OCSP
 // server. If nonce is not nil, then that value will be used as the nonce in
-// the request, otherwise no nonce is used.
+// the request, otherwise no nonce is used. Check always performs a live
+// request, see CheckCached for reusing responses.
+//
+// If requests to an OCSP server fail, then they fail over to the next
+// configured server. Servers with open circuit breakers are skipped.
 func (c *Client) Check(ctx context.Context, cert, issuer *x509.Certificate, nonce []byte) (
 	status *LiveCertStatus, err error) {
 
-	if len(c.url) == 0 {
+	if len(c.endpoints) == 0 {
 		return nil, UnconfiguredURLError{}
 	}
 
@@ -131,11 +183,12 @@ func (c *Client) Check(ctx context.Context, cert, issuer *x509.Certificate, nonc
 	}
 
 	// Submit the request to url and read the response.
+	var e *endpoint
 	var resp []byte
 	var basic *basicOCSPResponse
 retry:
 	for attempt := uint64(0); ; attempt++ {
-		switch resp, basic, err = c.submitRequest(ctx, reqCert, nonce); {
+		switch e, resp, basic, err = c.submit(ctx, reqCert, nonce); {
 		case err == nil:
 			break retry
 		case attempt < c.retry && shouldRetry(err):
@@ -147,7 +200,7 @@ retry:
 	}
 
 	// Check response.
-	respNonce, err := c.checkResponse(basic, reqCert, issuer, nonce)
+	respNonce, err := c.checkResponse(basic, reqCert, issuer, nonce, e.responders)
 	if err != nil {
 		return nil, CheckResponseError{Err: err}
 	}
@@ -159,6 +212,7 @@ retry:
 		RawResponse: resp,
 		CertStatus: CertStatus{
 			ProducedAt:       basic.TBSResponseData.ProducedAt,
+			ThisUpdate:       single.ThisUpdate,
 			Good:             bool(single.CertStatusGood),
 			Unknown:          bool(single.CertStatusUnknown),
 			Nonce:            respNonce,
@@ -167,6 +221,31 @@ retry:
 	}, nil
 }
 
+// submit submits the request to the first endpoint with a closed circuit
+// breaker. If the request fails with an error that should be retried, then it
+// fails over to the next endpoint. submit returns the endpoint which
+// responded.
+func (c *Client) submit(ctx context.Context, reqCert *certID, nonce []byte) (
+	e *endpoint, response []byte, basic *basicOCSPResponse, err error) {
+
+	err = NoAvailableEndpointError{}
+	for _, e = range c.endpoints {
+		if !e.breaker.Allow() {
+			log.Log(ctx, SkippingEndpoint{URL: e.url})
+			continue
+		}
+		response, basic, err = c.submitRequest(ctx, e.url, reqCert, nonce)
+		if err != nil && shouldRetry(err) {
+			e.breaker.Failure()
+			log.Log(ctx, EndpointFailed{URL: e.url, Err: err})
+			continue
+		}
+		e.breaker.Success()
+		return
+	}
+	return nil, nil, nil, err
+}
+
 func shouldRetry(err error) bool {
 	return errors.Walk(err, func(err error) error {
 		switch t := err.(type) {
@@ -237,6 +316,7 @@ func (c *Client) CheckResponse(response []byte, cert, issuer *x509.Certificate,
 
 	return &CertStatus{
 		ProducedAt:       basic.TBSResponseData.ProducedAt,
+		ThisUpdate:       single.ThisUpdate,
 		Good:             bool(single.CertStatusGood),
 		Unknown:          bool(single.CertStatusUnknown),
 		Nonce:            respNonce,
@@ -276,7 +356,7 @@ func ExtractProducedAtTimeFromRawOcspResponse(rawOcspResponse []byte) (time.Time
 	return basic.TBSResponseData.ProducedAt, nil
 }
 
-func (c *Client) submitRequest(ctx context.Context, reqCert *certID, nonce []byte) (
+func (c *Client) submitRequest(ctx context.Context, url string, reqCert *certID, nonce []byte) (
 	response []byte, basic *basicOCSPResponse, err error) {
 
 	r := ocspRequest{
@@ -298,7 +378,7 @@ func (c *Client) submitRequest(ctx context.Context, reqCert *certID, nonce []byt
 
 	var client http.Client
 
-	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewBuffer(req))
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(req))
 	if err != nil {
 		err = NewRequestError{Err: err}
 		return
@@ -314,7 +394,7 @@ func (c *Client) submitRequest(ctx context.Context, reqCert *certID, nonce []byt
 	log.Debug(ctx, RequestDebugDump{Request: string(reqDump)})
 
 	log.Log(ctx, SendingRequest{
-		URL:            c.url,
+		URL:            url,
 		Serial:         reqCert.SerialNumber,
 		IssuerNameHash: reqCert.IssuerNameHash,
 	})
@@ -409,12 +489,14 @@ func unmarshalResponse(der []byte, basic *basicOCSPResponse) (err error) {
 
 // checkResponse checks if the given response should be accepted.
 func (c *Client) checkResponse(resp *basicOCSPResponse,
-	cert *certID, issuer *x509.Certificate, nonce []byte) (
+	cert *certID, issuer *x509.Certificate, nonce []byte,
+	responders []*x509.Certificate) (
 	respNonce []byte, err error) {
 	var defaultTime time.Time
 
 	// Perform common checks.
-	if respNonce, err = c.checkResponseCommon(resp, cert, issuer, nonce, defaultTime); err != nil {
+	if respNonce, err = c.checkResponseCommon(resp, cert, issuer, nonce,
+		defaultTime, responders); err != nil {
 		return nil, CheckResponseCommonError{Err: err}
 	}
 
@@ -453,7 +535,8 @@ func (c *Client) checkStoredResponse(resp *basicOCSPResponse,
 	respNonce []byte, err error) {
 
 	// Perform common checks.
-	if respNonce, err = c.checkResponseCommon(resp, cert, issuer, nonce, sigTime); err != nil {
+	if respNonce, err = c.checkResponseCommon(resp, cert, issuer, nonce,
+		sigTime, c.responders); err != nil {
 		return nil, CheckStoredResponseCommonError{Err: err}
 	}
 
@@ -476,9 +559,11 @@ func (c *Client) checkStoredResponse(resp *basicOCSPResponse,
 }
 
 // checkResponseCommon performs checks on the basic response that are common
-// for fresh and stored responses.
+// for fresh and stored responses. responders are the trusted responder
+// certificates.
 func (c *Client) checkResponseCommon(resp *basicOCSPResponse,
-	cert *certID, issuer *x509.Certificate, nonce []byte, sigTime time.Time) (
+	cert *certID, issuer *x509.Certificate, nonce []byte, sigTime time.Time,
+	responders []*x509.Certificate) (
 	respNonce []byte, err error) {
 
 	// Compare certificate requested and in the response.
@@ -509,7 +594,7 @@ func (c *Client) checkResponseCommon(resp *basicOCSPResponse,
 	}
 
 	// Find responder certificate and check signature on the response.
-	responder, err := c.responder(resp, issuer, sigTime)
+	responder, err := c.responder(resp, issuer, sigTime, responders)
 	if err != nil {
 		return nil, ResponderCertificateError{Err: err}
 	}
@@ -528,13 +613,13 @@ func (c *Client) checkResponseCommon(resp *basicOCSPResponse,
 }
 
 func (c *Client) responder(resp *basicOCSPResponse, issuer *x509.Certificate,
-	sigTime time.Time) (
+	sigTime time.Time, responders []*x509.Certificate) (
 	*x509.Certificate, error) {
 
 	name := resp.TBSResponseData.ResponderIDByName
 
 	// First check if the response is signed by a configured responder.
-	for _, responder := range c.responders {
+	for _, responder := range responders {
 
 		responder.Subject.ExtraNames = responder.Subject.Names
 		if cryptoutil.RDNSequenceEqual(responder.Subject.ToRDNSequence(), name) {
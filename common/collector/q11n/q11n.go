@@ -13,6 +13,8 @@ import (
 	"time"
 
 	"ivxv.ee/common/collector/container"
+	"ivxv.ee/common/collector/metrics"
+	"ivxv.ee/common/collector/trace"
 	"ivxv.ee/common/collector/yaml"
 )
 
@@ -110,21 +112,48 @@ func Register(p Protocol, newFunc NewFunc, parseTimeFunc ParseTimeFunc) {
 type Conf []struct {
 	Protocol Protocol
 	Conf     yaml.Node
+
+	// Timeout is the number of seconds to wait for the qualifying
+	// property. 0 means that only the request context limits the wait.
+	Timeout int64
+
+	// After lists the protocols which must have returned their qualifying
+	// properties before this qualifier is run. Only protocols configured
+	// before this one can be listed. It is only used for concurrent
+	// qualification: otherwise each qualifier is run after the previous
+	// one. Qualifiers configured after TSPREG always depend on it, so
+	// that the registration request is stored first, and do not need to
+	// list it.
+	After []Protocol
 }
 
 // Qualifiers is a list of qualifiers in the same order they were presented in
 // the configuration. This is also the order in which the qualification
-// requests should be made.
+// requests should be made if they are made sequentially.
 type Qualifiers []struct {
 	Protocol  Protocol
 	Qualifier Qualifier
+	Timeout   time.Duration // Zero for no qualifier-specific timeout.
+
+	// After contains the indexes of qualifiers which must have returned
+	// their qualifying properties before this qualifier is run. The
+	// qualification times of their properties must also not be later than
+	// that of this qualifier.
+	After []int
 }
 
 // Configure configures a list of qualifier implementations specified in the
 // configuration. sensitive is the path to the service instance directory which
 // can contain sensitive information, e.g., request signing keys.
-func Configure(c Conf, sensitive string) (qs Qualifiers, err error) {
+//
+// If concurrent is true, then qualifiers depend only on the qualifiers listed
+// in their After configuration and on a TSPREG qualifier configured before
+// them, and Run can request independent qualifying properties concurrently.
+// Otherwise each qualifier depends on the previous one and Run requests
+// qualifying properties sequentially.
+func Configure(c Conf, concurrent bool, sensitive string) (qs Qualifiers, err error) {
 	qs = make(Qualifiers, len(c))
+	index := make(map[Protocol]int)
 
 	// For each configured implementation, ...
 	reglock.RLock()
@@ -135,17 +164,170 @@ func Configure(c Conf, sensitive string) (qs Qualifiers, err error) {
 		if !ok {
 			return nil, UnlinkedProtocolError{Protocol: p.Protocol}
 		}
+		if _, ok := index[p.Protocol]; ok {
+			return nil, DuplicateProtocolError{Protocol: p.Protocol}
+		}
+		index[p.Protocol] = i
 		qs[i].Protocol = p.Protocol
 
 		// ...and if creating the qualifier succeeds.
-		qs[i].Qualifier, err = entry.newQualifier(p.Conf, sensitive)
+		q, err := entry.newQualifier(p.Conf, sensitive)
 		if err != nil {
 			return nil, ConfigureProtocolError{Protocol: p.Protocol, Err: err}
 		}
+		qs[i].Qualifier = observed{q, p.Protocol}
+
+		if p.Timeout < 0 {
+			return nil, NegativeTimeoutError{Protocol: p.Protocol, Timeout: p.Timeout}
+		}
+		qs[i].Timeout = time.Duration(p.Timeout) * time.Second
+
+		// Resolve dependencies. Since only previously configured
+		// protocols can be depended on, there can be no cycles.
+		if !concurrent {
+			if i > 0 {
+				qs[i].After = []int{i - 1}
+			}
+			continue
+		}
+		for _, after := range p.After {
+			j, ok := index[after]
+			if !ok || j == i {
+				return nil, AfterUnknownProtocolError{
+					Protocol: p.Protocol,
+					After:    after,
+				}
+			}
+			qs[i].After = append(qs[i].After, j)
+		}
+
+		// The registration request must be stored before any other
+		// qualifying properties, so depend on it even if not listed.
+		if j, ok := index[TSPREG]; ok && j != i && !contains(qs[i].After, j) {
+			qs[i].After = append(qs[i].After, j)
+		}
 	}
 	return
 }
 
+// contains reports if indexes contains i.
+func contains(indexes []int, i int) bool {
+	for _, index := range indexes {
+		if index == i {
+			return true
+		}
+	}
+	return false
+}
+
+// Run requests qualifying properties for c from all qualifiers. Each
+// qualifier is run as soon as all qualifiers it depends on have returned, so
+// independent qualifiers are run concurrently.
+//
+// handle is called with each qualifying property as soon as it is returned,
+// before any dependent qualifiers are run. It is never called concurrently.
+//
+// If a qualifier or handle returns an error, then no new qualifiers are run,
+// the contexts of running qualifiers are cancelled, and the first error is
+// returned once they have returned. Qualifier errors are wrapped in
+// QualifierError.
+func (qs Qualifiers) Run(ctx context.Context, c container.Container,
+	handle func(Protocol, []byte) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		index    int
+		property []byte
+		err      error
+	}
+	results := make(chan result)
+	qualify := func(i int) {
+		qctx := ctx
+		if qs[i].Timeout > 0 {
+			var qcancel context.CancelFunc
+			qctx, qcancel = context.WithTimeout(ctx, qs[i].Timeout)
+			defer qcancel()
+		}
+		property, err := qs[i].Qualifier.Qualify(qctx, c)
+		results <- result{i, property, err}
+	}
+
+	// pending counts the unfinished dependencies of each qualifier.
+	pending := make([]int, len(qs))
+	for i, q := range qs {
+		pending[i] = len(q.After)
+	}
+
+	var running int
+	start := func() {
+		for i := range qs {
+			if pending[i] == 0 {
+				pending[i] = -1 // Mark as started.
+				running++
+				go qualify(i)
+			}
+		}
+	}
+
+	var err error
+	start()
+	for running > 0 {
+		r := <-results
+		running--
+		if err != nil {
+			continue // Wait for running qualifiers to return.
+		}
+
+		protocol := qs[r.index].Protocol
+		if r.err != nil {
+			err = QualifierError{Protocol: protocol, Err: r.err}
+		} else {
+			err = handle(protocol, r.property)
+		}
+		if err != nil {
+			cancel()
+			continue
+		}
+
+		for i, q := range qs {
+			for _, after := range q.After {
+				if after == r.index {
+					pending[i]--
+				}
+			}
+		}
+		start()
+	}
+	return err
+}
+
+var qualifyDuration = metrics.NewHistogram("ivxv_q11n_duration_seconds",
+	"Time taken to request qualifying properties.", nil, "protocol", "result")
+
+// observed wraps a Qualifier to record the duration of qualification requests
+// and trace them.
+type observed struct {
+	Qualifier
+	protocol Protocol
+}
+
+func (o observed) Qualify(ctx context.Context, c container.Container) (
+	property []byte, err error) {
+
+	ctx, span := trace.Start(ctx, "q11n.Qualify", "protocol", string(o.protocol))
+	defer func(start time.Time) {
+		result := "ok"
+		if err != nil {
+			result = "error"
+		}
+		qualifyDuration.Since(start, string(o.protocol), result)
+		span.Finish(err)
+	}(time.Now())
+	return o.Qualifier.Qualify(ctx, c)
+}
+
 // Properties is a map from qualifier protocols to qualifying properties. It is
 // a convenience type to be used outside of q11n to store the results of
 // qualification.
@@ -182,33 +364,32 @@ func CanonicalTime(properties Properties) (time.Time, error) {
 	return time.Time{}, nil // No canonical time protocol in properties.
 }
 
-// CompareQualificationTimes loops over all qualifiers, preconfigured via election.yml,
-// and compares that each previous properties[qualifier.Protocol] time is <= subsequent
-// properties[qualifier.Protocol] time.
+// CompareQualificationTimes checks that the qualification time of each
+// qualifying property in properties is not before the qualification times of
+// the properties of the qualifiers it depends on.
 //
-// For example qualifers={tspreg, ocsp}, then ensures that tspreg.Time <= ocsp.Time.
+// For example, if qualifiers are run sequentially and qualifers={tspreg,
+// ocsp}, then it ensures that tspreg.Time <= ocsp.Time.
 //
-// Another example qualifers={tspreg, tsp, ocsp}, then ensures that tspreg.Time <= tsp.Time,
-// tsp.Time <= ocsp.Time.
+// Another example, if qualifiers are run sequentially and
+// qualifers={tspreg, tsp, ocsp}, then it ensures that tspreg.Time <= tsp.Time,
+// tsp.Time <= ocsp.Time. If they are run concurrently and ocsp is configured
+// to run after tspreg, but tsp independently, then it only ensures that
+// tspreg.Time <= ocsp.Time.
 func CompareQualificationTimes(qualifiers Qualifiers, properties Properties) error {
 	reglock.RLock()
 	defer reglock.RUnlock()
 
-	// Default value is 0001-01-01 00:00:00 +0000 UTC
-	var qualificationTime time.Time
-
-	var qualificationProtocol Protocol
-
-	// Order of qualifiers does matter and is configurable in election.yml's
-	// section "qualification:", i.e
-	// qualification:
-	//   - protocol: tspreg
-	//     ...
-	//   - protocol: ocsp
-	//     ...
-	// Means that first qualifier is tspreg
-	for _, qualifier := range qualifiers {
+	// "qualification:" in election.yml is empty
+	if len(qualifiers) == 0 {
+		var noQualifiersErr NoPreconfiguredQualifiersError
+		return noQualifiersErr
+	}
 
+	// Parse all qualification times first, so that unparsable properties
+	// are detected even if they have no dependencies.
+	times := make([]time.Time, len(qualifiers))
+	for i, qualifier := range qualifiers {
 		entry, ok := registry[qualifier.Protocol]
 		if !ok {
 			return CompareQualificationTimesNoRegistryForProtocolError{
@@ -224,25 +405,20 @@ func CompareQualificationTimes(qualifiers Qualifiers, properties Properties) err
 				Protocol: qualifier.Protocol,
 				Err:      err}
 		}
-
-		// Ensure that previous qualification time is <= ctime
-		if qualificationTime.Before(ctime) || qualificationTime.Equal(ctime) {
-			qualificationTime = ctime
-			qualificationProtocol = qualifier.Protocol
-			continue
-		}
-		return CompareQualificationTimesQualificationTimeError{
-			CurrentProtocol:                   qualifier.Protocol,
-			CurrentProtocolQualificationTime:  ctime,
-			PreviousProtocol:                  qualificationProtocol,
-			PreviousProtocolQualificationTime: qualificationTime}
+		times[i] = ctime
 	}
 
-	// "qualification:" in election.yml is empty
-	if qualificationProtocol == "" {
-		var noQualifiersErr NoPreconfiguredQualifiersError
-		return noQualifiersErr
+	// Ensure that the qualification time of each dependency is <= ctime.
+	for i, qualifier := range qualifiers {
+		for _, j := range qualifier.After {
+			if times[j].After(times[i]) {
+				return CompareQualificationTimesQualificationTimeError{
+					CurrentProtocol:                   qualifier.Protocol,
+					CurrentProtocolQualificationTime:  times[i],
+					PreviousProtocol:                  qualifiers[j].Protocol,
+					PreviousProtocolQualificationTime: times[j]}
+			}
+		}
 	}
-
 	return nil
 }
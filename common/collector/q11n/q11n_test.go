@@ -0,0 +1,181 @@
+package q11n
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/container"
+	"ivxv.ee/common/collector/yaml"
+)
+
+// testQualifier returns its protocol as the qualifying property after delay
+// and records the order of returned qualifiers.
+type testQualifier struct {
+	protocol Protocol
+	delay    time.Duration
+	err      error
+
+	lock  *sync.Mutex
+	order *[]Protocol
+}
+
+func (q testQualifier) Qualify(ctx context.Context, _ container.Container) ([]byte, error) {
+	select {
+	case <-time.After(q.delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	q.lock.Lock()
+	*q.order = append(*q.order, q.protocol)
+	q.lock.Unlock()
+	return []byte(q.protocol), q.err
+}
+
+func testQualifiers(delays map[Protocol]time.Duration, after map[Protocol][]int) (
+	qs Qualifiers, order *[]Protocol) {
+
+	order = new([]Protocol)
+	lock := new(sync.Mutex)
+	for _, p := range []Protocol{TSPREG, TSP, OCSP} {
+		qs = append(qs, Qualifiers{{
+			Protocol:  p,
+			Qualifier: testQualifier{protocol: p, delay: delays[p], lock: lock, order: order},
+			After:     after[p],
+		}}...)
+	}
+	return
+}
+
+func TestRun(t *testing.T) {
+	delays := map[Protocol]time.Duration{
+		TSPREG: 20 * time.Millisecond,
+		TSP:    10 * time.Millisecond,
+	}
+
+	tests := []struct {
+		name     string
+		after    map[Protocol][]int
+		expected []Protocol
+	}{
+		{"sequential", map[Protocol][]int{TSP: {0}, OCSP: {1}}, []Protocol{TSPREG, TSP, OCSP}},
+		{"concurrent", nil, []Protocol{OCSP, TSP, TSPREG}},
+		{"dependent", map[Protocol][]int{OCSP: {0}}, []Protocol{TSP, TSPREG, OCSP}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			qs, order := testQualifiers(delays, test.after)
+			properties := make(Properties)
+			err := qs.Run(context.Background(), nil, func(p Protocol, prop []byte) error {
+				properties[p] = prop
+				return nil
+			})
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			if len(properties) != len(qs) {
+				t.Errorf("unexpected properties: %q", properties)
+			}
+			for i, p := range test.expected {
+				if (*order)[i] != p {
+					t.Fatalf("unexpected order: got %q, expected %q",
+						*order, test.expected)
+				}
+			}
+		})
+	}
+}
+
+func TestRunError(t *testing.T) {
+	qs, _ := testQualifiers(map[Protocol]time.Duration{TSPREG: time.Minute}, nil)
+	qs[1].Qualifier = testQualifier{
+		protocol: TSP,
+		err:      errors.New("test"),
+		lock:     new(sync.Mutex),
+		order:    new([]Protocol),
+	}
+
+	err := qs.Run(context.Background(), nil, func(p Protocol, prop []byte) error {
+		return nil
+	})
+	qerr, ok := err.(QualifierError)
+	if !ok || qerr.Protocol != TSP {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRunTimeout(t *testing.T) {
+	qs, _ := testQualifiers(map[Protocol]time.Duration{OCSP: time.Minute}, nil)
+	qs[2].Timeout = 10 * time.Millisecond
+
+	err := qs.Run(context.Background(), nil, func(p Protocol, prop []byte) error {
+		return nil
+	})
+	qerr, ok := err.(QualifierError)
+	if !ok || qerr.Protocol != OCSP || qerr.Err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestConfigure(t *testing.T) {
+	for _, p := range []Protocol{TSPREG, TSP, OCSP} {
+		p := p
+		Register(p, func(yaml.Node, string) (Qualifier, error) {
+			return testQualifier{protocol: p}, nil
+		}, nil)
+	}
+
+	tests := []struct {
+		name       string
+		protocols  []Protocol
+		after      map[Protocol][]Protocol
+		concurrent bool
+		expected   [][]int
+	}{
+		{"sequential", []Protocol{TSPREG, TSP, OCSP}, nil, false,
+			[][]int{nil, {0}, {1}}},
+		{"concurrent without after", []Protocol{TSPREG, TSP, OCSP}, nil, true,
+			[][]int{nil, {0}, {0}}},
+		{"concurrent with after", []Protocol{TSPREG, TSP, OCSP},
+			map[Protocol][]Protocol{TSP: {TSPREG}, OCSP: {TSP}}, true,
+			[][]int{nil, {0}, {1, 0}}},
+		{"concurrent before registration", []Protocol{OCSP, TSPREG, TSP}, nil, true,
+			[][]int{nil, nil, {1}}},
+		{"concurrent without registration", []Protocol{TSP, OCSP}, nil, true,
+			[][]int{nil, nil}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var c Conf
+			for _, p := range test.protocols {
+				c = append(c, Conf{{Protocol: p, After: test.after[p]}}...)
+			}
+			qs, err := Configure(c, test.concurrent, "")
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			for i, q := range qs {
+				if !equalIndexes(q.After, test.expected[i]) {
+					t.Errorf("unexpected dependencies of %s: got %v, expected %v",
+						q.Protocol, q.After, test.expected[i])
+				}
+			}
+		})
+	}
+}
+
+func equalIndexes(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
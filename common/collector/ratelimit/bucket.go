@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// GlobalBucket is a token bucket policy for all requests to a single service
+// instance.
+type GlobalBucket struct {
+	rate  float64 // Tokens per second.
+	burst float64
+
+	lock   sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewGlobalBucket creates a new token bucket policy. The bucket starts full.
+func NewGlobalBucket(c BucketConf) *GlobalBucket {
+	burst := c.Burst
+	if burst == 0 {
+		burst = c.Rate
+	}
+	return &GlobalBucket{
+		rate:   float64(c.Rate) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+	}
+}
+
+// Check implements the Policy interface.
+func (b *GlobalBucket) Check(ctx context.Context, r Request) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.refill(r.Time)
+}
+
+// Record implements the Policy interface.
+func (b *GlobalBucket) Record(ctx context.Context, r Request) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if err := b.refill(r.Time); err != nil {
+		return err
+	}
+	b.tokens--
+	return nil
+}
+
+// refill refills the bucket for the time passed since the last request and
+// returns an error if there are no tokens left. The caller must hold b.lock.
+func (b *GlobalBucket) refill(now time.Time) error {
+	// Do not rewind if requests are processed out of order.
+	if !b.last.IsZero() && now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+	}
+	if now.After(b.last) {
+		b.last = now
+	}
+
+	if b.tokens < 1 {
+		return exceeded(GlobalBucketExceededError{})
+	}
+	return nil
+}
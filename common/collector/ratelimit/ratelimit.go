@@ -0,0 +1,166 @@
+/*
+Package ratelimit provides policies for limiting the rate of requests, e.g.,
+vote submissions.
+
+A Policy decides if a single request is allowed. The policies provided by this
+package are a sliding window per voter, which is shared by all service
+instances through the storage service, a sliding window per client address and
+a global token bucket, which are both kept in memory of a single service
+instance.
+*/
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"ivxv.ee/common/collector/storage"
+)
+
+// Request describes a request subject to rate limiting.
+type Request struct {
+	Voter   string    // Identifier of the authenticated voter.
+	Address net.Addr  // Address of the client, may be nil.
+	Time    time.Time // Time of the request.
+}
+
+// Policy is a rate limiting policy.
+//
+// Checking and recording a request are separate, so that requests can be
+// checked against all policies before any expensive processing, but only count
+// towards the rate limits once they have been processed successfully. Policies
+// which should count all attempts are wrapped in CountAttempts.
+type Policy interface {
+	// Check checks if the request is allowed by the policy without counting
+	// it towards the rate limit. If the request exceeds the rate limit,
+	// then it returns an error caused by LimitExceededError. Other errors
+	// indicate a failure to apply the policy.
+	Check(ctx context.Context, r Request) error
+
+	// Record counts the request towards the rate limit. Since other
+	// requests may have been recorded after Check, Record checks the
+	// limit again and returns an error caused by LimitExceededError
+	// without counting the request if it is no longer allowed.
+	Record(ctx context.Context, r Request) error
+}
+
+// CountAttempts wraps a Policy which counts every attempted request towards
+// the rate limit, not only the ones which are processed successfully. This is
+// meant for policies which protect the service from abuse: invalid requests
+// are as expensive to process as valid ones.
+type CountAttempts struct {
+	Policy
+}
+
+// Policies is a set of policies which are applied together.
+type Policies []Policy
+
+// Check checks the request against all policies and returns the first error.
+func (ps Policies) Check(ctx context.Context, r Request) error {
+	for _, p := range ps {
+		if err := p.Check(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Attempt checks an attempted request against all policies before processing
+// it and records it in the policies wrapped in CountAttempts. Returns the
+// first error: if an error is returned, then the request has been counted by
+// the CountAttempts policies preceding the one that failed.
+func (ps Policies) Attempt(ctx context.Context, r Request) error {
+	for _, p := range ps {
+		var err error
+		if a, ok := p.(CountAttempts); ok {
+			err = a.Record(ctx, r)
+		} else {
+			err = p.Check(ctx, r)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record records the processed request in all policies except the ones
+// wrapped in CountAttempts, which have already recorded it in Attempt, and
+// returns the first error. If an error is returned, then the request has been
+// counted by the policies preceding the one that failed.
+func (ps Policies) Record(ctx context.Context, r Request) error {
+	for _, p := range ps {
+		if _, ok := p.(CountAttempts); ok {
+			continue
+		}
+		if err := p.Record(ctx, r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WindowConf is the configuration of a sliding window policy.
+type WindowConf struct {
+	// Count is the maximum number of requests allowed in a window. 0
+	// disables the policy.
+	Count uint64
+
+	// Minutes is the length of the window in minutes.
+	Minutes uint64
+}
+
+// BucketConf is the configuration of a token bucket policy.
+type BucketConf struct {
+	// Rate is the number of tokens added to the bucket per minute. 0
+	// disables the policy.
+	Rate uint64
+
+	// Burst is the capacity of the bucket. If 0, then Rate is used.
+	Burst uint64
+}
+
+// Conf contains the configuration of all supported policies.
+type Conf struct {
+	// Voter limits the requests of each voter across all service
+	// instances.
+	Voter WindowConf
+
+	// Address limits the requests from each client IP address to a
+	// single service instance.
+	Address WindowConf
+
+	// Instance limits all requests to a single service instance.
+	Instance BucketConf
+}
+
+// Configure creates the policies enabled in the configuration. s is used by
+// policies which share state across service instances.
+//
+// The per-voter window only counts requests which were processed
+// successfully, so that voters are not penalized for failed submissions. The
+// per-address window and the global bucket count all attempts.
+func Configure(c Conf, s *storage.Client) (policies Policies, err error) {
+	if c.Voter.Count > 0 {
+		if c.Voter.Minutes == 0 {
+			return nil, VoterWindowMinutesError{}
+		}
+		policies = append(policies, NewVoterWindow(s, c.Voter))
+	}
+	if c.Address.Count > 0 {
+		if c.Address.Minutes == 0 {
+			return nil, AddressWindowMinutesError{}
+		}
+		policies = append(policies, CountAttempts{NewAddressWindow(c.Address)})
+	}
+	if c.Instance.Rate > 0 {
+		policies = append(policies, CountAttempts{NewGlobalBucket(c.Instance)})
+	}
+	return
+}
+
+// exceeded wraps err in a LimitExceededError.
+func exceeded(err error) error {
+	return LimitExceededError{Err: err}
+}
@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+// allow checks and records the request in p and reports if it was allowed.
+func allow(t *testing.T, p Policy, r Request) bool {
+	t.Helper()
+	err := p.Check(context.Background(), r)
+	if err == nil {
+		err = p.Record(context.Background(), r)
+	}
+	switch {
+	case err == nil:
+		return true
+	case errors.CausedBy(err, new(LimitExceededError)) != nil:
+		return false
+	default:
+		t.Fatal("unexpected error:", err)
+		return false
+	}
+}
+
+func TestVoterWindow(t *testing.T) {
+	s := storage.NewWithProtocol(memory.New(nil))
+	p := NewVoterWindow(s, WindowConf{Count: 2, Minutes: 10})
+	now := time.Now()
+	at := func(voter string, minutes int) Request {
+		return Request{Voter: voter, Time: now.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	for _, test := range []struct {
+		request  Request
+		expected bool
+	}{
+		{at("first", 0), true},
+		{at("first", 1), true},
+		{at("first", 2), false},
+		{at("second", 2), true}, // Voters are limited separately.
+		{at("first", 10), true}, // First submission left the window.
+		{at("first", 10), false},
+		{at("first", 30), true}, // All submissions left the window.
+	} {
+		if got := allow(t, p, test.request); got != test.expected {
+			t.Errorf("%s at %s: got %t, want %t", test.request.Voter,
+				test.request.Time.Sub(now), got, test.expected)
+		}
+	}
+}
+
+func TestAddressWindow(t *testing.T) {
+	p := NewAddressWindow(WindowConf{Count: 1, Minutes: 1})
+	now := time.Now()
+	first := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000}
+	samehost := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 2000}
+	second := &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1000}
+
+	if !allow(t, p, Request{Address: first, Time: now}) {
+		t.Error("first request not allowed")
+	}
+	if allow(t, p, Request{Address: samehost, Time: now}) {
+		t.Error("request from same host allowed")
+	}
+	if !allow(t, p, Request{Address: second, Time: now}) {
+		t.Error("request from second host not allowed")
+	}
+	if !allow(t, p, Request{Time: now}) {
+		t.Error("request without address not allowed")
+	}
+	if !allow(t, p, Request{Address: first, Time: now.Add(time.Minute)}) {
+		t.Error("request after window not allowed")
+	}
+}
+
+func TestGlobalBucket(t *testing.T) {
+	p := NewGlobalBucket(BucketConf{Rate: 60, Burst: 2})
+	now := time.Now()
+
+	if !allow(t, p, Request{Time: now}) || !allow(t, p, Request{Time: now}) {
+		t.Fatal("burst not allowed")
+	}
+	if allow(t, p, Request{Time: now}) {
+		t.Error("request over burst allowed")
+	}
+	if !allow(t, p, Request{Time: now.Add(time.Second)}) {
+		t.Error("request after refill not allowed")
+	}
+	if allow(t, p, Request{Time: now.Add(time.Second)}) {
+		t.Error("request over refill allowed")
+	}
+}
+
+func TestCheckDoesNotRecord(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	r := Request{
+		Voter:   "voter",
+		Address: &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000},
+		Time:    now,
+	}
+	ps := Policies{
+		NewVoterWindow(storage.NewWithProtocol(memory.New(nil)), WindowConf{Count: 1, Minutes: 1}),
+		NewAddressWindow(WindowConf{Count: 1, Minutes: 1}),
+		NewGlobalBucket(BucketConf{Rate: 1}),
+	}
+
+	// Checking any number of times leaves the limits untouched.
+	for i := 0; i < 3; i++ {
+		if err := ps.Check(ctx, r); err != nil {
+			t.Fatalf("check %d failed: %v", i, err)
+		}
+	}
+	if err := ps.Record(ctx, r); err != nil {
+		t.Fatal("failed to record request:", err)
+	}
+
+	// Once recorded, every policy rejects the next request.
+	for i, p := range ps {
+		if err := p.Check(ctx, r); errors.CausedBy(err, new(LimitExceededError)) == nil {
+			t.Errorf("policy %d allowed request after record: %v", i, err)
+		}
+		if err := p.Record(ctx, r); errors.CausedBy(err, new(LimitExceededError)) == nil {
+			t.Errorf("policy %d recorded request over limit: %v", i, err)
+		}
+	}
+}
+
+func TestAttemptRecordsAbusePolicies(t *testing.T) {
+	ctx := context.Background()
+	ps, err := Configure(Conf{
+		Voter:    WindowConf{Count: 1, Minutes: 10},
+		Address:  WindowConf{Count: 2, Minutes: 10},
+		Instance: BucketConf{Rate: 1, Burst: 3},
+	}, storage.NewWithProtocol(memory.New(nil)))
+	if err != nil {
+		t.Fatal("failed to configure policies:", err)
+	}
+	now := time.Now()
+	attempt := func(ip byte) Request {
+		return Request{
+			Voter:   "voter",
+			Address: &net.TCPAddr{IP: net.IPv4(192, 0, 2, ip), Port: 1000},
+			Time:    now,
+		}
+	}
+
+	// Repeated attempts from one address which are never recorded, e.g.,
+	// because they were invalid, are throttled by the address window.
+	for i := 0; i < 2; i++ {
+		if err = ps.Attempt(ctx, attempt(1)); err != nil {
+			t.Fatalf("attempt %d failed: %v", i, err)
+		}
+	}
+	if err = ps.Attempt(ctx, attempt(1)); errors.CausedBy(err,
+		new(AddressWindowExceededError)) == nil {
+
+		t.Errorf("unexpected error for attempt over address limit: %v", err)
+	}
+
+	// The attempts used up the global bucket, but not the voter window.
+	if err = ps.Attempt(ctx, attempt(2)); err != nil {
+		t.Fatal("attempt from other address failed:", err)
+	}
+	if err = ps.Record(ctx, attempt(2)); err != nil {
+		t.Fatal("failed to record request:", err)
+	}
+	if err = ps.Attempt(ctx, attempt(3)); errors.CausedBy(err,
+		new(VoterWindowExceededError)) == nil {
+
+		t.Errorf("unexpected error for attempt over voter limit: %v", err)
+	}
+	if err = ps.Attempt(ctx, Request{Voter: "other", Time: now}); errors.CausedBy(err,
+		new(GlobalBucketExceededError)) == nil {
+
+		t.Errorf("unexpected error for attempt over global limit: %v", err)
+	}
+}
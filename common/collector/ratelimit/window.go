@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+// VoterWindow is a sliding window policy per voter. The submission times of
+// each voter are kept in the storage service, so the limit applies across all
+// service instances.
+type VoterWindow struct {
+	storage *storage.Client
+	count   int
+	window  time.Duration
+}
+
+// NewVoterWindow creates a new sliding window policy per voter.
+func NewVoterWindow(s *storage.Client, c WindowConf) *VoterWindow {
+	return &VoterWindow{
+		storage: s,
+		count:   int(c.Count),
+		window:  time.Duration(c.Minutes) * time.Minute,
+	}
+}
+
+// Check implements the Policy interface.
+func (w *VoterWindow) Check(ctx context.Context, r Request) error {
+	submissions, err := w.storage.GetVoterSubmissions(ctx, r.Voter)
+	if err != nil {
+		return VoterWindowGetSubmissionsError{Err: err}
+	}
+	_, err = w.recent(submissions, r)
+	return err
+}
+
+// Record implements the Policy interface.
+func (w *VoterWindow) Record(ctx context.Context, r Request) error {
+	// If the submissions changed between retrieving and attempting to
+	// update, then there was another concurrent voting session for this
+	// voter that got there first. If this happens, then try again.
+	for {
+		old, err := w.storage.GetVoterSubmissions(ctx, r.Voter)
+		if err != nil {
+			return VoterWindowRecordGetSubmissionsError{Err: err}
+		}
+
+		recent, err := w.recent(old, r)
+		if err != nil {
+			return err
+		}
+
+		err = w.storage.SetVoterSubmissions(ctx, r.Voter, old, append(recent, r.Time))
+		if err != nil {
+			if errors.CausedBy(err, new(storage.UnexpectedValueError)) != nil {
+				log.Log(ctx, ConcurrentVoterWindowUpdate{Err: err})
+				continue
+			}
+			return VoterWindowSetSubmissionsError{Err: err}
+		}
+		return nil
+	}
+}
+
+// recent returns the submissions within the window before the request or an
+// error if there are too many of them to allow the request.
+func (w *VoterWindow) recent(submissions []time.Time, r Request) ([]time.Time, error) {
+	recent := slide(submissions, r.Time, w.window)
+	if len(recent) >= w.count {
+		return nil, exceeded(VoterWindowExceededError{
+			Count:  len(recent),
+			Oldest: recent[0],
+		})
+	}
+	return recent, nil
+}
+
+// AddressWindow is a sliding window policy per client IP address. The
+// submission times are kept in memory, so the limit applies to a single
+// service instance.
+type AddressWindow struct {
+	count  int
+	window time.Duration
+
+	lock        sync.Mutex
+	submissions map[string][]time.Time
+	cleaned     time.Time
+}
+
+// NewAddressWindow creates a new sliding window policy per client IP address.
+func NewAddressWindow(c WindowConf) *AddressWindow {
+	return &AddressWindow{
+		count:       int(c.Count),
+		window:      time.Duration(c.Minutes) * time.Minute,
+		submissions: make(map[string][]time.Time),
+	}
+}
+
+// Check implements the Policy interface. Requests without a client address
+// are always allowed.
+func (w *AddressWindow) Check(ctx context.Context, r Request) error {
+	ip := addressIP(r.Address)
+	if len(ip) == 0 {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	_, err := w.recent(ip, r.Time)
+	return err
+}
+
+// Record implements the Policy interface. Requests without a client address
+// are not recorded.
+func (w *AddressWindow) Record(ctx context.Context, r Request) error {
+	ip := addressIP(r.Address)
+	if len(ip) == 0 {
+		return nil
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	recent, err := w.recent(ip, r.Time)
+	if err != nil {
+		return err
+	}
+	w.submissions[ip] = append(recent, r.Time)
+	return nil
+}
+
+// recent returns the submissions from ip within the window before now or an
+// error if there are too many of them to allow another request. The caller
+// must hold w.lock.
+func (w *AddressWindow) recent(ip string, now time.Time) ([]time.Time, error) {
+	// Periodically drop addresses without any recent submissions to
+	// bound memory usage.
+	if now.Sub(w.cleaned) >= w.window {
+		for key, submissions := range w.submissions {
+			if len(slide(submissions, now, w.window)) == 0 {
+				delete(w.submissions, key)
+			}
+		}
+		w.cleaned = now
+	}
+
+	recent := slide(w.submissions[ip], now, w.window)
+	if len(recent) >= w.count {
+		w.submissions[ip] = recent
+		return nil, exceeded(AddressWindowExceededError{
+			Address: ip,
+			Count:   len(recent),
+			Oldest:  recent[0],
+		})
+	}
+	return recent, nil
+}
+
+// slide returns the submissions which are within window before now.
+// submissions must be sorted, oldest first.
+func slide(submissions []time.Time, now time.Time, window time.Duration) []time.Time {
+	start := now.Add(-window)
+	for i, t := range submissions {
+		if t.After(start) {
+			return submissions[i:]
+		}
+	}
+	return nil
+}
+
+// addressIP returns the IP address part of addr as a string or an empty
+// string if addr is nil.
+func addressIP(addr net.Addr) string {
+	switch a := addr.(type) {
+	case nil:
+		return ""
+	case *net.TCPAddr:
+		return a.IP.String()
+	default:
+		host, _, err := net.SplitHostPort(a.String())
+		if err != nil {
+			return a.String()
+		}
+		return host
+	}
+}
@@ -182,9 +182,15 @@ prepare_ballot_box_backup() {
   SERVICE_ID="$1"
   BACKUP_FILENAME="$2"
   echo "# Creating ballot box backup file ${BACKUP_FILENAME}"
-  rm -fv "${BACKUP_FILENAME}"
+  rm -fv "${BACKUP_FILENAME}" "${BACKUP_FILENAME}.checkpoint" \
+    "${BACKUP_FILENAME}.manifest.json" "${BACKUP_FILENAME}.manifest.sig"
+  SIGN_FLAGS=""
+  if [ ! -f "/var/lib/ivxv/service/${SERVICE_ID}/voteexp.key" ]; then
+    echo "WARNING: No export signing key, the ballot box manifest is left unsigned"
+    SIGN_FLAGS="-nosign"
+  fi
   RETVAL=""
-  ivxv-voteexp -instance "${SERVICE_ID}" "${BACKUP_FILENAME}" || RETVAL="$?"
+  ivxv-voteexp -instance "${SERVICE_ID}" ${SIGN_FLAGS} "${BACKUP_FILENAME}" || RETVAL="$?"
   if [ "${RETVAL}" = 2 ]; then
     echo "NOTE: The ivxv-voteexp utility exited with non-fatal errors"
   elif [ "${RETVAL}" ]; then
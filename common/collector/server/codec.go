@@ -17,6 +17,7 @@ import (
 
 	"ivxv.ee/common/collector/log"
 	"ivxv.ee/common/collector/safereader"
+	"ivxv.ee/common/collector/trace"
 )
 
 // wrappedConn wraps net.Conn so its Read method can be replaced with another
@@ -51,6 +52,10 @@ type serverCodec struct {
 
 	header  *Header // Server header of the request and response.
 	filters headerFilters
+
+	start  time.Time   // Time when the request header was read.
+	method string      // Requested method.
+	span   *trace.Span // Span of the request, nil if not traced.
 }
 
 func newCodec(ctx context.Context, conf *CodecConf, conn net.Conn,
@@ -105,6 +110,8 @@ func (s *serverCodec) ReadRequestHeader(req *rpc.Request) error {
 		log.Error(s.header.Ctx, ReadJSONRequestError{Err: err})
 		return errIgnored
 	}
+	s.start = time.Now()
+	s.method = req.ServiceMethod
 	return nil
 }
 
@@ -149,8 +156,9 @@ func (s *serverCodec) ReadRequestBody(x interface{}) error {
 	// error information and return a generic error, so just pass it
 	// through without doing anything.
 	h := x.(header).header()
-	h.Ctx = s.header.Ctx
+	h.Ctx, s.span = trace.Start(s.header.Ctx, s.method)
 	err := s.filters.next(h)
+	s.span.SetAttribute("session.id", h.SessionID)
 	s.header = h
 	return err
 }
@@ -224,10 +232,20 @@ func checkSize(v reflect.Value) error {
 // components. Therefore WriteResponse is left with logging any errors related
 // to writing or generated by the rpc package.
 func (s *serverCodec) WriteResponse(resp *rpc.Response, x interface{}) error {
-	// Log any rpc package errors and replace with generic ones.
+	// Log any rpc package errors and replace with generic ones. These
+	// are caused by unknown methods, so do not use the requested method
+	// name in metrics.
+	method := resp.ServiceMethod
 	if strings.HasPrefix(resp.Error, "rpc: ") {
 		log.Error(s.header.Ctx, RPCMethodError{ErrString: resp.Error})
 		resp.Error = ErrBadRequest.Error()
+		method = "unknown"
+	}
+	observeRPC(method, s.start, resp.Error)
+	if len(resp.Error) > 0 {
+		s.span.Finish(errors.New(resp.Error))
+	} else {
+		s.span.Finish(nil)
 	}
 
 	// Set the header of the response unless we are returning an error.
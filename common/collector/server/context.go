@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/x509"
 	"crypto/x509/pkix"
+	"net"
 )
 
 // Header is a common protocol message header, which should be embedded in the
@@ -64,8 +65,8 @@ const (
 	voterIDKey               // Context key for authenticated client's unique identifier.
 	voterIDNumber            // Context key for authenticated client's unique number.
 
-	// Keys only used internally.
-	addrKey // Context key for connection's remote address.
+	addrKey      // Context key for connection's remote address.
+	sessionIDKey // Context key for the session identifier.
 
 	authMethod
 )
@@ -136,3 +137,32 @@ func VoterNumber(ctx context.Context) string {
 	}
 	return ""
 }
+
+// WithSessionID returns a copy of ctx with the session identifier sessionID.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionID returns the session identifier of the request or empty string if
+// the context is not from a request.
+func SessionID(ctx context.Context) string {
+	if val := ctx.Value(sessionIDKey); val != nil {
+		return val.(string)
+	}
+	return ""
+}
+
+// WithClientAddress returns a copy of ctx with the client address addr.
+func WithClientAddress(ctx context.Context, addr net.Addr) context.Context {
+	return context.WithValue(ctx, addrKey, addr)
+}
+
+// ClientAddress returns the address of the client, i.e., the address from the
+// PROXY protocol prefix if present, otherwise the connection's remote address.
+// Returns nil if the context is not from an incoming connection.
+func ClientAddress(ctx context.Context) net.Addr {
+	if val := ctx.Value(addrKey); val != nil {
+		return val.(net.Addr)
+	}
+	return nil
+}
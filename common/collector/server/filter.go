@@ -191,11 +191,10 @@ func proxyFilter(ctx context.Context, c net.Conn, chain connFilters) context.Con
 		log.Log(ctx, PROXYProtocol{Address: addr})
 	}
 
-	// Put remote address into context for addrFilter. Remove once
-	// addrFilter is no longer necessary.
-	ctx = context.WithValue(ctx, addrKey, c.RemoteAddr())
+	// Put remote address into context for addrFilter and ClientAddress.
+	ctx = WithClientAddress(ctx, c.RemoteAddr())
 	if addr != nil {
-		ctx = context.WithValue(ctx, addrKey, addr)
+		ctx = WithClientAddress(ctx, addr)
 	}
 
 	return chain.next(ctx, c)
@@ -255,6 +254,7 @@ func (f *tlsFilter) filter(ctx context.Context, c net.Conn, chain connFilters) c
 		return ctx
 	}
 	if err := tlsc.Handshake(); err != nil {
+		filterRejections.Inc(filterTLS)
 		close(ctx, tlsc, HandshakeError{Err: err})
 		return ctx
 	}
@@ -339,6 +339,7 @@ type endFilter time.Time
 func (e endFilter) filter(header *Header, chain headerFilters) error {
 	if !time.Now().Before(time.Time(e)) { // not before == equal or after
 		log.Log(header.Ctx, VotingEnded{})
+		filterRejections.Inc(filterEnd)
 		return ErrVotingEnd
 	}
 	return chain.next(header)
@@ -367,7 +368,8 @@ func sessIDFilter(header *Header, chain headerFilters) error {
 		return ErrBadRequest
 	}
 
-	// Set session ID in logging context and log.
+	// Set session ID in context for SessionID and logging, and log.
+	header.Ctx = WithSessionID(header.Ctx, header.SessionID)
 	header.Ctx = log.WithSessionID(header.Ctx, header.SessionID)
 	log.Log(header.Ctx, entry)
 	return chain.next(header)
@@ -411,6 +413,7 @@ func (a authFilter) filter(header *Header, chain headerFilters) error {
 
 		if err != nil {
 			log.Error(header.Ctx, AuthenticationError{Err: err})
+			filterRejections.Inc(filterAuth)
 			switch {
 			case errors.CausedBy(err, new(auth.UnconfiguredTypeError)) != nil:
 				fallthrough
@@ -460,6 +463,7 @@ func (i identityFilter) filter(header *Header, chain headerFilters) error {
 		id, err := identity.Identifier(i)(name)
 		if err != nil {
 			log.Error(header.Ctx, IdentityError{Err: err})
+			filterRejections.Inc(filterIdentity)
 			return ErrIneligible
 		}
 		header.Ctx = context.WithValue(header.Ctx, voterIDKey, id)
@@ -469,13 +473,19 @@ func (i identityFilter) filter(header *Header, chain headerFilters) error {
 }
 
 // ageFilter determines the voter's age and checks if they are over a voting
-// age limit.
+// age limit. The client certificate is passed to the checker if available,
+// i.e., when using TLS or Web eID authentication.
 type ageFilter age.Checker
 
 func (a *ageFilter) filter(header *Header, chain headerFilters) error {
 	if id := VoterIdentity(header.Ctx); len(id) > 0 {
-		if err := (*age.Checker)(a).Check(id); err != nil {
+		var cert *x509.Certificate
+		if certs := TLSClient(header.Ctx); len(certs) > 0 {
+			cert = certs[0]
+		}
+		if err := (*age.Checker)(a).Check(header.Ctx, id, cert); err != nil {
 			log.Error(header.Ctx, AgeError{Err: err})
+			filterRejections.Inc(filterAge)
 			if errors.CausedBy(err, new(age.TooYoungError)) != nil {
 				return ErrTooYoung
 			}
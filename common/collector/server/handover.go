@@ -0,0 +1,211 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+)
+
+const (
+	// handoverEnv is the environment variable which is set for a process
+	// started to take over the listening socket of a server.
+	handoverEnv = "IVXV_HANDOVER"
+
+	// handoverControlFD is the file descriptor of the control socket in
+	// the process taking over: the first file after standard input,
+	// output, and error.
+	handoverControlFD = 3
+)
+
+// handoverTimeout is the time that the new process has for starting up and
+// accepting connections on the inherited socket. It is a variable for testing.
+var handoverTimeout = time.Minute
+
+// inherited is a listening socket inherited from a previous server process
+// together with a control socket for coordinating the handover.
+type inherited struct {
+	listener *net.TCPListener
+	control  *net.UnixConn
+}
+
+// inherit returns the listening socket inherited from a previous server
+// process or nil if this process was not started for a handover.
+func inherit() (*inherited, error) {
+	if len(os.Getenv(handoverEnv)) == 0 {
+		return nil, nil
+	}
+	// Do not pass the variable on to any processes we start.
+	os.Unsetenv(handoverEnv) //nolint:errcheck // Only fails for invalid names.
+
+	cf := os.NewFile(handoverControlFD, "handover control")
+	defer cf.Close()
+	c, err := net.FileConn(cf)
+	if err != nil {
+		return nil, InheritControlError{Err: err}
+	}
+	control, ok := c.(*net.UnixConn)
+	if !ok {
+		c.Close()
+		return nil, InheritedControlTypeError{Addr: c.LocalAddr()}
+	}
+
+	if err = control.SetDeadline(time.Now().Add(handoverTimeout)); err != nil {
+		control.Close()
+		return nil, InheritedControlDeadlineError{Err: err}
+	}
+	l, err := receiveListener(control)
+	if err != nil {
+		control.Close()
+		return nil, InheritListenerError{Err: err}
+	}
+	return &inherited{listener: l, control: control}, nil
+}
+
+// receiveListener receives the listening socket sent by sendListener over
+// control.
+func receiveListener(control *net.UnixConn) (*net.TCPListener, error) {
+	oob := make([]byte, syscall.CmsgSpace(4)) // Space for a single descriptor.
+	_, oobn, _, _, err := control.ReadMsgUnix(make([]byte, 1), oob)
+	if err != nil {
+		return nil, ReceiveListenerError{Err: err}
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		return nil, ParseListenerMessageError{Messages: len(msgs), Err: err}
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+		return nil, ParseListenerRightsError{Descriptors: len(fds), Err: err}
+	}
+
+	lf := os.NewFile(uintptr(fds[0]), "handover listener")
+	defer lf.Close()
+	l, err := net.FileListener(lf)
+	if err != nil {
+		return nil, FileListenerError{Err: err}
+	}
+	tl, ok := l.(*net.TCPListener)
+	if !ok {
+		l.Close()
+		return nil, InheritedListenerTypeError{Addr: l.Addr()}
+	}
+	return tl, nil
+}
+
+// sendListener sends listening socket l over control. The socket is passed as
+// ancillary data instead of through exec.Cmd.ExtraFiles, because the latter
+// puts the shared socket into blocking mode, after which this process could
+// not close its listener.
+func sendListener(control *net.UnixConn, l *net.TCPListener) error {
+	raw, err := l.SyscallConn()
+	if err != nil {
+		return SendListenerRawConnError{Err: err}
+	}
+	var werr error
+	if err = raw.Control(func(fd uintptr) {
+		_, _, werr = control.WriteMsgUnix([]byte{0}, syscall.UnixRights(int(fd)), nil)
+	}); err != nil {
+		return SendListenerControlError{Err: err}
+	}
+	if werr != nil {
+		return SendListenerError{Err: werr}
+	}
+	return nil
+}
+
+// ready notifies the previous server process that this process is accepting
+// connections and waits until it has handed over the service.
+func (i *inherited) ready() error {
+	defer i.control.Close()
+	if _, err := i.control.Write([]byte{1}); err != nil {
+		return InheritedReadyError{Err: err}
+	}
+	if _, err := io.ReadFull(i.control, make([]byte, 1)); err != nil {
+		return InheritedAckError{Err: err}
+	}
+	return nil
+}
+
+// handover starts a new process of the current executable with the same
+// arguments and passes it listening socket l. Once the new process is
+// accepting connections on l, it is made the main process of the service and
+// handover returns. If the new process fails to start in time, then it is
+// killed and an error is returned: the caller should continue serving.
+func (s *S) handover(ctx context.Context, l *net.TCPListener) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return HandoverExecutableError{Err: err}
+	}
+
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return HandoverSocketpairError{Err: err}
+	}
+	local := os.NewFile(uintptr(fds[0]), "handover control")
+	remote := os.NewFile(uintptr(fds[1]), "handover control")
+	c, err := net.FileConn(local)
+	local.Close()
+	if err != nil {
+		remote.Close()
+		return HandoverControlError{Err: err}
+	}
+	control := c.(*net.UnixConn) // FileConn of a Unix socket.
+	defer control.Close()
+
+	cmd := exec.Command(exe, os.Args[1:]...) //nolint:gosec // Re-executes ourselves.
+	cmd.Env = append(os.Environ(), handoverEnv+"=1")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.ExtraFiles = []*os.File{remote} // handoverControlFD
+	err = cmd.Start()
+	remote.Close()
+	if err != nil {
+		return HandoverStartError{Executable: exe, Err: err}
+	}
+	log.Log(ctx, HandoverStarted{Executable: exe, PID: cmd.Process.Pid})
+
+	abort := func(err error) error {
+		if kerr := cmd.Process.Kill(); kerr != nil {
+			log.Error(ctx, HandoverKillError{PID: cmd.Process.Pid, Err: kerr})
+		}
+		cmd.Wait() //nolint:errcheck // Killed, so always an error.
+		return err
+	}
+
+	// Pass the listening socket and wait until the new process is
+	// accepting connections on it.
+	if err = control.SetDeadline(time.Now().Add(handoverTimeout)); err != nil {
+		return abort(HandoverControlDeadlineError{Err: err})
+	}
+	if err = sendListener(control, l); err != nil {
+		return abort(HandoverSendListenerError{Err: err})
+	}
+	if _, err = io.ReadFull(control, make([]byte, 1)); err != nil {
+		return abort(HandoverNotReadyError{PID: cmd.Process.Pid, Err: err})
+	}
+
+	// Make the new process the main process of the service before
+	// acknowledging, so that its status updates are accepted by systemd.
+	if err = s.status.handover(cmd.Process.Pid); err != nil {
+		return abort(HandoverStatusError{Err: err})
+	}
+	if _, err = control.Write([]byte{1}); err != nil {
+		// The new process is already the main process, so there is no
+		// going back: only log the error and let it continue.
+		log.Error(ctx, HandoverAcknowledgeError{Err: err})
+	}
+	if err = cmd.Process.Release(); err != nil {
+		log.Error(ctx, HandoverReleaseError{Err: err})
+	}
+	log.Log(ctx, HandedOver{PID: cmd.Process.Pid})
+	return nil
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+)
+
+// handoverTestEnv selects the behavior of the test binary when it is started
+// by handover: "serve" takes over the listener and serves a single connection,
+// "hang" never becomes ready.
+const handoverTestEnv = "IVXV_HANDOVER_TEST"
+
+func TestMain(m *testing.M) {
+	if len(os.Getenv(handoverEnv)) > 0 {
+		os.Exit(handoverChild(os.Getenv(handoverTestEnv)))
+	}
+	os.Exit(m.Run())
+}
+
+// handoverChild is the process started by handover in tests.
+func handoverChild(mode string) int {
+	// Never outlive the test, even if it fails.
+	time.AfterFunc(10*time.Second, func() { os.Exit(2) })
+
+	i, err := inherit()
+	if err != nil || i == nil {
+		return 1
+	}
+	if mode == "hang" {
+		select {}
+	}
+	if err = i.ready(); err != nil {
+		return 1
+	}
+	conn, err := i.listener.Accept()
+	if err != nil {
+		return 1
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("child")); err != nil {
+		return 1
+	}
+	return 0
+}
+
+// controlPair returns a connected pair of control sockets.
+func controlPair(t *testing.T) (parent, child *net.UnixConn) {
+	t.Helper()
+	fds, err := syscall.Socketpair(syscall.AF_UNIX, syscall.SOCK_STREAM|syscall.SOCK_CLOEXEC, 0)
+	if err != nil {
+		t.Fatal("failed to create socketpair:", err)
+	}
+	conn := func(fd int) *net.UnixConn {
+		f := os.NewFile(uintptr(fd), "control")
+		defer f.Close()
+		c, err := net.FileConn(f)
+		if err != nil {
+			t.Fatal("failed to create control connection:", err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c.(*net.UnixConn)
+	}
+	return conn(fds[0]), conn(fds[1])
+}
+
+func TestInheritWithoutHandover(t *testing.T) {
+	t.Setenv(handoverEnv, "")
+	i, err := inherit()
+	if err != nil || i != nil {
+		t.Errorf("unexpected inherited listener: %v, %v", i, err)
+	}
+}
+
+func TestSendListener(t *testing.T) {
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer l.Close()
+
+	parent, child := controlPair(t)
+	if err = sendListener(parent, l); err != nil {
+		t.Fatal("failed to send listener:", err)
+	}
+	received, err := receiveListener(child)
+	if err != nil {
+		t.Fatal("failed to receive listener:", err)
+	}
+	defer received.Close()
+	if received.Addr().String() != l.Addr().String() {
+		t.Fatalf("unexpected received address: %s, want %s", received.Addr(), l.Addr())
+	}
+
+	// The ready and acknowledge exchange completes.
+	readyc := make(chan error, 1)
+	go func() {
+		readyc <- (&inherited{listener: received, control: child}).ready()
+	}()
+	if _, err = io.ReadFull(parent, make([]byte, 1)); err != nil {
+		t.Fatal("failed to read ready notification:", err)
+	}
+	if _, err = parent.Write([]byte{1}); err != nil {
+		t.Fatal("failed to acknowledge:", err)
+	}
+	if err = <-readyc; err != nil {
+		t.Fatal("ready failed:", err)
+	}
+
+	// The original listener can be closed while connections are accepted
+	// on the received one: it must not have been made blocking.
+	l.Close()
+	acceptc := make(chan error, 1)
+	go func() {
+		conn, err := received.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		acceptc <- err
+	}()
+	conn, err := net.Dial("tcp", received.Addr().String())
+	if err != nil {
+		t.Fatal("failed to connect to received listener:", err)
+	}
+	conn.Close()
+	if err = <-acceptc; err != nil {
+		t.Error("failed to accept on received listener:", err)
+	}
+}
+
+func TestHandover(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	t.Setenv(handoverTestEnv, "serve")
+
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	s := new(S)
+	if err = s.handover(ctx, l); err != nil {
+		t.Fatal("handover failed:", err)
+	}
+
+	// Once this process closes its listener, connections are served by
+	// the new process.
+	if err = l.Close(); err != nil {
+		t.Fatal("failed to close listener after handover:", err)
+	}
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to connect after handover:", err)
+	}
+	defer conn.Close()
+	if err = conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal("failed to set deadline:", err)
+	}
+	if b, err := io.ReadAll(conn); err != nil || string(b) != "child" {
+		t.Errorf("unexpected response from new process: %q, %v", b, err)
+	}
+}
+
+func TestHandoverNotReady(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	t.Setenv(handoverTestEnv, "hang")
+	defer func(timeout time.Duration) { handoverTimeout = timeout }(handoverTimeout)
+	handoverTimeout = 100 * time.Millisecond
+
+	l, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	defer l.Close()
+
+	err = new(S).handover(ctx, l)
+	if errors.CausedBy(err, new(HandoverNotReadyError)) == nil {
+		t.Fatalf("unexpected error: %v, want HandoverNotReadyError", err)
+	}
+
+	// The aborted handover leaves the listener usable.
+	acceptc := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err == nil {
+			conn.Close()
+		}
+		acceptc <- err
+	}()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal("failed to connect after aborted handover:", err)
+	}
+	conn.Close()
+	if err = <-acceptc; err != nil {
+		t.Error("failed to accept after aborted handover:", err)
+	}
+}
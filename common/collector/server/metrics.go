@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/metrics"
+)
+
+// Server metrics exposed on the metrics listener.
+var (
+	rpcRequests = metrics.NewCounter("ivxv_rpc_requests_total",
+		"Number of handled RPC requests.", "method")
+	rpcErrors = metrics.NewCounter("ivxv_rpc_errors_total",
+		"Number of RPC requests which returned an error, by error class.",
+		"method", "error")
+	rpcDuration = metrics.NewHistogram("ivxv_rpc_duration_seconds",
+		"Time taken to handle RPC requests.", nil, "method")
+	filterRejections = metrics.NewCounter("ivxv_filter_rejections_total",
+		"Number of connections or requests rejected by a filter.", "filter")
+)
+
+// Filter names used as filterRejections label values.
+const (
+	filterTLS      = "tls"
+	filterAuth     = "auth"
+	filterIdentity = "identity"
+	filterAge      = "age"
+	filterEnd      = "end"
+)
+
+// errorClasses are the error strings which are used as rpcErrors label values
+// as is. All other errors are counted as "OTHER" to bound the number of label
+// values.
+var errorClasses = make(map[string]struct{})
+
+func init() {
+	for _, err := range []error{
+		ErrBadRequest, ErrCertificate, ErrIneligible, ErrInternal,
+		ErrTooYoung, ErrUnauthenticated, ErrVotingEnd,
+
+		ErrMIDAbsent, ErrMIDCanceled, ErrMIDCertificate, ErrMIDExpired,
+		ErrMIDGeneral, ErrMIDNotUser, ErrMIDOperator,
+
+		ErrSmartIDCanceled, ErrSmartIDCertificate, ErrSmartIDExpired,
+		ErrSmartIDGeneral, ErrSmartIDVerification, ErrSmartIDAccount,
+
+		ErrIdentityMismatch, ErrOutdatedChoices, ErrVotingRateLimit,
+	} {
+		errorClasses[err.Error()] = struct{}{}
+	}
+}
+
+// errorClass returns the rpcErrors label value for the error string s.
+func errorClass(s string) string {
+	if _, ok := errorClasses[s]; ok {
+		return s
+	}
+	return "OTHER"
+}
+
+// observeRPC records a handled RPC request for method which started at start
+// and returned the error string errstr.
+func observeRPC(method string, start time.Time, errstr string) {
+	rpcRequests.Inc(method)
+	rpcDuration.Since(start, method)
+	if len(errstr) > 0 {
+		rpcErrors.Inc(method, errorClass(errstr))
+	}
+}
+
+// serveMetrics serves all registered metrics over HTTP on address until ctx
+// is cancelled. Errors are logged, but do not affect the server. If retry is
+// true, then listening on address is retried every second until it succeeds.
+func serveMetrics(ctx context.Context, address string, retry bool) {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		log.Error(ctx, MetricsListenError{Address: address, Err: err})
+	}
+	for err != nil {
+		if !retry {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+		l, err = net.Listen("tcp", address)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	srv := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		sctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if err := srv.Shutdown(sctx); err != nil {
+			log.Error(ctx, MetricsShutdownError{Err: err})
+		}
+	}()
+
+	log.Log(ctx, ServingMetrics{Address: l.Addr()})
+	if err := srv.Serve(l); err != http.ErrServerClosed {
+		log.Error(ctx, MetricsServeError{Err: err})
+	}
+}
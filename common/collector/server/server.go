@@ -10,8 +10,12 @@ import (
 	"fmt"
 	"net"
 	"net/rpc"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime/debug"
 	"sync"
+	"syscall"
 	"time"
 
 	"ivxv.ee/common/collector/age"
@@ -20,6 +24,7 @@ import (
 	"ivxv.ee/common/collector/cryptoutil"
 	"ivxv.ee/common/collector/identity"
 	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/trace"
 )
 
 // S is a server which listens for incoming connections, filters them, and
@@ -29,6 +34,15 @@ type S struct {
 	filters connFilters
 	addr    *net.TCPAddr
 	status  *status
+
+	// inherited is the listening socket inherited from a previous server
+	// process during a handover or nil.
+	inherited *inherited
+	sigc      chan os.Signal // Drain signals.
+
+	metricsAddr string
+	metricsOnce sync.Once
+	traceFile   string
 }
 
 // Conf is the configuration for a server instance.
@@ -49,11 +63,19 @@ type Conf struct {
 	Version *version.V // Necessary for reporting server status.
 
 	ClientCA string
+
+	// MetricsAddress is the tcp host:port to serve metrics on. If empty,
+	// then metrics are not served.
+	MetricsAddress string
+
+	// TraceFile is the path of the file to export trace spans to in the
+	// OTLP/JSON format. If empty, then requests are not traced.
+	TraceFile string
 }
 
 // New creates a new server with the provided configuration and handler.
 func New(c *Conf, handler interface{}) (*S, error) {
-	s := &S{end: c.End}
+	s := &S{end: c.End, metricsAddr: c.MetricsAddress, traceFile: c.TraceFile}
 
 	// Setup the RPC server with handler.
 	r := rpc.NewServer()
@@ -89,6 +111,17 @@ func New(c *Conf, handler interface{}) (*S, error) {
 	if s.status, err = newStatus(c.Version); err != nil {
 		return nil, NewStatusError{Err: err}
 	}
+
+	// Take over the listening socket if started for a handover.
+	if s.inherited, err = inherit(); err != nil {
+		return nil, InheritError{Err: err}
+	}
+
+	// Register for drain signals already here, so that they do not
+	// terminate the process before serving: signals received earlier
+	// are handled once Serve is called.
+	s.sigc = make(chan os.Signal, 1)
+	signal.Notify(s.sigc, syscall.SIGUSR1, syscall.SIGUSR2)
 	return s, nil
 }
 
@@ -99,14 +132,27 @@ type AuthConf struct {
 	Age      *age.Checker
 }
 
-// NewAuthConf initializes an AuthConf with the given configurations.
-func NewAuthConf(a auth.Conf, i identity.Type, g *age.Conf) (AuthConf, error) {
+// Store is the interface for looking up voter data imported into the storage
+// service. It is implemented by the storage client.
+type Store interface {
+	auth.Store
+	age.Store
+}
+
+// NewAuthConf initializes an AuthConf with the given configurations. store is
+// used to look up pre-registered credentials and voters' dates of birth if
+// required by the authentication or age check methods and can be nil
+// otherwise.
+func NewAuthConf(a auth.Conf, i identity.Type, g *age.Conf, store Store) (AuthConf, error) {
 	var conf AuthConf
 	var err error
 	if len(a) > 0 {
 		if conf.Auth, err = auth.Configure(a); err != nil {
 			return conf, AuthConfError{Err: err}
 		}
+		if store != nil {
+			conf.Auth.UseStore(store)
+		}
 	}
 
 	if len(i) > 0 {
@@ -125,7 +171,7 @@ func NewAuthConf(a auth.Conf, i identity.Type, g *age.Conf) (AuthConf, error) {
 		if conf.Identity == nil {
 			return conf, AgeWithoutIdentityError{}
 		}
-		if conf.Age, err = age.New(g); err != nil {
+		if conf.Age, err = age.New(g, store); err != nil {
 			return conf, AgeConfError{Err: err}
 		}
 	}
@@ -143,14 +189,38 @@ func (s *S) WithAuth(conf AuthConf) *S {
 // server handler on new goroutines. It blocks until ctx is cancelled or a
 // non-temporary error occurs, after which it waits until all open connections
 // are served.
+//
+// Serve also stops accepting connections and returns once open connections
+// are served, i.e., drains the server, when the process receives SIGUSR1. On
+// SIGUSR2 it first starts a new process of the current executable, which takes
+// over the listening socket, so that an updated binary can be rolled out
+// without refusing any connections. If the new process fails to start, then
+// the server continues serving.
 func (s *S) Serve(ctx context.Context) error {
-	l, err := net.ListenTCP("tcp", s.addr)
+	s.serveMetrics(ctx)
+
+	if len(s.traceFile) > 0 {
+		e, err := trace.NewFileExporter(s.traceFile, filepath.Base(os.Args[0]))
+		if err != nil {
+			return ServeTraceError{Err: err}
+		}
+		trace.SetExporter(e)
+		defer func() {
+			trace.SetExporter(nil)
+			if err := e.Close(); err != nil {
+				log.Error(ctx, CloseTraceError{Err: err})
+			}
+		}()
+	}
+
+	l, err := s.listen(ctx)
 	if err != nil {
-		return ServeListenError{Address: s.addr, Err: err}
+		return err
 	}
 
 	// Set the server state to serving and set to ended at s.end.
 	if err := s.status.serving(); err != nil {
+		l.Close()
 		return ServeStatusServingError{Err: err}
 	}
 
@@ -210,17 +280,30 @@ func (s *S) Serve(ctx context.Context) error {
 		}
 	}()
 
-	// Wait until context is cancelled or an error occurs.
-	select {
-	case <-ctx.Done():
-	case err := <-errc:
-		log.Error(ctx, AcceptingConnectionFailed{Err: err})
+	// Wait until context is cancelled, an error occurs, or the server
+	// starts draining.
+	var draining bool
+serve:
+	for {
+		select {
+		case <-ctx.Done():
+			break serve
+		case err := <-errc:
+			log.Error(ctx, AcceptingConnectionFailed{Err: err})
+			break serve
+		case sig := <-s.sigc:
+			if draining = s.drain(ctx, l, sig); draining {
+				break serve
+			}
+		}
 	}
 
 	// If updating the status returns an error, then only log it: do not
 	// skip closing the listener.
-	if err := s.status.stopping(); err != nil {
-		log.Error(ctx, ServeStatusStoppingError{Err: err})
+	if !draining {
+		if err := s.status.stopping(); err != nil {
+			log.Error(ctx, ServeStatusStoppingError{Err: err})
+		}
 	}
 
 	if err := l.Close(); err != nil {
@@ -230,6 +313,45 @@ func (s *S) Serve(ctx context.Context) error {
 	return nil
 }
 
+// listen returns the inherited listening socket or starts listening on s.addr.
+// If the socket is inherited, then the previous server process is notified
+// that this process is accepting connections.
+func (s *S) listen(ctx context.Context) (*net.TCPListener, error) {
+	if s.inherited == nil {
+		l, err := net.ListenTCP("tcp", s.addr)
+		if err != nil {
+			return nil, ServeListenError{Address: s.addr, Err: err}
+		}
+		return l, nil
+	}
+
+	l := s.inherited.listener
+	log.Log(ctx, InheritedListener{Address: l.Addr()})
+	if err := s.inherited.ready(); err != nil {
+		l.Close()
+		return nil, ServeHandoverError{Err: err}
+	}
+	s.inherited = nil
+	return l, nil
+}
+
+// drain handles signal sig received while serving on l and reports if the
+// server is draining. On SIGUSR2 the listening socket is first handed over to
+// a new process.
+func (s *S) drain(ctx context.Context, l *net.TCPListener, sig os.Signal) bool {
+	log.Log(ctx, DrainSignal{Signal: sig})
+	if sig == syscall.SIGUSR2 {
+		if err := s.handover(ctx, l); err != nil {
+			log.Error(ctx, HandoverError{Err: err})
+			return false
+		}
+	} else if err := s.status.draining(); err != nil {
+		log.Error(ctx, ServeStatusDrainingError{Err: err})
+	}
+	log.Log(ctx, Draining{})
+	return true
+}
+
 // ServeAt waits until start and then calls Serve.
 func (s *S) ServeAt(ctx context.Context, start time.Time) error {
 	// Ensure that the server can bind to s.addr. Preferrably we would
@@ -244,16 +366,36 @@ func (s *S) ServeAt(ctx context.Context, start time.Time) error {
 	// immediately closing it. This does not guarantee that Serve will be
 	// able to listen on the address, but at least performs some elementary
 	// checks.
-	l, err := net.ListenTCP("tcp", s.addr)
-	if err != nil {
-		return ServeAtListenError{Address: s.addr, Err: err}
-	}
-	if err := l.Close(); err != nil {
-		return ServeAtCloseListenerError{Err: err}
+	//
+	// If the socket is inherited, then the address is in use by the
+	// previous server process and there is nothing to check.
+	if s.inherited == nil {
+		l, err := net.ListenTCP("tcp", s.addr)
+		if err != nil {
+			return ServeAtListenError{Address: s.addr, Err: err}
+		}
+		if err := l.Close(); err != nil {
+			return ServeAtCloseListenerError{Err: err}
+		}
 	}
 
+	// Serve metrics already while waiting for start.
+	s.serveMetrics(ctx)
+
 	if err := s.status.waiting(); err != nil {
 		return ServeAtStatusWaitingError{Err: err}
 	}
 	return waitStart(ctx, start, s.Serve)
 }
+
+// serveMetrics starts serving metrics in the background if a metrics address
+// is configured and they are not served yet.
+func (s *S) serveMetrics(ctx context.Context) {
+	if len(s.metricsAddr) == 0 {
+		return
+	}
+	// During a handover the previous server process is still serving
+	// metrics, so keep retrying until it releases the address.
+	retry := s.inherited != nil
+	s.metricsOnce.Do(func() { go serveMetrics(ctx, s.metricsAddr, retry) })
+}
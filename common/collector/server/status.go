@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"net"
 	"os"
+	"strconv"
 	"sync"
 	"time"
 
@@ -58,6 +59,17 @@ func (s *status) serving() error {
 // ended sets the systemd status string to "ended".
 func (s *status) ended() error { return s.set("ended") }
 
+// draining sets the systemd status string to "draining" and notifies systemd
+// that the server is stopping once open connections are served.
+func (s *status) draining() error { return s.set("draining", "STOPPING=1") }
+
+// handover sets the systemd status string to "draining" and notifies systemd
+// that process pid is the new main process of the service. After this, status
+// updates from this process are no longer accepted.
+func (s *status) handover(pid int) error {
+	return s.set("draining", "MAINPID="+strconv.Itoa(pid))
+}
+
 // stopping sets the systemd status string to "stopping" and notifies systemd
 // that the server is stopping.
 func (s *status) stopping() error { return s.set("stopping", "STOPPING=1") }
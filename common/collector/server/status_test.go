@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/conf/version"
+)
+
+func TestStatusDrain(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenPacket("unixgram", socket)
+	if err != nil {
+		t.Fatal("failed to listen on notify socket:", err)
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", socket)
+
+	s, err := newStatus(new(version.V))
+	if err != nil {
+		t.Fatal("failed to create status:", err)
+	}
+
+	read := func() string {
+		buf := make([]byte, 4096)
+		if err := conn.SetReadDeadline(time.Now().Add(time.Second)); err != nil {
+			t.Fatal("failed to set deadline:", err)
+		}
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatal("failed to read notification:", err)
+		}
+		return string(buf[:n])
+	}
+
+	tests := []struct {
+		name   string
+		set    func() error
+		status string
+		extra  string
+	}{
+		{"draining", s.draining, `"Status":"draining"`, "\nSTOPPING=1"},
+		{"handover", func() error { return s.handover(1234) }, `"Status":"draining"`, "\nMAINPID=1234"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.set(); err != nil {
+				t.Fatal("failed to set status:", err)
+			}
+			msg := read()
+			if !strings.HasPrefix(msg, "STATUS=") || !strings.Contains(msg, test.status) ||
+				!strings.HasSuffix(msg, test.extra) {
+
+				t.Errorf("unexpected notification: %q", msg)
+			}
+		})
+	}
+}
@@ -91,7 +91,7 @@ func (c *Client) parseAndVerify(ctx context.Context, certDER []byte) (
 	}
 
 	// Check OCSP status.
-	status, err := c.ocsp.Check(ctx, cert, issuer, nil)
+	status, err := c.ocsp.CheckCached(ctx, cert, issuer)
 	if err != nil {
 		err = CheckAuthenticationCertOCSPResponsError{
 			Response: status,
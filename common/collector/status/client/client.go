@@ -8,6 +8,7 @@ const (
 	MobileIDAuth = "mid"
 	SmartIDAuth  = "sid"
 	WebeIDAuth   = "wid"
+	WebAuthnAuth = "wa"
 	NoAuth       = ""
 )
 
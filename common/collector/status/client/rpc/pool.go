@@ -0,0 +1,334 @@
+package rpc
+
+import (
+	"crypto/tls"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	status "ivxv.ee/common/collector/status/client"
+)
+
+// Default values for unset PoolConf fields.
+const (
+	defaultMaxConns    = 16
+	defaultKeepAlive   = 30 * time.Second
+	defaultIdleTimeout = 60 * time.Second
+	defaultHealthCheck = 5 * time.Second
+	defaultCallTimeout = 10 * time.Second
+	dialTimeout        = 5 * time.Second
+)
+
+// PoolConf is the connection pool configuration of a pooled TLS client. Zero
+// values are replaced with defaults.
+type PoolConf struct {
+	// MaxConns is the maximum number of open connections, and therefore
+	// concurrent requests, to a single status server instance.
+	MaxConns int64
+
+	// KeepAlive is the TCP keepalive period of connections in seconds.
+	KeepAlive int64
+
+	// IdleTimeout is the time in seconds after which idle connections are
+	// closed instead of reused.
+	IdleTimeout int64
+
+	// HealthCheck is the interval in seconds in which unhealthy instances
+	// are checked for recovery.
+	HealthCheck int64
+
+	// CallTimeout is the time in seconds to wait for a response to a
+	// single request from an instance.
+	CallTimeout int64
+
+	// Idempotent lists the service methods which can safely be sent again
+	// if it is unknown whether an instance already applied the request,
+	// e.g., because the response timed out. Other requests are only retried
+	// with another instance if they were not sent.
+	Idempotent []string
+}
+
+// instance is a single status server instance with its idle connections.
+type instance struct {
+	addr string
+	sem  chan struct{} // Bounds the number of open connections.
+
+	mu      sync.Mutex
+	idle    []*pooledConn
+	healthy bool
+}
+
+// pooledConn is a persistent RPC connection to a status server instance.
+type pooledConn struct {
+	*rpc.Client
+	used time.Time // Time when the connection was last returned to the pool.
+}
+
+// pooledClient keeps persistent TLS connections to all status server
+// instances and fails over between them.
+type pooledClient struct {
+	instances   []*instance
+	next        uint32 // Round-robin counter for choosing the first instance.
+	tls         *tls.Config
+	dialer      *net.Dialer
+	idleTimeout time.Duration
+	healthCheck time.Duration
+	callTimeout time.Duration
+	idempotent  map[string]bool
+}
+
+// NewPooledTLSClient returns a new RPC TLS client to status server instances
+// at addrs which reuses connections across calls.
+//
+// Requests are distributed round-robin over healthy instances. If a
+// connection to an instance fails, then the instance is marked unhealthy and
+// the request is retried with the next instance, given that the request was
+// not sent or is idempotent. A request which times out is treated as a failed
+// connection. Unhealthy instances are
+// periodically checked in the background and used again once a connection can
+// be established. If all instances are unhealthy, then all of them are still
+// tried.
+//
+// The requirements on TLS configuration conf are the same as for
+// NewTLSClient.
+func NewPooledTLSClient(addrs []string, conf *tls.Config, pool *PoolConf) status.TLSDialer {
+	if pool == nil {
+		pool = new(PoolConf)
+	}
+	maxConns := orDefault[int64](pool.MaxConns, 1, defaultMaxConns)
+
+	p := &pooledClient{
+		tls: conf,
+		dialer: &net.Dialer{
+			Timeout:   dialTimeout,
+			KeepAlive: orDefault(pool.KeepAlive, time.Second, defaultKeepAlive),
+		},
+		idleTimeout: orDefault(pool.IdleTimeout, time.Second, defaultIdleTimeout),
+		healthCheck: orDefault(pool.HealthCheck, time.Second, defaultHealthCheck),
+		callTimeout: orDefault(pool.CallTimeout, time.Second, defaultCallTimeout),
+		idempotent:  make(map[string]bool),
+	}
+	for _, method := range pool.Idempotent {
+		p.idempotent[method] = true
+	}
+	for _, addr := range addrs {
+		p.instances = append(p.instances, &instance{
+			addr:    addr,
+			sem:     make(chan struct{}, maxConns),
+			healthy: true,
+		})
+	}
+	return p
+}
+
+// orDefault returns value in units or def if value is not positive.
+func orDefault[T int64 | time.Duration](value int64, unit, def T) T {
+	if value <= 0 {
+		return def
+	}
+	return T(value) * unit
+}
+
+func (p *pooledClient) TLSDial(req interface{}) (interface{}, error) {
+	// Any data that is passed to TLSDial should be of a
+	// *StatusReq type, otherwise error
+	statusReq, err := castAnyToStatusReq(req)
+	if err != nil {
+		var castErr CastAnyToStatusReqError
+		castErr.Err = err
+		return nil, castErr
+	}
+
+	if len(p.instances) == 0 {
+		return nil, NoStatusInstancesError{}
+	}
+
+	for _, inst := range p.order() {
+		var resp *StatusResp
+		var failover bool
+		if resp, failover, err = p.call(inst, statusReq); !failover {
+			if err != nil {
+				return nil, err
+			}
+			return resp, nil
+		}
+		p.unhealthy(inst)
+	}
+	return nil, AllStatusInstancesFailedError{Err: err}
+}
+
+// order returns the instances in the order they should be tried: healthy
+// instances first, starting from the next one in round-robin order, followed
+// by unhealthy instances.
+func (p *pooledClient) order() []*instance {
+	start := int(atomic.AddUint32(&p.next, 1))
+	healthy := make([]*instance, 0, len(p.instances))
+	var unhealthy []*instance
+	for i := range p.instances {
+		inst := p.instances[(start+i)%len(p.instances)]
+		inst.mu.Lock()
+		ok := inst.healthy
+		inst.mu.Unlock()
+		if ok {
+			healthy = append(healthy, inst)
+		} else {
+			unhealthy = append(unhealthy, inst)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// call performs the request using a connection to instance inst. If the
+// request failed due to the connection and should be retried with another
+// instance, then failover is true.
+func (p *pooledClient) call(inst *instance, req *StatusReq) (
+	resp *StatusResp, failover bool, err error) {
+
+	// Block until a connection slot is available.
+	inst.sem <- struct{}{}
+	defer func() { <-inst.sem }()
+
+	conn, reused := inst.get(p.idleTimeout)
+	for {
+		if conn == nil {
+			if conn, err = p.dial(inst.addr); err != nil {
+				return nil, true, err
+			}
+		}
+
+		// rpcConn.Call(..., ..., reply), where reply is a map[string]any
+		resp = new(StatusResp)
+		var sent bool
+		sent, err = p.send(conn, req, resp)
+		if err == nil {
+			inst.put(conn)
+			return resp, false, nil
+		}
+
+		var callErr RPCCallError
+		callErr.ServiceMethod = req.ServiceMethod
+		callErr.Err = err
+		if _, ok := err.(rpc.ServerError); ok {
+			// The server responded, so the connection can be reused.
+			inst.put(conn)
+			return nil, false, callErr
+		}
+
+		// The connection is broken. If the request may have reached the
+		// instance, then only send it again if it is idempotent.
+		conn.Close()
+		conn = nil
+		if sent && !p.idempotent[req.ServiceMethod] {
+			return nil, false, callErr
+		}
+
+		// If it was an idle connection, then the server may have closed
+		// it: retry once with a new connection before failing over.
+		if !reused {
+			return nil, true, callErr
+		}
+		reused = false
+	}
+}
+
+// send performs the request on conn and waits at most p.callTimeout for the
+// response. If the call fails, then sent reports if the request may have
+// reached the server.
+func (p *pooledClient) send(conn *pooledConn, req *StatusReq, resp *StatusResp) (
+	sent bool, err error) {
+
+	timer := time.NewTimer(p.callTimeout)
+	defer timer.Stop()
+
+	call := conn.Go(req.ServiceMethod, req.Request, &resp.Response, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		// net/rpc only reports ErrShutdown for calls which it did not
+		// send, because the connection was already broken. Calls which
+		// were pending when the connection broke get the read error.
+		return call.Error != rpc.ErrShutdown, call.Error
+	case <-timer.C:
+		// Closing the connection makes the call return, which frees
+		// the goroutine reading responses from it.
+		conn.Close()
+		return true, CallTimeoutError{Timeout: p.callTimeout}
+	}
+}
+
+// dial establishes a new TLS connection to addr.
+func (p *pooledClient) dial(addr string) (*pooledConn, error) {
+	tlsConn, err := tls.DialWithDialer(p.dialer, tcp, addr, p.tls)
+	if err != nil {
+		var dialErr TLSDialError
+		dialErr.Addr = addr
+		dialErr.Err = err
+		return nil, dialErr
+	}
+	return &pooledConn{Client: jsonrpc.NewClient(tlsConn)}, nil
+}
+
+// unhealthy marks inst as unhealthy, closes its idle connections, and starts
+// checking it in the background.
+func (p *pooledClient) unhealthy(inst *instance) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if !inst.healthy {
+		return // Already being checked.
+	}
+	inst.healthy = false
+	for _, conn := range inst.idle {
+		conn.Close()
+	}
+	inst.idle = nil
+	go p.check(inst)
+}
+
+// check periodically tries to establish a connection to inst until it
+// succeeds and then marks inst as healthy again.
+func (p *pooledClient) check(inst *instance) {
+	for {
+		time.Sleep(p.healthCheck)
+		conn, err := p.dial(inst.addr)
+		if err != nil {
+			continue
+		}
+		conn.Close()
+		inst.mu.Lock()
+		inst.healthy = true
+		inst.mu.Unlock()
+		return
+	}
+}
+
+// get returns the most recently used idle connection of inst which has not
+// timed out or nil if there are none. reused reports if a connection was
+// returned.
+func (inst *instance) get(timeout time.Duration) (conn *pooledConn, reused bool) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	for len(inst.idle) > 0 {
+		conn = inst.idle[len(inst.idle)-1]
+		inst.idle = inst.idle[:len(inst.idle)-1]
+		if time.Since(conn.used) < timeout {
+			return conn, true
+		}
+		conn.Close()
+	}
+	return nil, false
+}
+
+// put returns conn to the idle connections of inst. If the pool is full, then
+// conn is closed.
+func (inst *instance) put(conn *pooledConn) {
+	inst.mu.Lock()
+	defer inst.mu.Unlock()
+	if !inst.healthy || len(inst.idle) >= cap(inst.sem) {
+		conn.Close()
+		return
+	}
+	conn.used = time.Now()
+	inst.idle = append(inst.idle, conn)
+}
@@ -0,0 +1,233 @@
+package rpc
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"math/big"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+)
+
+// Echo is a status server RPC service for testing.
+type Echo struct{}
+
+func (Echo) Echo(req map[string]any, resp *map[string]any) error {
+	*resp = req
+	return nil
+}
+
+func (Echo) Fail(_ map[string]any, _ *map[string]any) error {
+	return rpc.ServerError("failed")
+}
+
+// hung counts the calls to Hang, which block until hangRelease is closed.
+var (
+	hung        int32
+	hangRelease = make(chan struct{})
+)
+
+func (Echo) Hang(_ map[string]any, _ *map[string]any) error {
+	atomic.AddInt32(&hung, 1)
+	<-hangRelease
+	return nil
+}
+
+// statusServer is a status server instance for testing which counts the number of
+// accepted connections.
+type statusServer struct {
+	ln       net.Listener
+	accepted int32
+}
+
+func newServer(t *testing.T, conf *tls.Config) *statusServer {
+	ln, err := tls.Listen(tcp, "127.0.0.1:0", conf)
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	srv := rpc.NewServer()
+	if err = srv.RegisterName("RPC", Echo{}); err != nil {
+		t.Fatal("failed to register service:", err)
+	}
+	s := &statusServer{ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&s.accepted, 1)
+			go srv.ServeCodec(jsonrpc.NewServerCodec(conn))
+		}
+	}()
+	return s
+}
+
+// tlsConfigs returns server and client TLS configurations with a self-signed
+// server certificate for 127.0.0.1.
+func tlsConfigs(t *testing.T) (serverConf, clientConf *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal("failed to parse certificate:", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		MinVersion:   tls.VersionTLS12,
+	}, &tls.Config{
+		RootCAs:    pool,
+		MinVersion: tls.VersionTLS12,
+	}
+}
+
+func echo(t *testing.T, client interface {
+	TLSDial(interface{}) (interface{}, error)
+}) {
+	resp, err := client.TLSDial(&StatusReq{
+		ServiceMethod: "RPC.Echo",
+		Request:       map[string]any{"SessionID": "0101e9342abab1577b8b2844d6a1d317"},
+	})
+	if err != nil {
+		t.Error("unexpected error:", err)
+		return
+	}
+	if id := resp.(*StatusResp).Response["SessionID"]; id != "0101e9342abab1577b8b2844d6a1d317" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+}
+
+func TestPooledTLSClientReuse(t *testing.T) {
+	serverConf, clientConf := tlsConfigs(t)
+	s := newServer(t, serverConf)
+	client := NewPooledTLSClient([]string{s.ln.Addr().String()}, clientConf,
+		&PoolConf{MaxConns: 2})
+
+	// Sequential calls reuse a single connection.
+	for i := 0; i < 5; i++ {
+		echo(t, client)
+	}
+	if accepted := atomic.LoadInt32(&s.accepted); accepted != 1 {
+		t.Errorf("unexpected number of connections: %d, want 1", accepted)
+	}
+
+	// Server errors do not close the connection.
+	_, err := client.TLSDial(&StatusReq{ServiceMethod: "RPC.Fail", Request: map[string]any{}})
+	if err == nil {
+		t.Error("unexpected success of failing call")
+	}
+	echo(t, client)
+	if accepted := atomic.LoadInt32(&s.accepted); accepted != 1 {
+		t.Errorf("unexpected number of connections: %d, want 1", accepted)
+	}
+
+	// Concurrent calls open at most MaxConns connections.
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			echo(t, client)
+		}()
+	}
+	wg.Wait()
+	if accepted := atomic.LoadInt32(&s.accepted); accepted > 2 {
+		t.Errorf("unexpected number of connections: %d, want at most 2", accepted)
+	}
+}
+
+func TestPooledTLSClientFailover(t *testing.T) {
+	serverConf, clientConf := tlsConfigs(t)
+	s := newServer(t, serverConf)
+
+	// Reserve an address with no server listening on it.
+	ln, err := net.Listen(tcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("failed to listen:", err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	client := NewPooledTLSClient([]string{down, s.ln.Addr().String()}, clientConf, nil)
+	for i := 0; i < 3; i++ {
+		echo(t, client)
+	}
+
+	p := client.(*pooledClient)
+	p.instances[0].mu.Lock()
+	healthy := p.instances[0].healthy
+	p.instances[0].mu.Unlock()
+	if healthy {
+		t.Error("unavailable instance not marked unhealthy")
+	}
+
+	// With all instances down, the last error is returned.
+	s.ln.Close()
+	p.unhealthy(p.instances[1])
+	_, err = client.TLSDial(&StatusReq{ServiceMethod: "RPC.Echo", Request: map[string]any{}})
+	if errors.CausedBy(err, new(AllStatusInstancesFailedError)) == nil {
+		t.Errorf("unexpected error: %v, want AllStatusInstancesFailedError", err)
+	}
+}
+
+func TestPooledTLSClientTimeout(t *testing.T) {
+	serverConf, clientConf := tlsConfigs(t)
+	first, second := newServer(t, serverConf), newServer(t, serverConf)
+	defer close(hangRelease)
+
+	addrs := []string{first.ln.Addr().String(), second.ln.Addr().String()}
+	hang := func(idempotent []string) error {
+		client := NewPooledTLSClient(addrs, clientConf,
+			&PoolConf{CallTimeout: 1, Idempotent: idempotent})
+		start := time.Now()
+		_, err := client.TLSDial(&StatusReq{ServiceMethod: "RPC.Hang", Request: map[string]any{}})
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("call took %s, want about the call timeout", elapsed)
+		}
+		return err
+	}
+
+	// A non-idempotent request which may have been applied is not sent
+	// to another instance.
+	if err := hang(nil); errors.CausedBy(err, new(CallTimeoutError)) == nil {
+		t.Errorf("unexpected error: %v, want CallTimeoutError", err)
+	}
+	if n := atomic.LoadInt32(&hung); n != 1 {
+		t.Errorf("non-idempotent request sent %d times, want 1", n)
+	}
+
+	// An idempotent request is sent to all instances.
+	atomic.StoreInt32(&hung, 0)
+	if err := hang([]string{"RPC.Hang"}); errors.CausedBy(err, new(AllStatusInstancesFailedError)) == nil {
+		t.Errorf("unexpected error: %v, want AllStatusInstancesFailedError", err)
+	}
+	if n := atomic.LoadInt32(&hung); n != 2 {
+		t.Errorf("idempotent request sent %d times, want 2", n)
+	}
+}
@@ -0,0 +1,36 @@
+package rpc
+
+import (
+	"context"
+
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/status/client"
+	"ivxv.ee/common/collector/trace"
+)
+
+// tracedVerifier is a client.Verifier which traces calls to another
+// client.Verifier.
+type tracedVerifier struct {
+	client.Verifier
+}
+
+// Traced returns a client.Verifier which traces each call to v in the context
+// of the server.Header in the VerifyReq.
+func Traced(v client.Verifier) client.Verifier {
+	return tracedVerifier{v}
+}
+
+func (t tracedVerifier) Verify(req interface{}) (ok bool, err error) {
+	ctx := context.Background()
+	var method string
+	if verifyReq, cerr := CastAnyToVerifyReq(req); cerr == nil {
+		method = verifyReq.ServiceMethod
+		if header, hok := verifyReq.Request.(server.Header); hok && header.Ctx != nil {
+			ctx = header.Ctx
+		}
+	}
+
+	_, span := trace.Start(ctx, "status.Verify", "method", method)
+	defer func() { span.Finish(err) }()
+	return t.Verifier.Verify(req)
+}
@@ -1,5 +1,10 @@
 package status
 
+import (
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/identity"
+)
+
 // Conf is a configuration for each Observable.
 type Conf struct {
 	// Session is an Observable for a SessionID status.
@@ -8,6 +13,11 @@ type Conf struct {
 
 // Observable represents a Status service configuration.
 type Observable struct {
+	// Embedded makes services process status requests in-process against
+	// the storage instead of using a separate status service. Intended for
+	// test and small single-node deployments.
+	Embedded bool
+
 	// ServerName is used to resolve server SNI during a TLS handshake.
 	ServerName string
 
@@ -22,4 +32,46 @@ type Observable struct {
 
 	// VerifyTTL is a time in seconds for user to verify a choice.
 	VerifyTTL int64
+
+	// MaxConns is the maximum number of connections to a single status
+	// service instance. Optional, defaults to 16.
+	MaxConns int64
+
+	// KeepAlive is the TCP keepalive period in seconds of connections to
+	// status service instances. Optional, defaults to 30.
+	KeepAlive int64
+
+	// IdleTimeout is the time in seconds after which idle connections to
+	// status service instances are closed. Optional, defaults to 60.
+	IdleTimeout int64
+
+	// HealthCheck is the interval in seconds in which unavailable status
+	// service instances are checked for recovery. Optional, defaults to 5.
+	HealthCheck int64
+
+	// CallTimeout is the time in seconds to wait for a response from a
+	// status service instance. Optional, defaults to 10.
+	CallTimeout int64
+
+	// HistoryTTL is the time in seconds for which status histories are
+	// retained after the last update. Optional, defaults to 86400.
+	HistoryTTL int64
+
+	// Admin enables status history lookups for operators. Optional.
+	Admin *Admin
+}
+
+// Admin is the configuration of operator access to a status service.
+type Admin struct {
+	// Auth configures the authentication of operators. Operators must
+	// also present a TLS client certificate trusted by the status service.
+	Auth auth.Conf
+
+	// Identity is the type of identifier extracted from authenticated
+	// operators' names.
+	Identity identity.Type
+
+	// Operators are the identifiers of operators allowed to look up
+	// status histories.
+	Operators []string
 }
@@ -0,0 +1,455 @@
+/*
+Package bolt implements a storage protocol which reads and writes data from an
+embedded, single-file bbolt database.
+
+The protocol is meant for small elections and staging environments where all
+collector services run on a single host and operating an etcd cluster is not
+justified. Every operation is performed in a single bbolt transaction, so the
+database file stays consistent even if a service crashes mid-write.
+
+bbolt only allows one process at a time to have the database file open for
+writing. In order for several collector services to share the same database,
+each operation opens the file, performs its transaction and closes the file
+again. Concurrent operations are serialized using the file lock, which is
+waited on for at most OpTimeout seconds.
+
+Keys which are attached to an expired lease (see
+ivxv.ee/common/collector/storage.PutGetterWithOpts) are treated as missing and
+are removed by the next write transaction that encounters them.
+*/
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/yaml"
+)
+
+func init() {
+	storage.Register(storage.Bolt, func(n yaml.Node, _ *storage.Services) (
+		s storage.PutGetter, err error) {
+
+		var cfg Conf
+		if err = yaml.Apply(n, &cfg); err != nil {
+			return nil, ConfigurationError{Err: err}
+		}
+		return New(&cfg)
+	})
+}
+
+// Conf is the bolt storage protocol configuration.
+type Conf struct {
+	// Path is the location of the database file. The file and any
+	// missing parent directories are created if they do not exist. The
+	// file must be readable and writable by all collector services which
+	// use it.
+	Path string
+
+	// OpTimeout is the timeout for acquiring the database file lock for a
+	// single operation in seconds. If 0, then defaults to 10 seconds.
+	OpTimeout int64
+}
+
+// defaultOpTimeout is used if Conf.OpTimeout is not set.
+const defaultOpTimeout = 10 * time.Second
+
+// Buckets used to store the data. Values, serials and lease attachments are
+// kept in separate buckets with the same keys so that the values themselves
+// are stored without any encoding.
+var (
+	valuesBucket    = []byte("values")    // Key to value.
+	serialsBucket   = []byte("serials")   // Key to serial, see GetWithSerial.
+	keyLeasesBucket = []byte("keyleases") // Key to attached lease ID.
+	leasesBucket    = []byte("leases")    // Lease ID to expiration time.
+)
+
+type client struct {
+	path   string
+	optime time.Duration
+
+	// lock serializes access to the database file between goroutines of
+	// this process, so that they do not have to poll for the file lock.
+	lock sync.RWMutex
+
+	// now returns the current time used for lease expiration. It is a
+	// field so that it can be overridden by tests.
+	now func() time.Time
+}
+
+// New creates a new bolt storage protocol client with the provided
+// configuration. New creates the database file if it does not exist yet.
+//
+// Using the storage protocol registry is preferred to New, but the latter can
+// be useful for tools and testing.
+func New(cfg *Conf) (storage.PutGetter, error) {
+	if cfg.Path == "" {
+		return nil, MissingPathError{}
+	}
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0770); err != nil {
+		return nil, DatabaseDirectoryError{Path: cfg.Path, Err: err}
+	}
+
+	c := &client{
+		path:   cfg.Path,
+		optime: time.Duration(cfg.OpTimeout) * time.Second,
+		now:    time.Now,
+	}
+	if c.optime == 0 {
+		c.optime = defaultOpTimeout
+	}
+
+	// Create the database file and all buckets, so that later read-only
+	// transactions can assume that they exist.
+	if err := c.update(context.Background(), func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{valuesBucket, serialsBucket,
+			keyLeasesBucket, leasesBucket} {
+
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return CreateBucketError{Bucket: string(name), Err: err}
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, InitializeDatabaseError{Path: cfg.Path, Err: err}
+	}
+	return c, nil
+}
+
+// open opens the database file, waiting for the file lock for at most the
+// operation timeout or until the deadline of ctx.
+func (c *client) open(ctx context.Context, readOnly bool) (*bolt.DB, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	timeout := c.optime
+	if deadline, ok := ctx.Deadline(); ok {
+		if left := time.Until(deadline); left < timeout {
+			timeout = left
+		}
+	}
+	if timeout <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	return bolt.Open(c.path, 0660, &bolt.Options{
+		Timeout:  timeout,
+		ReadOnly: readOnly,
+	})
+}
+
+// view opens the database file and calls f within a read-only transaction.
+func (c *client) view(ctx context.Context, f func(*bolt.Tx) error) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	db, err := c.open(ctx, true)
+	if err != nil {
+		return ViewOpenError{Path: c.path, Err: err}
+	}
+	defer db.Close() // Nothing is written, so ignore close errors.
+	return db.View(f)
+}
+
+// update opens the database file and calls f within a read-write transaction.
+// If f returns nil, then the transaction is committed, otherwise it is rolled
+// back.
+func (c *client) update(ctx context.Context, f func(*bolt.Tx) error) (err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	db, err := c.open(ctx, false)
+	if err != nil {
+		return UpdateOpenError{Path: c.path, Err: err}
+	}
+	defer func() {
+		if cerr := db.Close(); cerr != nil && err == nil {
+			err = UpdateCloseError{Path: c.path, Err: cerr}
+		}
+	}()
+	return db.Update(f)
+}
+
+func (c *client) BatchSize() int {
+	// Not limited by bbolt, but keep transactions reasonably small since
+	// they block all other services using the database.
+	return 128
+}
+
+func (c *client) Put(ctx context.Context, key string, value []byte) error {
+	log.Debug(ctx, PutRequest{Key: key, Value: value})
+	var exists bool
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		if _, serial := lookup(tx, key, now); serial > 0 {
+			exists = true
+			return nil
+		}
+		return store(tx, key, value, now)
+	}); err != nil {
+		return log.Alert(PutError{Key: key, Err: err})
+	}
+
+	if exists {
+		return storage.ExistError{Key: key, Err: PutExistingKeyError{}}
+	}
+	return nil
+}
+
+func (c *client) PutAll(ctx context.Context, reqs ...storage.PutAllRequest) error {
+	if len(reqs) > c.BatchSize() {
+		return PutAllBatchSizeError{Count: len(reqs), Max: c.BatchSize()}
+	}
+
+	log.Debug(ctx, PutAllRequest{Count: len(reqs)})
+	var existing string
+	var exists bool
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		for _, req := range reqs { // Find the first existing key.
+			if _, serial := lookup(tx, req.Key, now); serial > 0 {
+				existing, exists = req.Key, true
+				return nil
+			}
+		}
+		for _, req := range reqs {
+			if err := store(tx, req.Key, req.Value, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return log.Alert(PutAllError{Err: err})
+	}
+
+	if exists {
+		return storage.ExistError{Key: existing, Err: PutAllExistingKeyError{}}
+	}
+	return nil
+}
+
+func (c *client) Get(ctx context.Context, key string) (value []byte, err error) {
+	log.Debug(ctx, GetRequest{Key: key})
+	var serial int64
+	if err = c.view(ctx, func(tx *bolt.Tx) error {
+		value, serial = lookup(tx, key, c.now())
+		return nil
+	}); err != nil {
+		return nil, log.Alert(GetError{Key: key, Err: err})
+	}
+
+	if serial == 0 {
+		return nil, storage.NotExistError{Key: key, Err: GetMissingKeyError{}}
+	}
+	return
+}
+
+func (c *client) GetAll(ctx context.Context, keys ...string) (
+	values map[string][]byte, err error) {
+
+	if len(keys) > c.BatchSize() {
+		return nil, GetAllBatchSizeError{Count: len(keys), Max: c.BatchSize()}
+	}
+
+	log.Debug(ctx, GetAllRequest{Count: len(keys)})
+	values = make(map[string][]byte)
+	if err = c.view(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		for _, key := range keys {
+			if value, serial := lookup(tx, key, now); serial > 0 {
+				values[key] = value
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, log.Alert(GetAllError{Err: err})
+	}
+	log.Debug(ctx, GetAllResponse{Count: len(values)})
+	return
+}
+
+// blockSize is the maximum number of key-values that GetWithPrefix reads from
+// the database in a single transaction. Reading in blocks avoids holding the
+// file lock while the caller is processing results.
+const blockSize = 1024
+
+func (c *client) GetWithPrefix(ctx context.Context, prefix string) (
+	<-chan storage.GetWithPrefixResult, <-chan error) {
+
+	ch := make(chan storage.GetWithPrefixResult)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(ch)
+
+		from := []byte(prefix)
+		for from != nil {
+			var block []storage.GetWithPrefixResult
+			var err error
+			log.Debug(ctx, GetRangeRequest{Prefix: prefix, Key: from})
+			if block, from, err = c.getRange(ctx, prefix, from); err != nil {
+				errc <- log.Alert(GetWithPrefixError{Prefix: prefix, Err: err})
+				return
+			}
+			log.Debug(ctx, GetRangeResponse{Count: len(block)})
+
+			for _, r := range block {
+				select {
+				case ch <- r:
+				case <-ctx.Done():
+					errc <- ctx.Err()
+					return
+				}
+			}
+		}
+	}()
+	return ch, errc
+}
+
+// getRange reads up to blockSize unexpired key-values with the given prefix,
+// starting from the key from. It returns the key to continue reading from in
+// the next block or nil if there are no more keys with the prefix.
+func (c *client) getRange(ctx context.Context, prefix string, from []byte) (
+	block []storage.GetWithPrefixResult, next []byte, err error) {
+
+	err = c.view(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		cur := tx.Bucket(valuesBucket).Cursor()
+		k, _ := cur.Seek(from)
+		for ; k != nil && bytes.HasPrefix(k, []byte(prefix)); k, _ = cur.Next() {
+			if len(block) == blockSize {
+				next = append([]byte(nil), k...)
+				return nil
+			}
+			if value, serial := lookup(tx, string(k), now); serial > 0 {
+				block = append(block, storage.GetWithPrefixResult{
+					Key:   string(k),
+					Value: value,
+				})
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func (c *client) GetWithSerial(ctx context.Context, key string) (
+	value []byte, serial int64, err error) {
+
+	log.Debug(ctx, GetWithSerialRequest{Key: key})
+	if err = c.view(ctx, func(tx *bolt.Tx) error {
+		value, serial = lookup(tx, key, c.now())
+		return nil
+	}); err != nil {
+		return nil, 0, log.Alert(GetWithSerialError{Key: key, Err: err})
+	}
+
+	if serial == 0 {
+		return nil, 0, storage.NotExistError{Key: key, Err: GetWithSerialMissingKeyError{}}
+	}
+	log.Debug(ctx, GetWithSerialResponse{Key: key, Serial: serial})
+	return
+}
+
+func (c *client) CAS(ctx context.Context, cas string, old, new []byte) error {
+	log.Debug(ctx, CASRequest{CAS: cas, Old: old, New: new})
+	var have []byte
+	var serial int64
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		if have, serial = lookup(tx, cas, now); serial == 0 || !bytes.Equal(have, old) {
+			return nil
+		}
+		return store(tx, cas, new, now)
+	}); err != nil {
+		return log.Alert(CASError{CAS: cas, Err: err})
+	}
+
+	switch {
+	case serial == 0:
+		return storage.NotExistError{Key: cas, Err: CASMissingCASKeyError{}}
+	case !bytes.Equal(have, old):
+		return storage.UnexpectedValueError{
+			Key: cas,
+			Err: CASValueMismatchError{
+				Have: string(have),
+				Want: string(old),
+			},
+		}
+	}
+	return nil
+}
+
+// lookup returns a copy of the value and the serial number of key. If the key
+// does not exist or is attached to an expired lease, then serial is 0.
+func lookup(tx *bolt.Tx, key string, now time.Time) (value []byte, serial int64) {
+	k := []byte(key)
+	s := tx.Bucket(serialsBucket).Get(k)
+	if s == nil || expired(tx, k, now) {
+		return nil, 0
+	}
+	value = append([]byte{}, tx.Bucket(valuesBucket).Get(k)...)
+	return value, int64(binary.BigEndian.Uint64(s))
+}
+
+// expired reports if key is attached to a lease which has expired or no
+// longer exists.
+func expired(tx *bolt.Tx, key []byte, now time.Time) bool {
+	id := tx.Bucket(keyLeasesBucket).Get(key)
+	if id == nil {
+		return false // Not attached to any lease.
+	}
+	expiry := tx.Bucket(leasesBucket).Get(id)
+	return expiry == nil || now.UnixNano() >= int64(binary.BigEndian.Uint64(expiry))
+}
+
+// store sets the value of key, detaching it from any lease. The serial number
+// of the key is incremented, or set to 1 if the key did not exist.
+func store(tx *bolt.Tx, key string, value []byte, now time.Time) error {
+	_, serial := lookup(tx, key, now)
+	if serial == 0 {
+		// Remove any expired leftovers to start from scratch.
+		if err := remove(tx, key); err != nil {
+			return err
+		}
+	}
+
+	k := []byte(key)
+	if err := tx.Bucket(valuesBucket).Put(k, value); err != nil {
+		return StoreValueError{Key: key, Err: err}
+	}
+	if err := tx.Bucket(serialsBucket).Put(k, itob(serial+1)); err != nil {
+		return StoreSerialError{Key: key, Err: err}
+	}
+	if err := tx.Bucket(keyLeasesBucket).Delete(k); err != nil {
+		return StoreDetachLeaseError{Key: key, Err: err}
+	}
+	return nil
+}
+
+// remove deletes key and all its metadata.
+func remove(tx *bolt.Tx, key string) error {
+	k := []byte(key)
+	for _, name := range [][]byte{valuesBucket, serialsBucket, keyLeasesBucket} {
+		if err := tx.Bucket(name).Delete(k); err != nil {
+			return RemoveError{Key: key, Bucket: string(name), Err: err}
+		}
+	}
+	return nil
+}
+
+// itob encodes a non-negative integer for storage so that byte order matches
+// numeric order.
+func itob(i int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(i))
+	return b
+}
@@ -0,0 +1,100 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storagetest"
+)
+
+func newClient(t *testing.T) (context.Context, *client) {
+	t.Helper()
+	p, err := New(&Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("new failed:", err)
+	}
+	return log.TestContext(context.Background()), p.(*client)
+}
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.PutGetter {
+		_, c := newClient(t)
+		return c
+	})
+}
+
+func TestSerial(t *testing.T) {
+	ctx, c := newClient(t)
+
+	if err := c.Put(ctx, "/counter", []byte("0")); err != nil {
+		t.Fatal("put failed:", err)
+	}
+	if err := c.CAS(ctx, "/counter", []byte("0"), []byte("1")); err != nil {
+		t.Fatal("CAS failed:", err)
+	}
+
+	// Serial numbers match etcd versions: 1 on creation and incremented
+	// on each modification.
+	if _, serial, err := c.GetWithSerial(ctx, "/counter"); err != nil || serial != 2 {
+		t.Errorf("unexpected serial: %d, %v", serial, err)
+	}
+}
+
+func TestLease(t *testing.T) {
+	ctx, c := newClient(t)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	err := c.PutForceWithOpts(ctx, "/session", []byte("auth"),
+		&storage.PutOpOptionWithTTL{TTL: "60"})
+	if err != nil {
+		t.Fatal("put with TTL failed:", err)
+	}
+
+	value, lease, err := c.GetWithLease(ctx, "/session")
+	if err != nil {
+		t.Fatal("get with lease failed:", err)
+	}
+	if !bytes.Equal(value, []byte("auth")) || lease == "0" {
+		t.Fatalf("unexpected value and lease: %q, %s", value, lease)
+	}
+
+	// Reusing the lease keeps the original expiration time.
+	now = now.Add(30 * time.Second)
+	if err = c.PutForceWithOpts(ctx, "/session", []byte("vote"),
+		&storage.PutOpOptionWithTTL{LeaseID: lease}); err != nil {
+
+		t.Fatal("put with existing lease failed:", err)
+	}
+
+	ttls, err := c.GetTTLs(ctx, "/")
+	if err != nil {
+		t.Fatal("get TTLs failed:", err)
+	}
+	if ttls["/session"] != 30 {
+		t.Errorf("unexpected TTLs: %v", ttls)
+	}
+
+	now = now.Add(31 * time.Second)
+	if ttls, err = c.GetTTLs(ctx, "/"); err != nil || len(ttls) > 0 {
+		t.Errorf("unexpected TTLs after expiration: %v, %v", ttls, err)
+	}
+	if value, _, err = c.GetWithLease(ctx, "/session"); err != nil || value != nil {
+		t.Errorf("expired key was returned: %q, %v", value, err)
+	}
+	if err = c.PutForceWithOpts(ctx, "/session", []byte("verify"),
+		&storage.PutOpOptionWithTTL{LeaseID: lease}); err == nil {
+
+		t.Error("put with expired lease succeeded")
+	}
+
+	// Keys with expired leases can be put again.
+	if err = c.Put(ctx, "/session", []byte("new")); err != nil {
+		t.Error("put after expiration failed:", err)
+	}
+}
@@ -0,0 +1,214 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+const (
+	emptyLeaseID = ""
+	base10       = 10
+)
+
+// GetWithLease returns the value of key along with the ID of the lease it is
+// attached to ("0" if none). Missing keys are not an error, but return a nil
+// value instead.
+func (c *client) GetWithLease(ctx context.Context, key string) ([]byte, string, error) {
+	log.Debug(ctx, GetWithLeaseRequest{Key: key})
+
+	var value []byte
+	var serial int64
+	var lease uint64
+	if err := c.view(ctx, func(tx *bolt.Tx) error {
+		if value, serial = lookup(tx, key, c.now()); serial > 0 {
+			if id := tx.Bucket(keyLeasesBucket).Get([]byte(key)); id != nil {
+				lease = binary.BigEndian.Uint64(id)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, emptyLeaseID, log.Alert(GetWithLeaseError{Key: key, Err: err})
+	}
+
+	if serial == 0 {
+		log.Debug(ctx, GetWithLeaseEmptyResponse{Key: key})
+		return nil, emptyLeaseID, nil
+	}
+
+	leaseID := strconv.FormatUint(lease, base10)
+	log.Debug(ctx, GetWithLeaseResponse{Key: key, Value: value, LeaseID: leaseID})
+	return value, leaseID, nil
+}
+
+// GetTTLs returns the remaining time to live of all unexpired keys with prefix
+// which are attached to a lease, rounded up to whole seconds.
+func (c *client) GetTTLs(ctx context.Context, prefix string) (map[string]int64, error) {
+	log.Debug(ctx, GetTTLsRequest{Prefix: prefix})
+
+	ttls := make(map[string]int64)
+	if err := c.view(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		leases := tx.Bucket(leasesBucket)
+		cur := tx.Bucket(keyLeasesBucket).Cursor()
+		k, id := cur.Seek([]byte(prefix))
+		for ; k != nil && bytes.HasPrefix(k, []byte(prefix)); k, id = cur.Next() {
+			expiry := leases.Get(id)
+			if expiry == nil {
+				continue
+			}
+			left := time.Duration(int64(binary.BigEndian.Uint64(expiry)) - now.UnixNano())
+			if left <= 0 {
+				continue
+			}
+			ttls[string(k)] = int64((left + time.Second - 1) / time.Second)
+		}
+		return nil
+	}); err != nil {
+		return nil, log.Alert(GetTTLsError{Prefix: prefix, Err: err})
+	}
+
+	log.Debug(ctx, GetTTLsResponse{Count: len(ttls)})
+	return ttls, nil
+}
+
+// PutForceWithOpts puts value into key unconditionally and attaches it to a
+// lease. opts must be a *storage.PutOpOptionWithTTL: if it has a lease ID,
+// then key is attached to that existing lease, otherwise a new lease which
+// expires after TTL seconds is granted.
+func (c *client) PutForceWithOpts(ctx context.Context, key string, value []byte,
+	opts interface{}) error {
+
+	putOptsWithTTL, ok := opts.(*storage.PutOpOptionWithTTL)
+	if !ok {
+		return log.Alert(PutForceWithOptsCastToPutOpOptionsWithTTLError{Key: key})
+	}
+
+	var leaseID uint64
+	if putOptsWithTTL.LeaseID != "" {
+		var err error
+		if leaseID, err = strconv.ParseUint(putOptsWithTTL.LeaseID, base10, 64); err != nil {
+			return log.Alert(PutForceWithOptsConvertLeaseIDError{
+				LeaseID: putOptsWithTTL.LeaseID,
+				Err:     err,
+			})
+		}
+	}
+
+	var ttl int64
+	if putOptsWithTTL.TTL != "" {
+		var err error
+		if ttl, err = strconv.ParseInt(putOptsWithTTL.TTL, base10, 64); err != nil {
+			return log.Alert(PutForceWithOptsConvertTTLError{
+				TTL: putOptsWithTTL.TTL,
+				Err: err,
+			})
+		}
+	}
+
+	log.Debug(ctx, PutForceWithOptsRequest{
+		Key:     key,
+		Value:   value,
+		LeaseID: leaseID,
+		TTL:     ttl,
+	})
+
+	var missing bool
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		leases := tx.Bucket(leasesBucket)
+		if leaseID == 0 {
+			// Grant a new lease, taking the opportunity to clean
+			// up keys attached to expired leases.
+			if err := sweep(tx, now); err != nil {
+				return err
+			}
+			id, err := leases.NextSequence()
+			if err != nil {
+				return GrantNewLeaseIDError{Key: key, Err: err}
+			}
+			leaseID = id
+			expiry := now.Add(time.Duration(ttl) * time.Second)
+			if err = leases.Put(itob(int64(leaseID)), itob(expiry.UnixNano())); err != nil {
+				return GrantNewLeaseError{Key: key, Err: err}
+			}
+		} else if expiry := leases.Get(itob(int64(leaseID))); expiry == nil ||
+			now.UnixNano() >= int64(binary.BigEndian.Uint64(expiry)) {
+
+			missing = true
+			return nil
+		}
+
+		if err := store(tx, key, value, now); err != nil {
+			return err
+		}
+		if err := tx.Bucket(keyLeasesBucket).Put([]byte(key), itob(int64(leaseID))); err != nil {
+			return AttachLeaseError{Key: key, Err: err}
+		}
+		return nil
+	}); err != nil {
+		return log.Alert(PutForceWithOptsError{Key: key, Err: err})
+	}
+
+	if missing {
+		return log.Alert(PutForceWithOptsLeaseNotFoundError{
+			Key:     key,
+			LeaseID: leaseID,
+		})
+	}
+	log.Debug(ctx, PutForceWithOptsResponse{Key: key, LeaseID: leaseID})
+	return nil
+}
+
+// Delete removes key permanently. Deleting a missing key is not an error.
+func (c *client) Delete(ctx context.Context, key string) error {
+	log.Debug(ctx, DeleteRequest{Key: key})
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		return remove(tx, key)
+	}); err != nil {
+		return log.Alert(DeleteError{Key: key, Err: err})
+	}
+	return nil
+}
+
+// sweep removes all expired leases and the keys attached to them.
+func sweep(tx *bolt.Tx, now time.Time) error {
+	// Collect keys first: buckets must not be modified while iterating.
+	var keys []string
+	if err := tx.Bucket(keyLeasesBucket).ForEach(func(k, _ []byte) error {
+		if expired(tx, k, now) {
+			keys = append(keys, string(k))
+		}
+		return nil
+	}); err != nil {
+		return SweepKeysError{Err: err}
+	}
+	for _, key := range keys {
+		if err := remove(tx, key); err != nil {
+			return err
+		}
+	}
+
+	var ids [][]byte
+	if err := tx.Bucket(leasesBucket).ForEach(func(id, expiry []byte) error {
+		if now.UnixNano() >= int64(binary.BigEndian.Uint64(expiry)) {
+			ids = append(ids, append([]byte(nil), id...))
+		}
+		return nil
+	}); err != nil {
+		return SweepLeasesError{Err: err}
+	}
+	for _, id := range ids {
+		if err := tx.Bucket(leasesBucket).Delete(id); err != nil {
+			return SweepDeleteLeaseError{Err: err}
+		}
+	}
+	return nil
+}
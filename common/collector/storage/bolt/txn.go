@@ -0,0 +1,154 @@
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+
+	bolt "go.etcd.io/bbolt"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+const expectedCastForTxnOp = "*txnOp"
+
+// opKind enumerates the operations that can be added to a transaction.
+type opKind int
+
+const (
+	opPut      opKind = iota // Insert if the key is missing.
+	opPutForce               // Insert or overwrite unconditionally.
+	opCAS                    // Overwrite if the key has the old value.
+)
+
+// operation is a single operation in a transaction.
+type operation struct {
+	kind  opKind
+	key   string
+	value []byte
+	old   []byte // Only used by opCAS.
+}
+
+// txnOp is an implementation for a transaction.
+type txnOp struct {
+	ops    []operation
+	readyc chan bool
+	errorc chan error
+}
+
+// Begin a transaction with lazy initialization.
+func (c *client) Begin(ctx context.Context) (storage.TxnOp, error) {
+	log.Debug(ctx, BeginTxn{})
+
+	return &txnOp{
+		readyc: make(chan bool, 1),
+		errorc: make(chan error, 1),
+	}, nil
+}
+
+// Ready sends bool over the ready chan and waits for an error
+// on the error chan.
+func (t *txnOp) Ready(ctx context.Context) error {
+	t.readyc <- true
+
+	select {
+	case err := <-t.errorc:
+		log.Debug(ctx, ReadyReceivedOnErrorChannel{Err: err})
+		return err
+	case <-ctx.Done():
+		return log.Alert(ReadyContextCancelled{})
+	}
+}
+
+// AutoCommit waits for a bool on the ready chan and once received,
+// attempts to Commit and send an error over the error chan.
+func (c *client) AutoCommit(ctx context.Context, op storage.TxnOp) {
+	unit := op.(*txnOp)
+
+	go func() {
+		defer close(unit.readyc)
+		defer close(unit.errorc)
+
+		select {
+		case <-unit.readyc:
+			unit.errorc <- c.Commit(ctx, op)
+			log.Debug(ctx, AutoCommitSentOnErrorc{})
+		case <-ctx.Done():
+			log.Debug(ctx, AutoCommitContextCancelled{})
+		}
+
+		log.Debug(ctx, AutoCommitClose{})
+	}()
+}
+
+// Commit a transaction. The conditions of all operations are checked against
+// the state of the database before the transaction, and only if all of them
+// hold are the operations applied, in the order they were added.
+func (c *client) Commit(ctx context.Context, op storage.TxnOp) error {
+	unit, ok := op.(*txnOp)
+	if !ok {
+		return log.Alert(CommitCastToTxnOpError{
+			Expected: expectedCastForTxnOp,
+			Got:      reflect.TypeOf(op),
+		})
+	}
+
+	log.Debug(ctx, CommitRequest{Count: len(unit.ops)})
+	var failed *operation
+	if err := c.update(ctx, func(tx *bolt.Tx) error {
+		now := c.now()
+		for i, o := range unit.ops {
+			value, serial := lookup(tx, o.key, now)
+			switch {
+			case o.kind == opPut && serial > 0,
+				o.kind == opCAS && (serial == 0 || !bytes.Equal(value, o.old)):
+
+				failed = &unit.ops[i]
+				return nil
+			}
+		}
+		for _, o := range unit.ops {
+			if err := store(tx, o.key, o.value, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return log.Alert(CommitError{Err: err})
+	}
+
+	if failed != nil {
+		log.Debug(ctx, CommitConditionFailed{Key: failed.key})
+		return storage.UnexpectedValueError{
+			Key: failed.key,
+			Err: CommitConditionError{Key: failed.key},
+		}
+	}
+	log.Debug(ctx, CommitResponse{Count: len(unit.ops)})
+	return nil
+}
+
+// Put adds key-value into a buffer to be further committed.
+// The transaction only succeeds if the key does not exist.
+func (t *txnOp) Put(key string, value []byte) {
+	t.ops = append(t.ops, operation{kind: opPut, key: key, value: value})
+}
+
+// PutAll calls Put on each req in reqs.
+func (t *txnOp) PutAll(reqs ...*storage.PutAllRequest) {
+	for _, req := range reqs {
+		t.Put(req.Key, req.Value)
+	}
+}
+
+// PutForce adds key-value into a buffer without any conditions.
+func (t *txnOp) PutForce(key string, value []byte) {
+	t.ops = append(t.ops, operation{kind: opPutForce, key: key, value: value})
+}
+
+// CAS adds key-value into a buffer to be further committed.
+// The transaction only succeeds if key's current value equals to old.
+func (t *txnOp) CAS(key string, old, new []byte) {
+	t.ops = append(t.ops, operation{kind: opCAS, key: key, value: new, old: old})
+}
@@ -0,0 +1,206 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/q11n"
+)
+
+const (
+	cancelListPrefix  = "/cancel/list/"
+	cancelVoterPrefix = "/cancel/voter/"
+)
+
+// Cancellation is a record of a voter's electronic votes being cancelled,
+// e.g., because the voter voted on paper on election day. A cancellation
+// applies to all votes of the voter submitted before Time.
+//
+// Cancellations do not remove anything from storage: votes remain stored as
+// evidence and it is up to the consumers of votes to honor cancellations.
+type Cancellation struct {
+	Voter  string
+	Time   time.Time
+	Reason string
+
+	// List is the identifier of the cancellation list that contained the
+	// record.
+	List string
+}
+
+// Cancelled reports if a vote with canonical time voted is cancelled by a
+// cancellation with time cancelled. All consumers of votes must use the
+// canonical time of the vote (see StoredVote.CanonicalTime) for this, which is
+// the same time that SetVoted indexes and GetLatestVoteTime returns.
+func Cancelled(cancelled, voted time.Time) bool {
+	return voted.Before(cancelled)
+}
+
+// CanonicalTime returns the canonical time of the vote: the time of the first
+// qualifying property in q11n.CanonicalOrder or the time the vote was received
+// if there are no such properties.
+func (s StoredVote) CanonicalTime() (time.Time, error) {
+	ctime, err := q11n.CanonicalTime(s.Qualification)
+	if err != nil {
+		return time.Time{}, CanonicalTimeError{VoteID: s.VoteID, Err: err}
+	}
+	if ctime.IsZero() {
+		return s.Time, nil
+	}
+	return ctime, nil
+}
+
+// PutCancellations stores the cancellation list with the given identifier and
+// the cancellations it contains. container is the signed container of the
+// list, which is stored as evidence of who authorized the cancellations.
+//
+// Cancellations are append-only: storing a list with an existing identifier is
+// only allowed if the contents are the same, i.e., importing the same list
+// again is idempotent.
+func (c *Client) PutCancellations(ctx context.Context, list string, container []byte,
+	cancellations []Cancellation) (err error) {
+
+	ctx, end := observe(ctx, "PutCancellations")
+	defer end(&err)
+
+	if len(list) == 0 || strings.Contains(list, "/") {
+		return PutCancellationsInvalidListError{List: list}
+	}
+
+	for _, record := range cancellations {
+		if len(record.Voter) == 0 || strings.Contains(record.Voter, "/") {
+			return PutCancellationsInvalidVoterError{Voter: record.Voter}
+		}
+		if err := c.ensure(ctx, cancelVoterPrefix+record.Voter+"/"+list,
+			encodePair(record.Time.Format(timefmt), record.Reason)); err != nil {
+
+			return PutCancellationError{Voter: record.Voter, List: list, Err: err}
+		}
+	}
+
+	// Store the container last, so that its presence marks the list as
+	// completely imported.
+	if err := c.ensure(ctx, cancelListPrefix+list, container); err != nil {
+		return PutCancellationListError{List: list, Err: err}
+	}
+	return nil
+}
+
+// CheckCancellationList checks if the cancellation list with the given
+// identifier has been completely imported.
+func (c *Client) CheckCancellationList(ctx context.Context, list string) (
+	imported bool, err error) {
+
+	ctx, end := observe(ctx, "CheckCancellationList")
+	defer end(&err)
+
+	switch _, err = c.prot.Get(ctx, cancelListPrefix+list); {
+	case err == nil:
+		return true, nil
+	case errors.CausedBy(err, new(NotExistError)) != nil:
+		return false, nil
+	default:
+		return false, CheckCancellationListError{List: list, Err: err}
+	}
+}
+
+// GetCancellations returns all stored cancellation records.
+//
+// Entries must be read from result channel until it is closed and then a
+// single error must be read from the error channel.
+func (c *Client) GetCancellations(ctx context.Context) (<-chan Cancellation, <-chan error) {
+	cancelc := make(chan Cancellation)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(errc)
+		defer close(cancelc)
+
+		pctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		protc, proterrc := c.prot.GetWithPrefix(pctx, cancelVoterPrefix)
+		for r := range protc {
+			// The key is the voter identifier and list identifier.
+			key := r.Key[len(cancelVoterPrefix):]
+			sep := strings.LastIndexByte(key, '/')
+			if sep < 0 {
+				errc <- log.Alert(GetCancellationsKeyError{Key: r.Key})
+				return
+			}
+
+			// The value is an encoded pair of timestamp and reason.
+			timestr, reason, err := decodePair(r.Value)
+			if err != nil {
+				errc <- log.Alert(GetCancellationsDecodeError{Key: r.Key, Err: err})
+				return
+			}
+			ctime, err := time.Parse(timefmt, timestr)
+			if err != nil {
+				errc <- log.Alert(GetCancellationsParseTimeError{Key: r.Key, Err: err})
+				return
+			}
+
+			select {
+			case cancelc <- Cancellation{
+				Voter:  key[:sep],
+				Time:   ctime,
+				Reason: reason,
+				List:   key[sep+1:],
+			}:
+			case <-ctx.Done():
+				errc <- ctx.Err()
+				return
+			}
+		}
+
+		var err error
+		if err = <-proterrc; err != nil {
+			err = log.Alert(GetWithCancelPrefixError{Err: err})
+		}
+		errc <- err
+	}()
+	return cancelc, errc
+}
+
+// GetCancellationTimes returns a map from voters with cancelled votes to the
+// latest cancellation time of their votes: all votes of the voter submitted
+// before that time are cancelled.
+func (c *Client) GetCancellationTimes(ctx context.Context) (_ map[string]time.Time, err error) {
+	ctx, end := observe(ctx, "GetCancellationTimes")
+	defer end(&err)
+
+	times := make(map[string]time.Time)
+	cancelc, errc := c.GetCancellations(ctx)
+	for record := range cancelc {
+		if record.Time.After(times[record.Voter]) {
+			times[record.Voter] = record.Time
+		}
+	}
+	if err := <-errc; err != nil {
+		return nil, GetCancellationTimesError{Err: err}
+	}
+	return times, nil
+}
+
+// GetLatestVoteTime returns the canonical time of the latest successful vote
+// of the voter.
+func (c *Client) GetLatestVoteTime(ctx context.Context, voter string) (_ time.Time, err error) {
+	ctx, end := observe(ctx, "GetLatestVoteTime")
+	defer end(&err)
+
+	latest, err := c.prot.Get(ctx, votedLatestPrefix+voter)
+	if err != nil {
+		return time.Time{}, GetLatestVoteError{Voter: voter, Err: err}
+	}
+	timestr, _, err := decodePair(latest)
+	if err != nil {
+		return time.Time{}, GetLatestVoteDecodeError{Voter: voter, Err: err}
+	}
+	ltime, err := time.Parse(timefmt, timestr)
+	if err != nil {
+		return time.Time{}, GetLatestVoteParseTimeError{Voter: voter, Err: err}
+	}
+	return ltime, nil
+}
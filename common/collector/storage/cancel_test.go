@@ -0,0 +1,104 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/container"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/q11n"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+// testCanonical is a qualifying property protocol with a canonical time.
+const testCanonical = q11n.TSPREG
+
+func init() {
+	q11n.Register(testCanonical, nil, func(property []byte) (time.Time, error) {
+		return time.Parse(time.RFC3339, string(property))
+	})
+}
+
+func TestCancellation(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	s := storage.NewWithProtocol(memory.New(nil))
+
+	// The vote is received just before the cancellation time, but its
+	// canonical time is just after it.
+	cancelled := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	vote := storage.StoredVote{
+		VoteID:   []byte("vote"),
+		Time:     cancelled.Add(-time.Second),
+		VoteType: container.BDOC,
+		Vote:     []byte("container"),
+		Voter:    "38001085718",
+		Version:  "version",
+		Qualification: q11n.Properties{
+			testCanonical: []byte(cancelled.Add(time.Second).Format(time.RFC3339)),
+		},
+	}
+	if err := s.StoreVote(ctx, vote); err != nil {
+		t.Fatal("failed to store vote:", err)
+	}
+	vtime, err := vote.CanonicalTime()
+	if err != nil {
+		t.Fatal("failed to get canonical time:", err)
+	}
+	if !vtime.Equal(cancelled.Add(time.Second)) {
+		t.Fatalf("unexpected canonical time: %s", vtime)
+	}
+	if err = s.SetVoted(ctx, vote.VoteID, "", vtime, false); err != nil { //nolint:staticcheck // Same index as TxnSetVoted.
+		t.Fatal("failed to set voted:", err)
+	}
+
+	records := []storage.Cancellation{{Voter: vote.Voter, Time: cancelled, Reason: "paper"}}
+	if err = s.PutCancellations(ctx, "list", []byte("list container"), records); err != nil {
+		t.Fatal("failed to put cancellations:", err)
+	}
+	if err = s.PutCancellations(ctx, "list", []byte("list container"), records); err != nil {
+		t.Error("failed to put same cancellations again:", err)
+	}
+	if err = s.PutCancellations(ctx, "list", []byte("other container"), records); err == nil {
+		t.Error("unexpected success of putting different list with same identifier")
+	}
+	if imported, err := s.CheckCancellationList(ctx, "list"); err != nil || !imported {
+		t.Errorf("unexpected list status: %t, %v", imported, err)
+	}
+
+	times, err := s.GetCancellationTimes(ctx)
+	if err != nil {
+		t.Fatal("failed to get cancellation times:", err)
+	}
+	ctime, ok := times[vote.Voter]
+	if len(times) != 1 || !ok || !ctime.Equal(cancelled) {
+		t.Fatalf("unexpected cancellation times: %v", times)
+	}
+
+	// voterstats uses the latest vote time and voteexp the canonical time
+	// of the exported vote: both must agree that the vote is not cancelled.
+	latest, err := s.GetLatestVoteTime(ctx, vote.Voter)
+	if err != nil {
+		t.Fatal("failed to get latest vote time:", err)
+	}
+	if storage.Cancelled(ctime, latest) || storage.Cancelled(ctime, vtime) {
+		t.Errorf("vote with canonical time %s cancelled at %s", vtime, ctime)
+	}
+
+	// A later cancellation cancels the vote in both.
+	later := cancelled.Add(time.Minute)
+	records[0].Time = later
+	if err = s.PutCancellations(ctx, "later", []byte("later container"), records); err != nil {
+		t.Fatal("failed to put later cancellations:", err)
+	}
+	if times, err = s.GetCancellationTimes(ctx); err != nil {
+		t.Fatal("failed to get cancellation times:", err)
+	}
+	if ctime = times[vote.Voter]; !ctime.Equal(later) {
+		t.Fatalf("unexpected latest cancellation time: %s", ctime)
+	}
+	if !storage.Cancelled(ctime, latest) || !storage.Cancelled(ctime, vtime) {
+		t.Errorf("vote with canonical time %s not cancelled at %s", vtime, ctime)
+	}
+}
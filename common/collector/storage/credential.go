@@ -0,0 +1,100 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"ivxv.ee/common/collector/command/status"
+)
+
+const (
+	credentialsPrefix        = "/credentials/"
+	credentialCountersPrefix = "/credentialcounters/"
+)
+
+// PutCredentials stores pre-registered authentication credentials, i.e., map
+// from credential identifiers to encoded credentials. The encoding is defined
+// by the authentication verifier using the credentials.
+//
+// Credentials can be imported multiple times, but an existing credential can
+// not be changed.
+//
+// Progress of the operation is reported to progress as well as logged
+// periodically.
+func (c *Client) PutCredentials(ctx context.Context, credentials map[string][]byte,
+	progress status.Add) (err error) {
+
+	ctx, end := observe(ctx, "PutCredentials")
+	defer end(&err)
+
+	for id := range credentials {
+		if len(id) == 0 || strings.Contains(id, "/") {
+			return PutCredentialsInvalidIDError{ID: id}
+		}
+	}
+	if err := c.putAll(ctx, credentialsPrefix, credentials, true, progress); err != nil {
+		return PutCredentialsError{Err: err}
+	}
+	return nil
+}
+
+// GetCredential returns the encoded credential with the identifier id. Returns
+// a NotExistError if the credential is not registered.
+func (c *Client) GetCredential(ctx context.Context, id string) (credential []byte, err error) {
+	ctx, end := observe(ctx, "GetCredential")
+	defer end(&err)
+
+	if credential, err = c.prot.Get(ctx, credentialsPrefix+id); err != nil {
+		err = GetCredentialError{ID: id, Err: err}
+	}
+	return
+}
+
+// UseCredential records the use of credential id in an assertion with
+// signature counter count for challenge. The counter must be greater than the
+// counter of the previous assertion with the credential, so that replayed
+// assertions and cloned authenticators are detected. Otherwise a
+// CredentialCounterError is returned.
+//
+// There are two exceptions: repeating the last assertion, i.e., with the same
+// challenge and counter, is allowed so that an authentication token can be
+// used for all requests in a session, and counters which stay zero are
+// allowed, because not all authenticators support them.
+func (c *Client) UseCredential(ctx context.Context, id string, count uint32, challenge []byte) (
+	err error) {
+
+	ctx, end := observe(ctx, "UseCredential")
+	defer end(&err)
+
+	hash := sha256.Sum256(challenge)
+	newv := []byte(strconv.FormatUint(uint64(count), 10) + " " +
+		base64.StdEncoding.EncodeToString(hash[:]))
+	err = c.update(ctx, credentialCountersPrefix+id, func(existing []byte) ([]byte, error) {
+		if existing == nil {
+			return newv, nil
+		}
+		if bytes.Equal(existing, newv) {
+			return nil, nil // Same assertion, keep as is.
+		}
+		fields := strings.Fields(string(existing))
+		if len(fields) != 2 {
+			return nil, CredentialCounterFormatError{ID: id, Value: existing}
+		}
+		last, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return nil, ParseCredentialCounterError{ID: id, Err: err}
+		}
+		if uint64(count) <= last && (count != 0 || last != 0) {
+			return nil, CredentialCounterError{ID: id, Count: count, Last: last}
+		}
+		return newv, nil
+	})
+	if err != nil {
+		return UseCredentialError{ID: id, Err: err}
+	}
+	return nil
+}
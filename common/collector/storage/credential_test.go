@@ -0,0 +1,45 @@
+package storage_test
+
+import (
+	"context"
+	"testing"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+func TestUseCredential(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	s := storage.NewWithProtocol(memory.New(nil))
+
+	for _, test := range []struct {
+		name      string
+		id        string
+		count     uint32
+		challenge string
+		ok        bool
+	}{
+		{"first", "a", 5, "one", true},
+		{"same assertion", "a", 5, "one", true},
+		{"same counter", "a", 5, "two", false},
+		{"lower counter", "a", 4, "two", false},
+		{"higher counter", "a", 6, "two", true},
+		{"replayed assertion", "a", 5, "one", false},
+		{"other credential", "b", 0, "one", true},
+		{"no counter support", "b", 0, "two", true},
+		{"counter started", "b", 1, "three", true},
+		{"counter reset", "b", 0, "four", false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := s.UseCredential(ctx, test.id, test.count, []byte(test.challenge))
+			switch {
+			case test.ok && err != nil:
+				t.Error("unexpected error:", err)
+			case !test.ok && errors.CausedBy(err, new(storage.CredentialCounterError)) == nil:
+				t.Errorf("unexpected error: %v, want CredentialCounterError", err)
+			}
+		})
+	}
+}
@@ -59,6 +59,61 @@ func (c *client) GetWithLease(ctx context.Context, key string) ([]byte, string,
 	return resp.Kvs[0].Value, leaseID, err
 }
 
+// GetTTLs returns the remaining time to live of all keys with prefix which are
+// attached to a lease. The keys are listed in blocks of blockSize and the
+// lease of each is queried once.
+func (c *client) GetTTLs(ctx context.Context, prefix string) (map[string]int64, error) {
+	kv, err := c.kv(ctx)
+	if err != nil {
+		return nil, log.Alert(GetTTLsKVError{Err: err})
+	}
+
+	log.Debug(ctx, GetTTLsRequest{Prefix: prefix})
+
+	leases := make(map[clientv3.LeaseID][]string)
+	ops := []clientv3.OpOption{
+		clientv3.WithRange(clientv3.GetPrefixRangeEnd(prefix)),
+		clientv3.WithLimit(blockSize),
+		clientv3.WithKeysOnly(),
+	}
+	for key := prefix; ; {
+		opctx, cancel := context.WithTimeout(ctx, c.optime)
+		resp, err := kv.Get(opctx, key, ops...)
+		cancel() // We do not want to defer in a loop.
+		if err != nil {
+			return nil, log.Alert(GetTTLsKeysError{Key: key, Err: err})
+		}
+		if len(resp.Kvs) == 0 {
+			break
+		}
+		for _, kv := range resp.Kvs {
+			if id := clientv3.LeaseID(kv.Lease); id != clientv3.NoLease {
+				leases[id] = append(leases[id], string(kv.Key))
+			}
+		}
+		key = nextKey(resp.Kvs[len(resp.Kvs)-1].Key)
+	}
+
+	ttls := make(map[string]int64)
+	for id, keys := range leases {
+		opctx, cancel := context.WithTimeout(ctx, c.optime)
+		resp, err := c.cli.TimeToLive(opctx, id)
+		cancel()
+		if err != nil {
+			return nil, log.Alert(GetTTLsTimeToLiveError{LeaseID: int64(id), Err: err})
+		}
+		if resp.TTL <= 0 {
+			continue // Expired, the keys are being deleted.
+		}
+		for _, key := range keys {
+			ttls[key] = resp.TTL
+		}
+	}
+
+	log.Debug(ctx, GetTTLsResponse{Count: len(ttls)})
+	return ttls, nil
+}
+
 func (c *client) PutForceWithOpts(ctx context.Context, key string, value []byte,
 	opts interface{}) (err error) {
 	// Currently only TTL option is expected as opts,
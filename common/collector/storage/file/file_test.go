@@ -0,0 +1,14 @@
+package file
+
+import (
+	"testing"
+
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.PutGetter {
+		return F{WD: t.TempDir()}
+	})
+}
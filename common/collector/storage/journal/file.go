@@ -0,0 +1,262 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+)
+
+// Kind is the kind of a journal entry.
+type Kind string
+
+// Enumeration of journal entry kinds.
+const (
+	KindPut    Kind = "put"    // Intent of PutGetter.Put.
+	KindPutAll Kind = "putall" // Intent of Batcher.PutAll.
+	KindCAS    Kind = "cas"    // Intent of PutGetter.CAS.
+	KindCommit Kind = "commit" // Intent of Transaction.Commit.
+	KindResult Kind = "result" // Result of a previous intent.
+)
+
+// Op is the operation of a single mutation.
+type Op string
+
+// Enumeration of mutation operations.
+const (
+	OpPut      Op = "put"      // Insert if the key is missing.
+	OpPutForce Op = "putforce" // Insert or overwrite unconditionally.
+	OpCAS      Op = "cas"      // Overwrite if the key has the old value.
+)
+
+// Mutation is a single change of a key requested from the storage service.
+type Mutation struct {
+	Op    Op     `json:"op"`
+	Key   string `json:"key"`
+	Value []byte `json:"value"`
+	Old   []byte `json:"old,omitempty"` // Only used by OpCAS.
+}
+
+// Entry is a single entry in a journal.
+type Entry struct {
+	// Seq is the sequence number of the entry in the journal, starting
+	// from 1.
+	Seq uint64 `json:"seq"`
+
+	// Time is the time when the entry was appended.
+	Time time.Time `json:"time"`
+
+	// Writer is the identifier of the service instance which appended the
+	// entry.
+	Writer string `json:"writer"`
+
+	// Kind is the kind of the entry.
+	Kind Kind `json:"kind"`
+
+	// Mutations are the changes requested by an intent entry. For
+	// KindPut and KindCAS there is always exactly one mutation.
+	Mutations []Mutation `json:"mutations,omitempty"`
+
+	// Ref is the sequence number of the intent that a KindResult entry
+	// reports the result of.
+	Ref uint64 `json:"ref,omitempty"`
+
+	// Error is the error returned by the storage protocol for the
+	// referenced intent or empty on success. Only used by KindResult.
+	Error string `json:"error,omitempty"`
+}
+
+// genesis is the previous hash used for the first entry in a journal.
+var genesis = make([]byte, sha256.Size)
+
+// chain computes the hash of an entry with the encoding data following an
+// entry with the hash prev.
+func chain(prev, data []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// parseLine splits a journal line without the terminating newline into the
+// hash and encoding of the entry and decodes the entry.
+func parseLine(line []byte) (hash, data []byte, entry *Entry, err error) {
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 {
+		return nil, nil, nil, MalformedLineError{}
+	}
+	if hash, err = hex.DecodeString(string(line[:i])); err != nil {
+		return nil, nil, nil, MalformedHashError{Err: err}
+	}
+	data = line[i+1:]
+	entry = new(Entry)
+	if err = json.Unmarshal(data, entry); err != nil {
+		return nil, nil, nil, MalformedEntryError{Err: err}
+	}
+	return
+}
+
+// tailChunk is the size of chunks read when searching for the last entry.
+const tailChunk = 4096
+
+// file is a journal file which is appended to.
+//
+// Several processes can append to the same file: each append locks the file
+// and, if the file was changed by someone else, continues the chain from the
+// last entry in the file.
+type file struct {
+	path   string
+	writer string
+	now    func() time.Time
+
+	lock sync.Mutex // Serializes appends from this process.
+	fp   *os.File
+	size int64  // Size of the file after the last append or -1.
+	seq  uint64 // Sequence number of the last entry.
+	prev []byte // Hash of the last entry.
+}
+
+// openFile opens or creates the journal file at path.
+func openFile(path, writer string) (*file, error) {
+	fp, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, OpenJournalError{Path: path, Err: err}
+	}
+	return &file{
+		path:   path,
+		writer: writer,
+		now:    time.Now,
+		fp:     fp,
+		size:   -1,
+	}, nil
+}
+
+// append fills in the sequence number, time, and writer of e and appends it
+// to the journal. The journal is synced to disk before returning.
+func (f *file) append(ctx context.Context, e *Entry) (err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fd := int(f.fp.Fd())
+	if err = syscall.Flock(fd, syscall.LOCK_EX); err != nil {
+		return LockJournalError{Path: f.path, Err: err}
+	}
+	defer func() {
+		if uerr := syscall.Flock(fd, syscall.LOCK_UN); uerr != nil && err == nil {
+			err = UnlockJournalError{Path: f.path, Err: uerr}
+		}
+	}()
+
+	fi, err := f.fp.Stat()
+	if err != nil {
+		return StatJournalError{Path: f.path, Err: err}
+	}
+	if fi.Size() != f.size {
+		if err = f.resume(ctx, fi.Size()); err != nil {
+			return ResumeJournalError{Path: f.path, Err: err}
+		}
+	}
+
+	e.Seq = f.seq + 1
+	e.Time = f.now().UTC()
+	e.Writer = f.writer
+	data, err := json.Marshal(e)
+	if err != nil {
+		return MarshalEntryError{Seq: e.Seq, Err: err}
+	}
+	hash := chain(f.prev, data)
+
+	line := make([]byte, 0, hex.EncodedLen(len(hash))+len(data)+2)
+	line = append(line, hex.EncodeToString(hash)...)
+	line = append(line, ' ')
+	line = append(line, data...)
+	line = append(line, '\n')
+	if _, err = f.fp.WriteAt(line, f.size); err != nil {
+		// Force resume on next append to drop the partial line.
+		f.size = -1
+		return WriteEntryError{Path: f.path, Seq: e.Seq, Err: err}
+	}
+	if err = f.fp.Sync(); err != nil {
+		f.size = -1
+		return SyncJournalError{Path: f.path, Seq: e.Seq, Err: err}
+	}
+
+	f.size += int64(len(line))
+	f.seq = e.Seq
+	f.prev = hash
+	return nil
+}
+
+// resume continues the chain from the last entry in the journal file of the
+// given size. An incomplete last line, e.g., left over from a crash while
+// appending, is truncated.
+func (f *file) resume(ctx context.Context, size int64) error {
+	last, end, err := tail(f.fp, size)
+	if err != nil {
+		return ReadLastEntryError{Err: err}
+	}
+	if end < size {
+		log.Error(ctx, TruncateIncompleteEntry{Path: f.path, Size: size, Offset: end})
+		if err = f.fp.Truncate(end); err != nil {
+			return TruncateIncompleteEntryError{Offset: end, Err: err}
+		}
+	}
+	f.size = end
+
+	if last == nil {
+		f.seq, f.prev = 0, genesis
+		return nil
+	}
+	hash, _, entry, err := parseLine(last)
+	if err != nil {
+		return ParseLastEntryError{Err: err}
+	}
+	f.seq, f.prev = entry.Seq, hash
+	return nil
+}
+
+// tail returns the last complete line in fp of the given size without the
+// terminating newline and the offset after that newline. If there are no
+// complete lines, then returns a nil line and zero offset.
+func tail(fp *os.File, size int64) (last []byte, end int64, err error) {
+	var buf []byte
+	off := size
+	end = -1
+	for off > 0 {
+		n := int64(tailChunk)
+		if n > off {
+			n = off
+		}
+		off -= n
+		chunk := make([]byte, n, n+int64(len(buf)))
+		if _, err = fp.ReadAt(chunk, off); err != nil {
+			return nil, 0, err
+		}
+		buf = append(chunk, buf...)
+
+		// buf starts at offset off: first find the newline terminating
+		// the last complete line and then the one preceding it.
+		if end < 0 {
+			i := bytes.LastIndexByte(buf, '\n')
+			if i < 0 {
+				continue
+			}
+			end = off + int64(i) + 1
+			buf = buf[:i]
+		}
+		if i := bytes.LastIndexByte(buf, '\n'); i >= 0 {
+			return buf[i+1:], end, nil
+		}
+	}
+	if end < 0 {
+		return nil, 0, nil
+	}
+	return buf, end, nil
+}
@@ -0,0 +1,233 @@
+/*
+Package journal implements a storage protocol which wraps another storage
+protocol and records every mutation into a write-ahead audit journal.
+
+The journal is a hash-chained, append-only local file. Before a Put, PutAll,
+CAS, or transaction commit is forwarded to the wrapped protocol, an intent
+entry describing the requested mutations is appended to the journal and synced
+to disk: if this fails, then the mutation is not performed. After the wrapped
+protocol returns, a result entry referencing the intent and recording any
+error is appended. Each entry also records the time it was appended and the
+identifier of the service instance which appended it.
+
+Every line in the journal consists of the hex-encoded hash of the entry, a
+space, and the JSON-encoded entry. The hash of an entry is the SHA-256 hash of
+the previous entry's hash concatenated with the JSON encoding of the entry; the
+first entry uses 32 zero bytes as the previous hash. Any modification of
+earlier entries is thus detected by Verify.
+
+Each service instance writes into its own journal file named after its
+identifier in the configured directory, so the journals are independent of the
+wrapped storage service and its own history. Journals from all service
+instances can be verified and replayed into an empty storage service using
+Replay.
+
+Keys with leases (see ivxv.ee/common/collector/storage.PutGetterWithOpts) are
+used for short-lived session data, which is deleted after expiring: these are
+forwarded to the wrapped protocol without journaling.
+
+The configuration of the protocol is
+
+	dir: /var/lib/ivxv/journal
+	protocol: etcd
+	conf: <configuration of the wrapped protocol>
+*/
+package journal
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/yaml"
+)
+
+func init() {
+	storage.Register(storage.Journal, func(n yaml.Node, services *storage.Services) (
+		s storage.PutGetter, err error) {
+
+		var cfg Conf
+		if err = yaml.Apply(n, &cfg); err != nil {
+			return nil, ConfigurationError{Err: err}
+		}
+		if cfg.Protocol == storage.Journal {
+			return nil, NestedJournalError{}
+		}
+		prot, err := storage.NewProtocol(cfg.Protocol, cfg.Conf, services)
+		if err != nil {
+			return nil, WrappedProtocolError{Protocol: cfg.Protocol, Err: err}
+		}
+		var writer string
+		if services != nil {
+			writer = services.ID
+		}
+		return New(&cfg, writer, prot)
+	})
+}
+
+// Conf is the journal storage protocol configuration.
+type Conf struct {
+	// Dir is the directory where journal files are stored. It is created
+	// if it does not exist.
+	Dir string
+
+	// Protocol is the wrapped storage protocol.
+	Protocol storage.Protocol
+
+	// Conf is the configuration of the wrapped storage protocol.
+	Conf yaml.Node
+}
+
+// Path returns the path of the journal file of writer in dir.
+func Path(dir, writer string) string {
+	if writer == "" {
+		writer = "journal"
+	}
+	return filepath.Join(dir, strings.ReplaceAll(writer, "/", "_")+".journal")
+}
+
+// New creates a new journal storage protocol client which records mutations
+// made by writer to prot in a journal file in cfg.Dir. cfg.Protocol and
+// cfg.Conf are ignored.
+//
+// If prot implements storage.Batcher, storage.Transaction, and
+// storage.PutGetterWithOpts, then so does the returned client. Otherwise it
+// only implements storage.PutGetter.
+//
+// Using the storage protocol registry is preferred to New, but the latter can
+// be useful for tools and testing.
+func New(cfg *Conf, writer string, prot storage.PutGetter) (storage.PutGetter, error) {
+	if cfg.Dir == "" {
+		return nil, MissingDirError{}
+	}
+	if err := os.MkdirAll(cfg.Dir, 0770); err != nil {
+		return nil, JournalDirectoryError{Path: cfg.Dir, Err: err}
+	}
+	f, err := openFile(Path(cfg.Dir, writer), writer)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &client{prot: prot, journal: f}
+	if _, ok := prot.(fullProtocol); ok {
+		return &fullClient{client: c}, nil
+	}
+	return c, nil
+}
+
+// client implements the storage.PutGetter interface.
+type client struct {
+	prot    storage.PutGetter
+	journal *file
+}
+
+// record appends an intent with the mutations to the journal, calls apply,
+// and appends the result of apply to the journal. If appending the intent
+// fails, then apply is not called.
+func (c *client) record(ctx context.Context, kind Kind, mutations []Mutation,
+	apply func() error) error {
+
+	intent := &Entry{Kind: kind, Mutations: mutations}
+	if err := c.journal.append(ctx, intent); err != nil {
+		return log.Alert(AppendIntentError{Kind: kind, Err: err})
+	}
+	log.Debug(ctx, AppendedIntent{Kind: kind, Seq: intent.Seq})
+
+	err := apply()
+
+	result := &Entry{Kind: KindResult, Ref: intent.Seq}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	if jerr := c.journal.append(ctx, result); jerr != nil {
+		// The mutation has already been performed or failed, so the
+		// caller gets the actual result: the missing result entry is
+		// handled as unresolved during replay.
+		log.Error(ctx, AppendResultError{Ref: intent.Seq, Err: log.Alert(jerr)})
+	}
+	return err
+}
+
+func (c *client) Put(ctx context.Context, key string, value []byte) error {
+	return c.record(ctx, KindPut, []Mutation{{Op: OpPut, Key: key, Value: value}},
+		func() error { return c.prot.Put(ctx, key, value) })
+}
+
+func (c *client) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.prot.Get(ctx, key)
+}
+
+func (c *client) GetWithPrefix(ctx context.Context, prefix string) (
+	<-chan storage.GetWithPrefixResult, <-chan error) {
+
+	return c.prot.GetWithPrefix(ctx, prefix)
+}
+
+func (c *client) CAS(ctx context.Context, cas string, old, new []byte) error {
+	return c.record(ctx, KindCAS, []Mutation{{Op: OpCAS, Key: cas, Value: new, Old: old}},
+		func() error { return c.prot.CAS(ctx, cas, old, new) })
+}
+
+func (c *client) GetWithSerial(ctx context.Context, key string) ([]byte, int64, error) {
+	return c.prot.GetWithSerial(ctx, key)
+}
+
+// fullProtocol is a storage protocol which implements all optional storage
+// interfaces.
+type fullProtocol interface {
+	storage.Batcher
+	storage.Transaction
+	storage.PutGetterWithOpts
+	storage.TTLGetter
+}
+
+// fullClient wraps a fullProtocol and implements all optional storage
+// interfaces itself.
+type fullClient struct {
+	*client
+}
+
+func (c *fullClient) full() fullProtocol {
+	return c.prot.(fullProtocol)
+}
+
+func (c *fullClient) BatchSize() int {
+	return c.full().BatchSize()
+}
+
+func (c *fullClient) GetAll(ctx context.Context, keys ...string) (map[string][]byte, error) {
+	return c.full().GetAll(ctx, keys...)
+}
+
+func (c *fullClient) PutAll(ctx context.Context, reqs ...storage.PutAllRequest) error {
+	mutations := make([]Mutation, len(reqs))
+	for i, req := range reqs {
+		mutations[i] = Mutation{Op: OpPut, Key: req.Key, Value: req.Value}
+	}
+	return c.record(ctx, KindPutAll, mutations,
+		func() error { return c.full().PutAll(ctx, reqs...) })
+}
+
+// GetWithLease is not journaled, see package documentation.
+func (c *fullClient) GetWithLease(ctx context.Context, key string) ([]byte, string, error) {
+	return c.full().GetWithLease(ctx, key)
+}
+
+// PutForceWithOpts is not journaled, see package documentation.
+func (c *fullClient) PutForceWithOpts(ctx context.Context, key string, value []byte,
+	opts interface{}) error {
+
+	return c.full().PutForceWithOpts(ctx, key, value, opts)
+}
+
+func (c *fullClient) GetTTLs(ctx context.Context, prefix string) (map[string]int64, error) {
+	return c.full().GetTTLs(ctx, prefix)
+}
+
+// Delete is not journaled, see package documentation.
+func (c *fullClient) Delete(ctx context.Context, key string) error {
+	return c.full().Delete(ctx, key)
+}
@@ -0,0 +1,197 @@
+package journal
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/bolt"
+	"ivxv.ee/common/collector/storage/memory"
+	"ivxv.ee/common/collector/storagetest"
+)
+
+func newBolt(t *testing.T) storage.PutGetter {
+	t.Helper()
+	p, err := bolt.New(&bolt.Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("new bolt failed:", err)
+	}
+	return p
+}
+
+func newJournal(t *testing.T, dir, writer string, prot storage.PutGetter) storage.PutGetter {
+	t.Helper()
+	j, err := New(&Conf{Dir: dir}, writer, prot)
+	if err != nil {
+		t.Fatal("new failed:", err)
+	}
+	return j
+}
+
+func TestConformance(t *testing.T) {
+	t.Run("Memory", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.PutGetter {
+			return newJournal(t, t.TempDir(), "test", memory.New(nil))
+		})
+	})
+	t.Run("Bolt", func(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.PutGetter {
+			return newJournal(t, t.TempDir(), "test", newBolt(t))
+		})
+	})
+}
+
+// mutate performs one of each journaled mutation on j.
+func mutate(ctx context.Context, t *testing.T, j storage.PutGetter) {
+	t.Helper()
+	if err := j.Put(ctx, "/put", []byte("1")); err != nil {
+		t.Fatal("put failed:", err)
+	}
+	if err := j.Put(ctx, "/put", []byte("2")); err == nil {
+		t.Fatal("put of existing key succeeded")
+	}
+	if err := j.CAS(ctx, "/put", []byte("1"), []byte("3")); err != nil {
+		t.Fatal("CAS failed:", err)
+	}
+	if err := j.(storage.Batcher).PutAll(ctx,
+		storage.PutAllRequest{Key: "/all/a", Value: []byte("a")},
+		storage.PutAllRequest{Key: "/all/b", Value: []byte("b")}); err != nil {
+
+		t.Fatal("put all failed:", err)
+	}
+
+	txn := j.(storage.Transaction)
+	op, err := txn.Begin(ctx)
+	if err != nil {
+		t.Fatal("begin failed:", err)
+	}
+	op.Put("/txn", []byte("t"))
+	op.PutForce("/all/a", []byte("A"))
+	op.CAS("/put", []byte("3"), []byte("4"))
+	if err = txn.Commit(ctx, op); err != nil {
+		t.Fatal("commit failed:", err)
+	}
+}
+
+func contents(ctx context.Context, t *testing.T, p storage.PutGetter) map[string]string {
+	t.Helper()
+	kv := make(map[string]string)
+	c, errc := p.GetWithPrefix(ctx, "/")
+	for r := range c {
+		kv[r.Key] = string(r.Value)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("get with prefix failed:", err)
+	}
+	return kv
+}
+
+func TestReplay(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	dir := t.TempDir()
+	source := newBolt(t)
+	mutate(ctx, t, newJournal(t, dir, "writer", source))
+
+	path := Path(dir, "writer")
+	fp, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	// 5 intents and 5 results.
+	if count, err := Verify(fp); err != nil || count != 10 {
+		t.Fatalf("verify failed: %d, %v", count, err)
+	}
+
+	target := newBolt(t)
+	applied, err := Replay(ctx, target, path)
+	if err != nil {
+		t.Fatal("replay failed:", err)
+	}
+	if applied != 4 { // The failed put is skipped.
+		t.Errorf("unexpected applied count: %d", applied)
+	}
+
+	want, have := contents(ctx, t, source), contents(ctx, t, target)
+	if len(want) != len(have) {
+		t.Fatalf("replayed contents differ: want %v, have %v", want, have)
+	}
+	for k, v := range want {
+		if have[k] != v {
+			t.Errorf("replayed %s differs: want %q, have %q", k, v, have[k])
+		}
+	}
+
+	// Replaying again must fail, because the target is not empty.
+	if _, err = Replay(ctx, target, path); err == nil {
+		t.Error("replay into non-empty target succeeded")
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	dir := t.TempDir()
+	mutate(ctx, t, newJournal(t, dir, "writer", newBolt(t)))
+
+	data, err := os.ReadFile(Path(dir, "writer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(data, []byte(`"key":"/txn"`), []byte(`"key":"/nxt"`), 1)
+	if bytes.Equal(data, tampered) {
+		t.Fatal("journal does not contain the expected entry")
+	}
+	if count, err := Verify(bytes.NewReader(tampered)); err == nil {
+		t.Error("tampered journal verified")
+	} else if count != 8 {
+		t.Errorf("unexpected count of valid entries: %d", count)
+	}
+
+	// Removing an entry is also detected.
+	lines := bytes.SplitAfter(data, []byte("\n"))
+	removed := bytes.Join(append(lines[:2:2], lines[3:]...), nil)
+	if _, err = Verify(bytes.NewReader(removed)); err == nil {
+		t.Error("journal with removed entry verified")
+	}
+}
+
+func TestResume(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	dir := t.TempDir()
+	prot := memory.New(nil)
+	j := newJournal(t, dir, "writer", prot)
+	if err := j.Put(ctx, "/a", []byte("a")); err != nil {
+		t.Fatal("put failed:", err)
+	}
+
+	// Simulate a crash during append and another process appending to
+	// the same journal.
+	path := Path(dir, "writer")
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = fp.WriteString(`0123 {"seq":3`); err != nil {
+		t.Fatal(err)
+	}
+	fp.Close()
+
+	if err = newJournal(t, dir, "writer", prot).Put(ctx, "/b", []byte("b")); err != nil {
+		t.Fatal("put from second journal failed:", err)
+	}
+	if err = j.Put(ctx, "/c", []byte("c")); err != nil {
+		t.Fatal("put after resume failed:", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count, err := Verify(bytes.NewReader(data)); err != nil || count != 6 {
+		t.Errorf("verify failed: %d, %v", count, err)
+	}
+}
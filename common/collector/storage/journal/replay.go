@@ -0,0 +1,247 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+// Verify reads a journal from r and checks that the hash chain is intact,
+// that sequence numbers are consecutive, and that results reference earlier
+// entries. It returns the number of verified entries: on error, this is the
+// number of entries preceding the invalid one.
+func Verify(r io.Reader) (count uint64, err error) {
+	return verify(r, nil)
+}
+
+// verify implements Verify. If f is not nil, then it is called with each
+// verified entry along with the offset and length of its line in r.
+func verify(r io.Reader, f func(e *Entry, offset int64, length int) error) (
+	count uint64, err error) {
+
+	br := bufio.NewReader(r)
+	prev := genesis
+	var offset int64
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				return count, IncompleteEntryError{Seq: count + 1}
+			}
+			return count, nil
+		}
+		if err != nil {
+			return count, ReadEntryError{Seq: count + 1, Err: err}
+		}
+
+		hash, data, entry, err := parseLine(line[:len(line)-1])
+		if err != nil {
+			return count, ParseEntryError{Seq: count + 1, Err: err}
+		}
+		if !bytes.Equal(hash, chain(prev, data)) {
+			return count, HashMismatchError{Seq: count + 1}
+		}
+		if entry.Seq != count+1 {
+			return count, SequenceMismatchError{Have: entry.Seq, Want: count + 1}
+		}
+		if entry.Kind == KindResult && (entry.Ref == 0 || entry.Ref >= entry.Seq) {
+			return count, InvalidResultReferenceError{Seq: entry.Seq, Ref: entry.Ref}
+		}
+		if f != nil {
+			if err = f(entry, offset, len(line)); err != nil {
+				return count, err
+			}
+		}
+		prev = hash
+		offset += int64(len(line))
+		count++
+	}
+}
+
+// record is an intent in a journal which is being replayed.
+type record struct {
+	file     int       // Index of the journal file.
+	seq      uint64    // Sequence number of the intent.
+	offset   int64     // Offset of the intent in the journal file.
+	length   int       // Length of the intent line.
+	time     time.Time // Time of the result or the intent if unresolved.
+	resolved bool      // Was a result recorded?
+	failed   bool      // Did the result report an error?
+}
+
+// Replay verifies the journals at paths and applies all mutations recorded in
+// them to target, which must be empty. Only the intents are kept in memory
+// during replay, the mutations themselves are read from the journals when
+// applied, so the journals must not be modified during replay.
+//
+// The mutations are applied in the order of their results, merging all
+// journals, so the clocks of the service instances that wrote them must be
+// synchronized. Mutations which failed are skipped. Mutations without a
+// recorded result, e.g., because the writer crashed, may or may not have been
+// performed: these are applied, but conflicts with existing values are
+// ignored.
+//
+// Returns the number of applied mutation intents.
+func Replay(ctx context.Context, target storage.PutGetter, paths ...string) (
+	applied int, err error) {
+
+	if err = empty(ctx, target); err != nil {
+		return 0, err
+	}
+
+	files := make([]*os.File, len(paths))
+	defer func() {
+		for _, fp := range files {
+			if fp != nil {
+				fp.Close() // Only read from, so ignore close errors.
+			}
+		}
+	}()
+
+	var records []*record
+	for i, path := range paths {
+		if files[i], err = os.Open(path); err != nil {
+			return 0, OpenReplayJournalError{Path: path, Err: err}
+		}
+		intents := make(map[uint64]*record)
+		if _, err = verify(files[i], func(e *Entry, offset int64, length int) error {
+			if e.Kind != KindResult {
+				r := &record{
+					file:   i,
+					seq:    e.Seq,
+					offset: offset,
+					length: length,
+					time:   e.Time,
+				}
+				intents[e.Seq] = r
+				records = append(records, r)
+				return nil
+			}
+			r, ok := intents[e.Ref]
+			if !ok || r.resolved {
+				return UnexpectedResultError{Seq: e.Seq, Ref: e.Ref}
+			}
+			r.time = e.Time
+			r.resolved = true
+			r.failed = e.Error != ""
+			return nil
+		}); err != nil {
+			return 0, VerifyReplayJournalError{Path: path, Err: err}
+		}
+	}
+	log.Log(ctx, ReplayingJournals{Count: len(paths), Intents: len(records)})
+
+	// Stable sort keeps the order of intents with equal times from the
+	// same journal.
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].time.Before(records[j].time)
+	})
+
+	for _, r := range records {
+		if r.failed {
+			log.Debug(ctx, SkipFailedIntent{Path: paths[r.file], Seq: r.seq})
+			continue
+		}
+
+		line := make([]byte, r.length)
+		if _, err = files[r.file].ReadAt(line, r.offset); err != nil {
+			return applied, ReadIntentError{Path: paths[r.file], Seq: r.seq, Err: err}
+		}
+		_, _, entry, err := parseLine(line[:len(line)-1])
+		if err != nil {
+			return applied, ParseIntentError{Path: paths[r.file], Seq: r.seq, Err: err}
+		}
+
+		if err = apply(ctx, target, entry); err != nil {
+			if !r.resolved && (errors.CausedBy(err, new(storage.ExistError)) != nil ||
+				errors.CausedBy(err, new(storage.UnexpectedValueError)) != nil) {
+
+				log.Log(ctx, SkipConflictingUnresolvedIntent{
+					Path: paths[r.file],
+					Seq:  r.seq,
+					Err:  err,
+				})
+				continue
+			}
+			return applied, ApplyIntentError{Path: paths[r.file], Seq: r.seq, Err: err}
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+// empty checks that target does not contain any keys.
+func empty(ctx context.Context, target storage.PutGetter) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	c, errc := target.GetWithPrefix(ctx, "")
+	if r, ok := <-c; ok {
+		return TargetNotEmptyError{Key: r.Key}
+	}
+	if err := <-errc; err != nil {
+		return CheckTargetEmptyError{Err: err}
+	}
+	return nil
+}
+
+// apply performs the mutations of an intent entry in target.
+func apply(ctx context.Context, target storage.PutGetter, e *Entry) error {
+	switch e.Kind {
+	case KindPut, KindCAS:
+		if len(e.Mutations) != 1 {
+			return MutationCountError{Seq: e.Seq, Kind: e.Kind, Count: len(e.Mutations)}
+		}
+		m := e.Mutations[0]
+		if e.Kind == KindPut {
+			return target.Put(ctx, m.Key, m.Value)
+		}
+		return target.CAS(ctx, m.Key, m.Old, m.Value)
+
+	case KindPutAll:
+		b, ok := target.(storage.Batcher)
+		if !ok {
+			for _, m := range e.Mutations {
+				if err := target.Put(ctx, m.Key, m.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		// The target may have a smaller batch size than the protocol
+		// that the journal was recorded with.
+		for len(e.Mutations) > 0 {
+			n := b.BatchSize()
+			if n > len(e.Mutations) {
+				n = len(e.Mutations)
+			}
+			reqs := make([]storage.PutAllRequest, n)
+			for i, m := range e.Mutations[:n] {
+				reqs[i] = storage.PutAllRequest{Key: m.Key, Value: m.Value}
+			}
+			if err := b.PutAll(ctx, reqs...); err != nil {
+				return err
+			}
+			e.Mutations = e.Mutations[n:]
+		}
+		return nil
+
+	case KindCommit:
+		t, ok := target.(storage.Transaction)
+		if !ok {
+			return TransactionNotSupportedError{Seq: e.Seq}
+		}
+		return commit(ctx, t, e.Mutations)
+
+	default:
+		return UnknownEntryKindError{Seq: e.Seq, Kind: e.Kind}
+	}
+}
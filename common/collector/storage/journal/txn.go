@@ -0,0 +1,124 @@
+package journal
+
+import (
+	"context"
+	"reflect"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+const expectedCastForTxnOp = "*txnOp"
+
+// txnOp collects the mutations of a transaction. They are only forwarded to
+// the wrapped protocol on Commit, after the intent has been journaled.
+type txnOp struct {
+	mutations []Mutation
+	readyc    chan bool
+	errorc    chan error
+}
+
+// Begin a transaction with lazy initialization.
+func (c *fullClient) Begin(ctx context.Context) (storage.TxnOp, error) {
+	log.Debug(ctx, BeginTxn{})
+
+	return &txnOp{
+		readyc: make(chan bool, 1),
+		errorc: make(chan error, 1),
+	}, nil
+}
+
+// Ready sends bool over the ready chan and waits for an error
+// on the error chan.
+func (t *txnOp) Ready(ctx context.Context) error {
+	t.readyc <- true
+
+	select {
+	case err := <-t.errorc:
+		log.Debug(ctx, ReadyReceivedOnErrorChannel{Err: err})
+		return err
+	case <-ctx.Done():
+		return log.Alert(ReadyContextCancelled{})
+	}
+}
+
+// AutoCommit waits for a bool on the ready chan and once received,
+// attempts to Commit and send an error over the error chan.
+func (c *fullClient) AutoCommit(ctx context.Context, op storage.TxnOp) {
+	unit := op.(*txnOp)
+
+	go func() {
+		defer close(unit.readyc)
+		defer close(unit.errorc)
+
+		select {
+		case <-unit.readyc:
+			unit.errorc <- c.Commit(ctx, op)
+			log.Debug(ctx, AutoCommitSentOnErrorc{})
+		case <-ctx.Done():
+			log.Debug(ctx, AutoCommitContextCancelled{})
+		}
+
+		log.Debug(ctx, AutoCommitClose{})
+	}()
+}
+
+// Commit journals the transaction and commits it in the wrapped protocol.
+func (c *fullClient) Commit(ctx context.Context, op storage.TxnOp) error {
+	unit, ok := op.(*txnOp)
+	if !ok {
+		return log.Alert(CommitCastToTxnOpError{
+			Expected: expectedCastForTxnOp,
+			Got:      reflect.TypeOf(op),
+		})
+	}
+
+	return c.record(ctx, KindCommit, unit.mutations, func() error {
+		return commit(ctx, c.full(), unit.mutations)
+	})
+}
+
+// commit performs mutations in a single transaction of prot.
+func commit(ctx context.Context, prot storage.Transaction, mutations []Mutation) error {
+	inner, err := prot.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	for _, m := range mutations {
+		switch m.Op {
+		case OpPut:
+			inner.Put(m.Key, m.Value)
+		case OpPutForce:
+			inner.PutForce(m.Key, m.Value)
+		case OpCAS:
+			inner.CAS(m.Key, m.Old, m.Value)
+		default:
+			return UnknownMutationOpError{Op: m.Op, Key: m.Key}
+		}
+	}
+	return prot.Commit(ctx, inner)
+}
+
+// Put adds key-value into a buffer to be further committed.
+// The transaction only succeeds if the key does not exist.
+func (t *txnOp) Put(key string, value []byte) {
+	t.mutations = append(t.mutations, Mutation{Op: OpPut, Key: key, Value: value})
+}
+
+// PutAll calls Put on each req in reqs.
+func (t *txnOp) PutAll(reqs ...*storage.PutAllRequest) {
+	for _, req := range reqs {
+		t.Put(req.Key, req.Value)
+	}
+}
+
+// PutForce adds key-value into a buffer without any conditions.
+func (t *txnOp) PutForce(key string, value []byte) {
+	t.mutations = append(t.mutations, Mutation{Op: OpPutForce, Key: key, Value: value})
+}
+
+// CAS adds key-value into a buffer to be further committed.
+// The transaction only succeeds if key's current value equals to old.
+func (t *txnOp) CAS(key string, old, new []byte) {
+	t.mutations = append(t.mutations, Mutation{Op: OpCAS, Key: key, Value: new, Old: old})
+}
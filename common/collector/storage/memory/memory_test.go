@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"testing"
+
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storagetest"
+)
+
+func TestConformance(t *testing.T) {
+	storagetest.Run(t, func(*testing.T) storage.PutGetter {
+		return New(nil)
+	})
+}
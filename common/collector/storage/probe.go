@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+const (
+	probeFailuresPrefix = "/probe/failures/"
+	probeBlockedPrefix  = "/probe/blocked/"
+)
+
+// probeRepository returns the storage protocol as a PutGetterWithOpts or an
+// error if the protocol does not support keys with leases.
+func (c *Client) probeRepository() (PutGetterWithOpts, error) {
+	repo, ok := c.prot.(PutGetterWithOpts)
+	if !ok {
+		return nil, ProbeLeasesUnsupportedError{}
+	}
+	return repo, nil
+}
+
+// ttl formats d as a lease TTL in seconds, which is at least 1.
+func ttl(d time.Duration) string {
+	seconds := int64(d / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// AddProbeFailure increments the count of failed lookups from source and
+// returns the new count. The count expires window after the first failure.
+//
+// The count is not updated atomically: concurrent failures from the same
+// source may be undercounted, which is acceptable for detecting probing.
+//
+// The storage protocol must support keys with leases, see PutGetterWithOpts.
+func (c *Client) AddProbeFailure(ctx context.Context, source string, window time.Duration) (
+	count uint64, err error) {
+
+	ctx, end := observe(ctx, "AddProbeFailure")
+	defer end(&err)
+
+	repo, err := c.probeRepository()
+	if err != nil {
+		return 0, err
+	}
+
+	key := probeFailuresPrefix + source
+	value, lease, err := repo.GetWithLease(ctx, key)
+	if err != nil {
+		return 0, GetProbeFailuresError{Source: source, Err: err}
+	}
+	if value != nil {
+		if count, err = strconv.ParseUint(string(value), 10, 64); err != nil {
+			return 0, ParseProbeFailuresError{Source: source, Err: err}
+		}
+	}
+	count++
+
+	// Keep the existing lease so that further failures do not extend the
+	// window. If the lease expired in the meantime, then start a new one.
+	newv := []byte(strconv.FormatUint(count, 10))
+	if value != nil && lease != "" && lease != "0" {
+		if err = repo.PutForceWithOpts(ctx, key, newv, &PutOpOptionWithTTL{
+			LeaseID: lease,
+		}); err == nil {
+			return count, nil
+		}
+		count, newv = 1, []byte("1")
+	}
+	if err = repo.PutForceWithOpts(ctx, key, newv, &PutOpOptionWithTTL{
+		TTL: ttl(window),
+	}); err != nil {
+		return 0, PutProbeFailuresError{Source: source, Err: err}
+	}
+	return count, nil
+}
+
+// BlockProbeSource blocks source for the given duration.
+//
+// The storage protocol must support keys with leases, see PutGetterWithOpts.
+func (c *Client) BlockProbeSource(ctx context.Context, source string, duration time.Duration) (err error) {
+	ctx, end := observe(ctx, "BlockProbeSource")
+	defer end(&err)
+
+	repo, err := c.probeRepository()
+	if err != nil {
+		return err
+	}
+	until := time.Now().Add(duration).Format(timefmt)
+	if err = repo.PutForceWithOpts(ctx, probeBlockedPrefix+source, []byte(until),
+		&PutOpOptionWithTTL{TTL: ttl(duration)}); err != nil {
+
+		return BlockProbeSourceError{Source: source, Err: err}
+	}
+	return nil
+}
+
+// CheckProbeBlocked checks if source is blocked.
+//
+// The storage protocol must support keys with leases, see PutGetterWithOpts.
+func (c *Client) CheckProbeBlocked(ctx context.Context, source string) (blocked bool, err error) {
+	ctx, end := observe(ctx, "CheckProbeBlocked")
+	defer end(&err)
+
+	repo, err := c.probeRepository()
+	if err != nil {
+		return false, err
+	}
+	value, _, err := repo.GetWithLease(ctx, probeBlockedPrefix+source)
+	if err != nil {
+		return false, CheckProbeBlockedError{Source: source, Err: err}
+	}
+	return value != nil, nil
+}
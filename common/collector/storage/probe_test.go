@@ -0,0 +1,60 @@
+package storage_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/bolt"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+func TestProbe(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	prot, err := bolt.New(&bolt.Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("failed to create bolt storage:", err)
+	}
+	s := storage.NewWithProtocol(prot)
+
+	// Failures are counted per source.
+	for want := uint64(1); want <= 3; want++ {
+		count, err := s.AddProbeFailure(ctx, "address/192.0.2.1", time.Minute)
+		if err != nil {
+			t.Fatal("failed to add probe failure:", err)
+		}
+		if count != want {
+			t.Fatalf("unexpected failure count: %d, want %d", count, want)
+		}
+	}
+	if count, err := s.AddProbeFailure(ctx, "session/other", time.Minute); err != nil || count != 1 {
+		t.Fatalf("unexpected failure count of other source: %d, %v", count, err)
+	}
+
+	if blocked, err := s.CheckProbeBlocked(ctx, "address/192.0.2.1"); err != nil || blocked {
+		t.Fatalf("unexpected blocked status before blocking: %t, %v", blocked, err)
+	}
+	if err = s.BlockProbeSource(ctx, "address/192.0.2.1", time.Minute); err != nil {
+		t.Fatal("failed to block source:", err)
+	}
+	if blocked, err := s.CheckProbeBlocked(ctx, "address/192.0.2.1"); err != nil || !blocked {
+		t.Errorf("unexpected blocked status after blocking: %t, %v", blocked, err)
+	}
+	if blocked, err := s.CheckProbeBlocked(ctx, "session/other"); err != nil || blocked {
+		t.Errorf("unexpected blocked status of other source: %t, %v", blocked, err)
+	}
+}
+
+func TestProbeLeasesUnsupported(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	s := storage.NewWithProtocol(memory.New(nil))
+	if _, err := s.AddProbeFailure(ctx, "address/192.0.2.1", time.Minute); err == nil {
+		t.Error("unexpected success of adding probe failure without lease support")
+	}
+	if _, err := s.CheckProbeBlocked(ctx, "address/192.0.2.1"); err == nil {
+		t.Error("unexpected success of checking blocked source without lease support")
+	}
+}
@@ -13,9 +13,11 @@ type Protocol string
 
 // Enumeration of storage protocols.
 const (
-	Memory Protocol = "memory"
-	File   Protocol = "file"
-	Etcd   Protocol = "etcd"
+	Memory  Protocol = "memory"
+	File    Protocol = "file"
+	Etcd    Protocol = "etcd"
+	Bolt    Protocol = "bolt"
+	Journal Protocol = "journal"
 )
 
 // Here we "declare" error types, but instead of defining them ourselves, we
@@ -143,3 +145,20 @@ func Register(p Protocol, n NewFunc) {
 	defer reglock.Unlock()
 	registry[p] = n
 }
+
+// NewProtocol creates a new storage protocol client using the implementation
+// registered for p. It is used by New, but can also be used by storage
+// protocols which wrap other protocols.
+func NewProtocol(p Protocol, n yaml.Node, services *Services) (PutGetter, error) {
+	reglock.RLock()
+	newFunc, ok := registry[p]
+	reglock.RUnlock()
+	if !ok {
+		return nil, UnlinkedProtocolError{Protocol: p}
+	}
+	prot, err := newFunc(n, services)
+	if err != nil {
+		return nil, ConfigureProtocolError{Protocol: p, Err: err}
+	}
+	return prot, nil
+}
@@ -49,6 +49,17 @@ type PutGetterWithOpts interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// TTLGetter is an optional extension of PutGetterWithOpts for storage
+// implementations which can report how long keys attached to leases have left
+// to live, e.g., so that they can be backed up and restored with their
+// remaining lifetime.
+type TTLGetter interface {
+	// GetTTLs returns the remaining time to live in seconds of all keys
+	// with prefix which are attached to a lease. Keys which are not
+	// attached to a lease are omitted.
+	GetTTLs(ctx context.Context, prefix string) (map[string]int64, error)
+}
+
 // SessionStatusRepository is an interface that all Status services should
 // implement!
 //
@@ -16,7 +16,9 @@ import (
 	"ivxv.ee/common/collector/container"
 	"ivxv.ee/common/collector/errors"
 	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/metrics"
 	"ivxv.ee/common/collector/q11n"
+	"ivxv.ee/common/collector/trace"
 	"ivxv.ee/common/collector/yaml"
 )
 
@@ -33,6 +35,11 @@ type Conf struct {
 // Services contains necessary information about the storage client and server
 // service instances not part of the client protocol configuration.
 type Services struct {
+	// ID is the identifier of the service instance using the storage
+	// client. It is used to attribute stored data to the writer, e.g., in
+	// audit journals.
+	ID string
+
 	// Sensitive is the path to the client service directory which can
 	// contain sensitive storage client information that can not be passed
 	// through the configuration, e.g., authentication credentials.
@@ -48,6 +55,28 @@ type Services struct {
 	Servers []string
 }
 
+// callDuration records the duration of storage client calls.
+var callDuration = metrics.NewHistogram("ivxv_storage_duration_seconds",
+	"Time taken by storage client calls.", nil, "method")
+
+// observe starts tracing the client call method and returns the context for
+// the call and a function, which must be called when the call is done to end
+// the span and record the duration of the call. The function takes a pointer
+// to the error returned by the call, so that it can be deferred before the
+// error is known, or nil if the call does not return an error.
+func observe(ctx context.Context, method string) (context.Context, func(*error)) {
+	start := time.Now()
+	ctx, span := trace.Start(ctx, "storage."+method)
+	return ctx, func(errp *error) {
+		var err error
+		if errp != nil {
+			err = *errp
+		}
+		span.Finish(err)
+		callDuration.Since(start, method)
+	}
+}
+
 // Client is used to access the storage service.
 type Client struct {
 	prot         PutGetter // The underlying protocol.
@@ -57,15 +86,9 @@ type Client struct {
 // New initializes a new storage service client with the provided configuration
 // and service instance information.
 func New(c *Conf, services *Services) (client *Client, err error) {
-	reglock.RLock()
-	defer reglock.RUnlock()
-	n, ok := registry[c.Protocol]
-	if !ok {
-		return nil, UnlinkedProtocolError{Protocol: c.Protocol}
-	}
 	client = new(Client)
-	if client.prot, err = n(c.Conf, services); err != nil {
-		return nil, ConfigureProtocolError{Protocol: c.Protocol, Err: err}
+	if client.prot, err = NewProtocol(c.Protocol, c.Conf, services); err != nil {
+		return nil, err
 	}
 	if c.OrderTimeout == 0 {
 		client.orderTimeout = 5
@@ -185,6 +208,9 @@ const (
 func (c *Client) PutDistricts(ctx context.Context, version string,
 	districts map[string][]byte, counties []byte, progress status.Add) (err error) {
 
+	ctx, end := observe(ctx, "PutDistricts")
+	defer end(&err)
+
 	// Check if districts are already stored.
 	oldver, err := c.GetDistrictsVersion(ctx)
 	switch {
@@ -218,6 +244,9 @@ func (c *Client) PutDistricts(ctx context.Context, version string,
 
 // GetCounties retrieves the serialized counties list.
 func (c *Client) GetCounties(ctx context.Context) (counties []byte, err error) {
+	ctx, end := observe(ctx, "GetCounties")
+	defer end(&err)
+
 	if counties, err = c.prot.Get(ctx, districtsPrefix+countiesKey); err != nil {
 		err = GetCountiesError{Err: err}
 	}
@@ -226,6 +255,9 @@ func (c *Client) GetCounties(ctx context.Context) (counties []byte, err error) {
 
 // GetDistrictsVersion retrieves the district list version string.
 func (c *Client) GetDistrictsVersion(ctx context.Context) (version string, err error) {
+	ctx, end := observe(ctx, "GetDistrictsVersion")
+	defer end(&err)
+
 	vb, err := c.prot.Get(ctx, districtsPrefix+versionKey)
 	version = string(vb)
 	if err != nil {
@@ -263,15 +295,25 @@ func decodePair(encoded []byte) (first, second string, err error) {
 }
 
 const (
-	choicesPrefix = "/choices/"
+	choicesPrefix         = "/choices/"
+	questionChoicesPrefix = "/questionchoices/"
 	// versionKey is already defined.
 )
 
 // PutChoices stores the map of choices lists with the given version string.
+//
+// If the election has multiple questions, then questions maps each question
+// identifier to the choices lists of that question. The choices lists of a
+// question are identified by the same district identifiers as choices.
+//
 // Progress of the operation is reported to progress as well as logged
 // periodically.
 func (c *Client) PutChoices(ctx context.Context, version string,
-	choices map[string][]byte, progress status.Add) (err error) {
+	choices map[string][]byte, questions map[string]map[string][]byte,
+	progress status.Add) (err error) {
+
+	ctx, end := observe(ctx, "PutChoices")
+	defer end(&err)
 
 	// Check if a choices list is already stored.
 	oldver, err := c.GetChoicesVersion(ctx)
@@ -290,6 +332,16 @@ func (c *Client) PutChoices(ctx context.Context, version string,
 	if err = c.putAll(ctx, choicesPrefix, choices, true, progress); err != nil {
 		return PutChoicesError{Err: err}
 	}
+	for question, lists := range questions {
+		if len(question) == 0 || strings.Contains(question, "/") {
+			return PutChoicesInvalidQuestionError{Question: question}
+		}
+		if err = c.putAll(ctx, questionChoicesPrefix+question+"/",
+			lists, true, progress); err != nil {
+
+			return PutQuestionChoicesError{Question: question, Err: err}
+		}
+	}
 
 	// Set the marker that choices lists were successfully stored.
 	if err = c.prot.Put(ctx, choicesPrefix+versionKey, []byte(version)); err != nil {
@@ -300,14 +352,34 @@ func (c *Client) PutChoices(ctx context.Context, version string,
 
 // GetChoices retrieves the choices list with the given identifier.
 func (c *Client) GetChoices(ctx context.Context, choices string) (list []byte, err error) {
+	ctx, end := observe(ctx, "GetChoices")
+	defer end(&err)
+
 	if list, err = c.prot.Get(ctx, choicesPrefix+choices); err != nil {
 		err = GetChoicesError{Choices: choices, Err: err}
 	}
 	return
 }
 
+// GetQuestionChoices retrieves the choices list of the question with the given
+// identifier.
+func (c *Client) GetQuestionChoices(ctx context.Context, question, choices string) (
+	list []byte, err error) {
+
+	ctx, end := observe(ctx, "GetQuestionChoices")
+	defer end(&err)
+
+	if list, err = c.prot.Get(ctx, questionChoicesPrefix+question+"/"+choices); err != nil {
+		err = GetQuestionChoicesError{Question: question, Choices: choices, Err: err}
+	}
+	return
+}
+
 // GetChoicesVersion retrieves the choices list version string.
 func (c *Client) GetChoicesVersion(ctx context.Context) (version string, err error) {
+	ctx, end := observe(ctx, "GetChoicesVersion")
+	defer end(&err)
+
 	vb, err := c.prot.Get(ctx, choicesPrefix+versionKey)
 	version = string(vb)
 	if err != nil {
@@ -317,8 +389,10 @@ func (c *Client) GetChoicesVersion(ctx context.Context) (version string, err err
 }
 
 const (
-	votersPrefix = "/voters/"
-	previousKey  = "previous"
+	votersPrefix   = "/voters/"
+	voterDOBPrefix = "/voterdob/"
+	previousKey    = "previous"
+	dobfmt         = "2006-01-02"
 )
 
 // PutVoters stores a new version of the voters list, i.e., map from voter
@@ -344,15 +418,23 @@ const (
 // containers were used to build the voters list. The list version is used to
 // compare actual contents of two different lists.
 //
+// dobs optionally maps voter identifiers to dates of birth, encoded using
+// EncodeVoterDOB, of voters added in this version. A date of birth belongs to
+// the voter entry in this version: if the voter is deleted and added again in
+// a later version without a date of birth, then it is no longer reported.
+//
 // PutVoters concatenates cversion to the current container version and
 // compare-and-swaps the list version from oldver to newver, unless oldver is
 // empty, in which case it creates a new version file.
 //
 // Progress of the operation is reported to progress as well as logged
 // periodically.
-func (c *Client) PutVoters(ctx context.Context, cversion string, voters map[string][]byte,
+func (c *Client) PutVoters(ctx context.Context, cversion string, voters, dobs map[string][]byte,
 	oldver, newver string, progress status.Add) (err error) {
 
+	ctx, end := observe(ctx, "PutVoters")
+	defer end(&err)
+
 	const vkey = votersPrefix + versionKey
 	prefix := versionPrefix(newver)
 
@@ -412,6 +494,22 @@ func (c *Client) PutVoters(ctx context.Context, cversion string, voters map[stri
 		return PutVotersPreviousKeyNotAllowedError{}
 	}
 
+	// Store dates of birth before the voters, so that they are available
+	// as soon as the voters are.
+	for voter := range dobs {
+		if _, ok := voters[voter]; !ok {
+			return PutVotersDOBWithoutVoterError{Voter: voter}
+		}
+	}
+	if len(dobs) > 0 {
+		var quiet *status.Line // Progress is only reported for voters.
+		if err = c.putAll(ctx, voterDOBPrefix+newver+"/", dobs, true,
+			quiet.Count(0, false)); err != nil {
+
+			return PutVotersDOBError{Version: newver, Err: err}
+		}
+	}
+
 	// Create a new voters list version.
 	if err = c.putAll(ctx, prefix, voters, true, progress); err != nil {
 		return PutVotersError{Version: newver, Err: err}
@@ -439,6 +537,9 @@ func (c *Client) PutVoters(ctx context.Context, cversion string, voters map[stri
 func (c *Client) GetVoter(ctx context.Context, version, voter string) (
 	adminCode, district string, err error) {
 
+	ctx, end := observe(ctx, "GetVoter")
+	defer end(&err)
+
 	encoded, err := c.getVoter(ctx, version, voter)
 	if err != nil {
 		return "", "", err
@@ -455,9 +556,18 @@ func (c *Client) GetVoter(ctx context.Context, version, voter string) (
 // getVoter performs the internal operation of GetVoter without decoding the
 // voter entry. Avoids decode-encode round-trip if used within this package.
 func (c *Client) getVoter(ctx context.Context, version, voter string) (encoded []byte, err error) {
+	encoded, _, err = c.lookupVoter(ctx, version, voter)
+	return
+}
+
+// lookupVoter returns the encoded entry of voter for the specified voter list
+// version and the version which contains the entry.
+func (c *Client) lookupVoter(ctx context.Context, version, voter string) (
+	encoded []byte, currentver string, err error) {
+
 	// Recursively walk back through version until we find the voter or hit
 	// the beginning.
-	currentver := version
+	currentver = version
 	for {
 		prefix := versionPrefix(currentver)
 		encoded, err = c.prot.Get(ctx, prefix+voter)
@@ -471,9 +581,9 @@ func (c *Client) getVoter(ctx context.Context, version, voter string) (encoded [
 					Voter:     voter,
 					DeletedAt: currentver,
 				}
-				return nil, ne
+				return nil, "", ne
 			}
-			return encoded, err // Existing voter.
+			return encoded, currentver, err // Existing voter.
 
 		case errors.CausedBy(err, new(NotExistError)) != nil:
 			prevb, verr := c.prot.Get(ctx, prefix+previousKey)
@@ -489,11 +599,11 @@ func (c *Client) getVoter(ctx context.Context, version, voter string) (encoded [
 					Version: version,
 					Voter:   voter,
 				}
-				return nil, ne
+				return nil, "", ne
 			}
 			err = verr
 		}
-		return nil, GetVoterError{
+		return nil, "", GetVoterError{
 			Version: version,
 			Voter:   voter,
 			Step:    currentver,
@@ -502,6 +612,44 @@ func (c *Client) getVoter(ctx context.Context, version, voter string) (encoded [
 	}
 }
 
+// GetVoterDOB returns the date of birth of voter from the current voter list
+// version. Returns a NotExistError if the voter is not on the list or their
+// entry has no date of birth.
+func (c *Client) GetVoterDOB(ctx context.Context, voter string) (dob time.Time, err error) {
+	ctx, end := observe(ctx, "GetVoterDOB")
+	defer end(&err)
+
+	version, err := c.GetVotersListVersion(ctx)
+	if err != nil {
+		return dob, GetVoterDOBVersionError{Err: err}
+	}
+	_, found, err := c.lookupVoter(ctx, version, voter)
+	if err != nil {
+		return dob, GetVoterDOBVoterError{Err: err}
+	}
+	dobb, err := c.prot.Get(ctx, voterDOBPrefix+found+"/"+voter)
+	if err != nil {
+		return dob, GetVoterDOBError{Version: found, Voter: voter, Err: err}
+	}
+	if dob, err = DecodeVoterDOB(dobb); err != nil {
+		err = log.Alert(GetVoterDOBParseError{Voter: voter, Err: err})
+	}
+	return
+}
+
+// EncodeVoterDOB encodes a voter's date of birth for PutVoters.
+func EncodeVoterDOB(dob time.Time) []byte {
+	return []byte(dob.Format(dobfmt))
+}
+
+// DecodeVoterDOB decodes a voter's date of birth encoded with EncodeVoterDOB.
+func DecodeVoterDOB(encoded []byte) (dob time.Time, err error) {
+	if dob, err = time.Parse(dobfmt, string(encoded)); err != nil {
+		err = DecodeVoterDOBError{Encoded: string(encoded), Err: err}
+	}
+	return
+}
+
 // VoterChoices returns the the current voter list version and the identifier
 // of voter's choices list, i.e., the district identifier.
 //
@@ -510,6 +658,9 @@ func (c *Client) getVoter(ctx context.Context, version, voter string) (encoded [
 func (c *Client) VoterChoices(ctx context.Context, voter, foreignAdminCode string) (
 	version, choices string, err error) {
 
+	ctx, end := observe(ctx, "VoterChoices")
+	defer end(&err)
+
 	if version, err = c.GetVotersListVersion(ctx); err != nil {
 		return "", "", VoterChoicesVersionError{Err: err}
 	}
@@ -537,7 +688,10 @@ func (c *Client) VoterChoices(ctx context.Context, voter, foreignAdminCode strin
 // VoterChoicesByVersion is similar to VoterChoices with the only difference,
 // it uses a version to return an identifier of voter's choices list
 func (c *Client) VoterChoicesByVersion(ctx context.Context, version, voter, foreignAdminCode string) (
-	string, error) {
+	_ string, err error) {
+
+	ctx, end := observe(ctx, "VoterChoicesByVersion")
+	defer end(&err)
 
 	adminDistrict, err := c.getVoter(ctx, version, voter)
 	if err != nil {
@@ -563,6 +717,9 @@ func (c *Client) VoterChoicesByVersion(ctx context.Context, version, voter, fore
 // GetVotersContainerVersions returns the container versions of the current
 // voters list.
 func (c *Client) GetVotersContainerVersions(ctx context.Context) (cversion string, err error) {
+	ctx, end := observe(ctx, "GetVotersContainerVersions")
+	defer end(&err)
+
 	version, err := c.GetVotersListVersion(ctx)
 	if err != nil {
 		return "", GetVotersContainerVersionsVersionError{Err: err}
@@ -579,6 +736,9 @@ func (c *Client) GetVotersContainerVersions(ctx context.Context) (cversion strin
 
 // GetVotersListVersion returns the list version of the current voters list.
 func (c *Client) GetVotersListVersion(ctx context.Context) (version string, err error) {
+	ctx, end := observe(ctx, "GetVotersListVersion")
+	defer end(&err)
+
 	versionb, err := c.prot.Get(ctx, votersPrefix+versionKey)
 	if err != nil {
 		err = GetVotersListVersionError{Err: err}
@@ -615,7 +775,10 @@ const (
 // vote registration timestamp.
 //
 // Deprecated: use TxnSetVoted instead.
-func (c *Client) SetVoted(ctx context.Context, voteID []byte, voterName string, ctime time.Time, testVote bool) error {
+func (c *Client) SetVoted(ctx context.Context, voteID []byte, voterName string, ctime time.Time, testVote bool) (err error) {
+	ctx, end := observe(ctx, "SetVoted")
+	defer end(&err)
+
 	// voteID was successful: refresh indexes related to the voter. Keep in
 	// mind that voteID is not guaranteed to be the latest vote from the
 	// voter, so be careful when updating the information.
@@ -734,6 +897,9 @@ func (c *Client) SetVoted(ctx context.Context, voteID []byte, voterName string,
 
 // CheckVoted checks if the voter has already voted.
 func (c *Client) CheckVoted(ctx context.Context, voter string) (voted bool, err error) {
+	ctx, end := observe(ctx, "CheckVoted")
+	defer end(&err)
+
 	switch _, err = c.prot.Get(ctx, votedStatsPrefix+voter); {
 	case err == nil:
 		return true, nil
@@ -746,6 +912,9 @@ func (c *Client) CheckVoted(ctx context.Context, voter string) (voted bool, err
 
 // GetVotesCount returns votes count.
 func (c *Client) GetVotesCount(ctx context.Context) (count uint64, err error) {
+	ctx, end := observe(ctx, "GetVotesCount")
+	defer end(&err)
+
 	switch countb, err := c.prot.Get(ctx, votesStatsPrefix); {
 	case err == nil:
 		return binary.BigEndian.Uint64(countb), nil
@@ -766,8 +935,9 @@ type VoteOrder struct {
 
 // AddVoteOrder tries to add vote order record
 func (c *Client) AddVoteOrder(ctx context.Context, voterName string, idVoter string,
-	district string, idAdminCode string) error {
-	var err error
+	district string, idAdminCode string) (err error) {
+	ctx, end := observe(ctx, "AddVoteOrder")
+	defer end(&err)
 
 	// Get amount of successful votes per voter using detail statistics
 	_, statsSerial, statsErr := c.prot.GetWithSerial(ctx, votedStatsPrefix+idVoter)
@@ -948,7 +1118,10 @@ func (c *Client) AddVoteOrder(ctx context.Context, voterName string, idVoter str
 }
 
 // GetVotesOrder returns for each successful vote record with order number and voter info.
-func (c *Client) GetVotesOrder(ctx context.Context, countFrom int, batchSize int) ([]VoteOrder, error) {
+func (c *Client) GetVotesOrder(ctx context.Context, countFrom int, batchSize int) (_ []VoteOrder, err error) {
+	ctx, end := observe(ctx, "GetVotesOrder")
+	defer end(&err)
+
 	var keys []string
 	for i := countFrom; i < countFrom+batchSize; i++ {
 		keys = append(keys, votesPrefix+strconv.FormatInt(int64(i), 10)+"/"+admincodeKey,
@@ -1055,6 +1228,9 @@ const ratePrefix = "/rate/"
 func (c *Client) GetVoterRateStats(ctx context.Context, voter string) (
 	submissions uint64, last time.Time, err error) {
 
+	ctx, end := observe(ctx, "GetVoterRateStats")
+	defer end(&err)
+
 	stats, err := c.prot.Get(ctx, ratePrefix+voter)
 	switch {
 	case err == nil:
@@ -1090,6 +1266,9 @@ func (c *Client) SetVoterRateStats(ctx context.Context, voter string,
 	submissions uint64, last, now time.Time) (
 	err error) {
 
+	ctx, end := observe(ctx, "SetVoterRateStats")
+	defer end(&err)
+
 	// Serialize the CAS values: 8 bytes for submissions followed by
 	// timestamp.
 	old := make([]byte, 8, 8+len(timefmt))
@@ -1190,7 +1369,10 @@ const (
 
 // StoreVote stores the provided vote and accompanying data in the storage
 // service.
-func (c *Client) StoreVote(ctx context.Context, vote StoredVote) error {
+func (c *Client) StoreVote(ctx context.Context, vote StoredVote) (err error) {
+	ctx, end := observe(ctx, "StoreVote")
+	defer end(&err)
+
 	if m := vote.missing(); len(m) > 0 {
 		return StoreIncompleteVoteError{VoteID: vote.VoteID, Missing: m}
 	}
@@ -1213,7 +1395,10 @@ func noopAdd(uint64) uint64 { return 0 }
 // StoreQualifyingProperty stores a qualifying property for a vote in the
 // storage service.
 func (c *Client) StoreQualifyingProperty(ctx context.Context, voteID []byte,
-	protocol q11n.Protocol, property []byte) error {
+	protocol q11n.Protocol, property []byte) (err error) {
+
+	ctx, end := observe(ctx, "StoreQualifyingProperty")
+	defer end(&err)
 
 	prefix := voteIDPrefix(voteID)
 	if err := c.prot.Put(ctx, prefix+string(protocol), property); err != nil {
@@ -1382,6 +1567,9 @@ next:
 func (c *Client) GetVerificationStats(ctx context.Context, voteid []byte, foreignAdminCode string,
 	predefinedDistrictID string) (count uint64, at time.Time, latest bool, choicesList []byte, err error) {
 
+	ctx, end := observe(ctx, "GetVerificationStats")
+	defer end(&err)
+
 	prefix := voteIDPrefix(voteid)
 	m, err := c.getAllStrict(ctx, prefix+timeKey, prefix+countKey, prefix+voterKey, prefix+versionKey)
 	if err != nil {
@@ -1459,6 +1647,9 @@ func (c *Client) GetVerification(ctx context.Context,
 	voteid []byte, count uint64, qps ...q11n.Protocol) (
 	vote StoredVote, err error) {
 
+	ctx, end := observe(ctx, "GetVerification")
+	defer end(&err)
+
 	prefix := voteIDPrefix(voteid)
 
 	// First ensure that we can read the the verification data.
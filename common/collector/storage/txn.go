@@ -68,6 +68,9 @@ func (c *Client) Txn() Transaction {
 // for a vote in the underlying storage.
 func (c *Client) TxnStoreQualifyingProperty(ctx context.Context,
 	voteID []byte, protocol q11n.Protocol, property []byte, op TxnOp) {
+	ctx, end := observe(ctx, "TxnStoreQualifyingProperty")
+	defer end(nil)
+
 	prefix := voteIDPrefix(voteID)
 
 	op.Put(prefix+string(protocol), property)
@@ -81,7 +84,10 @@ func (c *Client) TxnStoreQualifyingProperty(ctx context.Context,
 // vote registration timestamp.
 func (c *Client) TxnSetVoted(ctx context.Context,
 	txnOp TxnOp, voteID []byte, voterName string, ctime time.Time,
-	testVote bool) error {
+	testVote bool) (err error) {
+	ctx, end := observe(ctx, "TxnSetVoted")
+	defer end(&err)
+
 	// voteID was successful: refresh indexes related to the voter. Keep in
 	// mind that voteID is not guaranteed to be the latest vote from the
 	// voter, so be careful when updating the information.
@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+)
+
+const windowPrefix = "/ratewindow/"
+
+// GetVoterSubmissions returns the submission times stored for the voter using
+// SetVoterSubmissions, oldest first. If no submissions are stored, then the
+// result is empty. The returned value must be passed as old to
+// SetVoterSubmissions.
+func (c *Client) GetVoterSubmissions(ctx context.Context, voter string) (
+	submissions []time.Time, err error) {
+
+	ctx, end := observe(ctx, "GetVoterSubmissions")
+	defer end(&err)
+
+	encoded, err := c.prot.Get(ctx, windowPrefix+voter)
+	switch {
+	case err == nil:
+	case errors.CausedBy(err, new(NotExistError)) != nil:
+		return nil, nil
+	default:
+		return nil, GetVoterSubmissionsError{Voter: voter, Err: err}
+	}
+
+	for _, field := range bytes.Fields(encoded) {
+		t, err := time.Parse(timefmt, string(field))
+		if err != nil {
+			return nil, log.Alert(ParseVoterSubmissionTimeError{Voter: voter, Err: err})
+		}
+		submissions = append(submissions, t)
+	}
+	return
+}
+
+// SetVoterSubmissions replaces the submission times stored for the voter with
+// submissions, given that the old information returned by GetVoterSubmissions
+// is unchanged. If it has changed, then an UnexpectedValueError is returned
+// and the caller should try again with fresh values.
+func (c *Client) SetVoterSubmissions(ctx context.Context, voter string,
+	old, submissions []time.Time) (err error) {
+
+	ctx, end := observe(ctx, "SetVoterSubmissions")
+	defer end(&err)
+
+	key := windowPrefix + voter
+	newv := encodeSubmissions(submissions)
+
+	// If there are old submissions, then the key should already exist and
+	// we attempt to perform the usual compare-and-swap.
+	if len(old) > 0 {
+		if err = c.prot.CAS(ctx, key, encodeSubmissions(old), newv); err != nil {
+			err = SetVoterSubmissionsError{Voter: voter, Err: err}
+		}
+		return
+	}
+
+	// Otherwise this must be the first submission of this voter or all
+	// previous ones have expired. Use Put to create the key. Expired keys
+	// are kept, but contain no submissions.
+	switch err = c.prot.Put(ctx, key, newv); {
+	case err == nil:
+		return nil
+	case errors.CausedBy(err, new(ExistError)) != nil:
+		// The key exists with an empty value or somebody has created
+		// it before us: attempt to compare-and-swap from empty and
+		// mask the error as above.
+		if err = c.prot.CAS(ctx, key, encodeSubmissions(nil), newv); err != nil {
+			err = SetVoterSubmissionsEmptyError{Voter: voter, Err: err}
+		}
+		return
+	default:
+		return SetVoterSubmissionsPutError{Voter: voter, Err: err}
+	}
+}
+
+// encodeSubmissions encodes submission times as space-separated timestamps.
+func encodeSubmissions(submissions []time.Time) []byte {
+	encoded := []byte{}
+	for i, t := range submissions {
+		if i > 0 {
+			encoded = append(encoded, ' ')
+		}
+		encoded = t.AppendFormat(encoded, timefmt)
+	}
+	return encoded
+}
@@ -0,0 +1,536 @@
+/*
+Package storagetest provides a conformance test suite for storage protocols.
+
+The contracts of ivxv.ee/common/collector/storage.PutGetter and its optional
+extensions Batcher, Transaction, PutGetterWithOpts and TTLGetter are documented
+in the storage package. Run exercises an implementation against those
+contracts so that a new protocol can prove it is a drop-in replacement for
+existing ones:
+
+	func TestConformance(t *testing.T) {
+		storagetest.Run(t, func(t *testing.T) storage.PutGetter {
+			return newEmptyProtocol(t)
+		})
+	}
+
+Optional interfaces are only tested if the protocol implements them.
+
+This package lives outside of the storage package tree, because all
+sub-packages of storage are considered storage protocol modules and linked
+into collector services.
+*/
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+// NewFunc is the type of functions which create a new, empty storage
+// protocol instance for a single test. Any resources used by the instance
+// should be cleaned up using t.Cleanup.
+type NewFunc func(t *testing.T) storage.PutGetter
+
+// timeout limits the duration of a single test so that implementations which
+// do not close their channels fail instead of hanging.
+const timeout = 30 * time.Second
+
+// Run runs the conformance test suite against the storage protocol created by
+// newFunc. Each test is run as a sub-test of t with a fresh instance.
+func Run(t *testing.T, newFunc NewFunc) {
+	tests := []struct {
+		name string
+		test func(context.Context, *testing.T, storage.PutGetter)
+	}{
+		{"Put", testPut},
+		{"Get", testGet},
+		{"GetWithPrefix", testGetWithPrefix},
+		{"GetWithPrefixCancel", testGetWithPrefixCancel},
+		{"CAS", testCAS},
+		{"GetWithSerial", testGetWithSerial},
+		{"Batcher", testBatcher},
+		{"BatchSize", testBatchSize},
+		{"Transaction", testTransaction},
+		{"TransactionConflict", testTransactionConflict},
+		{"TransactionAutoCommit", testTransactionAutoCommit},
+		{"Lease", testLease},
+		{"LeaseExpiration", testLeaseExpiration},
+		{"TTLs", testTTLs},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(
+				log.TestContext(context.Background()), timeout)
+			defer cancel()
+			test.test(ctx, t, newFunc(t))
+		})
+	}
+}
+
+// put puts key-value pairs, failing the test on error.
+func put(ctx context.Context, t *testing.T, p storage.PutGetter, kv ...string) {
+	t.Helper()
+	for i := 0; i+1 < len(kv); i += 2 {
+		if err := p.Put(ctx, kv[i], []byte(kv[i+1])); err != nil {
+			t.Fatalf("put %q failed: %v", kv[i], err)
+		}
+	}
+}
+
+// expect checks that key has the value want.
+func expect(ctx context.Context, t *testing.T, p storage.PutGetter, key, want string) {
+	t.Helper()
+	value, err := p.Get(ctx, key)
+	if err != nil {
+		t.Errorf("get %q failed: %v", key, err)
+		return
+	}
+	if !bytes.Equal(value, []byte(want)) {
+		t.Errorf("unexpected value of %q: %q, want %q", key, value, want)
+	}
+}
+
+// expectMissing checks that key does not exist.
+func expectMissing(ctx context.Context, t *testing.T, p storage.PutGetter, key string) {
+	t.Helper()
+	if _, err := p.Get(ctx, key); errors.CausedBy(err, new(storage.NotExistError)) == nil {
+		t.Errorf("get %q did not return NotExistError: %v", key, err)
+	}
+}
+
+func testPut(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	put(ctx, t, p, "/put/key", "first")
+
+	err := p.Put(ctx, "/put/key", []byte("second"))
+	if errors.CausedBy(err, new(storage.ExistError)) == nil {
+		t.Error("put existing key did not return ExistError:", err)
+	}
+	expect(ctx, t, p, "/put/key", "first")
+
+	// Empty values must be distinguishable from missing keys.
+	put(ctx, t, p, "/put/empty", "")
+	expect(ctx, t, p, "/put/empty", "")
+}
+
+func testGet(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	expectMissing(ctx, t, p, "/get/missing")
+
+	put(ctx, t, p, "/get/key", "value")
+	expect(ctx, t, p, "/get/key", "value")
+
+	// Get must not match prefixes.
+	expectMissing(ctx, t, p, "/get/k")
+}
+
+// drain reads all results from GetWithPrefix and returns the sorted keys and
+// their values along with the error from the error channel.
+func drain(results <-chan storage.GetWithPrefixResult, errc <-chan error) (
+	keys []string, values map[string]string, err error) {
+
+	values = make(map[string]string)
+	for result := range results {
+		keys = append(keys, result.Key)
+		values[result.Key] = string(result.Value)
+	}
+	sort.Strings(keys)
+	return keys, values, <-errc
+}
+
+func testGetWithPrefix(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	put(ctx, t, p,
+		"/prefix/a", "a",
+		"/prefix/b", "b",
+		"/prefix/c/d", "d",
+		"/prefixed", "not included",
+		"/other", "not included")
+
+	keys, values, err := drain(p.GetWithPrefix(ctx, "/prefix/"))
+	if err != nil {
+		t.Fatal("get with prefix failed:", err)
+	}
+	want := []string{"/prefix/a", "/prefix/b", "/prefix/c/d"}
+	if fmt.Sprint(keys) != fmt.Sprint(want) {
+		t.Errorf("unexpected keys: %q, want %q", keys, want)
+	}
+	if values["/prefix/c/d"] != "d" {
+		t.Errorf("unexpected value of /prefix/c/d: %q", values["/prefix/c/d"])
+	}
+
+	// No matching keys must close the result channel and have a nil
+	// error available.
+	if keys, _, err = drain(p.GetWithPrefix(ctx, "/nomatch/")); err != nil || len(keys) > 0 {
+		t.Errorf("unexpected result for missing prefix: %q, %v", keys, err)
+	}
+}
+
+func testGetWithPrefixCancel(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	for i := 0; i < 100; i++ {
+		put(ctx, t, p, fmt.Sprintf("/cancel/%03d", i), "value")
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	results, errc := p.GetWithPrefix(cctx, "/cancel/")
+	if _, ok := <-results; !ok {
+		t.Fatal("result channel closed before first result")
+	}
+	cancel()
+
+	// After cancelling, the result channel must still get closed and an
+	// error (possibly nil) must be readable.
+	for range results {
+	}
+	if err := <-errc; err != nil && err != context.Canceled {
+		t.Error("unexpected error after cancel:", err)
+	}
+}
+
+func testCAS(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	err := p.CAS(ctx, "/cas/missing", []byte("old"), []byte("new"))
+	if errors.CausedBy(err, new(storage.NotExistError)) == nil {
+		t.Error("CAS of missing key did not return NotExistError:", err)
+	}
+
+	put(ctx, t, p, "/cas/key", "old")
+	err = p.CAS(ctx, "/cas/key", []byte("other"), []byte("new"))
+	if errors.CausedBy(err, new(storage.UnexpectedValueError)) == nil {
+		t.Error("CAS with unexpected value did not return UnexpectedValueError:", err)
+	}
+	expect(ctx, t, p, "/cas/key", "old")
+
+	if err = p.CAS(ctx, "/cas/key", []byte("old"), []byte("new")); err != nil {
+		t.Fatal("CAS failed:", err)
+	}
+	expect(ctx, t, p, "/cas/key", "new")
+}
+
+func testGetWithSerial(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	_, serial, err := p.GetWithSerial(ctx, "/serial/missing")
+	if errors.CausedBy(err, new(storage.NotExistError)) == nil {
+		t.Error("get with serial of missing key did not return NotExistError:", err)
+	}
+	if serial != 0 {
+		t.Error("serial of missing key is not 0:", serial)
+	}
+
+	put(ctx, t, p, "/serial/key", "0")
+	value, first, err := p.GetWithSerial(ctx, "/serial/key")
+	if err != nil {
+		t.Fatal("get with serial failed:", err)
+	}
+	if !bytes.Equal(value, []byte("0")) {
+		t.Errorf("unexpected value: %q", value)
+	}
+	if first < 1 {
+		t.Error("serial of existing key is less than 1:", first)
+	}
+
+	// Serial numbers must never decrease.
+	last := first
+	for i := 1; i <= 3; i++ {
+		if err = p.CAS(ctx, "/serial/key",
+			[]byte(fmt.Sprint(i-1)), []byte(fmt.Sprint(i))); err != nil {
+
+			t.Fatal("CAS failed:", err)
+		}
+		_, serial, err := p.GetWithSerial(ctx, "/serial/key")
+		if err != nil {
+			t.Fatal("get with serial failed:", err)
+		}
+		if serial < last {
+			t.Errorf("serial decreased from %d to %d", last, serial)
+		}
+		last = serial
+	}
+}
+
+// batcher returns p as a storage.Batcher or skips the test.
+func batcher(t *testing.T, p storage.PutGetter) storage.Batcher {
+	t.Helper()
+	b, ok := p.(storage.Batcher)
+	if !ok {
+		t.Skip("protocol does not implement storage.Batcher")
+	}
+	return b
+}
+
+func testBatcher(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	b := batcher(t, p)
+
+	if err := b.PutAll(ctx,
+		storage.PutAllRequest{Key: "/batch/a", Value: []byte("a")},
+		storage.PutAllRequest{Key: "/batch/b", Value: []byte("b")}); err != nil {
+
+		t.Fatal("put all failed:", err)
+	}
+
+	values, err := b.GetAll(ctx, "/batch/a", "/batch/b", "/batch/missing")
+	if err != nil {
+		t.Fatal("get all failed:", err)
+	}
+	if len(values) != 2 || string(values["/batch/a"]) != "a" ||
+		string(values["/batch/b"]) != "b" {
+
+		t.Errorf("unexpected get all result: %q", values)
+	}
+
+	// On error, no values must be stored.
+	err = b.PutAll(ctx,
+		storage.PutAllRequest{Key: "/batch/c", Value: []byte("c")},
+		storage.PutAllRequest{Key: "/batch/a", Value: []byte("new")})
+	if errors.CausedBy(err, new(storage.ExistError)) == nil {
+		t.Error("put all with existing key did not return ExistError:", err)
+	}
+	expectMissing(ctx, t, p, "/batch/c")
+	expect(ctx, t, p, "/batch/a", "a")
+}
+
+func testBatchSize(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	b := batcher(t, p)
+
+	size := b.BatchSize()
+	if size < 1 {
+		t.Fatal("batch size is less than 1:", size)
+	}
+
+	reqs := make([]storage.PutAllRequest, size+1)
+	keys := make([]string, size+1)
+	for i := range reqs {
+		keys[i] = fmt.Sprintf("/batchsize/%d", i)
+		reqs[i] = storage.PutAllRequest{Key: keys[i], Value: []byte("value")}
+	}
+
+	if err := b.PutAll(ctx, reqs...); err == nil {
+		t.Error("put all with more than BatchSize requests succeeded")
+	}
+	expectMissing(ctx, t, p, keys[0])
+	if _, err := b.GetAll(ctx, keys...); err == nil {
+		t.Error("get all with more than BatchSize keys succeeded")
+	}
+
+	if err := b.PutAll(ctx, reqs[:size]...); err != nil {
+		t.Error("put all with BatchSize requests failed:", err)
+	}
+}
+
+// transaction returns p as a storage.Transaction or skips the test.
+func transaction(t *testing.T, p storage.PutGetter) storage.Transaction {
+	t.Helper()
+	txn, ok := p.(storage.Transaction)
+	if !ok {
+		t.Skip("protocol does not implement storage.Transaction")
+	}
+	return txn
+}
+
+func testTransaction(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	txn := transaction(t, p)
+	put(ctx, t, p, "/txn/force", "old", "/txn/cas", "old")
+
+	op, err := txn.Begin(ctx)
+	if err != nil {
+		t.Fatal("begin failed:", err)
+	}
+	op.Put("/txn/put", []byte("put"))
+	op.PutAll(&storage.PutAllRequest{Key: "/txn/all", Value: []byte("all")})
+	op.PutForce("/txn/force", []byte("force"))
+	op.CAS("/txn/cas", []byte("old"), []byte("cas"))
+	if err = txn.Commit(ctx, op); err != nil {
+		t.Fatal("commit failed:", err)
+	}
+
+	expect(ctx, t, p, "/txn/put", "put")
+	expect(ctx, t, p, "/txn/all", "all")
+	expect(ctx, t, p, "/txn/force", "force")
+	expect(ctx, t, p, "/txn/cas", "cas")
+}
+
+func testTransactionConflict(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	txn := transaction(t, p)
+	put(ctx, t, p, "/conflict/existing", "old", "/conflict/cas", "old")
+
+	tests := []struct {
+		name string
+		add  func(storage.TxnOp)
+	}{
+		{"existing", func(op storage.TxnOp) {
+			op.Put("/conflict/existing", []byte("new"))
+		}},
+		{"cas", func(op storage.TxnOp) {
+			op.CAS("/conflict/cas", []byte("other"), []byte("new"))
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			op, err := txn.Begin(ctx)
+			if err != nil {
+				t.Fatal("begin failed:", err)
+			}
+			op.Put("/conflict/new", []byte("new"))
+			op.PutForce("/conflict/force", []byte("new"))
+			test.add(op)
+
+			err = txn.Commit(ctx, op)
+			if errors.CausedBy(err, new(storage.UnexpectedValueError)) == nil {
+				t.Fatal("conflicting commit did not return UnexpectedValueError:", err)
+			}
+
+			// All or nothing: no operation must be applied.
+			expectMissing(ctx, t, p, "/conflict/new")
+			expectMissing(ctx, t, p, "/conflict/force")
+			expect(ctx, t, p, "/conflict/existing", "old")
+			expect(ctx, t, p, "/conflict/cas", "old")
+		})
+	}
+}
+
+func testTransactionAutoCommit(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	txn := transaction(t, p)
+
+	op, err := txn.Begin(ctx)
+	if err != nil {
+		t.Fatal("begin failed:", err)
+	}
+	txn.AutoCommit(ctx, op)
+	op.Put("/autocommit/key", []byte("value"))
+	if err = op.Ready(ctx); err != nil {
+		t.Fatal("ready failed:", err)
+	}
+	expect(ctx, t, p, "/autocommit/key", "value")
+
+	// Errors must be reported through Ready.
+	if op, err = txn.Begin(ctx); err != nil {
+		t.Fatal("begin failed:", err)
+	}
+	txn.AutoCommit(ctx, op)
+	op.Put("/autocommit/key", []byte("other"))
+	err = op.Ready(ctx)
+	if errors.CausedBy(err, new(storage.UnexpectedValueError)) == nil {
+		t.Error("ready of conflicting commit did not return UnexpectedValueError:", err)
+	}
+	expect(ctx, t, p, "/autocommit/key", "value")
+}
+
+// withOpts returns p as a storage.PutGetterWithOpts or skips the test.
+func withOpts(t *testing.T, p storage.PutGetter) storage.PutGetterWithOpts {
+	t.Helper()
+	o, ok := p.(storage.PutGetterWithOpts)
+	if !ok {
+		t.Skip("protocol does not implement storage.PutGetterWithOpts")
+	}
+	return o
+}
+
+func testLease(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	o := withOpts(t, p)
+
+	value, lease, err := o.GetWithLease(ctx, "/lease/key")
+	if err != nil || value != nil {
+		t.Errorf("unexpected result for missing key: %q, %v", value, err)
+	}
+
+	if err = o.PutForceWithOpts(ctx, "/lease/key", []byte("first"),
+		&storage.PutOpOptionWithTTL{TTL: "60"}); err != nil {
+
+		t.Fatal("put with TTL failed:", err)
+	}
+	if value, lease, err = o.GetWithLease(ctx, "/lease/key"); err != nil {
+		t.Fatal("get with lease failed:", err)
+	}
+	if !bytes.Equal(value, []byte("first")) {
+		t.Errorf("unexpected value: %q", value)
+	}
+	if lease == "" || lease == "0" {
+		t.Errorf("unexpected lease ID: %q", lease)
+	}
+
+	// Reuse the existing lease.
+	if err = o.PutForceWithOpts(ctx, "/lease/key", []byte("second"),
+		&storage.PutOpOptionWithTTL{LeaseID: lease}); err != nil {
+
+		t.Fatal("put with lease failed:", err)
+	}
+	value, reused, err := o.GetWithLease(ctx, "/lease/key")
+	if err != nil {
+		t.Fatal("get with lease failed:", err)
+	}
+	if !bytes.Equal(value, []byte("second")) || reused != lease {
+		t.Errorf("unexpected value and lease: %q, %q, want lease %q", value, reused, lease)
+	}
+
+	if err = o.Delete(ctx, "/lease/key"); err != nil {
+		t.Fatal("delete failed:", err)
+	}
+	if value, _, err = o.GetWithLease(ctx, "/lease/key"); err != nil || value != nil {
+		t.Errorf("unexpected result for deleted key: %q, %v", value, err)
+	}
+	if err = o.Delete(ctx, "/lease/key"); err != nil {
+		t.Error("delete of missing key failed:", err)
+	}
+}
+
+func testLeaseExpiration(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	o := withOpts(t, p)
+	if testing.Short() {
+		t.Skip("waiting for lease expiration in short mode")
+	}
+
+	if err := o.PutForceWithOpts(ctx, "/expire/key", []byte("value"),
+		&storage.PutOpOptionWithTTL{TTL: "1"}); err != nil {
+
+		t.Fatal("put with TTL failed:", err)
+	}
+
+	// Allow for coarse expiration checks in the implementation.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		value, _, err := o.GetWithLease(ctx, "/expire/key")
+		if err != nil {
+			t.Fatal("get with lease failed:", err)
+		}
+		if value == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("key did not expire")
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+	expectMissing(ctx, t, p, "/expire/key")
+}
+
+func testTTLs(ctx context.Context, t *testing.T, p storage.PutGetter) {
+	o := withOpts(t, p)
+	g, ok := p.(storage.TTLGetter)
+	if !ok {
+		t.Skip("protocol does not implement storage.TTLGetter")
+	}
+
+	put(ctx, t, p, "/ttl/plain", "value")
+	if err := o.PutForceWithOpts(ctx, "/ttl/lease", []byte("value"),
+		&storage.PutOpOptionWithTTL{TTL: "60"}); err != nil {
+
+		t.Fatal("put with TTL failed:", err)
+	}
+	if err := o.PutForceWithOpts(ctx, "/other/lease", []byte("value"),
+		&storage.PutOpOptionWithTTL{TTL: "60"}); err != nil {
+
+		t.Fatal("put with TTL failed:", err)
+	}
+
+	ttls, err := g.GetTTLs(ctx, "/ttl/")
+	if err != nil {
+		t.Fatal("get TTLs failed:", err)
+	}
+	if len(ttls) != 1 || ttls["/ttl/lease"] < 1 || ttls["/ttl/lease"] > 60 {
+		t.Errorf("unexpected TTLs: %v", ttls)
+	}
+}
@@ -0,0 +1,183 @@
+package trace
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// maxPending is the number of spans after which pending spans are written out
+// even if no trace has finished.
+const maxPending = 512
+
+// FileExporter appends spans to a file in the OTLP/JSON format: each line is
+// an encoded ExportTraceServiceRequest message. Spans are buffered and
+// written out when a root span finishes, so that traces are written out
+// together.
+type FileExporter struct {
+	service string
+
+	lock    sync.Mutex
+	fp      *os.File
+	w       *bufio.Writer
+	pending []otlpSpan
+	err     error // First write error, reported by Close.
+}
+
+// NewFileExporter opens the file at path for appending spans of the named
+// service.
+func NewFileExporter(path, service string) (*FileExporter, error) {
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, OpenTraceFileError{Path: path, Err: err}
+	}
+	return &FileExporter{service: service, fp: fp, w: bufio.NewWriter(fp)}, nil
+}
+
+// Export implements the Exporter interface.
+func (f *FileExporter) Export(s *Span) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.fp == nil {
+		return // Closed.
+	}
+	f.pending = append(f.pending, encodeSpan(s))
+	if s.Root() || len(f.pending) >= maxPending {
+		f.flush()
+	}
+}
+
+// flush writes pending spans out. Must be called with f.lock held.
+func (f *FileExporter) flush() {
+	if len(f.pending) == 0 {
+		return
+	}
+	req := otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			attribute("service.name", f.service),
+		}},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "ivxv.ee/common/collector/trace"},
+			Spans: f.pending,
+		}},
+	}}}
+	f.pending = nil
+
+	encoded, err := json.Marshal(req)
+	if err == nil {
+		encoded = append(encoded, '\n')
+		if _, err = f.w.Write(encoded); err == nil {
+			err = f.w.Flush()
+		}
+	}
+	if err != nil && f.err == nil {
+		f.err = WriteTraceFileError{Err: err}
+	}
+}
+
+// Close writes out any pending spans and closes the file. Spans exported
+// after Close are dropped.
+func (f *FileExporter) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if f.fp == nil {
+		return nil
+	}
+	f.flush()
+	err := f.err
+	if cerr := f.fp.Close(); cerr != nil && err == nil {
+		err = CloseTraceFileError{Err: cerr}
+	}
+	f.fp = nil
+	return err
+}
+
+// OTLP/JSON message structure. Only the fields used by Span are included.
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              int             `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+// OTLP span kinds and status codes.
+const (
+	otlpKindInternal = 1
+	otlpKindServer   = 2
+	otlpStatusOK     = 1
+	otlpStatusError  = 2
+)
+
+func attribute(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func encodeSpan(s *Span) otlpSpan {
+	span := otlpSpan{
+		TraceID:           hex.EncodeToString(s.TraceID[:]),
+		SpanID:            hex.EncodeToString(s.SpanID[:]),
+		Name:              s.Name,
+		Kind:              otlpKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		Status:            otlpStatus{Code: otlpStatusOK},
+	}
+	if s.Root() {
+		span.Kind = otlpKindServer
+	} else {
+		span.ParentSpanID = hex.EncodeToString(s.ParentID[:])
+	}
+	for _, a := range s.Attributes {
+		span.Attributes = append(span.Attributes, attribute(a.Key, a.Value))
+	}
+	if len(s.Error) > 0 {
+		span.Status = otlpStatus{Code: otlpStatusError, Message: s.Error}
+	}
+	return span
+}
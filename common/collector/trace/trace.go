@@ -0,0 +1,135 @@
+/*
+Package trace provides span-based tracing of requests.
+
+A span measures a single operation, e.g., handling an RPC request or querying
+the storage service. Spans are started with Start, which stores the new span in
+the returned context: spans started with that context become its children, so
+the context must be passed down to nested operations.
+
+Finished spans are passed to the exporter set with SetExporter. If no exporter
+is set, then Start does not create spans and tracing has next to no overhead.
+*/
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"sync/atomic"
+	"time"
+)
+
+// Exporter exports finished spans.
+type Exporter interface {
+	// Export is called with each finished span. It must be safe for
+	// concurrent use and should not block for long.
+	Export(*Span)
+}
+
+// exporter holds an exporterBox, so that atomic.Value always stores the same
+// concrete type.
+var exporter atomic.Value
+
+type exporterBox struct{ Exporter }
+
+// SetExporter sets the exporter of finished spans. A nil exporter disables
+// tracing.
+func SetExporter(e Exporter) {
+	exporter.Store(exporterBox{e})
+}
+
+func current() Exporter {
+	box, _ := exporter.Load().(exporterBox)
+	return box.Exporter
+}
+
+// Attribute is a key-value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value string
+}
+
+// Span is a single traced operation. All methods of Span are safe to call on
+// a nil span, which is returned by Start if tracing is disabled.
+type Span struct {
+	TraceID  [16]byte
+	SpanID   [8]byte
+	ParentID [8]byte // Zero for root spans.
+
+	Name       string
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+
+	// Error is the error message of the operation if it failed.
+	Error string
+
+	exporter Exporter
+	ended    uint32
+}
+
+type spanKey struct{}
+
+// FromContext returns the current span stored in ctx or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// Start starts a new span with name and attributes given as a list of
+// alternating keys and values. If ctx contains a span, then the new span is
+// its child, otherwise a new trace is started. The returned context contains
+// the new span.
+//
+// If tracing is disabled, then Start returns ctx unmodified and a nil span.
+func Start(ctx context.Context, name string, attributes ...string) (context.Context, *Span) {
+	e := current()
+	if e == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{Name: name, Start: time.Now(), exporter: e}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID = parent.TraceID
+		span.ParentID = parent.SpanID
+	} else {
+		rand.Read(span.TraceID[:]) //nolint:errcheck // Never returns an error.
+	}
+	rand.Read(span.SpanID[:]) //nolint:errcheck // Never returns an error.
+	for i := 0; i+1 < len(attributes); i += 2 {
+		span.SetAttribute(attributes[i], attributes[i+1])
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SetAttribute adds an attribute to the span. It must not be called
+// concurrently with other methods of the span.
+func (s *Span) SetAttribute(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Attributes = append(s.Attributes, Attribute{Key: key, Value: value})
+}
+
+// Root reports if the span is the root of its trace.
+func (s *Span) Root() bool {
+	return s != nil && s.ParentID == [8]byte{}
+}
+
+// Finish ends the span and exports it. If err is not nil, then the span is
+// marked as failed. Only the first call to Finish has any effect.
+func (s *Span) Finish(err error) {
+	if s == nil || !atomic.CompareAndSwapUint32(&s.ended, 0, 1) {
+		return
+	}
+	s.End = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.exporter.Export(s)
+}
@@ -0,0 +1,63 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDisabled(t *testing.T) {
+	SetExporter(nil)
+	ctx := context.Background()
+	if sctx, span := Start(ctx, "disabled"); sctx != ctx || span != nil {
+		t.Error("span started with tracing disabled")
+	}
+	var span *Span
+	span.SetAttribute("key", "value")
+	span.Finish(nil) // Must not panic.
+}
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.json")
+	e, err := NewFileExporter(path, "test")
+	if err != nil {
+		t.Fatal("new file exporter error:", err)
+	}
+	SetExporter(e)
+	defer SetExporter(nil)
+
+	ctx, root := Start(context.Background(), "root", "method", "RPC.Vote")
+	_, child := Start(ctx, "child")
+	child.Finish(errors.New("failed"))
+	child.Finish(nil) // Ignored.
+	root.Finish(nil)
+	if err = e.Close(); err != nil {
+		t.Fatal("close error:", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("read error:", err)
+	}
+	var req otlpRequest
+	if err = json.Unmarshal(data, &req); err != nil {
+		t.Fatal("decode error:", err)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatal("unexpected span count:", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID || r.ParentSpanID != "" {
+		t.Errorf("bad span hierarchy: child %+v, root %+v", c, r)
+	}
+	if c.Status.Code != otlpStatusError || c.Status.Message != "failed" {
+		t.Errorf("unexpected child status: %+v", c.Status)
+	}
+	if len(r.Attributes) != 1 || r.Attributes[0].Value.StringValue != "RPC.Vote" {
+		t.Errorf("unexpected root attributes: %+v", r.Attributes)
+	}
+}
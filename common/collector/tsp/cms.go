@@ -80,7 +80,9 @@ var (
 	idSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
 )
 
-func (c *Client) checkSignedData(token timeStampToken, gen time.Time) error {
+func (c *Client) checkSignedData(token timeStampToken, gen time.Time,
+	signers []*x509.Certificate) error {
+
 	if !token.ContentType.Equal(idSignedData) {
 		return UnexpectedTSTContentType{ContentType: token.ContentType}
 	}
@@ -107,7 +109,7 @@ func (c *Client) checkSignedData(token timeStampToken, gen time.Time) error {
 	sInfo := sData.SignerInfos[0]
 
 	// Find the signer's certificate from our trusted pool.
-	cert, err := findCertificate(sInfo, c.signers)
+	cert, err := findCertificate(sInfo, signers)
 	if err != nil {
 		return UntrustedSigningCertificateError{Err: err}
 	}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"time"
 
+	"ivxv.ee/common/collector/breaker"
 	"ivxv.ee/common/collector/cryptoutil"
 	"ivxv.ee/common/collector/errors"
 	"ivxv.ee/common/collector/log"
@@ -55,6 +56,14 @@ type Conf struct {
 	// The certificates used by the server to sign the token.
 	Signers []string
 
+	// Endpoints are additional TSP servers which requests fail over to, in
+	// the listed order, if requests to URL fail.
+	Endpoints []Endpoint
+
+	// Breaker configures the circuit breakers used for skipping failing
+	// TSP servers.
+	Breaker breaker.Conf
+
 	// The maximum time that GenTime and SignTime can differ in a timestamp
 	DelayTime int64
 
@@ -69,24 +78,32 @@ type Conf struct {
 	MaxAge uint64
 }
 
-// Client is used for performing TSP requests and checking responses.
-type Client struct {
+// Endpoint is the configuration of an additional TSP server.
+type Endpoint struct {
+	URL     string
+	Signers []string // Signing certificates of this server.
+}
+
+// endpoint is a configured TSP server.
+type endpoint struct {
 	url     string
 	signers []*x509.Certificate
-	delay   time.Duration
-	retry   uint64
-	maxSkew time.Duration
-	maxAge  time.Duration
+	breaker *breaker.Breaker
+}
+
+// Client is used for performing TSP requests and checking responses.
+type Client struct {
+	endpoints []*endpoint
+	signers   []*x509.Certificate // Signers of all endpoints.
+	delay     time.Duration
+	retry     uint64
+	maxSkew   time.Duration
+	maxAge    time.Duration
 }
 
 // New returns a new TSP client with the provided configuration.
 func New(conf *Conf) (c *Client, err error) {
-	if len(conf.Signers) == 0 {
-		return nil, UnconfiguredSignersError{}
-	}
-
 	c = &Client{
-		url:     conf.URL,
 		delay:   time.Duration(conf.DelayTime) * time.Second,
 		retry:   conf.Retry,
 		maxSkew: time.Duration(conf.MaxSkew) * time.Second,
@@ -98,8 +115,29 @@ func New(conf *Conf) (c *Client, err error) {
 	if conf.MaxAge <= 0 {
 		c.maxAge = maxAge
 	}
-	if c.signers, err = cryptoutil.PEMCertificates(conf.Signers...); err != nil {
-		return nil, SignerParsingError{Err: err}
+	endpoints := append([]Endpoint{{URL: conf.URL, Signers: conf.Signers}},
+		conf.Endpoints...)
+	for i, e := range endpoints {
+		if len(e.Signers) == 0 {
+			return nil, UnconfiguredSignersError{Endpoint: i}
+		}
+		signers, err := cryptoutil.PEMCertificates(e.Signers...)
+		if err != nil {
+			return nil, SignerParsingError{Endpoint: i, Err: err}
+		}
+		c.signers = append(c.signers, signers...)
+
+		if len(e.URL) == 0 {
+			if i > 0 {
+				return nil, UnconfiguredEndpointURLError{Endpoint: i}
+			}
+			continue // Only checking stored tokens with signers.
+		}
+		c.endpoints = append(c.endpoints, &endpoint{
+			url:     e.URL,
+			signers: signers,
+			breaker: breaker.New(conf.Breaker, e.URL),
+		})
 	}
 	return
 }
@@ -108,8 +146,11 @@ func New(conf *Conf) (c *Client, err error) {
 // server. If nonce is not nil, then that value will be used as the nonce in
 // the request, otherwise a random value is generated. Create returns a
 // DER-encoded timestamp token.
+//
+// If requests to a TSP server fail, then they fail over to the next configured
+// server. Servers with open circuit breakers are skipped.
 func (c *Client) Create(ctx context.Context, data, nonce []byte) ([]byte, error) {
-	if len(c.url) == 0 {
+	if len(c.endpoints) == 0 {
 		return nil, UnconfiguredURLError{}
 	}
 
@@ -121,11 +162,12 @@ func (c *Client) Create(ctx context.Context, data, nonce []byte) ([]byte, error)
 		}
 	}
 
+	var e *endpoint
 	var tst timeStampToken
 	var err error
 retry:
 	for attempt := uint64(0); ; attempt++ {
-		switch tst, err = c.submitRequest(ctx, data, nonce); {
+		switch e, tst, err = c.submit(ctx, data, nonce); {
 		case err == nil:
 			break retry
 		case attempt < c.retry && shouldRetry(err):
@@ -145,13 +187,38 @@ retry:
 		return nil, GenTimeCheckError{Err: err}
 	}
 
-	if err = c.checkSignedData(tst, info.GenTime); err != nil {
+	if err = c.checkSignedData(tst, info.GenTime, e.signers); err != nil {
 		return nil, SignedDataCheckError{Err: err}
 	}
 
 	return tst.Raw, nil
 }
 
+// submit submits the request to the first endpoint with a closed circuit
+// breaker. If the request fails with an error that should be retried, then it
+// fails over to the next endpoint. submit returns the endpoint which
+// responded.
+func (c *Client) submit(ctx context.Context, data, nonce []byte) (
+	e *endpoint, tst timeStampToken, err error) {
+
+	err = NoAvailableEndpointError{}
+	for _, e = range c.endpoints {
+		if !e.breaker.Allow() {
+			log.Log(ctx, SkippingEndpoint{URL: e.url})
+			continue
+		}
+		tst, err = c.submitRequest(ctx, e.url, data, nonce)
+		if err != nil && shouldRetry(err) {
+			e.breaker.Failure()
+			log.Log(ctx, EndpointFailed{URL: e.url, Err: err})
+			continue
+		}
+		e.breaker.Success()
+		return
+	}
+	return nil, tst, err
+}
+
 func shouldRetry(err error) bool {
 	return errors.Walk(err, func(err error) error {
 		switch t := err.(type) {
@@ -184,7 +251,7 @@ func (c *Client) Check(response, data, nonce []byte) (time.Time, error) {
 		return time.Time{}, CheckTSTInfoCheckError{Err: err}
 	}
 
-	if err = c.checkSignedData(tsToken, info.GenTime); err != nil {
+	if err = c.checkSignedData(tsToken, info.GenTime, c.signers); err != nil {
 		return time.Time{}, CheckSignedDataCheckError{Err: err}
 	}
 	return info.GenTime, nil
@@ -207,7 +274,7 @@ func ParseTime(response []byte) (time.Time, error) {
 	return info.GenTime, nil
 }
 
-func (c *Client) submitRequest(ctx context.Context, data, nonce []byte) (
+func (c *Client) submitRequest(ctx context.Context, url string, data, nonce []byte) (
 	tst timeStampToken, err error) {
 
 	// Construct the request.
@@ -238,7 +305,7 @@ func (c *Client) submitRequest(ctx context.Context, data, nonce []byte) (
 	}
 
 	// Submit the request and read the response.
-	httpReq, err := http.NewRequest(http.MethodPost, c.url, bytes.NewBuffer(reqBytes))
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(reqBytes))
 	if err != nil {
 		err = NewRequestError{Err: err}
 		return
@@ -254,7 +321,7 @@ func (c *Client) submitRequest(ctx context.Context, data, nonce []byte) (
 	log.Debug(ctx, RequestDump{Request: string(reqDump)})
 
 	log.Log(ctx, SendingRequest{
-		URL:   c.url,
+		URL:   url,
 		Hash:  req.MessageImprint.HashedMessage,
 		Nonce: n,
 	})
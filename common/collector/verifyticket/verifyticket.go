@@ -0,0 +1,102 @@
+/*
+Package verifyticket implements time-limited vote verification tickets issued
+by the collector.
+
+After a vote is stored, the voting service issues a verification ticket which
+binds the vote identifier to the election and the end of the verification
+period. The ticket is encrypted and authenticated with a key derived from the
+key shared by collector services, so the verification service can reject
+forged and expired tickets without accessing storage, which makes probing
+random vote identifiers infeasible.
+
+The key is derived with a purpose label, so that verification tickets and
+authentication tickets cannot be accepted in place of each other.
+*/
+package verifyticket
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"os"
+	"time"
+
+	"ivxv.ee/common/collector/auth/ticket"
+	"ivxv.ee/common/collector/cookie"
+)
+
+// Ticket is the content of a verification ticket.
+type Ticket struct {
+	Election string    // Identifier of the election.
+	VoteID   []byte    // Identifier of the vote to verify.
+	Expiry   time.Time // Time after which the ticket is no longer valid.
+}
+
+// T is a verification ticket manager which can issue and open tickets.
+type T struct {
+	cookie *cookie.C
+}
+
+// purpose is the label used to derive the verification ticket key.
+const purpose = "ivxv.ee/common/collector/verifyticket"
+
+// New creates a new verification ticket manager with a key derived from the
+// provided cookie key.
+func New(key cookie.Key) (t *T, err error) {
+	c, err := cookie.New(cookie.Derive(key, purpose))
+	if err != nil {
+		return nil, NewCookieError{Err: err}
+	}
+	return &T{cookie: c}, nil
+}
+
+// NewFromSystem creates a new verification ticket manager with a key derived
+// from the key shared by collector services for authentication tickets.
+func NewFromSystem() (t *T, err error) {
+	key, err := os.ReadFile(ticket.SystemKeyPath)
+	if err != nil {
+		return nil, ReadSystemKeyError{Err: err}
+	}
+	if t, err = New(key); err != nil {
+		return nil, NewFromSystemError{Err: err}
+	}
+	return
+}
+
+// Create issues a new verification ticket.
+func (t *T) Create(vt Ticket) (ticket []byte, err error) {
+	plain, err := asn1.Marshal(vt)
+	if err != nil {
+		return nil, MarshalTicketError{Err: err}
+	}
+	return t.cookie.Create(plain), nil
+}
+
+// Open opens the verification ticket and checks that it was issued for the
+// election and has not expired at time now. If voteID is not empty, then it
+// must match the vote identifier in the ticket.
+func (t *T) Open(ticket []byte, election string, voteID []byte, now time.Time) (
+	vt Ticket, err error) {
+
+	plain, err := t.cookie.Open(ticket)
+	if err != nil {
+		return vt, OpenTicketError{Err: err}
+	}
+	rest, err := asn1.Unmarshal(plain, &vt)
+	if err != nil {
+		return vt, UnmarshalTicketError{Err: err}
+	}
+	if len(rest) > 0 {
+		return vt, TrailingDataError{Rest: rest}
+	}
+
+	if vt.Election != election {
+		return vt, ElectionMismatchError{Ticket: vt.Election, Election: election}
+	}
+	if len(voteID) > 0 && !bytes.Equal(vt.VoteID, voteID) {
+		return vt, VoteIDMismatchError{Ticket: vt.VoteID, VoteID: voteID}
+	}
+	if now.After(vt.Expiry) {
+		return vt, ExpiredTicketError{Expiry: vt.Expiry}
+	}
+	return vt, nil
+}
@@ -0,0 +1,96 @@
+package verifyticket
+
+import (
+	"encoding/asn1"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/auth/ticket"
+	"ivxv.ee/common/collector/errors"
+)
+
+func TestTicket(t *testing.T) {
+	vt, err := New(make([]byte, 16))
+	if err != nil {
+		t.Fatal("failed to create ticket manager:", err)
+	}
+	other, err := New(make([]byte, 32))
+	if err != nil {
+		t.Fatal("failed to create other ticket manager:", err)
+	}
+
+	now := time.Now()
+	voteID := []byte("vote identifier")
+	ticket, err := vt.Create(Ticket{
+		Election: "election",
+		VoteID:   voteID,
+		Expiry:   now.Add(time.Minute),
+	})
+	if err != nil {
+		t.Fatal("failed to create ticket:", err)
+	}
+
+	opened, err := vt.Open(ticket, "election", nil, now)
+	if err != nil {
+		t.Fatal("failed to open ticket:", err)
+	}
+	if string(opened.VoteID) != string(voteID) {
+		t.Errorf("unexpected vote ID: %q", opened.VoteID)
+	}
+
+	for _, test := range []struct {
+		name     string
+		t        *T
+		election string
+		voteID   []byte
+		now      time.Time
+		expected error
+	}{
+		{"forged", other, "election", nil, now, new(OpenTicketError)},
+		{"other election", vt, "other", nil, now, new(ElectionMismatchError)},
+		{"other vote", vt, "election", []byte("other"), now, new(VoteIDMismatchError)},
+		{"expired", vt, "election", nil, now.Add(2 * time.Minute), new(ExpiredTicketError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.t.Open(ticket, test.election, test.voteID, test.now)
+			if errors.CausedBy(err, test.expected) == nil {
+				t.Errorf("unexpected error: %v, want %T", err, test.expected)
+			}
+		})
+	}
+}
+
+func TestTicketPurpose(t *testing.T) {
+	key := make([]byte, 16)
+	vt, err := New(key)
+	if err != nil {
+		t.Fatal("failed to create ticket manager:", err)
+	}
+	at, err := ticket.New(key)
+	if err != nil {
+		t.Fatal("failed to create authentication ticket manager:", err)
+	}
+
+	// A verification ticket is not an authentication ticket.
+	now := time.Now()
+	vticket, err := vt.Create(Ticket{Election: "election", VoteID: []byte("vote"), Expiry: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal("failed to create ticket:", err)
+	}
+	if _, err = at.TokenData(vticket); err == nil {
+		t.Error("verification ticket accepted as authentication ticket")
+	}
+
+	// Neither is an authentication ticket with verification ticket contents.
+	plain, err := asn1.Marshal(Ticket{Election: "election", VoteID: []byte("vote"), Expiry: now.Add(time.Minute)})
+	if err != nil {
+		t.Fatal("failed to marshal ticket:", err)
+	}
+	aticket, err := at.CreateData(plain)
+	if err != nil {
+		t.Fatal("failed to create authentication ticket:", err)
+	}
+	if _, err = vt.Open(aticket, "election", nil, now); errors.CausedBy(err, new(OpenTicketError)) == nil {
+		t.Errorf("unexpected error: %v, want OpenTicketError", err)
+	}
+}
@@ -441,7 +441,7 @@ func ddsmain() (code int) {
 		// regardless of configuration, since those are the ones used
 		// by Mobile-ID.
 		if authConf, err = server.NewAuthConf(auth.Conf{auth.Ticket: ticketConf},
-			identity.SerialNumber, nil); err != nil {
+			identity.SerialNumber, nil, nil); err != nil {
 
 			return c.Error(exit.Config, ServerAuthConfError{Err: err},
 				"failed to configure client authentication:", err)
@@ -49,11 +49,11 @@ func NewClient(c *command.C) (client.Verifier, int) {
 		return nil, errCode
 	}
 
-	return &RPC{
+	return status.Traced(&RPC{
 		client:  tlsDialer,
 		authTTL: c.Conf.Technical.Status.Session.AuthTTL,
 		voteTTL: c.Conf.Technical.Status.Session.VoteTTL,
-	}, exitCodeOK
+	}), exitCodeOK
 }
 
 func (r *RPC) Verify(dto interface{}) (bool, error) {
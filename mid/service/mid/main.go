@@ -26,6 +26,7 @@ import (
 	status "ivxv.ee/common/collector/status/client/rpc"
 	internal "ivxv.ee/mid/internal/sessionstatus/rpc"
 	//ivxv:modules common/collector/container
+	//ivxv:modules common/collector/storage
 )
 
 const (
@@ -552,7 +553,7 @@ func midmain() (code int) {
 		// Parse configuration for authenticating with tickets issued
 		// by this server.
 		if authConf, err = server.NewAuthConf(auth.Conf{auth.Ticket: ticketConf},
-			c.Conf.Election.Identity, nil); err != nil {
+			c.Conf.Election.Identity, nil, nil); err != nil {
 
 			return c.Error(exit.Config, ServerAuthConfError{Err: err},
 				"failed to configure client authentication:", err)
@@ -568,12 +569,14 @@ func midmain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)
@@ -1,6 +1,10 @@
 package rpc
 
-import "ivxv.ee/common/collector/server"
+import (
+	"encoding/json"
+
+	"ivxv.ee/common/collector/server"
+)
 
 type StatusReadReqBuilder struct {
 	header server.Header
@@ -88,14 +92,20 @@ func (surb *StatusUpdateReqBuilder) WithTTL(t string) *StatusUpdateReqBuilder {
 	return surb
 }
 
-// Build returns StatusUpdateReq.
+// Build returns StatusUpdateReq. The voter identity is taken from the header
+// context if the voter is already authenticated.
 func (surb *StatusUpdateReqBuilder) Build() StatusUpdateReq {
+	var voter string
+	if surb.header.Ctx != nil {
+		voter = server.VoterIdentity(surb.header.Ctx)
+	}
 	return StatusUpdateReq{
 		Header: surb.header,
 		Caller: surb.caller,
 		Auth:   surb.auth,
 		Lease:  surb.lease,
 		TTL:    surb.ttl,
+		Voter:  voter,
 	}
 }
 
@@ -162,3 +172,67 @@ func (sdrb *StatusDeleteRespBuilder) Build() StatusDeleteResp {
 		Ok: sdrb.response[okField].(bool),
 	}
 }
+
+type StatusHistoryReqBuilder struct {
+	header  server.Header
+	session string
+	voter   string
+}
+
+// NewSessionStatusHistoryReqBuilder is a Builder-pattern constructor, which is
+// used to prepare a StatusHistoryReq.
+func NewSessionStatusHistoryReqBuilder() *StatusHistoryReqBuilder {
+	return new(StatusHistoryReqBuilder)
+}
+
+func (shrb *StatusHistoryReqBuilder) WithHeader(h server.Header) *StatusHistoryReqBuilder {
+	shrb.header = h
+	return shrb
+}
+
+func (shrb *StatusHistoryReqBuilder) WithSession(s string) *StatusHistoryReqBuilder {
+	shrb.session = s
+	return shrb
+}
+
+func (shrb *StatusHistoryReqBuilder) WithVoter(v string) *StatusHistoryReqBuilder {
+	shrb.voter = v
+	return shrb
+}
+
+// Build returns StatusHistoryReq.
+func (shrb *StatusHistoryReqBuilder) Build() StatusHistoryReq {
+	return StatusHistoryReq{
+		Header:  shrb.header,
+		Session: shrb.session,
+		Voter:   shrb.voter,
+	}
+}
+
+type StatusHistoryRespBuilder struct {
+	response map[string]any
+}
+
+// NewSessionStatusHistoryRespBuilder is a Builder-pattern constructor, which
+// is used to prepare a StatusHistoryResp.
+func NewSessionStatusHistoryRespBuilder() *StatusHistoryRespBuilder {
+	return new(StatusHistoryRespBuilder)
+}
+
+func (shrb *StatusHistoryRespBuilder) WithResponse(r map[string]any) *StatusHistoryRespBuilder {
+	shrb.response = r
+	return shrb
+}
+
+// Build returns StatusHistoryResp. Unlike other responses, the history is
+// nested, so it is decoded from the response using JSON.
+func (shrb *StatusHistoryRespBuilder) Build() (resp StatusHistoryResp, err error) {
+	encoded, err := json.Marshal(shrb.response)
+	if err != nil {
+		return resp, MarshalStatusHistoryRespError{Err: err}
+	}
+	if err = json.Unmarshal(encoded, &resp); err != nil {
+		return resp, UnmarshalStatusHistoryRespError{Err: err}
+	}
+	return resp, nil
+}
@@ -9,37 +9,6 @@ import (
 	status "ivxv.ee/common/collector/status/client"
 )
 
-// If any new RPC endpoint is about to appear in a IVXV online workflow
-// then it should be added here, in case you wish that endpoint to
-// receive status checks.
-const (
-	// Empty RPC
-	Empty = ""
-
-	// Mobile-ID or Smart-ID authentication
-	Authenticate       = "RPC.Authenticate"
-	AuthenticateStatus = "RPC.AuthenticateStatus"
-
-	// Web eID authentication
-	Challenge = "RPC.Challenge"
-	Token     = "RPC.Token"
-
-	// Choices list
-	VoterChoices = "RPC.VoterChoices"
-
-	// Mobile-ID or Smart-ID signing certificate REST query
-	GetCertificate = "RPC.GetCertificate"
-	// Smart-ID signing certificate received status check
-	GetCertificateStatus = "RPC.GetCertificateStatus"
-
-	// Mobile-ID or Smart-ID signing
-	Sign       = "RPC.Sign"
-	SignStatus = "RPC.SignStatus"
-
-	// Voting, i.e. storing a vote in a database
-	Vote = "RPC.Vote"
-)
-
 var commonErrTxt3 = "Two structs are not equal. Expected %v, got %v\n"
 
 // Example of StatusReadReq
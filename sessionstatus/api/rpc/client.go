@@ -7,6 +7,7 @@ import (
 	"ivxv.ee/common/collector/command/exit"
 	"ivxv.ee/common/collector/conf"
 	"ivxv.ee/common/collector/cryptoutil"
+	statusConf "ivxv.ee/common/collector/status"
 	status "ivxv.ee/common/collector/status/client"
 	client "ivxv.ee/common/collector/status/client/rpc"
 	"ivxv.ee/common/collector/storage/etcd"
@@ -18,7 +19,8 @@ type Client struct {
 }
 
 // NewClient configures session status TLS client to communicate with a
-// session status service.
+// session status service. If the session status is configured as embedded,
+// then the returned client processes requests in-process instead.
 func NewClient(c *command.C) (status.TLSDialer, int) {
 	// Get session status client configuration from technical.yml
 	observable := c.Conf.Technical.Status.Session
@@ -27,6 +29,42 @@ func NewClient(c *command.C) (status.TLSDialer, int) {
 			"failed to read session observable client from configuration")
 	}
 
+	// Process session status requests in-process if configured
+	if observable.Embedded {
+		return newEmbeddedClient(c, observable)
+	}
+
+	// Get filepath of a client TLS cert and key
+	cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
+
+	return newTLSClient(c, observable, cert, key)
+}
+
+// NewOperatorClient configures session status TLS client for operator
+// command-line tools, which authenticate using the operator's TLS client
+// certificate at cert and key instead of the service certificate. The
+// certificate must be issued by the storage CA. If the session status is
+// configured as embedded, then the returned client processes requests
+// in-process instead.
+func NewOperatorClient(c *command.C, cert, key string) (status.TLSDialer, int) {
+	observable := c.Conf.Technical.Status.Session
+	if observable == nil {
+		var confErr SessionObservableNotConfiguredError
+		return nil, c.Error(exit.Config, confErr,
+			"failed to read session observable client from configuration")
+	}
+	if observable.Embedded {
+		return newEmbeddedClient(c, observable)
+	}
+	return newTLSClient(c, observable, cert, key)
+}
+
+// newTLSClient configures session status TLS client with client certificate
+// cert and key to communicate with session status service instances in the
+// network segment of c.
+func newTLSClient(c *command.C, observable *statusConf.Observable, cert, key string) (
+	status.TLSDialer, int) {
+
 	// Get storage CA certificate from technical.yml (storage:conf:ca)
 	var storageConf etcd.Conf
 	err := yaml.Apply(c.Conf.Technical.Storage.Conf, &storageConf)
@@ -42,9 +80,6 @@ func NewClient(c *command.C) (status.TLSDialer, int) {
 			"failed to add storage CA to certificate pool:", err)
 	}
 
-	// Get filepath of a client TLS cert and key
-	cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
-
 	// Parse client TLS certificate-key pair
 	tlsCert, err := tls.LoadX509KeyPair(cert, key)
 	if err != nil {
@@ -56,16 +91,35 @@ func NewClient(c *command.C) (status.TLSDialer, int) {
 	network, _ := c.Conf.Technical.Service(c.Service.ID)
 	// List of services for a given network segment
 	services := c.Conf.Technical.Services(network)
-	// Read session status service address from services
-	addr := services.SessionStatus[0].Address
+	// Read addresses of all session status service instances from services
+	addrs := make([]string, 0, len(services.SessionStatus))
+	for _, s := range services.SessionStatus {
+		addrs = append(addrs, s.Address)
+	}
+	if len(addrs) == 0 {
+		return nil, c.Error(exit.Config, NoSessionStatusServicesError{Network: network},
+			"no session status services configured in network", network)
+	}
 
-	// Create session status RPC TLS client
+	// Create pooled session status RPC TLS client
 	return &Client{
-		TLSDialer: client.NewTLSClient(addr, &tls.Config{
+		TLSDialer: client.NewPooledTLSClient(addrs, &tls.Config{
 			RootCAs:      certPool,
 			Certificates: []tls.Certificate{tlsCert},
 			MinVersion:   tls.VersionTLS12,
 			ServerName:   observable.ServerName,
+		}, &client.PoolConf{
+			MaxConns:    observable.MaxConns,
+			KeepAlive:   observable.KeepAlive,
+			IdleTimeout: observable.IdleTimeout,
+			HealthCheck: observable.HealthCheck,
+			CallTimeout: observable.CallTimeout,
+			// Updates and deletes are not sent again if an
+			// instance may have already applied them.
+			Idempotent: []string{
+				Endpoint.SessionStatusRead,
+				Endpoint.SessionStatusHistory,
+			},
 		}),
 	}, 0
 }
@@ -38,6 +38,10 @@ type StatusUpdateReq struct {
 
 	// Lease is an optional field that indicates a TTL in seconds.
 	TTL string
+
+	// Voter is an optional unique identifier of the voter, if already
+	// authenticated. It is only recorded in the session history.
+	Voter string
 }
 
 // StatusUpdateResp is a data that RPC.SessionStatusUpdate responds back.
@@ -60,3 +64,39 @@ type StatusDeleteResp struct {
 	// Ok is true if updating was successful.
 	Ok bool
 }
+
+// StatusHistoryReq is a data to pass to RPC.SessionStatusHistory.
+//
+// Exactly one of Session and Voter must be set.
+type StatusHistoryReq struct {
+	server.Header
+
+	// Session is the ID of the session to look up.
+	Session string
+
+	// Voter is the unique identifier of the voter whose most recent
+	// sessions to look up.
+	Voter string
+}
+
+// StatusHistoryResp is a data that RPC.SessionStatusHistory responds back.
+type StatusHistoryResp struct {
+	server.Header
+
+	// Sessions are the histories of found sessions, most recent last.
+	Sessions []SessionHistory
+}
+
+// SessionHistory is the history of a single session together with its
+// current status.
+type SessionHistory struct {
+	History
+
+	// Active is true if the session status has not expired or been
+	// deleted.
+	Active bool
+
+	// Remaining is the time in seconds until the session status expires.
+	// It is zero for inactive sessions.
+	Remaining int64
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+
+	"ivxv.ee/common/collector/command"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/status"
+	client "ivxv.ee/common/collector/status/client"
+	statusRpc "ivxv.ee/common/collector/status/client/rpc"
+	"ivxv.ee/common/collector/storage"
+)
+
+// embeddedClient is a session status client which serves requests in-process
+// directly against the storage instead of sending them to a session status
+// service. It is used in deployments without a separate session status
+// service.
+type embeddedClient struct {
+	status  status.Status
+	history *HistoryRepository
+}
+
+// NewEmbeddedClient returns a session status client which handles requests
+// in-process using repository r, state machine m, and history h. The requests
+// and responses are the same as with the session status service, so the
+// client can be used in place of a TLS client.
+//
+// History lookups are not restricted to operators: anyone able to use the
+// embedded client already has access to the storage.
+func NewEmbeddedClient(r storage.SessionStatusRepository, m *Machine,
+	h *HistoryRepository) client.TLSDialer {
+
+	return &embeddedClient{status: NewStatusRepository(r, m, h), history: h}
+}
+
+// newEmbeddedClient creates an embedded session status client using the
+// storage client of c and the session status configuration conf. Services
+// which do not use the storage otherwise get a new storage client.
+func newEmbeddedClient(c *command.C, conf *status.Observable) (client.TLSDialer, int) {
+	if c.Storage == nil {
+		var err error
+		if c.Storage, err = storage.New(&c.Conf.Technical.Storage,
+			c.StorageServices()); err != nil {
+
+			return nil, c.Error(exit.Config, EmbeddedStorageConfigurationError{Err: err},
+				"failed to configure storage client for embedded session status:", err)
+		}
+	}
+	r := c.Storage.SessionStatusRepository()
+	return NewEmbeddedClient(r, NewMachine(conf, Transitions),
+		NewHistoryRepository(r, conf.HistoryTTL)), 0
+}
+
+func (e *embeddedClient) TLSDial(req interface{}) (interface{}, error) {
+	statusReq, ok := req.(*statusRpc.StatusReq)
+	if !ok {
+		return nil, EmbeddedCastToStatusReqError{Got: reflect.TypeOf(req)}
+	}
+
+	resp, err := e.handle(statusReq)
+	if err != nil {
+		return nil, EmbeddedCallError{
+			ServiceMethod: statusReq.ServiceMethod,
+			Err:           err,
+		}
+	}
+
+	// Encode the response the same way as the session status service, so
+	// that the response builders can process it unchanged.
+	encoded, err := json.Marshal(resp)
+	if err != nil {
+		return nil, EmbeddedMarshalResponseError{Err: err}
+	}
+	statusResp := new(statusRpc.StatusResp)
+	if err = json.Unmarshal(encoded, &statusResp.Response); err != nil {
+		return nil, EmbeddedUnmarshalResponseError{Err: err}
+	}
+	return statusResp, nil
+}
+
+// handle performs the session status request req against the repository in
+// the same way as the corresponding session status service endpoint.
+func (e *embeddedClient) handle(req *statusRpc.StatusReq) (interface{}, error) {
+	switch req.ServiceMethod {
+	case Endpoint.SessionStatusRead:
+		r, ok := req.Request.(StatusReadReq)
+		if !ok {
+			break
+		}
+		return e.status.Read(ctxOf(r.Header.Ctx), &r)
+
+	case Endpoint.SessionStatusUpdate:
+		r, ok := req.Request.(StatusUpdateReq)
+		if !ok {
+			break
+		}
+		if err := e.status.Update(ctxOf(r.Header.Ctx), &r); err != nil {
+			return nil, err
+		}
+		return &StatusUpdateResp{Ok: true}, nil
+
+	case Endpoint.SessionStatusDelete:
+		r, ok := req.Request.(StatusDeleteReq)
+		if !ok {
+			break
+		}
+		if err := e.status.Delete(ctxOf(r.Header.Ctx), &r); err != nil {
+			return nil, err
+		}
+		return &StatusDeleteResp{Ok: true}, nil
+
+	case Endpoint.SessionStatusHistory:
+		r, ok := req.Request.(StatusHistoryReq)
+		if !ok {
+			break
+		}
+		return e.history.Lookup(ctxOf(r.Header.Ctx), &r)
+
+	default:
+		return nil, EmbeddedUnknownServiceMethodError{ServiceMethod: req.ServiceMethod}
+	}
+	return nil, EmbeddedRequestTypeError{
+		ServiceMethod: req.ServiceMethod,
+		Got:           reflect.TypeOf(req.Request),
+	}
+}
+
+// ctxOf returns ctx or the background context if ctx is nil.
+func ctxOf(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.Background()
+	}
+	return ctx
+}
@@ -0,0 +1,123 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/status"
+	statusRpc "ivxv.ee/common/collector/status/client/rpc"
+)
+
+// memoryRepository is a storage.SessionStatusRepository which keeps values in
+// a map and ignores leases.
+type memoryRepository map[string][]byte
+
+func (m memoryRepository) GetWithLease(_ context.Context, key string) ([]byte, string, error) {
+	return m[key], "", nil
+}
+
+func (m memoryRepository) PutForceWithOpts(_ context.Context, key string, value []byte,
+	_ interface{}) error {
+
+	m[key] = value
+	return nil
+}
+
+func (m memoryRepository) Delete(_ context.Context, key string) error {
+	delete(m, key)
+	return nil
+}
+
+func TestEmbeddedClient(t *testing.T) {
+	repository := make(memoryRepository)
+	c := NewEmbeddedClient(repository, NewMachine(&status.Observable{ChoiceTTL: 60}, Transitions),
+		NewHistoryRepository(repository, 0))
+	h := server.Header{
+		Ctx:       log.TestContext(context.Background()),
+		SessionID: "0101e9342abab1577b8b2844d6a1d317",
+	}
+
+	read := func() StatusReadResp {
+		req := statusRpc.NewStatusReqBuilder().
+			WithServiceMethod(Endpoint.SessionStatusRead).
+			WithRequest(NewSessionStatusReadReqBuilder().WithHeader(h).Build()).
+			Build()
+		resp, err := c.TLSDial(&req)
+		if err != nil {
+			t.Fatal("failed to read session status:", err)
+		}
+		return NewSessionStatusReadRespBuilder().
+			WithResponse(resp.(*statusRpc.StatusResp).Response).
+			Build()
+	}
+
+	if status := read(); status.Caller != "" || status.Auth != "" {
+		t.Errorf("unexpected status of new session: %+v", status)
+	}
+
+	update := statusRpc.NewStatusReqBuilder().
+		WithServiceMethod(Endpoint.SessionStatusUpdate).
+		WithRequest(NewSessionStatusUpdateReqBuilder().
+			WithHeader(h).
+			WithCaller("RPC.VoterChoices").
+			WithAuth("id").
+			WithTTL("60").
+			Build()).
+		Build()
+	resp, err := c.TLSDial(&update)
+	if err != nil {
+		t.Fatal("failed to update session status:", err)
+	}
+	if updated := NewSessionStatusUpdateRespBuilder().
+		WithResponse(resp.(*statusRpc.StatusResp).Response).
+		Build(); !updated.Ok {
+		t.Error("session status update not ok")
+	}
+
+	if status := read(); status.Caller != "RPC.VoterChoices" || status.Auth != "id" {
+		t.Errorf("unexpected status of updated session: %+v", status)
+	}
+
+	del := statusRpc.NewStatusReqBuilder().
+		WithServiceMethod(Endpoint.SessionStatusDelete).
+		WithRequest(NewSessionStatusDeleteReqBuilder().WithHeader(h).Build()).
+		Build()
+	if _, err = c.TLSDial(&del); err != nil {
+		t.Fatal("failed to delete session status:", err)
+	}
+	if _, ok := repository[toSessionStorageKey(h.SessionID)]; ok {
+		t.Errorf("session status not deleted: %v", repository)
+	}
+
+	history := statusRpc.NewStatusReqBuilder().
+		WithServiceMethod(Endpoint.SessionStatusHistory).
+		WithRequest(NewSessionStatusHistoryReqBuilder().
+			WithHeader(h).
+			WithSession(h.SessionID).
+			Build()).
+		Build()
+	if resp, err = c.TLSDial(&history); err != nil {
+		t.Fatal("failed to look up session history:", err)
+	}
+	found, err := NewSessionStatusHistoryRespBuilder().
+		WithResponse(resp.(*statusRpc.StatusResp).Response).
+		Build()
+	if err != nil {
+		t.Fatal("failed to build session history response:", err)
+	}
+	if len(found.Sessions) != 1 || len(found.Sessions[0].Events) != 2 ||
+		found.Sessions[0].Active {
+
+		t.Errorf("unexpected session history: %+v", found)
+	}
+
+	unknown := statusRpc.NewStatusReqBuilder().
+		WithServiceMethod("RPC.Unknown").
+		WithRequest(h).
+		Build()
+	if _, err = c.TLSDial(&unknown); err == nil {
+		t.Error("unexpected success of unknown service method")
+	}
+}
@@ -2,11 +2,13 @@ package rpc
 
 // Endpoint is a collection of available session status server RPC endpoints.
 var Endpoint = struct {
-	SessionStatusRead   string
-	SessionStatusUpdate string
-	SessionStatusDelete string
+	SessionStatusRead    string
+	SessionStatusUpdate  string
+	SessionStatusDelete  string
+	SessionStatusHistory string
 }{
 	"RPC.SessionStatusRead",
 	"RPC.SessionStatusUpdate",
 	"RPC.SessionStatusDelete",
+	"RPC.SessionStatusHistory",
 }
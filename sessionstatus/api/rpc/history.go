@@ -0,0 +1,373 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+const (
+	historyPrefix = "/sessionhistory"
+	voterPrefix   = "/sessionvoter"
+
+	// defaultHistoryTTL is the default time in seconds for which session
+	// histories are retained.
+	defaultHistoryTTL = 86400
+
+	// maxHistoryEvents is the maximum number of events kept per session.
+	// Consecutive identical calls are recorded as a single event, so this
+	// is only reached by misbehaving clients.
+	maxHistoryEvents = 100
+
+	// maxVoterSessions is the maximum number of most recent sessions
+	// indexed per voter.
+	maxVoterSessions = 10
+)
+
+// Event is a session state transition attempt in the history of a session.
+// Consecutive identical attempts, e.g., status polling, are recorded once.
+type Event struct {
+	// Time is the time of the first attempt.
+	Time time.Time
+
+	// From is the state of the session before the attempt.
+	From string
+
+	// To is the service method which attempted the transition.
+	To string
+
+	// Auth is the authentication method of the session.
+	Auth string
+
+	// Count is the number of consecutive allowed attempts as counted by
+	// the session status. Repeated rejected attempts are not counted.
+	Count int
+
+	// Expires is the expiration time of the session status after the
+	// attempt.
+	Expires time.Time
+
+	// Rejected is the reason why the transition was not allowed or empty
+	// if it was.
+	Rejected string `json:",omitempty"`
+
+	// Deleted is true if the session status was deleted.
+	Deleted bool `json:",omitempty"`
+}
+
+// History is the transition history of a session. It contains no voting
+// data, only the service methods called.
+type History struct {
+	SessionID string
+
+	// Voter is the unique identifier of the voter or empty if the voter
+	// never authenticated in the session.
+	Voter string `json:",omitempty"`
+
+	Events []Event
+}
+
+// HistoryRepository records the transition histories of sessions and indexes
+// them by voter for lookup by support staff.
+//
+// Histories are only written when the state of a session changes: repeated
+// calls, e.g., status polling, are counted by the session status itself and
+// the count is copied into the history on the next transition or lookup. Each
+// history and voter index keeps the lease granted when it was first written,
+// so the retention period starts from the first event.
+//
+// Histories are updated with read-modify-write, so concurrent updates of the
+// same session may lose events. Sessions are used by a single client at a
+// time, so this only affects misbehaving clients.
+type HistoryRepository struct {
+	repository storage.SessionStatusRepository
+	ttl        string
+	now        func() time.Time
+}
+
+// NewHistoryRepository returns a new history repository using storage client
+// r, which retains histories for ttl seconds after the first event. If ttl is
+// not positive, then the default of one day is used.
+func NewHistoryRepository(r storage.SessionStatusRepository, ttl int64) *HistoryRepository {
+	if ttl <= 0 {
+		ttl = defaultHistoryTTL
+	}
+	return &HistoryRepository{
+		repository: r,
+		ttl:        strconv.FormatInt(ttl, 10),
+		now:        time.Now,
+	}
+}
+
+// transition records an allowed transition of the session in req from
+// current to next with the TTL of next in seconds. Repeated calls of the same
+// method which keep the existing lease, e.g., status polls, are not recorded,
+// unless they identify the voter for the first time.
+func (h *HistoryRepository) transition(ctx context.Context, req *StatusUpdateReq,
+	current, next State, ttl string) {
+
+	if h == nil || (next.Count > 1 && len(req.Lease) > 0 && len(req.Voter) == 0) {
+		return
+	}
+	e := Event{From: current.Caller, To: next.Caller, Auth: next.Auth}
+	// A new lease is granted only if no existing lease was given,
+	// otherwise the previous expiration time remains.
+	if req.Lease == "" {
+		if seconds, err := strconv.ParseInt(ttl, 10, 64); err == nil {
+			e.Expires = h.now().Add(time.Duration(seconds) * time.Second)
+		}
+	}
+	h.record(ctx, req.SessionID, req.Voter, current, e)
+}
+
+// rejected records a rejected transition of the session in req from current
+// because of err.
+func (h *HistoryRepository) rejected(ctx context.Context, req *StatusUpdateReq,
+	current State, err error) {
+
+	h.record(ctx, req.SessionID, req.Voter, current, Event{
+		From:     current.Caller,
+		To:       req.Caller,
+		Auth:     req.Auth,
+		Rejected: reflect.TypeOf(err).Name(),
+	})
+}
+
+// deleted records the deletion of the session status.
+func (h *HistoryRepository) deleted(ctx context.Context, sessionID string) {
+	h.record(ctx, sessionID, "", State{}, Event{Deleted: true})
+}
+
+// record adds event e in session state current to the history of session
+// sessionID and indexes the session by voter if not done yet. The history is
+// only informational, so errors are logged instead of failing the session
+// status update.
+func (h *HistoryRepository) record(ctx context.Context, sessionID, voter string,
+	current State, e Event) {
+
+	if h == nil {
+		return
+	}
+	if err := h.add(ctx, sessionID, voter, current, e); err != nil {
+		log.Error(ctx, RecordSessionHistoryError{SessionID: sessionID, Err: err})
+	}
+}
+
+func (h *HistoryRepository) add(ctx context.Context, sessionID, voter string,
+	current State, e Event) error {
+
+	hist, lease, err := h.get(ctx, sessionID)
+	if err != nil {
+		return err
+	}
+	if hist == nil {
+		hist = &History{SessionID: sessionID}
+	}
+
+	e.Time = h.now()
+	e.Count = 1
+	changed, repeated := true, false
+	if n := len(hist.Events); n > 0 {
+		last := &hist.Events[n-1]
+		repeated = last.To == e.To && last.Auth == e.Auth &&
+			last.Rejected == e.Rejected && last.Deleted == e.Deleted
+		switch {
+		case repeated && e.Expires.IsZero():
+			// Repeated attempt, which is already recorded.
+			changed = false
+		case repeated:
+			// Repeated call which was granted a new lease.
+			last.Expires = e.Expires
+		default:
+			if e.Expires.IsZero() && !e.Deleted {
+				e.Expires = last.Expires
+			}
+			// The session status counted the calls of the
+			// previous method since it was recorded.
+			if len(last.Rejected) == 0 && last.To == current.Caller {
+				last.Count = current.Count
+			}
+		}
+	}
+	if !repeated {
+		hist.Events = append(hist.Events, e)
+		if n := len(hist.Events); n > maxHistoryEvents {
+			hist.Events = hist.Events[n-maxHistoryEvents:]
+		}
+	}
+
+	indexVoter := len(voter) > 0 && len(hist.Voter) == 0
+	if indexVoter {
+		hist.Voter = voter
+	} else if !changed {
+		return nil
+	}
+
+	val, err := json.Marshal(hist)
+	if err != nil {
+		return MarshalSessionHistoryError{Err: err}
+	}
+	if err = h.put(ctx, toHistoryStorageKey(sessionID), val, lease); err != nil {
+		return err
+	}
+
+	if indexVoter {
+		return h.index(ctx, voter, sessionID)
+	}
+	return nil
+}
+
+// index adds sessionID to the most recent sessions of voter.
+func (h *HistoryRepository) index(ctx context.Context, voter, sessionID string) error {
+	sessions, lease, err := h.sessions(ctx, voter)
+	if err != nil {
+		return err
+	}
+	sessions = append(sessions, sessionID)
+	if n := len(sessions); n > maxVoterSessions {
+		sessions = sessions[n-maxVoterSessions:]
+	}
+
+	val, err := json.Marshal(sessions)
+	if err != nil {
+		return MarshalVoterSessionsError{Err: err}
+	}
+	return h.put(ctx, toVoterStorageKey(voter), val, lease)
+}
+
+// Lookup returns the histories of the session or the most recent sessions of
+// the voter in req together with their current status.
+func (h *HistoryRepository) Lookup(ctx context.Context, req *StatusHistoryReq) (
+	*StatusHistoryResp, error) {
+
+	var ids []string
+	switch {
+	case len(req.Session) > 0 && len(req.Voter) > 0:
+		return nil, AmbiguousHistoryLookupError{}
+	case len(req.Session) > 0:
+		ids = []string{req.Session}
+	case len(req.Voter) > 0:
+		var err error
+		if ids, _, err = h.sessions(ctx, req.Voter); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, MissingHistoryLookupKeyError{}
+	}
+
+	resp := &StatusHistoryResp{Header: req.Header}
+	for _, id := range ids {
+		hist, _, err := h.get(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if hist == nil {
+			continue // Retention period has passed.
+		}
+
+		s := SessionHistory{History: *hist}
+		key := toSessionStorageKey(id)
+		val, _, err := h.repository.GetWithLease(ctx, key)
+		if err != nil {
+			var getErr GetWithLeaseError
+			getErr.Key = key
+			getErr.Err = err
+			return nil, getErr
+		}
+		if s.Active = val != nil; s.Active && len(hist.Events) > 0 {
+			last := &s.Events[len(s.Events)-1]
+			if remaining := last.Expires.Sub(h.now()); remaining > 0 {
+				s.Remaining = int64(remaining / time.Second)
+			}
+			// Add the calls counted since the last transition.
+			if state, err := parseState(val); err == nil &&
+				len(last.Rejected) == 0 && last.To == state.Caller {
+
+				last.Count = state.Count
+			}
+		}
+		resp.Sessions = append(resp.Sessions, s)
+	}
+	return resp, nil
+}
+
+// get returns the history of session sessionID and its lease or nil if there
+// is none.
+func (h *HistoryRepository) get(ctx context.Context, sessionID string) (*History, string, error) {
+	key := toHistoryStorageKey(sessionID)
+	val, lease, err := h.repository.GetWithLease(ctx, key)
+	if err != nil {
+		var getErr GetWithLeaseError
+		getErr.Key = key
+		getErr.Err = err
+		return nil, "", getErr
+	}
+	if val == nil {
+		return nil, "", nil
+	}
+	hist := new(History)
+	if err = json.Unmarshal(val, hist); err != nil {
+		return nil, "", UnmarshalSessionHistoryError{Key: key, Err: err}
+	}
+	return hist, lease, nil
+}
+
+// sessions returns the most recent session IDs of voter, most recent last,
+// and the lease of the index.
+func (h *HistoryRepository) sessions(ctx context.Context, voter string) ([]string, string, error) {
+	key := toVoterStorageKey(voter)
+	val, lease, err := h.repository.GetWithLease(ctx, key)
+	if err != nil {
+		var getErr GetWithLeaseError
+		getErr.Key = key
+		getErr.Err = err
+		return nil, "", getErr
+	}
+	if val == nil {
+		return nil, "", nil
+	}
+	var sessions []string
+	if err = json.Unmarshal(val, &sessions); err != nil {
+		return nil, "", UnmarshalVoterSessionsError{Key: key, Err: err}
+	}
+	return sessions, lease, nil
+}
+
+// put stores val under key with the existing lease or, if there is none or it
+// has expired, with a new lease for the retention period.
+func (h *HistoryRepository) put(ctx context.Context, key string, val []byte, lease string) error {
+	if lease != "" && lease != "0" {
+		if err := h.repository.PutForceWithOpts(ctx, key, val,
+			&storage.PutOpOptionWithTTL{LeaseID: lease}); err == nil {
+
+			return nil
+		}
+	}
+	err := h.repository.PutForceWithOpts(ctx, key, val,
+		&storage.PutOpOptionWithTTL{TTL: h.ttl})
+	if err != nil {
+		var putErr PutForceWithOptsError
+		putErr.Key = key
+		putErr.Value = val
+		putErr.Err = err
+		return putErr
+	}
+	return nil
+}
+
+// toHistoryStorageKey returns NoSQL repository key for the history of a given
+// sessionID.
+func toHistoryStorageKey(sessionID string) string {
+	return historyPrefix + "/" + sessionID
+}
+
+// toVoterStorageKey returns NoSQL repository key for the sessions of a given
+// voter.
+func toVoterStorageKey(voter string) string {
+	return voterPrefix + "/" + voter
+}
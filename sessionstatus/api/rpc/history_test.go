@@ -0,0 +1,202 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/status"
+	client "ivxv.ee/common/collector/status/client"
+	"ivxv.ee/common/collector/storage"
+)
+
+func TestHistory(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	repository := make(memoryRepository)
+	history := NewHistoryRepository(repository, 0)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	history.now = func() time.Time { return now }
+	r := NewStatusRepository(repository, NewMachine(&status.Observable{
+		AuthTTL:   60,
+		ChoiceTTL: 600,
+		VoteTTL:   120,
+	}, Transitions), history)
+
+	const sessionID = "0101e9342abab1577b8b2844d6a1d317"
+	update := func(caller, voter string) error {
+		now = now.Add(time.Second)
+		return r.Update(ctx, &StatusUpdateReq{
+			Header: server.Header{SessionID: sessionID},
+			Caller: caller,
+			Auth:   client.MobileIDAuth,
+			Voter:  voter,
+		})
+	}
+
+	// Mobile-ID flow which expires while polling the signing status.
+	for _, step := range []struct {
+		caller string
+		voter  string
+	}{
+		{Authenticate, ""},
+		{AuthenticateStatus, ""},
+		{AuthenticateStatus, ""},
+		{VoterChoices, "38001085718"},
+		{GetCertificate, "38001085718"},
+		{Sign, "38001085718"},
+		{SignStatus, "38001085718"},
+		{SignStatus, "38001085718"},
+	} {
+		if err := update(step.caller, step.voter); err != nil {
+			t.Fatalf("failed to update session status to %s: %v", step.caller, err)
+		}
+	}
+	if err := update(Vote+"Unknown", "38001085718"); err == nil {
+		t.Fatal("unexpected success of unknown transition")
+	}
+
+	resp, err := history.Lookup(ctx, &StatusHistoryReq{Voter: "38001085718"})
+	if err != nil {
+		t.Fatal("failed to look up voter sessions:", err)
+	}
+	if len(resp.Sessions) != 1 {
+		t.Fatalf("unexpected number of sessions: %d, want 1", len(resp.Sessions))
+	}
+	s := resp.Sessions[0]
+	if s.SessionID != sessionID || s.Voter != "38001085718" {
+		t.Errorf("unexpected session: %s of %s", s.SessionID, s.Voter)
+	}
+	if !s.Active || s.Remaining != 119 {
+		t.Errorf("unexpected status: active %t, remaining %d, want true, 119",
+			s.Active, s.Remaining)
+	}
+
+	expected := []struct {
+		from, to string
+		count    int
+		rejected bool
+	}{
+		{Empty, Authenticate, 1, false},
+		{Authenticate, AuthenticateStatus, 2, false},
+		{AuthenticateStatus, VoterChoices, 1, false},
+		{VoterChoices, GetCertificate, 1, false},
+		{GetCertificate, Sign, 1, false},
+		{Sign, SignStatus, 2, false},
+		{SignStatus, Vote + "Unknown", 1, true},
+	}
+	if len(s.Events) != len(expected) {
+		t.Fatalf("unexpected number of events: %d, want %d: %+v",
+			len(s.Events), len(expected), s.Events)
+	}
+	for i, e := range expected {
+		got := s.Events[i]
+		if got.From != e.from || got.To != e.to || got.Count != e.count ||
+			(len(got.Rejected) > 0) != e.rejected {
+
+			t.Errorf("unexpected event %d: %+v", i, got)
+		}
+	}
+
+	// After expiry the session is no longer active.
+	delete(repository, toSessionStorageKey(sessionID))
+	now = now.Add(2 * time.Minute)
+	if resp, err = history.Lookup(ctx, &StatusHistoryReq{Session: sessionID}); err != nil {
+		t.Fatal("failed to look up session:", err)
+	}
+	if len(resp.Sessions) != 1 || resp.Sessions[0].Active || resp.Sessions[0].Remaining != 0 {
+		t.Errorf("unexpected expired session: %+v", resp.Sessions)
+	}
+
+	if _, err = history.Lookup(ctx, new(StatusHistoryReq)); err == nil {
+		t.Error("unexpected success of lookup without session or voter")
+	}
+}
+
+// leaseRepository is a memoryRepository which assigns leases to keys and
+// counts the writes of history keys and the leases granted for them.
+type leaseRepository struct {
+	memoryRepository
+	leases map[string]string
+	writes int
+	grants int
+}
+
+func (l *leaseRepository) GetWithLease(_ context.Context, key string) ([]byte, string, error) {
+	return l.memoryRepository[key], l.leases[key], nil
+}
+
+func (l *leaseRepository) PutForceWithOpts(ctx context.Context, key string, value []byte,
+	opts interface{}) error {
+
+	if strings.HasPrefix(key, historyPrefix+"/") || strings.HasPrefix(key, voterPrefix+"/") {
+		l.writes++
+		if opts.(*storage.PutOpOptionWithTTL).LeaseID == "" {
+			l.grants++
+			l.leases[key] = strconv.Itoa(l.grants)
+		}
+	}
+	return l.memoryRepository.PutForceWithOpts(ctx, key, value, opts)
+}
+
+func TestHistoryWrites(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	repository := &leaseRepository{memoryRepository: make(memoryRepository), leases: make(map[string]string)}
+	history := NewHistoryRepository(repository, 0)
+	r := NewStatusRepository(repository, NewMachine(&status.Observable{
+		AuthTTL:   60,
+		ChoiceTTL: 600,
+	}, Transitions), history)
+
+	const sessionID = "0101e9342abab1577b8b2844d6a1d317"
+	update := func(caller, lease, voter string) {
+		t.Helper()
+		if err := r.Update(ctx, &StatusUpdateReq{
+			Header: server.Header{SessionID: sessionID},
+			Caller: caller,
+			Auth:   client.MobileIDAuth,
+			Lease:  lease,
+			Voter:  voter,
+		}); err != nil {
+			t.Fatalf("failed to update session status to %s: %v", caller, err)
+		}
+	}
+
+	// Status polls which keep the lease are not written.
+	update(Authenticate, "", "")
+	const polls = 10
+	for i := 0; i < polls; i++ {
+		update(AuthenticateStatus, "1", "")
+	}
+	if repository.writes != 2 || repository.grants != 1 {
+		t.Fatalf("unexpected history writes and leases after polling: %d, %d, want 2, 1",
+			repository.writes, repository.grants)
+	}
+
+	// The active session reports the polls counted by the session status.
+	resp, err := history.Lookup(ctx, &StatusHistoryReq{Session: sessionID})
+	if err != nil {
+		t.Fatal("failed to look up session:", err)
+	}
+	if events := resp.Sessions[0].Events; len(events) != 2 || events[1].Count != polls {
+		t.Fatalf("unexpected events after polling: %+v", events)
+	}
+
+	// The next transition writes the history with its existing lease and
+	// indexes the voter with a new one.
+	update(VoterChoices, "", "38001085718")
+	if repository.writes != 4 || repository.grants != 2 {
+		t.Errorf("unexpected history writes and leases after transition: %d, %d, want 4, 2",
+			repository.writes, repository.grants)
+	}
+	hist, _, err := history.get(ctx, sessionID)
+	if err != nil {
+		t.Fatal("failed to get history:", err)
+	}
+	if len(hist.Events) != 3 || hist.Events[1].Count != polls || hist.Voter != "38001085718" {
+		t.Errorf("unexpected history after transition: %+v", hist)
+	}
+}
@@ -2,31 +2,36 @@ package rpc
 
 import (
 	"context"
-	"encoding/base64"
 
 	"ivxv.ee/common/collector/status"
 	"ivxv.ee/common/collector/storage"
-	api "ivxv.ee/sessionstatus/api/rpc"
 )
 
 const (
-	sessionIDPrefix             = "/session"
-	separator                   = "\x1f"
-	statusReadRespDBRecordCount = 2
+	sessionIDPrefix                   = "/session"
+	separator                         = "\x1f"
+	statusReadRespDBRecordCount       = 3
+	legacyStatusReadRespDBRecordCount = 2
 )
 
-type client struct {
+type statusRepository struct {
 	repository storage.SessionStatusRepository
+	machine    *Machine
+	history    *HistoryRepository
 }
 
 // NewStatusRepository initializes storage client r for a session
-// status server. TTL value can be used for assigning expiration time
-// for a key in a database.
-func NewStatusRepository(r storage.SessionStatusRepository) status.Status {
-	return &client{repository: r}
+// status server or an embedded session status client. Session status updates
+// are checked against state machine m, which also determines the TTL value
+// used for assigning expiration time for a key in a database. All transition
+// attempts are recorded in history h, which can be nil.
+func NewStatusRepository(r storage.SessionStatusRepository, m *Machine,
+	h *HistoryRepository) status.Status {
+
+	return &statusRepository{repository: r, machine: m, history: h}
 }
 
-func (c *client) Read(ctx context.Context, data interface{}) (interface{}, error) {
+func (c *statusRepository) Read(ctx context.Context, data interface{}) (interface{}, error) {
 	// Any data that is passed here, must cast to *SessionStatusReadReq
 	req, err := castAnyToSessionStatusReadReq(data)
 	if err != nil {
@@ -51,11 +56,11 @@ func (c *client) Read(ctx context.Context, data interface{}) (interface{}, error
 	// is a brand-new session ID or existing but tampered session ID.
 	// Decision should be made by a caller!
 	if val == nil {
-		return &api.StatusReadResp{Header: req.Header}, nil
+		return &StatusReadResp{Header: req.Header}, nil
 	}
 
 	// Verify val correctness
-	array, err := parseSessionStatus(val)
+	state, err := parseState(val)
 	if err != nil {
 		return nil, ParseSessionStatusError{
 			Value: val,
@@ -63,30 +68,56 @@ func (c *client) Read(ctx context.Context, data interface{}) (interface{}, error
 		}
 	}
 
-	return &api.StatusReadResp{
+	return &StatusReadResp{
 		Header: req.Header,
-		Caller: array[0],
-		Auth:   array[1],
+		Caller: state.Caller,
+		Auth:   state.Auth,
 		Lease:  lease,
 	}, nil
 }
 
-func (c *client) Update(ctx context.Context, data interface{}) error {
+func (c *statusRepository) Update(ctx context.Context, data interface{}) error {
 	// Any data that is passed here, must cast to *SessionStatusUpdateReq
 	req, err := castAnyToSessionStatusUpdateReq(data)
 	if err != nil {
 		return CastAnyToSessionStatusUpdateReqError{Err: err}
 	}
 
+	key := toSessionStorageKey(req.Header.SessionID)
+
+	// Read the current state of the session. Absent value means a new
+	// session.
+	var current State
+	val, _, err := c.repository.GetWithLease(ctx, key)
+	if err != nil {
+		var getErr GetWithLeaseError
+		getErr.Key = key
+		getErr.Err = err
+		return getErr
+	}
+	if val != nil {
+		if current, err = parseState(val); err != nil {
+			var parseErr ParseSessionStatusError
+			parseErr.Value = val
+			parseErr.Err = err
+			return parseErr
+		}
+	}
+
+	// Check that the transition is allowed and get the TTL of the new
+	// state from the state machine
+	next, ttlValue, err := c.machine.Transition(ctx, current, req)
+	if err != nil {
+		c.history.rejected(ctx, req, current, err)
+		return SessionStateTransitionError{Err: err}
+	}
+
 	// Value should be stored in a database as
-	// base64(Caller\x1FAuth)
-	concat := req.Caller + separator + req.Auth
-	val := []byte(base64.StdEncoding.EncodeToString([]byte(concat)))
+	// base64(Caller\x1FAuth\x1FCount)
+	val = encodeState(next)
 
 	// TTL value is int and measured in seconds!
-	ttl := &storage.PutOpOptionWithTTL{TTL: req.TTL, LeaseID: req.Lease}
-
-	key := toSessionStorageKey(req.Header.SessionID)
+	ttl := &storage.PutOpOptionWithTTL{TTL: ttlValue, LeaseID: req.Lease}
 
 	// PUT query to a database, where key will be deleted after ttl amount
 	// of seconds
@@ -99,10 +130,11 @@ func (c *client) Update(ctx context.Context, data interface{}) error {
 		}
 	}
 
+	c.history.transition(ctx, req, current, next, ttlValue)
 	return nil
 }
 
-func (c *client) Delete(ctx context.Context, data interface{}) error {
+func (c *statusRepository) Delete(ctx context.Context, data interface{}) error {
 	// Any data that is passed here, must cast to *SessionStatusDeleteReq
 	req, err := castAnyToSessionStatusDeleteReq(data)
 	if err != nil {
@@ -120,5 +152,6 @@ func (c *client) Delete(ctx context.Context, data interface{}) error {
 		}
 	}
 
+	c.history.deleted(ctx, req.Header.SessionID)
 	return nil
 }
@@ -0,0 +1,302 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/status"
+	client "ivxv.ee/common/collector/status/client"
+)
+
+// Service methods which move a session from one state to another. The state
+// of a session is identified by the service method which was last called in
+// the session, i.e., the Caller of StatusReadResp. Empty is the state of new
+// sessions.
+//
+// If any new RPC endpoint is about to appear in a IVXV online workflow, then
+// it should be added here and to Transitions, in case you wish that endpoint
+// to receive status checks.
+const (
+	Empty                = ""
+	Authenticate         = "RPC.Authenticate"
+	AuthenticateStatus   = "RPC.AuthenticateStatus"
+	Challenge            = "RPC.Challenge"
+	Token                = "RPC.Token"
+	WebAuthnChallenge    = "RPC.WebAuthnChallenge"
+	VoterChoices         = "RPC.VoterChoices"
+	GetCertificate       = "RPC.GetCertificate"
+	GetCertificateStatus = "RPC.GetCertificateStatus"
+	Sign                 = "RPC.Sign"
+	SignStatus           = "RPC.SignStatus"
+	Vote                 = "RPC.Vote"
+	Verify               = "RPC.Verify"
+)
+
+// Phase is the phase of the session which determines the TTL of a state.
+type Phase int
+
+// Enumeration of session phases. The TTL of each phase is configured in
+// status.Observable.
+const (
+	AuthPhase Phase = iota
+	ChoicePhase
+	VotePhase
+	VerifyPhase
+)
+
+// maxPolls is the maximum number of consecutive calls to status polling
+// methods. Clients poll at most once per second and the TTL of the phase
+// bounds polling anyway, so this only limits misbehaving clients.
+const maxPolls = 600
+
+// Transition is an allowed session state transition.
+type Transition struct {
+	// From are the states from which the transition is allowed.
+	From []string
+
+	// To is the service method which moves the session to the new state.
+	To string
+
+	// Auth are the authentication methods of sessions for which the
+	// transition is allowed. The authentication method of a new session is
+	// set by its first transition, after which it must stay the same.
+	Auth []string
+
+	// Phase determines the TTL of the new state.
+	Phase Phase
+
+	// Max is the maximum number of consecutive calls of To. Zero means no
+	// limit.
+	Max int
+}
+
+// Transitions are the session state transitions of all voting flows:
+//
+//   - ID card: VoterChoices, Vote;
+//   - Mobile-ID: Authenticate, AuthenticateStatus, VoterChoices,
+//     GetCertificate, Sign, SignStatus, Vote;
+//   - Smart-ID: Authenticate, AuthenticateStatus, VoterChoices,
+//     GetCertificate, GetCertificateStatus, Sign, SignStatus, Vote;
+//   - Web eID: Challenge, Token, VoterChoices, Vote;
+//   - WebAuthn: WebAuthnChallenge, VoterChoices, Vote;
+//
+// followed by any number of calls to Verify.
+var Transitions = []Transition{
+	{
+		From:  []string{Empty},
+		To:    Authenticate,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: AuthPhase,
+	},
+	{
+		From:  []string{Authenticate, AuthenticateStatus},
+		To:    AuthenticateStatus,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: AuthPhase,
+		Max:   maxPolls,
+	},
+	{
+		From:  []string{Empty},
+		To:    Challenge,
+		Auth:  []string{client.WebeIDAuth},
+		Phase: AuthPhase,
+	},
+	{
+		From:  []string{Challenge},
+		To:    Token,
+		Auth:  []string{client.WebeIDAuth},
+		Phase: AuthPhase,
+	},
+	{
+		From:  []string{Empty},
+		To:    WebAuthnChallenge,
+		Auth:  []string{client.WebAuthnAuth},
+		Phase: AuthPhase,
+	},
+	{
+		From:  []string{Empty},
+		To:    VoterChoices,
+		Auth:  []string{client.IDcardAuth},
+		Phase: ChoicePhase,
+	},
+	{
+		From:  []string{AuthenticateStatus},
+		To:    VoterChoices,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: ChoicePhase,
+	},
+	{
+		From:  []string{Token},
+		To:    VoterChoices,
+		Auth:  []string{client.WebeIDAuth},
+		Phase: ChoicePhase,
+	},
+	{
+		From:  []string{WebAuthnChallenge},
+		To:    VoterChoices,
+		Auth:  []string{client.WebAuthnAuth},
+		Phase: ChoicePhase,
+	},
+	{
+		From:  []string{VoterChoices},
+		To:    GetCertificate,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: VotePhase,
+	},
+	{
+		From:  []string{GetCertificate, GetCertificateStatus},
+		To:    GetCertificateStatus,
+		Auth:  []string{client.SmartIDAuth},
+		Phase: VotePhase,
+		Max:   maxPolls,
+	},
+	{
+		From:  []string{GetCertificate},
+		To:    Sign,
+		Auth:  []string{client.MobileIDAuth},
+		Phase: VotePhase,
+	},
+	{
+		From:  []string{GetCertificateStatus},
+		To:    Sign,
+		Auth:  []string{client.SmartIDAuth},
+		Phase: VotePhase,
+	},
+	{
+		From:  []string{Sign, SignStatus},
+		To:    SignStatus,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: VotePhase,
+		Max:   maxPolls,
+	},
+	{
+		From:  []string{VoterChoices},
+		To:    Vote,
+		Auth:  []string{client.IDcardAuth, client.WebeIDAuth, client.WebAuthnAuth},
+		Phase: VerifyPhase,
+	},
+	{
+		From:  []string{SignStatus},
+		To:    Vote,
+		Auth:  []string{client.MobileIDAuth, client.SmartIDAuth},
+		Phase: VerifyPhase,
+	},
+	{
+		From: []string{Vote, Verify},
+		To:   Verify,
+		Auth: []string{client.IDcardAuth, client.MobileIDAuth,
+			client.SmartIDAuth, client.WebeIDAuth, client.WebAuthnAuth},
+		Phase: VerifyPhase,
+	},
+}
+
+// State is the stored state of a session.
+type State struct {
+	// Caller is the service method which was last called.
+	Caller string
+
+	// Auth is the authentication method of the session.
+	Auth string
+
+	// Count is the number of consecutive calls of Caller.
+	Count int
+}
+
+// Machine enforces session state transitions.
+type Machine struct {
+	transitions map[string][]Transition // Map from To to transitions.
+	ttls        map[Phase]int64
+}
+
+// NewMachine returns a new session state machine which allows transitions
+// with the TTLs configured in conf.
+func NewMachine(conf *status.Observable, transitions []Transition) *Machine {
+	m := &Machine{
+		transitions: make(map[string][]Transition),
+		ttls: map[Phase]int64{
+			AuthPhase:   conf.AuthTTL,
+			ChoicePhase: conf.ChoiceTTL,
+			VotePhase:   conf.VoteTTL,
+			VerifyPhase: conf.VerifyTTL,
+		},
+	}
+	for _, t := range transitions {
+		m.transitions[t.To] = append(m.transitions[t.To], t)
+	}
+	return m
+}
+
+// Transition checks that the session with the current state can be moved to
+// the state requested in req and returns the new state with its TTL in
+// seconds. Every transition attempt is logged.
+func (m *Machine) Transition(ctx context.Context, current State, req *StatusUpdateReq) (
+	next State, ttl string, err error) {
+
+	next = State{Caller: req.Caller, Auth: req.Auth, Count: 1}
+	if current.Caller == next.Caller {
+		next.Count = current.Count + 1
+	}
+
+	t, err := m.find(current, next)
+	if err != nil {
+		log.Log(ctx, SessionStateTransitionRejected{
+			SessionID: req.SessionID,
+			From:      current.Caller,
+			To:        next.Caller,
+			FromAuth:  current.Auth,
+			ToAuth:    next.Auth,
+			Count:     next.Count,
+			Err:       err,
+		})
+		return State{}, "", err
+	}
+
+	ttl = strconv.FormatInt(m.ttls[t.Phase], 10)
+	log.Log(ctx, SessionStateTransition{
+		SessionID: req.SessionID,
+		From:      current.Caller,
+		To:        next.Caller,
+		Auth:      next.Auth,
+		Count:     next.Count,
+		TTL:       ttl,
+	})
+	return next, ttl, nil
+}
+
+// find returns the transition which allows moving from current to next.
+func (m *Machine) find(current, next State) (t Transition, err error) {
+	// The authentication method can only be set on new sessions.
+	if current.Caller != Empty && current.Auth != next.Auth {
+		return t, AuthMethodChangedError{From: current.Auth, To: next.Auth}
+	}
+
+	for _, t = range m.transitions[next.Caller] {
+		if !contains(t.From, current.Caller) || !contains(t.Auth, next.Auth) {
+			continue
+		}
+		if t.Max > 0 && next.Count > t.Max {
+			return t, TransitionCountExceededError{
+				Method: next.Caller,
+				Count:  next.Count,
+				Max:    t.Max,
+			}
+		}
+		return t, nil
+	}
+	return t, TransitionNotAllowedError{
+		From: current.Caller,
+		To:   next.Caller,
+		Auth: next.Auth,
+	}
+}
+
+// contains checks if values contains value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package rpc
+
+import (
+	"context"
+	"testing"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/status"
+	client "ivxv.ee/common/collector/status/client"
+)
+
+// step is a service method called with an authentication method.
+type step struct {
+	method string
+	auth   string
+}
+
+func TestMachine(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	m := NewMachine(&status.Observable{
+		AuthTTL:   10,
+		ChoiceTTL: 20,
+		VoteTTL:   30,
+		VerifyTTL: 40,
+	}, Transitions)
+
+	// run performs the steps and returns the state after the last step or
+	// the first error.
+	run := func(steps []step) (state State, ttl string, err error) {
+		for _, s := range steps {
+			req := &StatusUpdateReq{
+				Header: server.Header{SessionID: "0101e9342abab1577b8b2844d6a1d317"},
+				Caller: s.method,
+				Auth:   s.auth,
+			}
+			if state, ttl, err = m.Transition(ctx, state, req); err != nil {
+				return
+			}
+		}
+		return
+	}
+
+	mid := client.MobileIDAuth
+	sid := client.SmartIDAuth
+	for _, test := range []struct {
+		name  string
+		steps []step
+		ttl   string
+	}{
+		{"id", []step{{VoterChoices, client.IDcardAuth}, {Vote, client.IDcardAuth},
+			{Verify, client.IDcardAuth}, {Verify, client.IDcardAuth}}, "40"},
+		{"mid", []step{{Authenticate, mid}, {AuthenticateStatus, mid},
+			{AuthenticateStatus, mid}, {VoterChoices, mid}, {GetCertificate, mid},
+			{Sign, mid}, {SignStatus, mid}, {Vote, mid}}, "40"},
+		{"sid", []step{{Authenticate, sid}, {AuthenticateStatus, sid},
+			{VoterChoices, sid}, {GetCertificate, sid}, {GetCertificateStatus, sid},
+			{Sign, sid}, {SignStatus, sid}, {SignStatus, sid}}, "30"},
+		{"wid", []step{{Challenge, client.WebeIDAuth}, {Token, client.WebeIDAuth},
+			{VoterChoices, client.WebeIDAuth}}, "20"},
+		{"wa", []step{{WebAuthnChallenge, client.WebAuthnAuth},
+			{VoterChoices, client.WebAuthnAuth}, {Vote, client.WebAuthnAuth}}, "40"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			state, ttl, err := run(test.steps)
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+			last := test.steps[len(test.steps)-1]
+			if state.Caller != last.method || state.Auth != last.auth {
+				t.Errorf("unexpected state: %+v", state)
+			}
+			if ttl != test.ttl {
+				t.Errorf("unexpected TTL: %s, want %s", ttl, test.ttl)
+			}
+		})
+	}
+
+	polls := []step{{Authenticate, mid}}
+	for i := 0; i <= maxPolls; i++ {
+		polls = append(polls, step{AuthenticateStatus, mid})
+	}
+
+	for _, test := range []struct {
+		name     string
+		steps    []step
+		expected error
+	}{
+		{"vote before choices", []step{{Vote, client.IDcardAuth}},
+			new(TransitionNotAllowedError)},
+		{"mid without sign", []step{{Authenticate, mid}, {AuthenticateStatus, mid},
+			{VoterChoices, mid}, {Vote, mid}}, new(TransitionNotAllowedError)},
+		{"mid certificate status", []step{{Authenticate, mid}, {AuthenticateStatus, mid},
+			{VoterChoices, mid}, {GetCertificate, mid}, {GetCertificateStatus, mid}},
+			new(TransitionNotAllowedError)},
+		{"auth changed", []step{{Authenticate, mid}, {AuthenticateStatus, sid}},
+			new(AuthMethodChangedError)},
+		{"unknown method", []step{{"RPC.Unknown", client.IDcardAuth}},
+			new(TransitionNotAllowedError)},
+		{"too many polls", polls, new(TransitionCountExceededError)},
+		{"wa without challenge", []step{{VoterChoices, client.WebAuthnAuth}},
+			new(TransitionNotAllowedError)},
+		{"wa repeated challenge", []step{{WebAuthnChallenge, client.WebAuthnAuth},
+			{WebAuthnChallenge, client.WebAuthnAuth}}, new(TransitionNotAllowedError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := run(test.steps)
+			if errors.CausedBy(err, test.expected) == nil {
+				t.Errorf("unexpected error: %v, want %T", err, test.expected)
+			}
+		})
+	}
+}
@@ -1,13 +1,21 @@
 package rpc
 
 import (
+	"encoding/base64"
 	"reflect"
+	"strconv"
+	"strings"
 
 	"ivxv.ee/common/collector/server"
 	statusRpc "ivxv.ee/common/collector/status/client/rpc"
 )
 
-const expectedCastForServerHeader = "server.Header"
+const (
+	expectedCastForServerHeader    = "server.Header"
+	expectedCastForStatusReadReq   = "*rpc.StatusReadReq"
+	expectedCastForStatusUpdateReq = "*rpc.StatusUpdateReq"
+	expectedCastForStatusDeleteReq = "*rpc.StatusDeleteReq"
+)
 
 // CastVerifyRequestToServerHeader tries to cast req to server.Header.
 func CastVerifyRequestToServerHeader(req *statusRpc.VerifyReq) (*server.Header, error) {
@@ -22,3 +30,99 @@ func CastVerifyRequestToServerHeader(req *statusRpc.VerifyReq) (*server.Header,
 
 	return &header, nil
 }
+
+// parseSessionStatus parses val. This function expects val to be
+// base64("string" + "\x1F" + "string" + "\x1F" + "string"), otherwise returns
+// nil and error. Values without the last field, stored before transition
+// counts were recorded, are also accepted.
+func parseSessionStatus(val []byte) ([]string, error) {
+	// val is always in a form of:
+	// base64("RPC.Method" + "\x1F" + "Auth" + "\x1F" + "Count")
+	// Auth is "id" or "mid" or "sid" or "wid" or "wa"
+	sessionStatus, err := base64.StdEncoding.DecodeString(string(val))
+	if err != nil {
+		return nil, Base64DecodeSessionStatusError{Err: err}
+	}
+
+	sessionStatusStr := string(sessionStatus)
+
+	array := strings.Split(sessionStatusStr, separator)
+	if len(array) != statusReadRespDBRecordCount &&
+		len(array) != legacyStatusReadRespDBRecordCount {
+		return nil, InvalidReadStatusDatabaseRecordCountError{
+			Expected: statusReadRespDBRecordCount,
+			Got:      len(array),
+			Record:   sessionStatusStr,
+		}
+	}
+
+	return array, nil
+}
+
+// parseState parses the session state stored in val.
+func parseState(val []byte) (state State, err error) {
+	array, err := parseSessionStatus(val)
+	if err != nil {
+		return state, err
+	}
+	state = State{Caller: array[0], Auth: array[1], Count: 1}
+	if len(array) == statusReadRespDBRecordCount {
+		if state.Count, err = strconv.Atoi(array[2]); err != nil {
+			return state, ParseTransitionCountError{Count: array[2], Err: err}
+		}
+	}
+	return state, nil
+}
+
+// encodeState encodes the session state for storage.
+func encodeState(state State) []byte {
+	concat := state.Caller + separator + state.Auth + separator + strconv.Itoa(state.Count)
+	return []byte(base64.StdEncoding.EncodeToString([]byte(concat)))
+}
+
+// castAnyToSessionStatusReadReq tries to cast req to *StatusReadReq.
+func castAnyToSessionStatusReadReq(req interface{}) (*StatusReadReq, error) {
+	// Cast to *StatusReadReq
+	sessionStatusReadReq, ok := req.(*StatusReadReq)
+	if !ok {
+		return nil, CastToStatusReadReqError{
+			Expected: expectedCastForStatusReadReq,
+			Got:      reflect.TypeOf(req),
+		}
+	}
+
+	return sessionStatusReadReq, nil
+}
+
+// castAnyToSessionStatusUpdateReq tries to cast req to *StatusUpdateReq.
+func castAnyToSessionStatusUpdateReq(req interface{}) (*StatusUpdateReq, error) {
+	// Cast to *StatusUpdateReq
+	sessionStatusUpdateReq, ok := req.(*StatusUpdateReq)
+	if !ok {
+		return nil, CastToStatusUpdateReqError{
+			Expected: expectedCastForStatusUpdateReq,
+			Got:      reflect.TypeOf(req),
+		}
+	}
+
+	return sessionStatusUpdateReq, nil
+}
+
+// castAnyToSessionStatusDeleteReq tries to cast req to *StatusDeleteReq.
+func castAnyToSessionStatusDeleteReq(req interface{}) (*StatusDeleteReq, error) {
+	// Cast to *StatusDeleteReq
+	sessionStatusDeleteReq, ok := req.(*StatusDeleteReq)
+	if !ok {
+		return nil, CastToStatusDeleteReqError{
+			Expected: expectedCastForStatusDeleteReq,
+			Got:      reflect.TypeOf(req),
+		}
+	}
+
+	return sessionStatusDeleteReq, nil
+}
+
+// toSessionStorageKey returns NoSQL repository key for a given sessionID.
+func toSessionStorageKey(sessionID string) string {
+	return sessionIDPrefix + "/" + sessionID
+}
@@ -0,0 +1,167 @@
+/*
+The sessionlookup application is used by support staff to look up the
+transition histories of voting sessions from the session status service.
+*/
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/command"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/server"
+	status "ivxv.ee/common/collector/status/client/rpc"
+	api "ivxv.ee/sessionstatus/api/rpc"
+	//ivxv:modules common/collector/storage
+)
+
+const usage = `sessionlookup looks up the transition history of a voting session by session
+ID or of the most recent sessions of a voter by voter identifier.
+
+The history lists the service methods called in each session with timestamps,
+rejected transitions, and the remaining time until the session status expires.
+It contains no voting data.
+
+The lookup is authenticated with the operator's TLS client certificate, which
+must be issued by the collector's internal CA and whose identifier must be
+listed in status.session.admin.operators of the technical configuration.`
+
+var (
+	voterp = flag.Bool("voter", false, "look up the most recent sessions of a voter\n"+
+		"instead of a single session")
+	certp = flag.String("cert", "", "`path` to the operator's PEM-encoded TLS client certificate")
+	keyp  = flag.String("key", "", "`path` to the operator's PEM-encoded TLS client key")
+	jsonp = flag.Bool("json", false, "output the history as JSON")
+)
+
+func main() {
+	// Call sessionlookupmain in a separate function so that it can set up
+	// defers and have them trigger before returning with a non-zero exit
+	// code.
+	os.Exit(sessionlookupmain())
+}
+
+func sessionlookupmain() (code int) {
+	c := command.NewWithoutStorage("ivxv-sessionlookup", usage, "session ID or voter")
+	defer func() {
+		code = c.Cleanup(code)
+	}()
+
+	if c.Until < command.CheckInput {
+		return exit.OK
+	}
+	if len(*certp) == 0 || len(*keyp) == 0 {
+		return c.Error(exit.Usage, MissingOperatorCertificateError{},
+			"operator certificate and key are required")
+	}
+
+	client, code := api.NewOperatorClient(c, *certp, *keyp)
+	if code != exit.OK {
+		return code
+	}
+
+	if c.Until < command.Execute {
+		return exit.OK
+	}
+
+	builder := api.NewSessionStatusHistoryReqBuilder().WithHeader(server.Header{
+		Ctx:        c.Ctx,
+		AuthMethod: string(auth.TLS),
+	})
+	if *voterp {
+		builder.WithVoter(c.Args[0])
+	} else {
+		builder.WithSession(c.Args[0])
+	}
+	req := status.NewStatusReqBuilder().
+		WithServiceMethod(api.Endpoint.SessionStatusHistory).
+		WithRequest(builder.Build()).
+		Build()
+
+	raw, err := client.TLSDial(&req)
+	if err != nil {
+		return c.Error(exit.Unavailable, LookupError{Err: err},
+			"failed to look up session history:", err)
+	}
+	resp, err := api.NewSessionStatusHistoryRespBuilder().
+		WithResponse(status.NewStatusRespBuilder().WithResponse(raw).Build().Response).
+		Build()
+	if err != nil {
+		return c.Error(exit.Software, LookupResponseError{Err: err},
+			"failed to decode session history:", err)
+	}
+
+	if *jsonp {
+		err = json.NewEncoder(os.Stdout).Encode(resp.Sessions)
+	} else {
+		err = output(os.Stdout, resp.Sessions)
+	}
+	if err != nil {
+		return c.Error(exit.CantCreate, OutputError{Err: err},
+			"failed to output session history:", err)
+	}
+	return exit.OK
+}
+
+// output writes sessions to w in a human-readable format.
+func output(w io.Writer, sessions []api.SessionHistory) error {
+	if len(sessions) == 0 {
+		_, err := fmt.Fprintln(w, "No sessions found.")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for i, s := range sessions {
+		if i > 0 {
+			fmt.Fprintln(tw)
+		}
+		fmt.Fprintln(tw, "Session:\t"+s.SessionID)
+		if len(s.Voter) > 0 {
+			fmt.Fprintln(tw, "Voter:\t"+s.Voter)
+		}
+		if s.Active {
+			fmt.Fprintf(tw, "Status:\tactive, expires in %s\n",
+				time.Duration(s.Remaining)*time.Second)
+		} else {
+			fmt.Fprintln(tw, "Status:\texpired or deleted")
+		}
+
+		fmt.Fprintln(tw, "\nTime\tFrom\tTo\tAuth\tCount\tExpires\tResult")
+		for _, e := range s.Events {
+			result := "ok"
+			switch {
+			case e.Deleted:
+				result = "deleted"
+			case len(e.Rejected) > 0:
+				result = "rejected: " + e.Rejected
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				timestamp(e.Time), orDash(e.From), orDash(e.To),
+				orDash(e.Auth), e.Count, timestamp(e.Expires), result)
+		}
+	}
+	return tw.Flush()
+}
+
+// timestamp formats t in RFC 3339 or returns a dash if t is zero.
+func timestamp(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format(time.RFC3339)
+}
+
+// orDash returns s or a dash if s is empty.
+func orDash(s string) string {
+	if len(s) == 0 {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	api "ivxv.ee/sessionstatus/api/rpc"
+)
+
+func TestOutput(t *testing.T) {
+	var b strings.Builder
+	if err := output(&b, nil); err != nil {
+		t.Fatal("failed to output no sessions:", err)
+	}
+	if b.String() != "No sessions found.\n" {
+		t.Errorf("unexpected output of no sessions: %q", b.String())
+	}
+
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	sessions := []api.SessionHistory{
+		{
+			History: api.History{
+				SessionID: "0101e9342abab1577b8b2844d6a1d317",
+				Voter:     "38001085718",
+				Events: []api.Event{
+					{Time: start, To: api.Authenticate, Auth: "mid", Count: 1,
+						Expires: start.Add(time.Minute)},
+					{Time: start.Add(time.Second), From: api.Authenticate,
+						To: api.AuthenticateStatus, Auth: "mid", Count: 5,
+						Expires: start.Add(time.Minute)},
+					{Time: start.Add(time.Minute), From: api.AuthenticateStatus,
+						To: api.Vote, Auth: "mid", Count: 1,
+						Rejected: "TransitionNotAllowedError"},
+				},
+			},
+			Active:    true,
+			Remaining: 90,
+		},
+		{
+			History: api.History{
+				SessionID: "02a0e9342abab1577b8b2844d6a1d317",
+				Events:    []api.Event{{Time: start, Deleted: true}},
+			},
+		},
+	}
+	b.Reset()
+	if err := output(&b, sessions); err != nil {
+		t.Fatal("failed to output sessions:", err)
+	}
+	out := b.String()
+	for _, expected := range []string{
+		"Session:  0101e9342abab1577b8b2844d6a1d317\n",
+		"Voter:    38001085718\n",
+		"Status:   active, expires in 1m30s\n",
+		start.Local().Format(time.RFC3339),
+		api.AuthenticateStatus,
+		"rejected: TransitionNotAllowedError",
+		"Session:  02a0e9342abab1577b8b2844d6a1d317\n",
+		"Status:   expired or deleted\n",
+		"deleted",
+	} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("output does not contain %q:\n%s", expected, out)
+		}
+	}
+
+	// The count of each event is in its own column.
+	var polls int
+	for _, line := range strings.Split(out, "\n") {
+		if fields := strings.Fields(line); len(fields) == 7 && fields[2] == api.AuthenticateStatus {
+			polls++
+			if fields[4] != "5" {
+				t.Errorf("unexpected polling event line: %q", line)
+			}
+		}
+	}
+	if polls != 1 {
+		t.Errorf("unexpected number of polling event lines: %d:\n%s", polls, out)
+	}
+}
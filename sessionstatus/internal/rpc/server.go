@@ -1,7 +1,10 @@
 package rpc
 
 import (
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/errors"
 	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
 	"ivxv.ee/common/collector/status"
 	api "ivxv.ee/sessionstatus/api/rpc"
 )
@@ -9,13 +12,33 @@ import (
 // NewHandler returns an RPC handler that is ready to pass as rcvr
 // parameter into rpc.NewServer().Register(rcvr), which in turn means
 // that all rules applied to rcvr must also apply to a returned handler.
-func NewHandler(status status.Status) *RPC {
-	return &RPC{status: status}
+//
+// Session histories are looked up from history and only returned to
+// operators authenticated with admin whose identifiers are listed in
+// operators. If admin has no authentication or identity configured, then all
+// history requests are refused.
+func NewHandler(status status.Status, history *api.HistoryRepository,
+	admin server.AuthConf, operators []string) *RPC {
+
+	r := &RPC{
+		status:    status,
+		history:   history,
+		admin:     admin,
+		operators: make(map[string]bool),
+	}
+	for _, o := range operators {
+		r.operators[o] = true
+	}
+	return r
 }
 
-// RPC is a handler to process microservices' session status requests.
+// RPC is a handler to process microservices' session status requests and
+// operators' session history requests.
 type RPC struct {
-	status status.Status
+	status    status.Status
+	history   *api.HistoryRepository
+	admin     server.AuthConf
+	operators map[string]bool
 }
 
 // SessionStatusRead is an RPC endpoint to provide an information
@@ -25,8 +48,9 @@ type RPC struct {
 // then response resp will be an information includes previous RPC.Method being
 // called with this server.Header.SessionID and Auth, which is a detailed
 // authentication method being used ("id" for ID-card, "mid" for Mobile-ID,
-// "sid" for Smart-ID, "wid" for Web eID). Lease is used to keep track of
-// the TTL value of that particular server.Header.SessionID in a database.
+// "sid" for Smart-ID, "wid" for Web eID, "wa" for WebAuthn). Lease is used to
+// keep track of the TTL value of that particular server.Header.SessionID in a
+// database.
 func (r *RPC) SessionStatusRead(req api.StatusReadReq, resp *api.StatusReadResp) error {
 	log.Log(req.Ctx, SessionStatusReadReq{})
 
@@ -102,3 +126,61 @@ func (r *RPC) SessionStatusDelete(req api.StatusDeleteReq, resp *api.StatusDelet
 	log.Log(req.Ctx, SessionStatusDeleteResp{Success: resp.Ok})
 	return nil
 }
+
+// SessionStatusHistory is an RPC endpoint for support staff to look up the
+// transition history of a session by req.Session or of the most recent
+// sessions of a voter by req.Voter. The response contains the timestamps of
+// service methods called in the sessions and the remaining TTLs, but no
+// voting data.
+//
+// The client must be an authenticated operator listed in the configuration,
+// otherwise server.ErrUnauthenticated is returned.
+func (r *RPC) SessionStatusHistory(req api.StatusHistoryReq, resp *api.StatusHistoryResp) error {
+	log.Log(req.Ctx, SessionStatusHistoryReq{Session: req.Session, Voter: req.Voter})
+
+	operator, err := r.operator(&req.Header)
+	if err != nil {
+		log.Error(req.Ctx, SessionStatusHistoryUnauthorizedError{Err: err})
+		return server.ErrUnauthenticated
+	}
+	log.Log(req.Ctx, SessionStatusHistoryOperator{Operator: operator})
+
+	found, err := r.history.Lookup(req.Ctx, &req)
+	if err != nil {
+		log.Error(req.Ctx, SessionStatusHistoryError{Err: err})
+		if errors.CausedBy(err, new(api.MissingHistoryLookupKeyError)) != nil ||
+			errors.CausedBy(err, new(api.AmbiguousHistoryLookupError)) != nil {
+
+			return server.ErrBadRequest
+		}
+		return server.ErrInternal
+	}
+	resp.Sessions = found.Sessions
+
+	log.Log(req.Ctx, SessionStatusHistoryResp{Sessions: len(resp.Sessions)})
+	return nil
+}
+
+// operator authenticates the operator in header and returns their identifier
+// if they are allowed to look up session histories.
+//
+// Operators are authenticated here instead of by the server, because the other
+// endpoints are called by services which forward the voters' authentication
+// methods and tokens in their requests: these must not be verified against
+// the operator authentication configuration.
+func (r *RPC) operator(header *server.Header) (operator string, err error) {
+	if r.admin.Auth == nil || r.admin.Identity == nil {
+		return "", OperatorAuthUnconfiguredError{}
+	}
+	name, _, err := r.admin.Auth.Verify(header.Ctx, auth.Type(header.AuthMethod), header.AuthToken)
+	if err != nil {
+		return "", OperatorAuthenticationError{Method: header.AuthMethod, Err: err}
+	}
+	if operator, err = r.admin.Identity(name); err != nil {
+		return "", OperatorIdentityError{Err: err}
+	}
+	if !r.operators[operator] {
+		return "", OperatorNotAllowedError{Operator: operator}
+	}
+	return operator, nil
+}
@@ -0,0 +1,73 @@
+package rpc
+
+import (
+	"context"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"path/filepath"
+	"testing"
+
+	"ivxv.ee/common/collector/auth"
+	"ivxv.ee/common/collector/auth/dummy"
+	"ivxv.ee/common/collector/identity"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/bolt"
+	api "ivxv.ee/sessionstatus/api/rpc"
+)
+
+func dummyToken(t *testing.T, cn string) []byte {
+	t.Helper()
+	token, err := asn1.Marshal(pkix.Name{CommonName: cn}.ToRDNSequence())
+	if err != nil {
+		t.Fatal("failed to marshal dummy token:", err)
+	}
+	return token
+}
+
+func TestSessionStatusHistoryAuth(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	prot, err := bolt.New(&bolt.Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("failed to create bolt storage:", err)
+	}
+	history := api.NewHistoryRepository(prot.(storage.SessionStatusRepository), 0)
+	cn, err := identity.Get(identity.CommonName)
+	if err != nil {
+		t.Fatal("failed to get identifier:", err)
+	}
+	admin := server.AuthConf{
+		Auth:     auth.Auther{auth.Dummy: new(dummy.Conf)},
+		Identity: cn,
+	}
+
+	for _, test := range []struct {
+		name   string
+		admin  server.AuthConf
+		method auth.Type
+		token  []byte
+		err    error
+	}{
+		{"operator", admin, auth.Dummy, dummyToken(t, "support"), nil},
+		{"not operator", admin, auth.Dummy, dummyToken(t, "voter"), server.ErrUnauthenticated},
+		{"unconfigured method", admin, auth.TLS, nil, server.ErrUnauthenticated},
+		{"unauthenticated", admin, "", nil, server.ErrUnauthenticated},
+		{"disabled", server.AuthConf{}, auth.Dummy, dummyToken(t, "support"), server.ErrUnauthenticated},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := NewHandler(nil, history, test.admin, []string{"support"})
+			req := api.StatusHistoryReq{
+				Header: server.Header{
+					Ctx:        ctx,
+					AuthMethod: string(test.method),
+					AuthToken:  test.token,
+				},
+				Session: "0101e9342abab1577b8b2844d6a1d317",
+			}
+			if err := r.SessionStatusHistory(req, new(api.StatusHistoryResp)); err != test.err {
+				t.Errorf("unexpected error: %v, want %v", err, test.err)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"ivxv.ee/common/collector/server"
 	"ivxv.ee/common/collector/storage/etcd"
 	"ivxv.ee/common/collector/yaml"
+	api "ivxv.ee/sessionstatus/api/rpc"
 	internal "ivxv.ee/sessionstatus/internal/rpc"
 	//ivxv:modules common/collector/auth
 	//ivxv:modules common/collector/container
@@ -61,14 +62,39 @@ func sessionstatus() (code int) {
 			"failed to get CA cert from a storage config:", err)
 	}
 
+	// Session state TTLs are read from technical.yml `status:session`
+	observable := c.Conf.Technical.Status.Session
+	if observable == nil {
+		return c.Error(exit.Config, SessionObservableNotConfiguredError{},
+			"session status is not configured")
+	}
+
 	// Register Session status server as an RPC server
 	var rpc *internal.RPC
 
-	// Create desired repository for the server
+	// Create desired repository for the server, which enforces the
+	// session state machine and records session histories
 	r := c.Storage.SessionStatusRepository()
-	repository := internal.NewStatusRepository(r)
+	history := api.NewHistoryRepository(r, observable.HistoryTTL)
+	repository := api.NewStatusRepository(r,
+		api.NewMachine(observable, api.Transitions), history)
+
+	// Operators allowed to look up session histories and their
+	// authentication are read from technical.yml `status:session:admin`.
+	// Operators are authenticated by the handler and not the server,
+	// because requests forwarded from other services contain the voters'
+	// authentication tokens.
+	var adminAuth server.AuthConf
+	var operators []string
+	if admin := observable.Admin; admin != nil {
+		if adminAuth, err = server.NewAuthConf(admin.Auth, admin.Identity, nil, nil); err != nil {
+			return c.Error(exit.Config, AdminAuthConfError{Err: err},
+				"failed to configure operator authentication:", err)
+		}
+		operators = admin.Operators
+	}
 	// Create desired handler for the server
-	rpc = internal.NewHandler(repository)
+	rpc = internal.NewHandler(repository, history, adminAuth, operators)
 
 	var s *server.S
 
@@ -82,12 +108,14 @@ func sessionstatus() (code int) {
 			// and
 			// sessionStatusConf.ServerName == session.status.inttest.ivxv.ee
 			// then OK
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 			// will set `tls.RequireAndVerifyClientCert` to the server TLS,
 			// which means that any client should include RootCAs in their
 			// TLS configuration
@@ -26,6 +26,7 @@ import (
 	status "ivxv.ee/common/collector/status/client/rpc"
 	internal "ivxv.ee/smartid/internal/sessionstatus/rpc"
 	//ivxv:modules common/collector/container
+	//ivxv:modules common/collector/storage
 )
 
 const (
@@ -603,7 +604,7 @@ func smartidmain() (code int) {
 		// Parse configuration for authenticating with tickets issued
 		// by this server.
 		if authConf, err = server.NewAuthConf(auth.Conf{auth.Ticket: ticketConf},
-			c.Conf.Election.Identity, nil); err != nil {
+			c.Conf.Election.Identity, nil, nil); err != nil {
 
 			return c.Error(exit.Config, ServerAuthConfError{Err: err},
 				"failed to configure client authentication:", err)
@@ -619,12 +620,14 @@ func smartidmain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)
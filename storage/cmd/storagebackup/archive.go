@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+	"strings"
+	"time"
+)
+
+// The backup archive is a ZIP archive with the following hierarchy:
+//
+//	manifest.json
+//	manifest.sig
+//	data/
+//	├ 000001.jsonl
+//	├ 000002.jsonl
+//	└ ...
+//
+// Every data chunk contains up to chunkSize key-value records, one
+// JSON-encoded record per line. The manifest lists all chunks along with
+// their SHA-256 digests and the signature is a PKCS #1 v1.5 RSA signature of
+// the SHA-256 hash of the manifest.
+const (
+	formatVersion = 1
+	manifestName  = "manifest.json"
+	signatureName = "manifest.sig"
+	chunkFormat   = "data/%06d.jsonl"
+	chunkSize     = 1000
+)
+
+// manifest describes the contents of a backup archive.
+type manifest struct {
+	Version  int       // Archive format version.
+	Created  time.Time // Time when the backup was started.
+	Election string    // Identifier of the election.
+	Service  string    // Identifier of the service instance which made the backup.
+	Excluded []string  // Key prefixes which were not backed up.
+	Keys     uint64    // Total number of keys in the archive.
+	Digest   []byte    // Digest of all records, see digest.
+	Chunks   []chunk
+}
+
+// chunk describes a single data chunk in a backup archive.
+type chunk struct {
+	Name   string // Name of the file in the archive.
+	Keys   int    // Number of records in the chunk.
+	SHA256 []byte // Digest of the chunk file.
+}
+
+// record is a single key-value pair in a data chunk. TTL is the time to live
+// in seconds that the key had left when it was backed up, if it was attached
+// to a lease.
+type record struct {
+	Key   string
+	Value []byte
+	TTL   int64 `json:",omitempty"`
+}
+
+// digest is a SHA-256 hash of a sequence of records in archive order. It is
+// used to check that the archive contains all records listed in the manifest
+// in the same order as they were backed up.
+type digest struct {
+	hash.Hash
+}
+
+// newDigest returns a digest of an empty sequence of records.
+func newDigest() digest {
+	return digest{sha256.New()}
+}
+
+// add adds record r to the digest. Keys and values are length-prefixed so
+// that record boundaries are unambiguous.
+func (d digest) add(r record) {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(len(r.Key)))
+	d.Write(buf[:])
+	d.Write([]byte(r.Key))
+	binary.BigEndian.PutUint64(buf[:], uint64(len(r.Value)))
+	d.Write(buf[:])
+	d.Write(r.Value)
+	binary.BigEndian.PutUint64(buf[:], uint64(r.TTL))
+	d.Write(buf[:])
+}
+
+// excluded reports if key has any of the prefixes.
+func excluded(key string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
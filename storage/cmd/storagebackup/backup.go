@@ -0,0 +1,155 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+// backup reads all keys except excluded ones from prot and writes them into a
+// backup archive at fp. The rest of the manifest must already be filled in.
+// If prot implements storage.TTLGetter, then the remaining time to live of
+// keys attached to leases is backed up along with them.
+//
+// After writing, all keys are read again and if the contents of the storage
+// service have changed, then the backup fails: the archive is only consistent
+// if both reads returned the same contents. Storage protocols do not
+// necessarily return keys in the same order, so the hashes of all values
+// from the first read are kept in memory for comparison.
+func backup(ctx context.Context, prot storage.PutGetter, m *manifest,
+	key *rsa.PrivateKey, fp io.Writer) (err error) {
+
+	w := zip.NewWriter(fp)
+	defer func() {
+		if cerr := w.Close(); cerr != nil && err == nil {
+			err = CloseZIPArchiveError{Err: cerr}
+		}
+	}()
+
+	log.Log(ctx, BackingUpKeys{Excluded: m.Excluded})
+	progress.Static("Backing up keys:")
+	addprogress := progress.Count(0, true)
+	progress.Redraw()
+
+	var buf bytes.Buffer
+	var count int
+	enc := json.NewEncoder(&buf)
+	flush := func() error {
+		name := fmt.Sprintf(chunkFormat, len(m.Chunks)+1)
+		if err := archivesig.AddFile(w, m.Created, name, buf.Bytes()); err != nil {
+			return AddChunkError{Name: name, Err: err}
+		}
+		sum := sha256.Sum256(buf.Bytes())
+		m.Chunks = append(m.Chunks, chunk{Name: name, Keys: count, SHA256: sum[:]})
+		buf.Reset()
+		count = 0
+		return nil
+	}
+
+	var ttls map[string]int64
+	if g, ok := prot.(storage.TTLGetter); ok {
+		if ttls, err = g.GetTTLs(ctx, ""); err != nil {
+			return GetTTLsError{Err: err}
+		}
+	}
+
+	d := newDigest()
+	values := make(map[string][sha256.Size]byte)
+	if err = read(ctx, prot, m.Excluded, func(key string, value []byte) error {
+		if _, ok := values[key]; ok {
+			return DuplicateKeyError{Key: key}
+		}
+		values[key] = sha256.Sum256(value)
+
+		r := record{Key: key, Value: value, TTL: ttls[key]}
+		if err := enc.Encode(r); err != nil {
+			return EncodeRecordError{Key: key, Err: err}
+		}
+		d.add(r)
+		m.Keys++
+		addprogress(1)
+		if count++; count == chunkSize {
+			return flush()
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if count > 0 {
+		if err = flush(); err != nil {
+			return err
+		}
+	}
+	progress.Keep()
+	log.Log(ctx, BackedUpKeys{Count: m.Keys, Chunks: len(m.Chunks)})
+
+	// Read the keys again to check that nothing changed in between.
+	progress.Static("Checking consistency:")
+	checkprogress := progress.Count(0, true)
+	progress.Redraw()
+	defer progress.Keep()
+
+	var checked uint64
+	if err = read(ctx, prot, m.Excluded, func(key string, value []byte) error {
+		if sum, ok := values[key]; !ok || sum != sha256.Sum256(value) {
+			return StorageChangedKeyError{Key: key}
+		}
+		checked++
+		checkprogress(1)
+		return nil
+	}); err != nil {
+		return ConsistencyCheckError{Err: err}
+	}
+	if checked != m.Keys {
+		return StorageChangedError{Keys: m.Keys, Checked: checked}
+	}
+	m.Digest = d.Sum(nil)
+
+	encoded, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return EncodeManifestError{Err: err}
+	}
+	signature, err := archivesig.Sign(key, encoded)
+	if err != nil {
+		return SignManifestError{Err: err}
+	}
+	if err = archivesig.AddFile(w, m.Created, manifestName, encoded); err != nil {
+		return AddManifestError{Err: err}
+	}
+	if err = archivesig.AddFile(w, m.Created, signatureName, signature); err != nil {
+		return AddSignatureError{Err: err}
+	}
+	return nil
+}
+
+// read calls f with all key-value pairs in prot except those with excluded
+// prefixes.
+func read(ctx context.Context, prot storage.PutGetter, exclude []string,
+	f func(key string, value []byte) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stop GetWithPrefix if we terminate early.
+
+	c, errc := prot.GetWithPrefix(ctx, "")
+	for r := range c {
+		if excluded(r.Key, exclude) {
+			continue
+		}
+		if err := f(r.Key, r.Value); err != nil {
+			return err
+		}
+	}
+	if err := <-errc; err != nil {
+		return GetWithPrefixError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/bolt"
+)
+
+// newBolt returns an empty bolt storage protocol client.
+func newBolt(t *testing.T) storage.PutGetter {
+	t.Helper()
+	prot, err := bolt.New(&bolt.Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("failed to create storage:", err)
+	}
+	return prot
+}
+
+// newKey generates an RSA key for signing manifests.
+func newKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	return key
+}
+
+// writeBackup fills prot with keys which span multiple chunks, a key attached
+// to a lease, and an excluded key, and backs it up to path.
+func writeBackup(ctx context.Context, t *testing.T, prot storage.PutGetter,
+	key *rsa.PrivateKey, path string) *manifest {
+
+	t.Helper()
+	var reqs []storage.PutAllRequest
+	for i := 0; i < chunkSize+chunkSize/2; i++ {
+		reqs = append(reqs, storage.PutAllRequest{
+			Key:   fmt.Sprintf("/votes/%06d", i),
+			Value: []byte(fmt.Sprint("vote ", i)),
+		})
+	}
+	reqs = append(reqs, storage.PutAllRequest{Key: "/session/excluded", Value: []byte("session")})
+	b := prot.(storage.Batcher)
+	for len(reqs) > 0 {
+		n := min(len(reqs), b.BatchSize())
+		if err := b.PutAll(ctx, reqs[:n]...); err != nil {
+			t.Fatal("failed to put keys:", err)
+		}
+		reqs = reqs[n:]
+	}
+	if err := prot.(storage.PutGetterWithOpts).PutForceWithOpts(ctx, "/probe/lease",
+		[]byte("leased"), &storage.PutOpOptionWithTTL{TTL: "600"}); err != nil {
+
+		t.Fatal("failed to put leased key:", err)
+	}
+
+	m := &manifest{
+		Version:  formatVersion,
+		Created:  time.Now().UTC(),
+		Election: "TESTELECTION",
+		Service:  "storagebackup@test",
+		Excluded: []string{"/session/"},
+	}
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatal("failed to create archive:", err)
+	}
+	defer fp.Close()
+	if err = backup(ctx, prot, m, key, fp); err != nil {
+		t.Fatal("failed to back up storage:", err)
+	}
+	return m
+}
+
+// contents returns all key-value pairs in prot.
+func contents(ctx context.Context, t *testing.T, prot storage.PutGetter) map[string]string {
+	t.Helper()
+	kv := make(map[string]string)
+	c, errc := prot.GetWithPrefix(ctx, "")
+	for r := range c {
+		kv[r.Key] = string(r.Value)
+	}
+	if err := <-errc; err != nil {
+		t.Fatal("failed to read storage:", err)
+	}
+	return kv
+}
+
+func TestRoundTrip(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	key := newKey(t)
+	src := newBolt(t)
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	m := writeBackup(ctx, t, src, key, path)
+	if m.Keys != chunkSize+chunkSize/2+1 || len(m.Chunks) != 2 {
+		t.Fatalf("unexpected manifest: %d keys in %d chunks", m.Keys, len(m.Chunks))
+	}
+
+	a, err := open(ctx, path, &key.PublicKey)
+	if err != nil {
+		t.Fatal("failed to open archive:", err)
+	}
+	defer a.Close()
+
+	dst := newBolt(t)
+	if err = restore(ctx, dst, a); err != nil {
+		t.Fatal("failed to restore archive:", err)
+	}
+
+	want := contents(ctx, t, src)
+	delete(want, "/session/excluded")
+	have := contents(ctx, t, dst)
+	if len(have) != len(want) {
+		t.Errorf("restored %d keys, want %d", len(have), len(want))
+	}
+	for k, v := range want {
+		if have[k] != v {
+			t.Errorf("unexpected value of %s: %q, want %q", k, have[k], v)
+		}
+	}
+
+	// The leased key keeps its lease and the other keys do not get one.
+	ttls, err := dst.(storage.TTLGetter).GetTTLs(ctx, "")
+	if err != nil {
+		t.Fatal("failed to get TTLs:", err)
+	}
+	if ttl, ok := ttls["/probe/lease"]; len(ttls) != 1 || !ok || ttl <= 0 || ttl > 600 {
+		t.Errorf("unexpected TTLs after restore: %v", ttls)
+	}
+
+	// Restoring again does not overwrite existing keys.
+	if err = restore(ctx, dst, a); errors.CausedBy(err, new(ExistingKeyError)) == nil {
+		t.Errorf("unexpected error restoring into non-empty storage: %v", err)
+	}
+}
+
+// rewrite copies the archive at path to a new archive, replacing the contents
+// of files with the result of f, and returns the path of the new archive.
+func rewrite(t *testing.T, path string, f func(name string, data []byte) []byte) string {
+	t.Helper()
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal("failed to open archive:", err)
+	}
+	defer r.Close()
+
+	out := filepath.Join(t.TempDir(), "rewritten.zip")
+	fp, err := os.Create(out)
+	if err != nil {
+		t.Fatal("failed to create archive:", err)
+	}
+	defer fp.Close()
+	w := zip.NewWriter(fp)
+	for _, file := range r.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal("failed to open file:", err)
+		}
+		data, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal("failed to read file:", err)
+		}
+		if err = archivesig.AddFile(w, file.Modified, file.Name, f(file.Name, data)); err != nil {
+			t.Fatal("failed to add file:", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal("failed to close archive:", err)
+	}
+	return out
+}
+
+func TestOpenModified(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	key := newKey(t)
+	path := filepath.Join(t.TempDir(), "backup.zip")
+	m := writeBackup(ctx, t, newBolt(t), key, path)
+
+	// resign returns f which replaces the manifest with the result of
+	// modify and signs it with key.
+	resign := func(modify func(*manifest)) func(string, []byte) []byte {
+		mod := *m
+		mod.Chunks = append([]chunk(nil), m.Chunks...)
+		modify(&mod)
+		encoded, err := json.MarshalIndent(&mod, "", "\t")
+		if err != nil {
+			t.Fatal("failed to encode manifest:", err)
+		}
+		signature, err := archivesig.Sign(key, encoded)
+		if err != nil {
+			t.Fatal("failed to sign manifest:", err)
+		}
+		return func(name string, data []byte) []byte {
+			switch name {
+			case manifestName:
+				return encoded
+			case signatureName:
+				return signature
+			}
+			return data
+		}
+	}
+
+	for _, test := range []struct {
+		name string
+		path string
+		pub  *rsa.PublicKey
+		err  error
+	}{
+		{"other key", path, &newKey(t).PublicKey, new(VerifySignatureError)},
+		{"modified chunk", rewrite(t, path, func(name string, data []byte) []byte {
+			if name == m.Chunks[0].Name {
+				data[len(data)-2] = '!'
+			}
+			return data
+		}), &key.PublicKey, new(ChunkDigestMismatchError)},
+		{"reordered chunks", rewrite(t, path, resign(func(mod *manifest) {
+			mod.Chunks[0], mod.Chunks[1] = mod.Chunks[1], mod.Chunks[0]
+		})), &key.PublicKey, new(ArchiveDigestMismatchError)},
+		{"modified digest", rewrite(t, path, resign(func(mod *manifest) {
+			mod.Digest = make([]byte, len(m.Digest))
+		})), &key.PublicKey, new(ArchiveDigestMismatchError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a, err := open(ctx, test.path, test.pub)
+			if err == nil {
+				a.Close()
+			}
+			if errors.CausedBy(err, test.err) == nil {
+				t.Errorf("unexpected error: %v, want %T", err, test.err)
+			}
+		})
+	}
+}
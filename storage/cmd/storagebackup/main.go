@@ -0,0 +1,180 @@
+/*
+The storagebackup application creates signed snapshots of the storage service
+and restores them.
+*/
+package main
+
+import (
+	"crypto/rsa"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/command"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/command/status"
+	"ivxv.ee/common/collector/conf"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	//ivxv:modules common/collector/storage
+)
+
+const usage = `storagebackup creates a signed snapshot of all keys in the storage service or
+restores such a snapshot into a storage service.
+
+The snapshot is written into a versioned ZIP archive which contains the
+key-value pairs in data chunks and a manifest with the digests of the chunks.
+The manifest is signed with the RSA key given with -key. Keys which are
+attached to leases are backed up with the time they have left to live, if the
+storage protocol supports it, and restored with a new lease of that duration.
+
+All keys are read twice: if the contents of the storage service change between
+the reads, then the backup fails, because the snapshot would not be
+consistent. Stop the services writing to the storage service or retry at a
+quieter time if this happens.
+
+With -restore the archive is verified using the certificate given with -cert
+and all keys are put into the configured storage service. Restore refuses to
+overwrite any existing keys: if any of the keys in the archive already exist,
+then nothing is restored. Use "-check input" to only verify the archive.`
+
+var (
+	restorep = flag.Bool("restore", false, "restore the archive instead of creating it")
+
+	keyp = flag.String("key", "", "`path` to the PEM-encoded RSA private key used to sign\n"+
+		"the manifest (default backup.key in the sensitive directory\nof the service instance)")
+
+	certp = flag.String("cert", "", "`path` to the PEM-encoded certificate used to verify the\n"+
+		"manifest signature on restore")
+
+	excludep = flag.String("exclude", "/session/",
+		// End with newline for printing default value.
+		"comma-separated `list` of key prefixes to exclude from the backup\n")
+
+	qp = flag.Bool("q", false, "quiet, do not show progress")
+
+	progress *status.Line
+)
+
+func main() {
+	// Call storagebackupmain in a separate function so that it can set up
+	// defers and have them trigger before returning with a non-zero exit
+	// code.
+	os.Exit(storagebackupmain())
+}
+
+func storagebackupmain() (code int) {
+	c := command.NewWithoutStorage("ivxv-storagebackup", usage, "archive")
+	defer func() {
+		code = c.Cleanup(code)
+	}()
+
+	// Only a single configuration file is being checked.
+	if c.Conf.Technical == nil || c.Conf.Election == nil {
+		return exit.OK
+	}
+
+	var key *rsa.PrivateKey
+	var pub *rsa.PublicKey
+	var err error
+	if *restorep {
+		if *certp == "" {
+			return c.Error(exit.Usage, MissingCertificateError{},
+				"-cert is required with -restore")
+		}
+		if pub, err = archivesig.ReadCertificate(*certp); err != nil {
+			return c.Error(exit.NoInput, CertificateError{Err: err},
+				"failed to read certificate:", err)
+		}
+	} else {
+		path := *keyp
+		if path == "" {
+			path = filepath.Join(conf.Sensitive(c.Service.ID), "backup.key")
+		}
+		if key, err = archivesig.ReadKey(path); err != nil {
+			return c.Error(exit.NoInput, KeyError{Err: err},
+				"failed to read signing key:", err)
+		}
+	}
+
+	if !*qp {
+		progress = status.New()
+	}
+
+	prot, err := storage.NewProtocol(c.Conf.Technical.Storage.Protocol,
+		c.Conf.Technical.Storage.Conf, c.StorageServices())
+	if err != nil {
+		return c.Error(exit.Config, StorageConfigurationError{Err: err},
+			"failed to configure storage client:", err)
+	}
+
+	if c.Until < command.CheckInput {
+		return exit.OK
+	}
+	path := c.Args[0]
+
+	if *restorep {
+		a, err := open(c.Ctx, path, pub)
+		if err != nil {
+			return c.Error(exit.DataErr, VerifyArchiveError{Err: err},
+				"failed to verify archive:", err)
+		}
+		defer a.Close()
+
+		if a.manifest.Election != c.Conf.Election.Identifier {
+			return c.Error(exit.DataErr, ElectionMismatchError{
+				Archive:  a.manifest.Election,
+				Election: c.Conf.Election.Identifier,
+			}, "archive is for election", a.manifest.Election,
+				"but configured election is", c.Conf.Election.Identifier)
+		}
+		if c.Until < command.Execute {
+			return exit.OK
+		}
+
+		if err = restore(c.Ctx, prot, a); err != nil {
+			return c.Error(exit.Unavailable, RestoreError{Err: err},
+				"failed to restore archive:", err)
+		}
+		fmt.Println("Restored", a.manifest.Keys, "keys")
+		return
+	}
+
+	if c.Until < command.Execute {
+		return exit.OK
+	}
+
+	m := &manifest{
+		Version:  formatVersion,
+		Created:  time.Now().UTC(),
+		Election: c.Conf.Election.Identifier,
+		Service:  c.Service.ID,
+	}
+	if len(*excludep) > 0 {
+		m.Excluded = strings.Split(*excludep, ",")
+	}
+
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return c.Error(exit.CantCreate, CreateArchiveError{Path: path, Err: err},
+			"failed to create archive:", err)
+	}
+	err = backup(c.Ctx, prot, m, key, fp)
+	if cerr := fp.Close(); cerr != nil && err == nil {
+		err = CloseArchiveError{Err: cerr}
+	}
+	if err != nil {
+		// Do not leave an incomplete archive behind.
+		if rerr := os.Remove(path); rerr != nil {
+			log.Error(c.Ctx, RemoveIncompleteArchiveError{Path: path, Err: rerr})
+		}
+		return c.Error(exit.Unavailable, BackupError{Err: err},
+			"failed to back up storage:", err)
+	}
+	fmt.Println("Backed up", m.Keys, "keys")
+	return
+}
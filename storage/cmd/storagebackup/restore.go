@@ -0,0 +1,279 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+)
+
+// archive is an opened backup archive.
+type archive struct {
+	reader   *zip.ReadCloser
+	files    map[string]*zip.File
+	manifest manifest
+}
+
+// open opens the backup archive at path and verifies the manifest signature
+// with pub and the contents of the archive against the manifest.
+func open(ctx context.Context, path string, pub *rsa.PublicKey) (a *archive, err error) {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return nil, OpenArchiveError{Path: path, Err: err}
+	}
+	defer func() {
+		if err != nil {
+			reader.Close()
+		}
+	}()
+	a = &archive{reader: reader, files: make(map[string]*zip.File)}
+	for _, f := range a.reader.File {
+		a.files[f.Name] = f
+	}
+
+	encoded, err := a.read(manifestName)
+	if err != nil {
+		return nil, ReadManifestError{Err: err}
+	}
+	signature, err := a.read(signatureName)
+	if err != nil {
+		return nil, ReadSignatureError{Err: err}
+	}
+	if err = archivesig.Verify(pub, encoded, signature); err != nil {
+		return nil, VerifySignatureError{Err: err}
+	}
+	if err = json.Unmarshal(encoded, &a.manifest); err != nil {
+		return nil, DecodeManifestError{Err: err}
+	}
+	if a.manifest.Version != formatVersion {
+		return nil, UnsupportedVersionError{Version: a.manifest.Version}
+	}
+	log.Log(ctx, VerifiedManifest{
+		Created:  a.manifest.Created,
+		Election: a.manifest.Election,
+		Service:  a.manifest.Service,
+		Keys:     a.manifest.Keys,
+	})
+
+	// The archive must contain exactly the files listed in the manifest.
+	if len(a.files) != len(a.manifest.Chunks)+2 {
+		return nil, UnexpectedFileCountError{
+			Count:    len(a.files),
+			Expected: len(a.manifest.Chunks) + 2,
+		}
+	}
+	d := newDigest()
+	seen := make(map[string]struct{})
+	var keys uint64
+	for _, c := range a.manifest.Chunks {
+		if err = a.chunk(c, func(r record) error {
+			if _, ok := seen[r.Key]; ok {
+				return ArchiveDuplicateKeyError{Key: r.Key}
+			}
+			seen[r.Key] = struct{}{}
+			d.add(r)
+			keys++
+			return nil
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if keys != a.manifest.Keys || !bytes.Equal(d.Sum(nil), a.manifest.Digest) {
+		return nil, ArchiveDigestMismatchError{Keys: keys, Expected: a.manifest.Keys}
+	}
+	return a, nil
+}
+
+// Close closes the archive.
+func (a *archive) Close() error {
+	return a.reader.Close()
+}
+
+// read reads the file name from the archive.
+func (a *archive) read(name string) ([]byte, error) {
+	f, ok := a.files[name]
+	if !ok {
+		return nil, MissingFileError{Name: name}
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, OpenFileError{Name: name, Err: err}
+	}
+	defer rc.Close()
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, ReadFileError{Name: name, Err: err}
+	}
+	return data, nil
+}
+
+// chunk reads the data chunk c, checks it against the manifest, and calls f
+// with each record in it.
+func (a *archive) chunk(c chunk, f func(record) error) error {
+	data, err := a.read(c.Name)
+	if err != nil {
+		return ReadChunkError{Name: c.Name, Err: err}
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], c.SHA256) {
+		return ChunkDigestMismatchError{Name: c.Name}
+	}
+
+	var count int
+	s := bufio.NewScanner(bytes.NewReader(data))
+	s.Buffer(nil, len(data)+1) // Single records can be large.
+	for s.Scan() {
+		var r record
+		if err = json.Unmarshal(s.Bytes(), &r); err != nil {
+			return DecodeRecordError{Name: c.Name, Line: count + 1, Err: err}
+		}
+		if err = f(r); err != nil {
+			return err
+		}
+		count++
+	}
+	if err = s.Err(); err != nil {
+		return ScanChunkError{Name: c.Name, Err: err}
+	}
+	if count != c.Keys {
+		return ChunkKeyCountError{Name: c.Name, Count: count, Expected: c.Keys}
+	}
+	return nil
+}
+
+// restore puts all records in the archive into prot. It first checks that
+// none of the keys exist and refuses to overwrite any of them. Records with a
+// time to live are put with a new lease which expires after that time, so prot
+// must implement storage.PutGetterWithOpts if the archive contains any.
+func restore(ctx context.Context, prot storage.PutGetter, a *archive) error {
+	size := 1
+	b, batch := prot.(storage.Batcher)
+	if batch {
+		size = b.BatchSize()
+	}
+
+	// Process the records of each chunk in batches of size.
+	batches := func(f func([]record) error) error {
+		for _, c := range a.manifest.Chunks {
+			var records []record
+			if err := a.chunk(c, func(r record) error {
+				if records = append(records, r); len(records) == size {
+					err := f(records)
+					records = nil
+					return err
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if len(records) > 0 {
+				if err := f(records); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	log.Log(ctx, CheckingExistingKeys{})
+	progress.Static("Checking for existing keys:")
+	checkprogress := progress.Count(0, true)
+	progress.Redraw()
+	opts, leases := prot.(storage.PutGetterWithOpts)
+	if err := batches(func(records []record) error {
+		for _, r := range records {
+			if r.TTL > 0 && !leases {
+				return LeasesNotSupportedError{Key: r.Key}
+			}
+		}
+		if key, err := existing(ctx, prot, records); err != nil {
+			return CheckExistingKeyError{Err: err}
+		} else if key != "" {
+			return ExistingKeyError{Key: key}
+		}
+		checkprogress(uint64(len(records)))
+		return nil
+	}); err != nil {
+		return err
+	}
+	progress.Keep()
+
+	log.Log(ctx, RestoringKeys{Keys: a.manifest.Keys})
+	progress.Static("Restoring keys:")
+	addprogress := progress.Count(a.manifest.Keys, true)
+	progress.Redraw()
+	defer progress.Keep()
+	return batches(func(records []record) error {
+		// Keys created after the check are not overwritten by Put and
+		// PutAll, since they fail on existing keys. Keys with leases
+		// can only be put unconditionally, but these are short-lived
+		// and would be overwritten by their owners anyway.
+		var reqs []storage.PutAllRequest
+		for _, r := range records {
+			if r.TTL == 0 {
+				reqs = append(reqs, storage.PutAllRequest{Key: r.Key, Value: r.Value})
+				continue
+			}
+			if err := opts.PutForceWithOpts(ctx, r.Key, r.Value,
+				&storage.PutOpOptionWithTTL{TTL: strconv.FormatInt(r.TTL, 10)}); err != nil {
+
+				return RestoreLeasedKeyError{Key: r.Key, Err: err}
+			}
+		}
+
+		var err error
+		switch {
+		case len(reqs) == 0:
+		case batch:
+			err = b.PutAll(ctx, reqs...)
+		default:
+			err = prot.Put(ctx, reqs[0].Key, reqs[0].Value)
+		}
+		if err != nil {
+			return RestoreKeysError{Key: reqs[0].Key, Err: err}
+		}
+		addprogress(uint64(len(records)))
+		return nil
+	})
+}
+
+// existing returns the first key in records which exists in prot.
+func existing(ctx context.Context, prot storage.PutGetter, records []record) (
+	string, error) {
+
+	if b, ok := prot.(storage.Batcher); ok {
+		keys := make([]string, len(records))
+		for i, r := range records {
+			keys[i] = r.Key
+		}
+		values, err := b.GetAll(ctx, keys...)
+		if err != nil {
+			return "", err
+		}
+		for _, key := range keys {
+			if _, ok := values[key]; ok {
+				return key, nil
+			}
+		}
+		return "", nil
+	}
+
+	for _, r := range records {
+		switch _, err := prot.Get(ctx, r.Key); {
+		case err == nil:
+			return r.Key, nil
+		case errors.CausedBy(err, new(storage.NotExistError)) == nil:
+			return "", err
+		}
+	}
+	return "", nil
+}
@@ -116,11 +116,9 @@ func rebuildVotedStats(ctx context.Context, start time.Time, qps []q11n.Protocol
 				continue
 			}
 
-			ctime := vote.Time
-			if q11nTime, err := q11n.CanonicalTime(vote.Qualification); err != nil {
+			ctime, err := vote.CanonicalTime()
+			if err != nil {
 				return err
-			} else if !q11nTime.IsZero() {
-				ctime = q11nTime
 			}
 
 			testVote := ctime.Before(start)
@@ -0,0 +1,131 @@
+/*
+The storagejournal application verifies storage audit journals and replays
+them into an empty storage service.
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"ivxv.ee/common/collector/command"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/journal"
+	"ivxv.ee/common/collector/yaml"
+	//ivxv:modules common/collector/storage
+)
+
+const usage = `storagejournal verifies storage audit journals and replays them into an
+empty storage service.
+
+Audit journals are written by collector services if the journal storage
+protocol is configured in the technical configuration. Each service instance
+writes its own journal file into the journal directory: storagejournal
+verifies the hash chain of every *.journal file in that directory.
+
+The journal directory is taken from the journal storage protocol
+configuration, but can be overridden with -dir, e.g., to verify journals
+collected from several hosts into a single directory.
+
+If -replay is given, then after successful verification all mutations recorded
+in the journals are applied to the storage service wrapped by the journal
+protocol (or the configured storage service if the journal protocol is not
+used). The storage service must be empty.`
+
+var (
+	dirp    = flag.String("dir", "", "`path` to the journal directory")
+	replayp = flag.Bool("replay", false, "replay the journals into an empty storage service")
+)
+
+func main() {
+	// Call storagejournalmain in a separate function so that it can set up
+	// defers and have them trigger before returning with a non-zero exit
+	// code.
+	os.Exit(storagejournalmain())
+}
+
+func storagejournalmain() (code int) {
+	c := command.NewWithoutStorage("ivxv-storagejournal", usage)
+	defer func() {
+		code = c.Cleanup(code)
+	}()
+
+	// Only the election configuration is being checked.
+	if c.Conf.Technical == nil {
+		return exit.OK
+	}
+
+	// Determine the journal directory and the replay target protocol.
+	var cfg journal.Conf
+	target := c.Conf.Technical.Storage
+	if target.Protocol == storage.Journal {
+		if err := yaml.Apply(target.Conf, &cfg); err != nil {
+			return c.Error(exit.Config, JournalConfigurationError{Err: err},
+				"failed to apply journal configuration:", err)
+		}
+		target.Protocol, target.Conf = cfg.Protocol, cfg.Conf
+	}
+	if *dirp != "" {
+		cfg.Dir = *dirp
+	}
+	if cfg.Dir == "" {
+		return c.Error(exit.Usage, MissingJournalDirError{},
+			"journal storage protocol is not configured and -dir is missing")
+	}
+
+	if c.Until < command.CheckInput {
+		return exit.OK
+	}
+
+	paths, err := filepath.Glob(filepath.Join(cfg.Dir, "*.journal"))
+	if err != nil {
+		return c.Error(exit.Usage, JournalGlobError{Err: err},
+			"failed to list journal files:", err)
+	}
+	if len(paths) == 0 {
+		return c.Error(exit.NoInput, NoJournalsError{Dir: cfg.Dir},
+			"no journal files in", cfg.Dir)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		count, err := verify(path)
+		if err != nil {
+			return c.Error(exit.DataErr, VerifyJournalError{Path: path, Err: err},
+				"failed to verify journal", path, "after", count, "entries:", err)
+		}
+		fmt.Println(path, "OK,", count, "entries")
+	}
+
+	if c.Until < command.Execute || !*replayp {
+		return exit.OK
+	}
+
+	prot, err := storage.NewProtocol(target.Protocol, target.Conf, c.StorageServices())
+	if err != nil {
+		return c.Error(exit.Config, ReplayTargetConfigurationError{Err: err},
+			"failed to configure replay target storage client:", err)
+	}
+
+	applied, err := journal.Replay(c.Ctx, prot, paths...)
+	if err != nil {
+		return c.Error(exit.Unavailable, ReplayError{Applied: applied, Err: err},
+			"failed to replay journals after", applied, "mutations:", err)
+	}
+	fmt.Println("Replayed", applied, "mutations")
+	return
+}
+
+// verify verifies the journal file at path.
+func verify(path string) (count uint64, err error) {
+	fp, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer fp.Close()
+	return journal.Verify(fp)
+}
@@ -35,10 +35,10 @@ func NewClient(c *command.C) (client.Verifier, int) {
 		return nil, errCode
 	}
 
-	return &RPC{
+	return status.Traced(&RPC{
 		client:    tlsDialer,
 		verifyTTL: c.Conf.Technical.Status.Session.VerifyTTL,
-	}, exitCodeOK
+	}), exitCodeOK
 }
 
 func (r *RPC) Verify(dto interface{}) (bool, error) {
@@ -173,7 +173,11 @@ func verifyHandler(r *api.StatusReadResp) (bool, error) {
 	widAuth := r.Caller == Vote && r.Auth == client.WebeIDAuth ||
 		r.Caller == Verify && r.Auth == client.WebeIDAuth
 
-	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) {
+	// When voted with WebAuthn
+	waAuth := r.Caller == Vote && r.Auth == client.WebAuthnAuth ||
+		r.Caller == Verify && r.Auth == client.WebAuthnAuth
+
+	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) && !(waAuth) {
 		return false, VerifyInvalidCallerOrAuthForSessionID{
 			Method: Verify,
 			Caller: r.Caller,
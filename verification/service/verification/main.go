@@ -20,6 +20,7 @@ import (
 	"ivxv.ee/common/collector/status/client"
 	status "ivxv.ee/common/collector/status/client/rpc"
 	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/verifyticket"
 	internal "ivxv.ee/verification/internal/sessionstatus/rpc"
 	//ivxv:modules common/collector/container
 	//ivxv:modules common/collector/storage
@@ -33,12 +34,19 @@ type RPC struct {
 	storage              *storage.Client
 	foreignCode          string // Administrative unit code for foreign voters.
 	predefinedDistrictID string
+	vtickets             *verifyticket.T // Verification ticket manager, nil if disabled.
+	probe                *probeDetector  // Vote identifier probing detector, nil if disabled.
 }
 
 // Args are the arguments provided to a call of RPC.Verify.
 type Args struct {
 	server.Header
 	VoteID []byte `size:"16"` // Vote identifier of the vote to return.
+
+	// Ticket is the verification ticket issued by the voting service.
+	// Required if verification tickets are enabled, in which case VoteID
+	// may be omitted.
+	Ticket []byte `json:",omitempty" size:"256"`
 }
 
 // Response is the response returned by RPC.Verify.
@@ -73,6 +81,33 @@ func (r *RPC) Verify(args Args, resp *Response) error {
 		return server.ErrBadRequest
 	}
 
+	// Reject requests from sources blocked for probing vote identifiers
+	// and count failed lookups from the rest.
+	sources := r.probe.sources(args.Ctx, args.SessionID)
+	if r.probe.blocked(args.Ctx, sources) {
+		return server.ErrBadRequest
+	}
+	if err = r.lookup(args, resp, now); err == server.ErrBadRequest {
+		r.probe.failed(args.Ctx, sources)
+	}
+	return err
+}
+
+// lookup retrieves the vote to verify and increases its verification count.
+// Any failure to find a verifiable vote is reported as server.ErrBadRequest.
+func (r *RPC) lookup(args Args, resp *Response, now time.Time) error {
+	// Check the verification ticket before accessing storage. Report bad
+	// tickets exactly like a bad vote identifier.
+	if r.vtickets != nil {
+		vt, err := r.vtickets.Open(args.Ticket, r.election.Identifier, args.VoteID, now)
+		if err != nil {
+			log.Error(args.Ctx, BadVerificationTicketError{Err: err})
+			return server.ErrBadRequest
+		}
+		args.VoteID = vt.VoteID
+		log.Log(args.Ctx, VerificationTicket{VoteID: vt.VoteID, Expiry: vt.Expiry})
+	}
+
 	// If the verification count changed between retrieving it and
 	// attempting to update, then that means that there was another
 	// concurrent verification session for this ID that got there first. If
@@ -194,6 +229,28 @@ func verifymain() (code int) {
 		// Get foreign code (voterforeignehak) from election config
 		rpc.foreignCode = strings.TrimSpace(c.Conf.Election.VoterForeignEHAKDefault())
 
+		// Configure verification tickets if enabled.
+		if c.Conf.Election.Verification.Ticket {
+			if rpc.vtickets, err = verifyticket.NewFromSystem(); err != nil {
+				return c.Error(exit.Config, VerificationTicketConfError{Err: err},
+					"failed to configure verification tickets:", err)
+			}
+		}
+
+		// Configure vote identifier probing detection if enabled.
+		if p := c.Conf.Election.Verification.Probing; p.Failures > 0 {
+			if p.Minutes == 0 || p.BlockMinutes == 0 {
+				return c.Error(exit.Config, ProbingConfError{},
+					"probing detection window or block duration is 0")
+			}
+			rpc.probe = &probeDetector{
+				storage:  c.Storage,
+				failures: p.Failures,
+				window:   time.Duration(p.Minutes) * time.Minute,
+				block:    time.Duration(p.BlockMinutes) * time.Minute,
+			}
+		}
+
 		// No authentication is used during verification.
 	}
 
@@ -203,12 +260,14 @@ func verifymain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/server"
+	"ivxv.ee/common/collector/storage"
+)
+
+// probeDetector detects clients probing for vote identifiers by counting
+// failed lookups per source address and per session. Sources which exceed the
+// limit are temporarily blocked. The state is kept in the storage service, so
+// it is shared across service instances.
+//
+// All methods are safe to call on a nil detector, in which case detection is
+// disabled.
+type probeDetector struct {
+	storage  *storage.Client
+	failures uint64        // Failed lookups in window before blocking.
+	window   time.Duration // Window for counting failed lookups.
+	block    time.Duration // Duration of blocking.
+}
+
+// sources returns the source identifiers of the request: the client address
+// and session identifier.
+//
+// The session identifier is taken from the request header, but it can be
+// trusted for this purpose, because Verify only calls sources after the
+// session status service has accepted the transition to verification: this is
+// only allowed for sessions which have submitted a vote with an authenticated
+// voter. Thus a client cannot evade counting by sending fresh identifiers.
+// Session identifiers are random and only known to the voter, so a client
+// cannot get the session of another voter blocked either.
+func (p *probeDetector) sources(ctx context.Context, sessionID string) (sources []string) {
+	if p == nil {
+		return nil
+	}
+	if addr := server.ClientAddress(ctx); addr != nil {
+		host := addr.String()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		sources = append(sources, "address/"+host)
+	}
+	if len(sessionID) > 0 {
+		sources = append(sources, "session/"+sessionID)
+	}
+	return
+}
+
+// blocked checks if any of the sources is blocked. Failures to check are
+// logged and the source is not considered blocked, so that storage errors do
+// not prevent legitimate verification.
+func (p *probeDetector) blocked(ctx context.Context, sources []string) bool {
+	if p == nil {
+		return false
+	}
+	for _, source := range sources {
+		blocked, err := p.storage.CheckProbeBlocked(ctx, source)
+		if err != nil {
+			log.Error(ctx, CheckProbeBlockedError{Source: source, Err: log.Alert(err)})
+			continue
+		}
+		if blocked {
+			log.Error(ctx, ProbeSourceBlockedError{Source: source})
+			return true
+		}
+	}
+	return false
+}
+
+// failed records a failed lookup from sources and blocks the sources which
+// reach the failure limit.
+func (p *probeDetector) failed(ctx context.Context, sources []string) {
+	if p == nil {
+		return
+	}
+	for _, source := range sources {
+		count, err := p.storage.AddProbeFailure(ctx, source, p.window)
+		if err != nil {
+			log.Error(ctx, AddProbeFailureError{Source: source, Err: log.Alert(err)})
+			continue
+		}
+		log.Log(ctx, ProbeFailure{Source: source, Count: count})
+		if count < p.failures {
+			continue
+		}
+
+		// Alert about detected probing and block the source.
+		log.Error(ctx, ProbingDetectedError{Err: log.Alert(ProbingError{
+			Source:   source,
+			Failures: count,
+			Window:   p.window.String(),
+			Block:    p.block.String(),
+		})})
+		if err = p.storage.BlockProbeSource(ctx, source, p.block); err != nil {
+			log.Error(ctx, BlockProbeSourceError{Source: source, Err: log.Alert(err)})
+		}
+	}
+}
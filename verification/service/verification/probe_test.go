@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/bolt"
+)
+
+func TestProbeDetector(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	prot, err := bolt.New(&bolt.Conf{Path: filepath.Join(t.TempDir(), "ivxv.db")})
+	if err != nil {
+		t.Fatal("failed to create bolt storage:", err)
+	}
+	p := &probeDetector{
+		storage:  storage.NewWithProtocol(prot),
+		failures: 3,
+		window:   time.Minute,
+		block:    time.Minute,
+	}
+
+	// Without a connection only the session is a source.
+	sources := p.sources(ctx, "0123456789abcdef0123456789abcdef")
+	if len(sources) != 1 || sources[0] != "session/0123456789abcdef0123456789abcdef" {
+		t.Fatalf("unexpected sources: %v", sources)
+	}
+	if other := p.sources(ctx, ""); len(other) != 0 {
+		t.Fatalf("unexpected sources without session: %v", other)
+	}
+
+	// Sources are blocked once they reach the failure limit.
+	for i := uint64(1); i < p.failures; i++ {
+		p.failed(ctx, sources)
+		if p.blocked(ctx, sources) {
+			t.Fatalf("source blocked after %d failures", i)
+		}
+	}
+	p.failed(ctx, sources)
+	if !p.blocked(ctx, sources) {
+		t.Errorf("source not blocked after %d failures", p.failures)
+	}
+	if p.blocked(ctx, []string{"session/other"}) {
+		t.Error("other source blocked")
+	}
+}
+
+func TestProbeDetectorDisabled(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	var p *probeDetector
+	if sources := p.sources(ctx, "0123456789abcdef0123456789abcdef"); sources != nil {
+		t.Errorf("unexpected sources of disabled detector: %v", sources)
+	}
+	p.failed(ctx, []string{"session/0123456789abcdef0123456789abcdef"})
+	if p.blocked(ctx, []string{"session/0123456789abcdef0123456789abcdef"}) {
+		t.Error("source blocked by disabled detector")
+	}
+}
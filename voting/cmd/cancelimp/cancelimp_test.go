@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseList(t *testing.T) {
+	list, err := parseList(map[string][]byte{"cancellations.json": []byte(`{
+		"election": "TEST",
+		"cancellations": [
+			{"voter": "38001085718", "time": "2026-03-01T09:00:00+02:00", "reason": "paper"},
+			{"voter": "48001085718", "time": "2026-03-01T10:00:00Z"}
+		]
+	}`)})
+	if err != nil {
+		t.Fatal("failed to parse list:", err)
+	}
+	if list.Election != "TEST" || len(list.Cancellations) != 2 {
+		t.Fatalf("unexpected list: %+v", list)
+	}
+	if c := list.Cancellations[0]; c.Voter != "38001085718" || c.Reason != "paper" ||
+		!c.Time.Equal(time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC)) {
+
+		t.Errorf("unexpected first cancellation: %+v", c)
+	}
+
+	tests := []struct {
+		name string
+		data map[string][]byte
+	}{
+		{"no files", map[string][]byte{}},
+		{"multiple files", map[string][]byte{"a.json": []byte("{}"), "b.json": []byte("{}")}},
+		{"unknown field", map[string][]byte{"a.json": []byte(`{"election": "TEST", "extra": 1}`)}},
+		{"invalid time", map[string][]byte{"a.json": []byte(
+			`{"cancellations": [{"voter": "38001085718", "time": "yesterday"}]}`)}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := parseList(test.data); err == nil {
+				t.Error("unexpected success")
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+/*
+The cancelimp application is used for loading vote cancellation lists into the
+storage service.
+*/
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"ivxv.ee/common/collector/command"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/container"
+	"ivxv.ee/common/collector/cryptoutil"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	//ivxv:modules common/collector/container
+	//ivxv:modules common/collector/storage
+)
+
+const usage = `cancelimp loads vote cancellation lists into the collector's storage service
+for use by voteexp and voterstats.
+
+A cancellation list cancels the electronic votes of the listed voters which
+were submitted before the listed cancellation time, e.g., because the voter
+voted on paper on election day. Cancelled votes are not removed from storage,
+but are left out of exported votes and voter statistics.
+
+The cancellation list container must be signed only by operators listed in
+the election configuration and contain exactly one file with the JSON-encoded
+cancellation list:
+
+    {
+        "election": "<election identifier>",
+        "cancellations": [
+            {
+                "voter": "<voter identifier>",
+                "time": "<RFC 3339 cancellation time>",
+                "reason": "<optional reason>"
+            }
+        ]
+    }
+
+The cancellation list container must have an extension corresponding to the
+container type it is, e.g., cancellations.asice. Importing the same container
+again has no effect.`
+
+var qp = flag.Bool("q", false, "quiet, do not show progress")
+
+func main() {
+	// Call cancelimpmain in a separate function so that it can set up
+	// defers and have them trigger before returning with a non-zero exit
+	// code.
+	os.Exit(cancelimpmain())
+}
+
+// cancellationList is the JSON-encoded cancellation list.
+type cancellationList struct {
+	Election      string `json:"election"`
+	Cancellations []struct {
+		Voter  string    `json:"voter"`
+		Time   time.Time `json:"time"`
+		Reason string    `json:"reason"`
+	} `json:"cancellations"`
+}
+
+func cancelimpmain() (code int) {
+	c := command.New("ivxv-cancelimp", usage, "cancellation list container")
+	defer func() {
+		code = c.Cleanup(code)
+	}()
+
+	// Parse the certificates of operators allowed to sign the lists.
+	operators, err := cryptoutil.PEMCertificates(c.Conf.Election.Cancellation.Operators...)
+	if err != nil {
+		return c.Error(exit.Config, OperatorCertificateError{Err: err},
+			"failed to parse cancellation operator certificates:", err)
+	}
+	if len(operators) == 0 {
+		return c.Error(exit.Config, NoOperatorsError{},
+			"no cancellation operators configured")
+	}
+
+	if c.Until < command.CheckInput {
+		return exit.OK
+	}
+	path := c.Args[0]
+
+	// Read the container for storing as evidence and open it.
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		code = exit.NoInput
+		if !os.IsNotExist(err) {
+			code = exit.IOErr
+		}
+		return c.Error(code, ReadContainerError{Container: path, Err: err},
+			"failed to read cancellation list container:", err)
+	}
+	cnt, err := c.Conf.Container.Open(
+		container.Type(strings.TrimPrefix(filepath.Ext(path), ".")),
+		bytes.NewReader(raw))
+	if err != nil {
+		return c.Error(exit.DataErr, OpenContainerError{Container: path, Err: err},
+			"failed to open cancellation list container:", err)
+	}
+	defer cnt.Close()
+
+	// Ensure that the container is signed only by operators.
+	signatures := cnt.Signatures()
+	if len(signatures) == 0 {
+		return c.Error(exit.DataErr, UnsignedContainerError{Container: path},
+			"unsigned cancellation list container")
+	}
+	for _, s := range signatures {
+		log.Log(c.Ctx, ContainerSignature{Signer: s.Signer, SigningTime: s.SigningTime})
+		if !isOperator(operators, s.Signer) {
+			return c.Error(exit.DataErr, NotOperatorError{Signer: s.Signer.Subject},
+				"cancellation list container signed by non-operator",
+				s.Signer.Subject)
+		}
+	}
+
+	// Parse the cancellation list.
+	list, err := parseList(cnt.Data())
+	if err != nil {
+		return c.Error(exit.DataErr, ParseListError{Err: err},
+			"failed to parse cancellation list:", err)
+	}
+	if list.Election != c.Conf.Election.Identifier {
+		return c.Error(exit.DataErr, ElectionMismatchError{
+			List:     list.Election,
+			Election: c.Conf.Election.Identifier,
+		}, "cancellation list is for election", list.Election,
+			"but configured election is", c.Conf.Election.Identifier)
+	}
+	cancellations := make([]storage.Cancellation, len(list.Cancellations))
+	for i, record := range list.Cancellations {
+		if len(record.Voter) == 0 || record.Time.IsZero() {
+			return c.Error(exit.DataErr, InvalidCancellationError{Index: i},
+				"cancellation", i, "is missing the voter or time")
+		}
+		cancellations[i] = storage.Cancellation{
+			Voter:  record.Voter,
+			Time:   record.Time,
+			Reason: record.Reason,
+		}
+	}
+
+	// The list is identified by the digest of the container, so that
+	// importing the same container again is idempotent.
+	digest := sha256.Sum256(raw)
+	id := hex.EncodeToString(digest[:])
+	imported, err := c.Storage.CheckCancellationList(c.Ctx, id)
+	if err != nil {
+		return c.Error(exit.Unavailable, CheckListError{Err: err},
+			"failed to check if cancellation list is imported:", err)
+	}
+	if imported {
+		log.Log(c.Ctx, ListAlreadyImported{List: id})
+		if !*qp {
+			fmt.Println("Cancellation list", id, "already imported")
+		}
+		return exit.OK
+	}
+
+	if c.Until >= command.Execute {
+		log.Log(c.Ctx, ImportingCancellations{List: id, Count: len(cancellations)})
+		if err := c.Storage.PutCancellations(c.Ctx, id, raw, cancellations); err != nil {
+			return c.Error(exit.Unavailable, PutCancellationsError{Err: err},
+				"failed to import cancellation list:", err)
+		}
+		if !*qp {
+			fmt.Println("Imported", len(cancellations), "cancellations from list", id)
+		}
+	}
+	return exit.OK
+}
+
+// isOperator checks if cert is one of the operator certificates.
+func isOperator(operators []*x509.Certificate, cert *x509.Certificate) bool {
+	for _, operator := range operators {
+		if operator.Equal(cert) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseList parses the cancellation list from container data.
+func parseList(data map[string][]byte) (list cancellationList, err error) {
+	if len(data) != 1 {
+		return list, FileCountError{Count: len(data)}
+	}
+	for name, content := range data {
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(&list); err != nil {
+			return list, DecodeListError{File: name, Err: err}
+		}
+	}
+	return
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"time"
+)
+
+// checkpointSuffix is appended to the output archive path to get the path of
+// the checkpoint sidecar file.
+const checkpointSuffix = ".checkpoint"
+
+// checkpointStep is the number of votes after which progress is checkpointed.
+const checkpointStep = 1000
+
+// The checkpoint sidecar file consists of JSON-encoded lines: the first line
+// is a checkpointHeader and every following line is a checkpointVote for a
+// vote which has been completely written to and synced in the output archive.
+// The last line is thus the last exported vote.
+//
+// The entries of the output archive are written so that the archive can be
+// reconstructed from the checkpoint: see resumeWriter.
+
+// checkpointHeader identifies the export that a checkpoint belongs to.
+type checkpointHeader struct {
+	Election string    // Election identifier.
+	Since    string    // Path to the previous export manifest or empty.
+	Started  time.Time // Cutoff time of the export.
+}
+
+// checkpointVote lists the archive entries of an exported vote.
+type checkpointVote struct {
+	VoteID  string // Hex-encoded vote identifier.
+	Prefix  string // Common prefix of the entry names.
+	Entries []checkpointEntry
+}
+
+// checkpointEntry is a single raw entry in the output archive.
+type checkpointEntry struct {
+	Name             string
+	Modified         time.Time
+	CRC32            uint32
+	CompressedSize   uint64
+	UncompressedSize uint64
+	Offset           int64  // Offset of the compressed data in the archive.
+	SHA256           []byte // Digest of the uncompressed data.
+}
+
+// checkpoint appends to a checkpoint sidecar file.
+type checkpoint struct {
+	fp      *os.File
+	pending bytes.Buffer // Encoded votes not yet written to fp.
+	count   int          // Number of votes in pending.
+}
+
+// createCheckpoint creates a new checkpoint file at path and writes the header.
+func createCheckpoint(path string, header checkpointHeader) (*checkpoint, error) {
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, CreateCheckpointError{Path: path, Err: err}
+	}
+	c := &checkpoint{fp: fp}
+	if err = json.NewEncoder(&c.pending).Encode(header); err != nil {
+		fp.Close()
+		return nil, EncodeCheckpointHeaderError{Err: err}
+	}
+	if err = c.flush(); err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// add adds an exported vote to the checkpoint. It will only be written to the
+// checkpoint file on flush.
+func (c *checkpoint) add(vote checkpointVote) error {
+	if err := json.NewEncoder(&c.pending).Encode(vote); err != nil {
+		return EncodeCheckpointVoteError{VoteID: vote.VoteID, Err: err}
+	}
+	c.count++
+	return nil
+}
+
+// flush writes all pending votes to the checkpoint file and syncs it. The
+// caller must ensure that the votes are synced in the output archive first.
+func (c *checkpoint) flush() error {
+	if _, err := c.fp.Write(c.pending.Bytes()); err != nil {
+		return WriteCheckpointError{Err: err}
+	}
+	if err := c.fp.Sync(); err != nil {
+		return SyncCheckpointError{Err: err}
+	}
+	c.pending.Reset()
+	c.count = 0
+	return nil
+}
+
+// Close closes the checkpoint file without flushing.
+func (c *checkpoint) Close() error {
+	return c.fp.Close()
+}
+
+// readCheckpoint reads the checkpoint file at path and opens it for appending
+// more votes. An incomplete last line, left over from a crash while writing,
+// is discarded.
+func readCheckpoint(path string) (c *checkpoint, header checkpointHeader,
+	votes []checkpointVote, err error) {
+
+	fp, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, header, nil, OpenCheckpointError{Path: path, Err: err}
+	}
+	defer func() {
+		if err != nil {
+			fp.Close()
+		}
+	}()
+
+	r := bufio.NewReader(fp)
+	var offset int64
+	for first := true; ; first = false {
+		line, rerr := r.ReadBytes('\n')
+		if rerr == io.EOF {
+			break // Complete or not, the last line is ignored.
+		}
+		if rerr != nil {
+			return nil, header, nil, ReadCheckpointError{Path: path, Err: rerr}
+		}
+		if first {
+			err = json.Unmarshal(line, &header)
+		} else {
+			var vote checkpointVote
+			err = json.Unmarshal(line, &vote)
+			votes = append(votes, vote)
+		}
+		if err != nil {
+			return nil, header, nil, DecodeCheckpointError{
+				Path:   path,
+				Offset: offset,
+				Err:    err,
+			}
+		}
+		offset += int64(len(line))
+	}
+	if offset == 0 {
+		return nil, header, nil, EmptyCheckpointError{Path: path}
+	}
+
+	// Truncate any incomplete line and continue appending after the
+	// last complete one.
+	if err = fp.Truncate(offset); err != nil {
+		return nil, header, nil, TruncateCheckpointError{Path: path, Err: err}
+	}
+	if _, err = fp.Seek(offset, io.SeekStart); err != nil {
+		return nil, header, nil, SeekCheckpointError{Path: path, Err: err}
+	}
+	return &checkpoint{fp: fp}, header, votes, nil
+}
+
+// resumeWriter writes an archive into a file which may already contain a
+// prefix of the same archive from an interrupted export. Bytes written to it
+// within the prefix are compared against the existing contents instead of
+// being written, so that re-adding the checkpointed entries verifies that the
+// prefix is intact.
+type resumeWriter struct {
+	fp     *os.File
+	prefix int64 // Length of the existing prefix.
+	offset int64 // Number of bytes written.
+}
+
+func (w *resumeWriter) Write(p []byte) (n int, err error) {
+	if w.offset < w.prefix {
+		m := len(p)
+		if left := w.prefix - w.offset; int64(m) > left {
+			m = int(left)
+		}
+		existing := make([]byte, m)
+		if _, err = w.fp.ReadAt(existing, w.offset); err != nil {
+			return 0, ReadExistingOutputError{Offset: w.offset, Err: err}
+		}
+		if !bytes.Equal(existing, p[:m]) {
+			return 0, ExistingOutputMismatchError{Offset: w.offset}
+		}
+		w.offset += int64(m)
+		n, p = m, p[m:]
+	}
+	if len(p) > 0 {
+		var m int
+		m, err = w.fp.WriteAt(p, w.offset)
+		w.offset += int64(m)
+		n += m
+	}
+	return
+}
@@ -0,0 +1,332 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/q11n"
+	"ivxv.ee/common/collector/storage"
+)
+
+// exporter writes votes into the output archive and checkpoints progress.
+//
+// Archive entries are compressed by the exporter and added as raw entries,
+// so that their exact layout is known and recorded in the checkpoint.
+type exporter struct {
+	fp  *os.File
+	out *resumeWriter
+	w   *zip.Writer
+	cp  *checkpoint
+
+	skip   map[string]struct{} // Hex-encoded vote IDs not to export.
+	cutoff time.Time           // Votes stored after cutoff are not exported.
+	votes  []manifestVote      // Exported votes.
+
+	// cancelled maps voters to the time before which their votes are
+	// cancelled and cancelledIDs are the hex-encoded IDs of such votes.
+	cancelled    map[string]time.Time
+	cancelledIDs []string
+}
+
+// newExporter creates an exporter which writes votes stored before cutoff into
+// the output archive fp and checkpoint cp. If resumed contains checkpointed
+// votes, then these are re-added to the archive: fp must already contain them
+// and the checkpoint must end with them.
+func newExporter(fp *os.File, cp *checkpoint, resumed []checkpointVote, cutoff time.Time) (
+	*exporter, error) {
+
+	var prefix int64
+	if n := len(resumed); n > 0 {
+		if m := len(resumed[n-1].Entries); m > 0 {
+			last := resumed[n-1].Entries[m-1]
+			prefix = last.Offset + int64(last.CompressedSize)
+		}
+	}
+	// Drop any data written after the last checkpointed vote.
+	if err := fp.Truncate(prefix); err != nil {
+		return nil, TruncateOutputError{Offset: prefix, Err: err}
+	}
+
+	e := &exporter{
+		fp:     fp,
+		out:    &resumeWriter{fp: fp, prefix: prefix},
+		cp:     cp,
+		skip:   make(map[string]struct{}),
+		cutoff: cutoff,
+	}
+	e.w = zip.NewWriter(e.out)
+
+	for _, vote := range resumed {
+		for i := range vote.Entries {
+			entry := &vote.Entries[i]
+			data := io.NewSectionReader(fp, entry.Offset, int64(entry.CompressedSize))
+			if err := e.addRaw(entry, data, true); err != nil {
+				return nil, ResumeVoteError{VoteID: vote.VoteID, Err: err}
+			}
+		}
+		e.skip[vote.VoteID] = struct{}{}
+		e.votes = append(e.votes, vote.manifest())
+	}
+	if err := e.w.Flush(); err != nil {
+		return nil, ResumeFlushError{Err: err}
+	}
+	if e.out.offset != prefix {
+		return nil, ResumeOffsetMismatchError{Offset: e.out.offset, Expected: prefix}
+	}
+	return e, nil
+}
+
+// addRaw adds an archive entry with already compressed data. If resumed is
+// true, then the entry must be located at entry.Offset, otherwise the offset
+// is filled in.
+func (e *exporter) addRaw(entry *checkpointEntry, data io.Reader, resumed bool) error {
+	f, err := e.w.CreateRaw(&zip.FileHeader{
+		Name:               entry.Name,
+		Method:             zip.Deflate,
+		Modified:           entry.Modified,
+		CRC32:              entry.CRC32,
+		CompressedSize64:   entry.CompressedSize,
+		UncompressedSize64: entry.UncompressedSize,
+	})
+	if err != nil {
+		return AddFileCreateError{Name: entry.Name, Err: err}
+	}
+
+	// Flush the header, so that the offset of the data is known.
+	if err = e.w.Flush(); err != nil {
+		return AddFileFlushError{Name: entry.Name, Err: err}
+	}
+	if resumed && e.out.offset != entry.Offset {
+		return EntryOffsetMismatchError{
+			Name:     entry.Name,
+			Offset:   e.out.offset,
+			Expected: entry.Offset,
+		}
+	}
+	entry.Offset = e.out.offset
+
+	if _, err = io.Copy(f, data); err != nil {
+		return AddFileWriteError{Name: entry.Name, Err: err}
+	}
+	return nil
+}
+
+// addFile compresses value and adds it to the archive.
+func (e *exporter) addFile(mod time.Time, name string, value []byte) (
+	entry checkpointEntry, err error) {
+
+	var compressed bytes.Buffer
+	fw, err := flate.NewWriter(&compressed, flate.DefaultCompression)
+	if err != nil {
+		return entry, CompressorError{Err: err}
+	}
+	if _, err = fw.Write(value); err != nil {
+		return entry, CompressError{Name: name, Err: err}
+	}
+	if err = fw.Close(); err != nil {
+		return entry, CompressCloseError{Name: name, Err: err}
+	}
+
+	sum := sha256.Sum256(value)
+	entry = checkpointEntry{
+		Name:             name,
+		Modified:         mod,
+		CRC32:            crc32.ChecksumIEEE(value),
+		CompressedSize:   uint64(compressed.Len()),
+		UncompressedSize: uint64(len(value)),
+		SHA256:           sum[:],
+	}
+	err = e.addRaw(&entry, &compressed, false)
+	return
+}
+
+// addVote adds the entries of a vote to the archive in the following
+// hierarchy:
+//
+//	votes/
+//	└ <voter id>/
+//	  ├ <timestamp>.version
+//	  ├ <timestamp>.<vote type>
+//	  └ <timestamp>.<q11n protocol>*
+func (e *exporter) addVote(vote *storage.StoredVote) error {
+	prefix := fmt.Sprintf("votes/%s/%s.", vote.Voter,
+		strings.ReplaceAll(vote.Time.Format("20060102150405.000-0700"), ".", ""))
+
+	cv := checkpointVote{VoteID: hex.EncodeToString(vote.VoteID), Prefix: prefix}
+	entry, err := e.addFile(vote.Time, prefix+"version", []byte(vote.Version))
+	if err != nil {
+		return AddVersionError{VoteID: vote.VoteID, Prefix: prefix, Err: err}
+	}
+	cv.Entries = append(cv.Entries, entry)
+	if entry, err = e.addFile(vote.Time, prefix+string(vote.VoteType), vote.Vote); err != nil {
+		return AddVoteError{VoteID: vote.VoteID, Prefix: prefix, Err: err}
+	}
+	cv.Entries = append(cv.Entries, entry)
+	for p, b := range vote.Qualification {
+		if entry, err = e.addFile(vote.Time, prefix+string(p), b); err != nil {
+			return AddQualifyingPropertyError{
+				VoteID:   vote.VoteID,
+				Prefix:   prefix,
+				Protocol: p,
+				Err:      err,
+			}
+		}
+		cv.Entries = append(cv.Entries, entry)
+	}
+
+	e.votes = append(e.votes, cv.manifest())
+	if err = e.cp.add(cv); err != nil {
+		return err
+	}
+	if e.cp.count >= checkpointStep {
+		return e.sync()
+	}
+	return nil
+}
+
+// sync syncs the archive written so far to disk and then checkpoints all
+// votes in it.
+func (e *exporter) sync() error {
+	if err := e.w.Flush(); err != nil {
+		return SyncFlushError{Err: err}
+	}
+	if err := e.fp.Sync(); err != nil {
+		return SyncOutputError{Err: err}
+	}
+	return e.cp.flush()
+}
+
+// export reads the votes and related metadata from the storage service and
+// adds them to the archive, skipping votes which have already been exported.
+// On success, the archive is finished, otherwise progress is checkpointed.
+func (e *exporter) export(ctx context.Context, s *storage.Client, qps []q11n.Protocol,
+	optional []string) (err error) {
+
+	defer func() {
+		if err == nil || errors.CausedBy(err, new(NonFatalError)) != nil {
+			if cerr := e.w.Close(); cerr != nil && err == nil {
+				err = CloseZIPArchiveError{Err: cerr}
+			}
+			return
+		}
+		// Save progress for resuming.
+		if serr := e.sync(); serr != nil {
+			log.Error(ctx, CheckpointOnErrorError{Err: serr})
+		}
+	}()
+
+	// Check if the context is canceled before the expensive GetVotes
+	// operation.
+	select {
+	case <-ctx.Done():
+		return ExportCanceled{Err: ctx.Err()}
+	default:
+	}
+
+	// Start exporting votes from the storage service.
+	log.Log(ctx, ExportingVotes{Resumed: len(e.votes), Skip: len(e.skip)})
+	progress.Static("Exporting votes:")
+	addprogress := progress.Count(uint64(len(e.votes)), true)
+	progress.Redraw()
+	defer progress.Keep()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // Stop GetVotes if we terminate early.
+	c, errc := s.GetVotes(ctx, qps, optional)
+
+	// Start a goroutine which reads and logs errors parallel to this one.
+	// It either sends nil on lerrc if everything went fine, NonFatalError,
+	// if non-fatal errors occurred, or a fatal error from GetVotes.
+	gerrc := make(chan error, 1)
+	go func() {
+		var gerr log.ErrorEntry
+		for err := range errc {
+			gerr = GetVotesError{Err: err}
+			if errors.CausedBy(err, new(storage.GetVotesFatalError)) != nil {
+				break
+			}
+
+			gerr = NonFatalError{Err: gerr}
+			log.Error(ctx, gerr)
+			progress.Hide()
+			fmt.Fprintln(os.Stderr, "error: non-fatal error:", gerr)
+			progress.Show()
+		}
+		gerrc <- gerr
+	}()
+	defer func() {
+		if err != nil {
+			cancel() // Unblock GetVotes before waiting for errors.
+		}
+		if gerr := <-gerrc; err == nil {
+			err = gerr
+		}
+	}()
+
+	var count, skipped, later uint64
+	countlog := VoteExportProgress{Current: 0}
+	const logstep = 10000 // Log progress after each logstep.
+	for vote := range c {
+		id := hex.EncodeToString(vote.VoteID)
+		if vote.Time.After(e.cutoff) {
+			later++
+			continue
+		}
+		var cancelled bool
+		if cancelled, err = e.isCancelled(vote); err != nil {
+			return err
+		}
+		if cancelled {
+			log.Log(ctx, CancelledVote{VoteID: id, Voter: vote.Voter})
+			e.cancelledIDs = append(e.cancelledIDs, id)
+			continue
+		}
+		if _, ok := e.skip[id]; ok {
+			skipped++
+			continue
+		}
+		if err = e.addVote(vote); err != nil {
+			return err
+		}
+
+		count++
+		addprogress(1)
+		if count%logstep == 0 {
+			countlog.Current = count
+			log.Log(ctx, countlog)
+		}
+	}
+	log.Log(ctx, VoteCount{
+		Count:     count,
+		Skipped:   skipped,
+		Later:     later,
+		Cancelled: len(e.cancelledIDs),
+	})
+	return
+}
+
+// isCancelled reports if vote is cancelled. The canonical time of the vote is
+// compared against the cancellation time, same as in voterstats.
+func (e *exporter) isCancelled(vote *storage.StoredVote) (bool, error) {
+	ctime, ok := e.cancelled[vote.Voter]
+	if !ok {
+		return false, nil
+	}
+	vtime, err := vote.CanonicalTime()
+	if err != nil {
+		return false, CancelledVoteTimeError{VoteID: vote.VoteID, Err: err}
+	}
+	return storage.Cancelled(ctime, vtime), nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/container"
+	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/storage/memory"
+)
+
+func TestExportCutoff(t *testing.T) {
+	ctx := log.TestContext(context.Background())
+	s := storage.NewWithProtocol(memory.New(nil))
+	*qp = true
+
+	cutoff := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	for id, stored := range map[string]time.Time{
+		"exported": cutoff.Add(-2 * time.Minute),
+		"previous": cutoff.Add(-time.Minute),
+		"later":    cutoff.Add(time.Minute),
+	} {
+		if err := s.StoreVote(ctx, storage.StoredVote{
+			VoteID:   []byte(id),
+			Time:     stored,
+			VoteType: container.BDOC,
+			Vote:     []byte("container " + id),
+			Voter:    "38001085718",
+			Version:  "version",
+		}); err != nil {
+			t.Fatal("failed to store vote:", err)
+		}
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "votes.zip")
+	fp, err := os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		t.Fatal("failed to create output:", err)
+	}
+	defer fp.Close()
+	cp, err := createCheckpoint(output+checkpointSuffix, checkpointHeader{
+		Election: "TESTELECTION",
+		Started:  cutoff,
+	})
+	if err != nil {
+		t.Fatal("failed to create checkpoint:", err)
+	}
+	defer cp.Close()
+
+	e, err := newExporter(fp, cp, nil, cutoff)
+	if err != nil {
+		t.Fatal("failed to create exporter:", err)
+	}
+	e.skip[hex.EncodeToString([]byte("previous"))] = struct{}{}
+	if err = e.export(ctx, s, nil, nil); err != nil {
+		t.Fatal("failed to export votes:", err)
+	}
+
+	// Only the vote stored before the cutoff and not exported previously
+	// is in the archive.
+	if len(e.votes) != 1 || e.votes[0].VoteID != hex.EncodeToString([]byte("exported")) {
+		t.Fatalf("unexpected exported votes: %+v", e.votes)
+	}
+	r, err := zip.OpenReader(output)
+	if err != nil {
+		t.Fatal("failed to open output:", err)
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	expected := []string{
+		e.votes[0].Prefix + string(container.BDOC),
+		e.votes[0].Prefix + "version",
+	}
+	if len(names) != len(expected) || names[0] != expected[0] || names[1] != expected[1] {
+		t.Errorf("unexpected archive entries: %q, want %q", names, expected)
+	}
+}
@@ -4,18 +4,19 @@ The voteexp application is used for exporting votes from the storage service.
 package main
 
 import (
-	"archive/zip"
-	"context"
+	"crypto/rsa"
 	"flag"
 	"fmt"
-	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
+	"ivxv.ee/common/collector/archivesig"
 	"ivxv.ee/common/collector/command"
 	"ivxv.ee/common/collector/command/exit"
 	"ivxv.ee/common/collector/command/status"
+	"ivxv.ee/common/collector/conf"
 	"ivxv.ee/common/collector/errors"
 	"ivxv.ee/common/collector/log"
 	"ivxv.ee/common/collector/q11n"
@@ -30,6 +31,29 @@ processing application.
 voteexp only exports complete votes and votes which are only missing fields
 listed with the optional flag.
 
+Progress is checkpointed into a sidecar file next to the output archive. If an
+export is interrupted, then it can be continued with the resume flag. After a
+successful export, the checkpoint is removed and an export manifest is written
+next to the output archive. Giving a previous export manifest with the since
+flag makes an incremental export which only contains votes that were not
+included in the previous exports. The previous export manifest must be signed
+with the same key as the new one.
+
+An export contains the votes stored before the time it was started. Votes
+stored later are left for the next incremental export.
+
+The export manifest lists the digests of the files of each exported vote, the
+number of votes with each qualifying property, the export time, the election
+identifier, and the voter list version. It is signed with the RSA key given
+with the key flag or the default key. A missing key is an error: unsigned
+manifests must be explicitly requested with the nosign flag.
+
+Votes cancelled using cancelimp are not exported, but are listed in the export
+manifest.
+
+Use "ivxv-voteexp verify" to check an archive, e.g., the result of voteunion,
+against export manifests.
+
 If there were non-fatal errors, e.g. there were some partial votes in storage,
 then voteexp exits with code 2.`
 
@@ -38,12 +62,26 @@ var (
 		// End with newline for printing default value.
 		"comma-separated `list` of vote fields which are optional\n")
 
+	resumep = flag.Bool("resume", false, "resume an interrupted export into the output archive")
+
+	sincep = flag.String("since", "", "`path` to the manifest of a previous export to only\n"+
+		"export votes added since")
+
+	keyp = flag.String("key", "", "`path` to the PEM-encoded RSA private key used to sign\n"+
+		"the export manifest (default voteexp.key in the sensitive\ndirectory of the service instance)")
+
+	nosignp = flag.Bool("nosign", false, "leave the export manifest unsigned")
+
 	qp = flag.Bool("q", false, "quiet, do not show progress")
 
 	progress *status.Line
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		os.Exit(verifymain(os.Args[2:]))
+	}
+
 	// Call voteexpmain in a separate function so that it can set up defers
 	// and have them trigger before returning with a non-zero exit code.
 	os.Exit(voteexpmain())
@@ -68,20 +106,122 @@ func voteexpmain() (code int) {
 		progress = status.New()
 	}
 
+	// Read the signing key unless explicitly requested not to sign.
+	key, err := signingKey(*keyp, conf.Sensitive(c.Service.ID), *nosignp)
+	switch {
+	case errors.CausedBy(err, new(SignFlagsConflictError)) != nil:
+		return c.Error(exit.Usage, SigningFlagsError{Err: err},
+			"-key and -nosign are mutually exclusive")
+	case err != nil:
+		return c.Error(exit.NoInput, SigningKeyError{Err: err},
+			"failed to read signing key, use -nosign to leave the manifest unsigned:", err)
+	case key == nil:
+		log.Log(c.Ctx, UnsignedManifest{})
+	}
+
+	// The previous export manifest must be signed with the same key, so
+	// that the votes it lists are not skipped based on a forged manifest.
+	var since *manifest
+	if *sincep != "" {
+		if key == nil {
+			return c.Error(exit.Usage, SinceUnsignedError{},
+				"-since requires the signing key to verify the previous export manifest")
+		}
+		if since, err = readManifest(*sincep, &key.PublicKey); err != nil {
+			return c.Error(exit.NoInput, SinceManifestError{Err: err},
+				"failed to read previous export manifest:", err)
+		}
+		if since.Election != c.Conf.Election.Identifier {
+			return c.Error(exit.DataErr, SinceElectionMismatchError{
+				Manifest: since.Election,
+				Election: c.Conf.Election.Identifier,
+			}, "previous export is for election", since.Election,
+				"but configured election is", c.Conf.Election.Identifier)
+		}
+	}
+
 	if c.Until < command.Execute {
 		return exit.OK
 	}
 	output := c.Args[0]
+	cppath := output + checkpointSuffix
 
-	// Create the output container file.
-	fp, err := os.OpenFile(output, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	// Open or create the output archive and checkpoint. The cutoff time
+	// of the export is taken once when the export is started, so that
+	// resuming does not change it.
+	var fp *os.File
+	var cp *checkpoint
+	var resumed []checkpointVote
+	var cutoff time.Time
+	if *resumep {
+		var header checkpointHeader
+		if cp, header, resumed, err = readCheckpoint(cppath); err != nil {
+			return c.Error(exit.NoInput, ReadCheckpointFileError{Err: err},
+				"failed to read checkpoint:", err)
+		}
+		if header.Election != c.Conf.Election.Identifier || header.Since != *sincep {
+			return c.Error(exit.Usage, CheckpointMismatchError{
+				Election: header.Election,
+				Since:    header.Since,
+			}, "checkpoint is for election", header.Election,
+				"with previous export manifest", fmt.Sprintf("%q", header.Since))
+		}
+		if fp, err = os.OpenFile(output, os.O_RDWR, 0); err != nil {
+			return c.Error(exit.NoInput, OpenOutputError{Output: output, Err: err},
+				"failed to open output archive:", err)
+		}
+		log.Log(c.Ctx, ResumingExport{Started: header.Started, Votes: len(resumed)})
+		cutoff = header.Started
+	} else {
+		cutoff = time.Now()
+		if fp, err = os.OpenFile(output, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600); err != nil {
+			return c.Error(exit.CantCreate, CreateOutputError{Output: output, Err: err},
+				"failed to create output archive:", err)
+		}
+		if cp, err = createCheckpoint(cppath, checkpointHeader{
+			Election: c.Conf.Election.Identifier,
+			Since:    *sincep,
+			Started:  cutoff,
+		}); err != nil {
+			fp.Close()
+			return c.Error(exit.CantCreate, CreateCheckpointFileError{Err: err},
+				"failed to create checkpoint, use -resume to continue an earlier export:", err)
+		}
+	}
+	defer cp.Close()
+
+	e, err := newExporter(fp, cp, resumed, cutoff)
 	if err != nil {
-		return c.Error(exit.CantCreate, CreateOutputError{Output: output, Err: err},
-			"failed to create output archive:", err)
+		fp.Close()
+		return c.Error(exit.DataErr, ResumeError{Err: err},
+			"failed to resume export:", err)
+	}
+	m := &manifest{
+		Election: c.Conf.Election.Identifier,
+		Exported: cutoff,
+	}
+	if m.VoterListVersion, err = c.Storage.GetVotersListVersion(c.Ctx); err != nil {
+		if errors.CausedBy(err, new(storage.NotExistError)) == nil {
+			fp.Close()
+			return c.Error(exit.Unavailable, VoterListVersionError{Err: err},
+				"failed to get voter list version:", err)
+		}
+	}
+	if e.cancelled, err = c.Storage.GetCancellationTimes(c.Ctx); err != nil {
+		fp.Close()
+		return c.Error(exit.Unavailable, CancellationsError{Err: err},
+			"failed to get vote cancellations:", err)
+	}
+	if since != nil {
+		m.Since = &since.Exported
+		m.PreviousVoteIDs = since.exportedVoteIDs()
+		for _, id := range m.PreviousVoteIDs {
+			e.skip[id] = struct{}{}
+		}
 	}
 
-	// Export the votes into the opened file descriptor.
-	err = export(c.Ctx, c.Storage, qps, opt, fp)
+	// Export the votes into the opened file.
+	err = e.export(c.Ctx, c.Storage, qps, opt)
 	cerr := fp.Close()
 
 	if errors.CausedBy(err, new(NonFatalError)) != nil {
@@ -92,126 +232,38 @@ func voteexpmain() (code int) {
 	}
 	if err != nil {
 		return c.Error(exit.Unavailable, ExportVotesError{Err: err},
-			"failed to export votes:", err)
+			"failed to export votes, use -resume to continue:", err)
 	}
 	if cerr != nil {
-		return c.Error(exit.IOErr, CloseOutputError{Err: err},
-			"failed to close output file:", err)
+		return c.Error(exit.IOErr, CloseOutputError{Err: cerr},
+			"failed to close output file:", cerr)
 	}
 
-	return
-}
-
-// export reads the votes and related metadata from the storage service and
-// puts them in a ZIP archive at fp.
-func export(ctx context.Context, s *storage.Client, qps []q11n.Protocol,
-	optional []string, fp io.Writer) (err error) {
-
-	// Check if the context is canceled before the expensive GetVotes
-	// operation.
-	select {
-	case <-ctx.Done():
-		return ExportCanceled{Err: ctx.Err()}
-	default:
+	m.VoteList = e.votes
+	m.Cancelled = e.cancelledIDs
+	m.count(qps)
+	if err = writeManifest(output+manifestSuffix, m, key); err != nil {
+		return c.Error(exit.IOErr, WriteManifestFileError{Err: err},
+			"failed to write export manifest:", err)
 	}
-
-	// Wrap the file writer into a zip archive writer.
-	w := zip.NewWriter(fp)
-	defer func() {
-		if cerr := w.Close(); cerr != nil && err == nil {
-			err = CloseZIPArchiveError{Err: err}
-		}
-	}()
-
-	// Start exporting votes from the storage service.
-	log.Log(ctx, ExportingVotes{})
-	progress.Static("Exporting votes:")
-	addprogress := progress.Count(0, true)
-	progress.Redraw()
-	defer progress.Keep()
-
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel() // Stop GetVotes if we terminate early.
-	c, errc := s.GetVotes(ctx, qps, optional)
-
-	// Start a goroutine which reads and logs errors parallel to this one.
-	// It either sends nil on lerrc if everything went fine, NonFatalError,
-	// if non-fatal errors occurred, or a fatal error from GetVotes.
-	gerrc := make(chan error, 1)
-	go func() {
-		var gerr log.ErrorEntry
-		for err := range errc {
-			gerr = GetVotesError{Err: err}
-			if errors.CausedBy(err, new(storage.GetVotesFatalError)) != nil {
-				break
-			}
-
-			gerr = NonFatalError{Err: gerr}
-			log.Error(ctx, gerr)
-			progress.Hide()
-			fmt.Fprintln(os.Stderr, "error: non-fatal error:", gerr)
-			progress.Show()
-		}
-		gerrc <- gerr
-	}()
-	defer func() {
-		if gerr := <-gerrc; err == nil {
-			err = gerr
-		}
-	}()
-
-	// Add the entries to the ZIP archive in the following hierarchy:
-	//
-	//     votes/
-	//     └ <voter id>/
-	//       ├ <timestamp>.version
-	//       ├ <timestamp>.<vote type>
-	//       └ <timestamp>.<q11n protocol>*
-	//
-	var count uint64
-	countlog := VoteExportProgress{Current: 0}
-	const logstep = 10000 // Log progress after each logstep.
-	for vote := range c {
-		prefix := fmt.Sprintf("votes/%s/%s.", vote.Voter,
-			strings.ReplaceAll(vote.Time.Format("20060102150405.000-0700"), ".", ""))
-
-		if err = addFile(w, vote.Time, prefix+"version", []byte(vote.Version)); err != nil {
-			return AddVersionError{VoteID: vote.VoteID, Prefix: prefix, Err: err}
-		}
-		if err = addFile(w, vote.Time, prefix+string(vote.VoteType), vote.Vote); err != nil {
-			return AddVoteError{VoteID: vote.VoteID, Prefix: prefix, Err: err}
-		}
-		for p, b := range vote.Qualification {
-			if err = addFile(w, vote.Time, prefix+string(p), b); err != nil {
-				return AddQualifyingPropertyError{
-					VoteID:   vote.VoteID,
-					Prefix:   prefix,
-					Protocol: p,
-					Err:      err,
-				}
-			}
-		}
-
-		if count = addprogress(1); count%logstep == 0 {
-			countlog.Current = count
-			log.Log(ctx, countlog)
-		}
+	if err = os.Remove(cppath); err != nil {
+		return c.Error(exit.IOErr, RemoveCheckpointError{Err: err},
+			"failed to remove checkpoint:", err)
 	}
-	log.Log(ctx, VoteCount{Count: count})
+
 	return
 }
 
-func addFile(w *zip.Writer, mod time.Time, name string, value []byte) error {
-	f, err := w.CreateHeader(&zip.FileHeader{
-		Name:     name,
-		Method:   zip.Deflate,
-		Modified: mod,
-	})
-	if err != nil {
-		return AddFileCreateError{Name: name, Err: err}
-	}
-	if _, err := f.Write(value); err != nil {
-		return AddFileWriteError{Name: name, Err: err}
+// signingKey reads the manifest signing key from path or, if path is empty,
+// the default key from the sensitive directory. Returns nil if nosign is set.
+func signingKey(path, sensitive string, nosign bool) (*rsa.PrivateKey, error) {
+	switch {
+	case nosign && path != "":
+		return nil, SignFlagsConflictError{}
+	case nosign:
+		return nil, nil
+	case path == "":
+		path = filepath.Join(sensitive, "voteexp.key")
 	}
-	return nil
+	return archivesig.ReadKey(path)
 }
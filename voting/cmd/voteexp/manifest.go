@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/q11n"
+)
+
+// Suffixes appended to the output archive path to get the paths of the export
+// manifest and its signature.
+const (
+	manifestSuffix  = ".manifest.json"
+	signatureSuffix = ".manifest.sig"
+)
+
+// manifest describes an exported archive. It is written next to the archive
+// after a successful export and used for verifying the archive and as the
+// base for incremental exports.
+//
+// The manifest is signed with a PKCS #1 v1.5 RSA signature of the SHA-256 hash
+// of the encoded manifest, which is stored next to it.
+type manifest struct {
+	Election string // Election identifier.
+
+	// Exported is the cutoff time of the export, taken when it was
+	// started: the archive contains the votes stored before it.
+	Exported time.Time
+
+	// VoterListVersion is the version of the voter list which was current
+	// at the time of the export. Empty if no voter list was loaded.
+	VoterListVersion string
+
+	// Since is the export time of the previous export if this is an
+	// incremental export.
+	Since *time.Time `json:",omitempty"`
+
+	// Votes is the number of votes in the archive.
+	Votes int
+
+	// Qualification is the number of votes in the archive with each
+	// qualifying property.
+	Qualification map[q11n.Protocol]int
+
+	// VoteList lists the votes in the archive.
+	VoteList []manifestVote
+
+	// PreviousVoteIDs are the hex-encoded identifiers of votes exported
+	// by all previous exports that this incremental export builds on.
+	// These are not included in the archive.
+	PreviousVoteIDs []string `json:",omitempty"`
+
+	// Cancelled are the hex-encoded identifiers of votes which were not
+	// exported, because they were cancelled, e.g., due to the voter voting
+	// on paper. This includes votes exported by previous exports which
+	// have been cancelled since.
+	Cancelled []string `json:",omitempty"`
+}
+
+// manifestVote lists the files of a single vote in the archive.
+type manifestVote struct {
+	VoteID string // Hex-encoded vote identifier.
+
+	// Prefix is the common prefix of the names of the vote's files.
+	Prefix string
+
+	// Files maps the suffix of the file name after Prefix, i.e., "version",
+	// the vote type, or a qualifying property protocol, to the SHA-256
+	// digest of the file contents.
+	Files map[string][]byte
+}
+
+// manifest returns the manifest entry for the checkpointed vote.
+func (v checkpointVote) manifest() manifestVote {
+	mv := manifestVote{
+		VoteID: v.VoteID,
+		Prefix: v.Prefix,
+		Files:  make(map[string][]byte, len(v.Entries)),
+	}
+	for _, entry := range v.Entries {
+		mv.Files[strings.TrimPrefix(entry.Name, v.Prefix)] = entry.SHA256
+	}
+	return mv
+}
+
+// count sets the number of votes and the number of votes with each qualifying
+// property in qps.
+func (m *manifest) count(qps []q11n.Protocol) {
+	m.Votes = len(m.VoteList)
+	m.Qualification = make(map[q11n.Protocol]int, len(qps))
+	for _, qp := range qps {
+		m.Qualification[qp] = 0
+		for _, vote := range m.VoteList {
+			if _, ok := vote.Files[string(qp)]; ok {
+				m.Qualification[qp]++
+			}
+		}
+	}
+}
+
+// exportedVoteIDs returns the identifiers of all votes exported by m and
+// the exports it builds on.
+func (m *manifest) exportedVoteIDs() []string {
+	ids := make([]string, 0, len(m.PreviousVoteIDs)+len(m.VoteList))
+	ids = append(ids, m.PreviousVoteIDs...)
+	for _, vote := range m.VoteList {
+		ids = append(ids, vote.VoteID)
+	}
+	return ids
+}
+
+// signaturePath returns the path of the signature of the manifest at path.
+func signaturePath(path string) string {
+	return strings.TrimSuffix(path, manifestSuffix) + signatureSuffix
+}
+
+// readManifest reads an export manifest from path and verifies its signature
+// with pub.
+func readManifest(path string, pub *rsa.PublicKey) (*manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, ReadManifestError{Path: path, Err: err}
+	}
+	signature, err := os.ReadFile(signaturePath(path))
+	if err != nil {
+		return nil, ReadManifestSignatureError{Path: path, Err: err}
+	}
+	if err = archivesig.Verify(pub, data, signature); err != nil {
+		return nil, VerifyManifestSignatureError{Path: path, Err: err}
+	}
+	m := new(manifest)
+	if err = json.Unmarshal(data, m); err != nil {
+		return nil, DecodeManifestError{Path: path, Err: err}
+	}
+	return m, nil
+}
+
+// writeManifest writes m to path, overwriting any existing file. If key is not
+// nil, then the manifest is also signed with it.
+func writeManifest(path string, m *manifest, key *rsa.PrivateKey) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return EncodeManifestError{Err: err}
+	}
+	if err = writeFile(path, data); err != nil {
+		return WriteManifestError{Err: err}
+	}
+	if key == nil {
+		return nil
+	}
+
+	signature, err := archivesig.Sign(key, data)
+	if err != nil {
+		return SignManifestError{Err: err}
+	}
+	if err = writeFile(signaturePath(path), signature); err != nil {
+		return WriteManifestSignatureError{Err: err}
+	}
+	return nil
+}
+
+// writeFile writes data to path, overwriting any existing file.
+func writeFile(path string, data []byte) (err error) {
+	fp, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return CreateFileError{Path: path, Err: err}
+	}
+	defer func() {
+		if cerr := fp.Close(); cerr != nil && err == nil {
+			err = CloseFileError{Path: path, Err: cerr}
+		}
+	}()
+	if _, err = fp.Write(data); err != nil {
+		return WriteFileError{Path: path, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/errors"
+	"ivxv.ee/common/collector/q11n"
+)
+
+// writeTestKey generates an RSA key with a self-signed certificate and writes
+// them PEM-encoded into dir. Returns the key and the paths of the files.
+func writeTestKey(t *testing.T, dir string) (key *rsa.PrivateKey, keypath, certpath string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("failed to generate key:", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "voteexp"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal("failed to create certificate:", err)
+	}
+
+	keypath = filepath.Join(dir, "voteexp.key")
+	certpath = filepath.Join(dir, "voteexp.pem")
+	for path, block := range map[string]*pem.Block{
+		keypath:  {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		certpath: {Type: "CERTIFICATE", Bytes: der},
+	} {
+		if err = os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			t.Fatal("failed to write PEM file:", err)
+		}
+	}
+	return
+}
+
+func TestManifestSignature(t *testing.T) {
+	dir := t.TempDir()
+	_, keypath, certpath := writeTestKey(t, dir)
+	key, err := archivesig.ReadKey(keypath)
+	if err != nil {
+		t.Fatal("failed to read key:", err)
+	}
+	pub, err := archivesig.ReadCertificate(certpath)
+	if err != nil {
+		t.Fatal("failed to read certificate:", err)
+	}
+	other, _, _ := writeTestKey(t, t.TempDir())
+
+	m := &manifest{
+		Election: "TESTELECTION",
+		Exported: time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		VoteList: []manifestVote{{
+			VoteID: "0a",
+			Prefix: "votes/38001085718/20260301120000000+0000.",
+			Files:  map[string][]byte{"version": {1}, "bdoc": {2}, "tspreg": {3}},
+		}},
+	}
+	m.count([]q11n.Protocol{q11n.TSPREG})
+
+	path := filepath.Join(dir, "votes.zip"+manifestSuffix)
+	if err = writeManifest(path, m, key); err != nil {
+		t.Fatal("failed to write manifest:", err)
+	}
+	read, err := readManifest(path, pub)
+	if err != nil {
+		t.Fatal("failed to read signed manifest:", err)
+	}
+	if read.Election != m.Election || !read.Exported.Equal(m.Exported) ||
+		read.Votes != 1 || read.Qualification[q11n.TSPREG] != 1 {
+		t.Errorf("unexpected manifest: %+v", read)
+	}
+
+	// A manifest signed with another key is rejected.
+	otherpath := filepath.Join(dir, "other.zip"+manifestSuffix)
+	if err = writeManifest(otherpath, m, other); err != nil {
+		t.Fatal("failed to write manifest:", err)
+	}
+	if _, err = readManifest(otherpath, pub); errors.CausedBy(err,
+		new(VerifyManifestSignatureError)) == nil {
+
+		t.Errorf("unexpected error with other key: %v", err)
+	}
+
+	// A modified manifest is rejected.
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal("failed to read manifest:", err)
+	}
+	data[len(data)-2] = ' '
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal("failed to modify manifest:", err)
+	}
+	if _, err = readManifest(path, pub); errors.CausedBy(err,
+		new(VerifyManifestSignatureError)) == nil {
+
+		t.Errorf("unexpected error with modified manifest: %v", err)
+	}
+
+	// An unsigned manifest is rejected.
+	unsigned := filepath.Join(dir, "unsigned.zip"+manifestSuffix)
+	if err = writeManifest(unsigned, m, nil); err != nil {
+		t.Fatal("failed to write unsigned manifest:", err)
+	}
+	if _, err = readManifest(unsigned, pub); errors.CausedBy(err,
+		new(ReadManifestSignatureError)) == nil {
+
+		t.Errorf("unexpected error with unsigned manifest: %v", err)
+	}
+}
+
+func TestSigningKey(t *testing.T) {
+	dir := t.TempDir()
+	key, keypath, _ := writeTestKey(t, dir)
+	empty := t.TempDir()
+
+	for _, test := range []struct {
+		name      string
+		path      string
+		sensitive string
+		nosign    bool
+		signed    bool
+		err       error
+	}{
+		{"default key", "", dir, false, true, nil},
+		{"explicit key", keypath, empty, false, true, nil},
+		{"missing default key", "", empty, false, false, new(archivesig.ReadKeyError)},
+		{"missing explicit key", filepath.Join(empty, "voteexp.key"), dir, false, false,
+			new(archivesig.ReadKeyError)},
+		{"nosign", "", dir, true, false, nil},
+		{"nosign with key", keypath, dir, true, false, new(SignFlagsConflictError)},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			read, err := signingKey(test.path, test.sensitive, test.nosign)
+			switch {
+			case test.err == nil && err != nil:
+				t.Fatal("unexpected error:", err)
+			case test.err != nil && errors.CausedBy(err, test.err) == nil:
+				t.Fatalf("unexpected error: %v, want %T", err, test.err)
+			}
+			if signed := read != nil; signed != test.signed {
+				t.Errorf("unexpected key: %v", read)
+			}
+			if read != nil && !read.Equal(key) {
+				t.Error("read a different key")
+			}
+		})
+	}
+}
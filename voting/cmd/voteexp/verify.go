@@ -0,0 +1,283 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"ivxv.ee/common/collector/archivesig"
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/command/status"
+	"ivxv.ee/common/collector/q11n"
+)
+
+const verifyUsage = `-cert <path> [options] <archive> <manifest>...
+
+verify checks that an archive contains exactly the votes listed in the given
+export manifests. The archive can be a single export or the union of several
+exports made using voteunion.
+
+Every file of every vote in the manifests must be present in the archive with
+the listed digest and the archive must not contain any other files. Vote
+identifiers which are listed with differing contents, i.e., which would end up
+in the archive more than once, are reported as duplicated and vote identifiers
+with files missing from the archive are reported as dropped. Votes which are
+listed in one manifest, but cancelled in another, are reported as cancelled.
+
+The signature of each manifest is verified with the certificate given with
+the cert flag.
+
+options:`
+
+// expectedFile is a file that is expected to be in the verified archive.
+type expectedFile struct {
+	voteID string
+	sha256 []byte
+	found  bool
+}
+
+// verifier collects the expected contents of an archive from manifests and
+// checks the archive against them.
+type verifier struct {
+	votes  map[string]manifestVote  // Vote identifier to vote.
+	files  map[string]*expectedFile // File name to expected file.
+	counts map[q11n.Protocol]int    // Votes with each qualifying property.
+
+	// cancelled maps cancelled vote identifiers to the manifest listing
+	// them as cancelled.
+	cancelled map[string]string
+
+	problems []string
+}
+
+func verifymain(args []string) int {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	certp := fs.String("cert", "", "`path` to the PEM-encoded certificate used to verify the\n"+
+		"manifest signatures (required)")
+	quietp := fs.Bool("q", false, "quiet, do not show progress")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage:", os.Args[0], "verify", verifyUsage)
+		fs.PrintDefaults()
+	}
+	//nolint:errcheck // Exits on error.
+	fs.Parse(args)
+	if fs.NArg() < 2 || *certp == "" {
+		fs.Usage()
+		return exit.Usage
+	}
+
+	pub, err := archivesig.ReadCertificate(*certp)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: failed to read certificate:", err)
+		return exit.NoInput
+	}
+	if !*quietp {
+		progress = status.New()
+	}
+
+	v := &verifier{
+		votes:     make(map[string]manifestVote),
+		files:     make(map[string]*expectedFile),
+		counts:    make(map[q11n.Protocol]int),
+		cancelled: make(map[string]string),
+	}
+	var election string
+	for _, path := range fs.Args()[1:] {
+		m, err := readManifest(path, pub)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error: failed to read manifest:", err)
+			return exit.DataErr
+		}
+		if election == "" {
+			election = m.Election
+		} else if m.Election != election {
+			fmt.Fprintf(os.Stderr, "error: manifest %q is for election %q, expected %q\n",
+				path, m.Election, election)
+			return exit.DataErr
+		}
+		v.addManifest(path, m)
+	}
+	v.cancelledExported()
+
+	if err = v.verify(fs.Arg(0)); err != nil {
+		fmt.Fprintln(os.Stderr, "error: failed to verify archive:", err)
+		return exit.DataErr
+	}
+	v.dropped()
+
+	fmt.Println("Election:", election)
+	fmt.Println("Votes:", len(v.votes))
+	qps := make([]string, 0, len(v.counts))
+	for qp := range v.counts {
+		qps = append(qps, string(qp))
+	}
+	sort.Strings(qps)
+	for _, qp := range qps {
+		fmt.Printf("Votes with %s: %d\n", qp, v.counts[q11n.Protocol(qp)])
+	}
+	for _, p := range v.problems {
+		fmt.Println("problem:", p)
+	}
+	if len(v.problems) > 0 {
+		fmt.Println("Problems:", len(v.problems))
+		return exit.DataErr
+	}
+	fmt.Println("OK")
+	return exit.OK
+}
+
+func (v *verifier) problem(format string, a ...interface{}) {
+	v.problems = append(v.problems, fmt.Sprintf(format, a...))
+}
+
+// addManifest adds the votes listed in m, read from path, to the expected
+// contents of the archive.
+func (v *verifier) addManifest(path string, m *manifest) {
+	// Check that the counts in the manifest match the listed votes.
+	qps := make([]q11n.Protocol, 0, len(m.Qualification))
+	for qp := range m.Qualification {
+		qps = append(qps, qp)
+	}
+	counted := manifest{VoteList: m.VoteList}
+	counted.count(qps)
+	if counted.Votes != m.Votes {
+		v.problem("manifest %q lists %d votes, but has count %d",
+			path, counted.Votes, m.Votes)
+	}
+	for _, qp := range qps {
+		v.counts[qp] += 0 // Report protocols without any votes.
+		if counted.Qualification[qp] != m.Qualification[qp] {
+			v.problem("manifest %q lists %d votes with %s, but has count %d",
+				path, counted.Qualification[qp], qp, m.Qualification[qp])
+		}
+	}
+
+	for _, id := range m.Cancelled {
+		v.cancelled[id] = path
+	}
+
+	for _, vote := range m.VoteList {
+		if existing, ok := v.votes[vote.VoteID]; ok {
+			// The same vote in several exports is expected after
+			// voteunion, but only if it is exported identically.
+			if !sameVote(existing, vote) {
+				v.problem("vote %s is duplicated: exported as both %q and %q",
+					vote.VoteID, existing.Prefix, vote.Prefix)
+			}
+			continue
+		}
+		v.votes[vote.VoteID] = vote
+		for _, qp := range qps {
+			if _, ok := vote.Files[string(qp)]; ok {
+				v.counts[qp]++
+			}
+		}
+
+		for kind, sum := range vote.Files {
+			name := vote.Prefix + kind
+			if f, ok := v.files[name]; ok {
+				v.problem("file %q is listed for both vote %s and vote %s",
+					name, f.voteID, vote.VoteID)
+				continue
+			}
+			v.files[name] = &expectedFile{voteID: vote.VoteID, sha256: sum}
+		}
+	}
+}
+
+// sameVote reports if a and b list the same files with the same contents.
+func sameVote(a, b manifestVote) bool {
+	if a.Prefix != b.Prefix || len(a.Files) != len(b.Files) {
+		return false
+	}
+	for kind, sum := range a.Files {
+		if !bytes.Equal(sum, b.Files[kind]) {
+			return false
+		}
+	}
+	return true
+}
+
+// verify checks the files in the archive at path against the expected files.
+func (v *verifier) verify(path string) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer r.Close()
+
+	progress.Static("Verifying archive:")
+	addcount := progress.Count(uint64(len(r.File)), true)
+	progress.Redraw()
+	defer progress.Keep()
+
+	hash := sha256.New()
+	for _, zf := range r.File {
+		addcount(1)
+		f, ok := v.files[zf.Name]
+		switch {
+		case !ok:
+			v.problem("file %q is not listed in any manifest", zf.Name)
+			continue
+		case f.found:
+			v.problem("file %q is in the archive more than once", zf.Name)
+			continue
+		}
+		f.found = true
+
+		rc, err := zf.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open file %q: %v", zf.Name, err)
+		}
+		hash.Reset()
+		//nolint:gosec // Only used on trusted Zip archives.
+		_, err = io.Copy(hash, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read file %q: %v", zf.Name, err)
+		}
+		if !bytes.Equal(hash.Sum(nil), f.sha256) {
+			v.problem("file %q of vote %s has a digest mismatch", zf.Name, f.voteID)
+		}
+	}
+	return nil
+}
+
+// cancelledExported reports votes which are listed as cancelled, but still
+// expected in the archive.
+func (v *verifier) cancelledExported() {
+	ids := make([]string, 0, len(v.cancelled))
+	for id := range v.cancelled {
+		if _, ok := v.votes[id]; ok {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		v.problem("vote %s is exported, but cancelled by manifest %q", id, v.cancelled[id])
+	}
+}
+
+// dropped reports votes with files missing from the archive.
+func (v *verifier) dropped() {
+	missing := make(map[string][]string)
+	for name, f := range v.files {
+		if !f.found {
+			missing[f.voteID] = append(missing[f.voteID], name)
+		}
+	}
+	ids := make([]string, 0, len(missing))
+	for id := range missing {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		sort.Strings(missing[id])
+		v.problem("vote %s is dropped: missing %q", id, missing[id])
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"ivxv.ee/common/collector/command/exit"
+	"ivxv.ee/common/collector/q11n"
+)
+
+// writeTestArchive writes an archive with files to path and returns a
+// manifest listing them as a single vote with prefix.
+func writeTestArchive(t *testing.T, path, voteID, prefix string, files map[string]string) *manifest {
+	t.Helper()
+	fp, err := os.Create(path)
+	if err != nil {
+		t.Fatal("failed to create archive:", err)
+	}
+	defer fp.Close()
+
+	kinds := make([]string, 0, len(files))
+	for kind := range files {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+
+	w := zip.NewWriter(fp)
+	vote := manifestVote{VoteID: voteID, Prefix: prefix, Files: make(map[string][]byte)}
+	for _, kind := range kinds {
+		f, err := w.Create(prefix + kind)
+		if err != nil {
+			t.Fatal("failed to create archive entry:", err)
+		}
+		if _, err = f.Write([]byte(files[kind])); err != nil {
+			t.Fatal("failed to write archive entry:", err)
+		}
+		sum := sha256.Sum256([]byte(files[kind]))
+		vote.Files[kind] = sum[:]
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal("failed to close archive:", err)
+	}
+
+	m := &manifest{
+		Election: "TESTELECTION",
+		Exported: time.Now(),
+		VoteList: []manifestVote{vote},
+	}
+	m.count([]q11n.Protocol{q11n.TSPREG})
+	return m
+}
+
+func TestVerify(t *testing.T) {
+	dir := t.TempDir()
+	key, _, certpath := writeTestKey(t, dir)
+	other, _, _ := writeTestKey(t, t.TempDir())
+
+	files := map[string]string{"version": "1", "bdoc": "vote", "tspreg": "registration"}
+	archive := filepath.Join(dir, "votes.zip")
+	m := writeTestArchive(t, archive, "0a", "votes/38001085718/20260301120000000+0000.", files)
+	manifestpath := archive + manifestSuffix
+	if err := writeManifest(manifestpath, m, key); err != nil {
+		t.Fatal("failed to write manifest:", err)
+	}
+
+	// An archive with a modified file.
+	modified := filepath.Join(dir, "modified.zip")
+	files["bdoc"] = "other vote"
+	writeTestArchive(t, modified, "0a", "votes/38001085718/20260301120000000+0000.", files)
+
+	// A manifest signed with another key.
+	otherpath := filepath.Join(dir, "other.zip"+manifestSuffix)
+	if err := writeManifest(otherpath, m, other); err != nil {
+		t.Fatal("failed to write manifest:", err)
+	}
+
+	for _, test := range []struct {
+		name string
+		args []string
+		code int
+	}{
+		{"ok", []string{"-q", "-cert", certpath, archive, manifestpath}, exit.OK},
+		{"modified", []string{"-q", "-cert", certpath, modified, manifestpath}, exit.DataErr},
+		{"other key", []string{"-q", "-cert", certpath, archive, otherpath}, exit.DataErr},
+		{"no cert", []string{"-q", archive, manifestpath}, exit.Usage},
+		{"no manifest", []string{"-q", "-cert", certpath, archive}, exit.Usage},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if code := verifymain(test.args); code != test.code {
+				t.Errorf("unexpected exit code: %d, want %d", code, test.code)
+			}
+		})
+	}
+}
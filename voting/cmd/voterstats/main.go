@@ -31,7 +31,9 @@ voters (the default) and a detailed per county count of voters per day.
 
 The statistics only contain voters that have cast a complete vote. This might
 be less than the number of votes exported using voteexp, because the latter
-exports some partial votes needed by the processing application.`
+exports some partial votes needed by the processing application.
+
+Voters whose latest vote was cancelled using cancelimp are not counted.`
 
 var (
 	detailedp = flag.Bool("detailed", false, "export detailed statistics")
@@ -138,13 +140,19 @@ func voterstatsmain() (code int) {
 		}
 	}()
 
+	cancelled, err := cancelledVoters(c.Ctx, c.Storage)
+	if err != nil {
+		return c.Error(exit.Unavailable, CancelledVotersError{Err: err},
+			"failed to get voters with cancelled votes:", err)
+	}
+
 	var stats interface{}
 	if *detailedp {
 		periods := cumulativePeriodsNotAfter(start, time.Now(), stop, loc)
 		stats, err = statsDetailed(c.Ctx, c.Conf.Election.Identifier,
-			dists, periods, c.Storage, loc)
+			dists, periods, c.Storage, cancelled, loc)
 	} else {
-		stats, err = statsTotal(c.Ctx, c.Conf.Election.Identifier, c.Storage)
+		stats, err = statsTotal(c.Ctx, c.Conf.Election.Identifier, c.Storage, cancelled)
 	}
 	if err != nil {
 		return c.Error(exit.Unavailable, ExportStatisticsError{Err: err},
@@ -163,6 +171,29 @@ func voterstatsmain() (code int) {
 	return
 }
 
+// cancelledVoters returns the set of voters whose latest vote was cancelled.
+// Voters who have voted again after the cancellation are not included.
+func cancelledVoters(ctx context.Context, s *storage.Client) (map[string]struct{}, error) {
+	times, err := s.GetCancellationTimes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	cancelled := make(map[string]struct{})
+	for voter, ctime := range times {
+		latest, err := s.GetLatestVoteTime(ctx, voter)
+		switch {
+		case errors.CausedBy(err, new(storage.NotExistError)) != nil:
+			continue // Cancelled voter has not voted electronically.
+		case err != nil:
+			return nil, err
+		case storage.Cancelled(ctime, latest):
+			cancelled[voter] = struct{}{}
+		}
+	}
+	log.Log(ctx, CancelledVoters{Count: len(cancelled)})
+	return cancelled, nil
+}
+
 type votersTotal struct {
 	Total votersTotalInner `json:"TOTAL"`
 }
@@ -173,7 +204,9 @@ type votersTotalInner struct {
 	Voted    uint64 `json:"online-voters"`
 }
 
-func statsTotal(ctx context.Context, election string, s *storage.Client) (*votersTotal, error) {
+func statsTotal(ctx context.Context, election string, s *storage.Client,
+	cancelled map[string]struct{}) (*votersTotal, error) {
+
 	log.Log(ctx, ExportingTotalStatistics{})
 	progress.Static("Exporting total statistics:")
 	addprogress := progress.Count(0, true)
@@ -182,7 +215,10 @@ func statsTotal(ctx context.Context, election string, s *storage.Client) (*voter
 
 	var voted uint64
 	statsc, errc := s.GetVotedStats(ctx)
-	for range statsc {
+	for stats := range statsc {
+		if _, ok := cancelled[stats.Voter]; ok {
+			continue
+		}
 		voted++
 		addprogress(1)
 	}
@@ -215,7 +251,8 @@ type votersDetailedPeriod struct {
 }
 
 func statsDetailed(ctx context.Context, election string,
-	dists *districtlist, periods []period, s *storage.Client, loc *time.Location) (
+	dists *districtlist, periods []period, s *storage.Client,
+	cancelled map[string]struct{}, loc *time.Location) (
 	*votersDetailed, error) {
 
 	log.Log(ctx, ExportingDetailedStatistics{})
@@ -240,6 +277,9 @@ func statsDetailed(ctx context.Context, election string,
 	// Get successful voter stats from storage and add to map.
 	statsc, errc := s.GetVotedStats(ctx)
 	for stats := range statsc {
+		if _, ok := cancelled[stats.Voter]; ok {
+			continue
+		}
 		labels := findPeriodLabels(periods, stats.Time)
 		if len(labels) == 0 {
 			nonfatal(ctx, TimeOutsideStatsPeriodError{
@@ -39,10 +39,10 @@ func NewClient(c *command.C) (client.Verifier, int) {
 		return nil, errCode
 	}
 
-	return &RPC{
+	return status.Traced(&RPC{
 		client:    tlsDialer,
 		verifyTTL: c.Conf.Technical.Status.Session.VerifyTTL,
-	}, exitCodeOK
+	}), exitCodeOK
 }
 
 func (r *RPC) Verify(dto interface{}) (bool, error) {
@@ -179,8 +179,12 @@ func voteHandler(r *api.StatusReadResp) (bool, error) {
 	// has previously interacted with IVXV using RPC.RPCVoterChoices method
 	widAuth := r.Caller == VoterChoices && r.Auth == client.WebeIDAuth
 
+	// When authenticating with WebAuthn, then IVXV requires that client
+	// has previously interacted with IVXV using RPC.VoterChoices method
+	waAuth := r.Caller == VoterChoices && r.Auth == client.WebAuthnAuth
+
 	// All conditions must satisfy simultaneously!
-	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) {
+	if !(idCardAuth) && !(midAuth) && !(sidAuth) && !(widAuth) && !(waAuth) {
 		return false, VoteInvalidCallerOrAuthForSessionID{
 			Method: Vote,
 			Caller: r.Caller,
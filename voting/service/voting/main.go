@@ -24,10 +24,13 @@ import (
 	"ivxv.ee/common/collector/identity"
 	"ivxv.ee/common/collector/log"
 	"ivxv.ee/common/collector/q11n"
+	"ivxv.ee/common/collector/ratelimit"
 	"ivxv.ee/common/collector/server"
 	"ivxv.ee/common/collector/status/client"
 	status "ivxv.ee/common/collector/status/client/rpc"
 	"ivxv.ee/common/collector/storage"
+	"ivxv.ee/common/collector/trace"
+	"ivxv.ee/common/collector/verifyticket"
 	internal "ivxv.ee/voting/internal/sessionstatus/rpc"
 	//ivxv:modules common/collector/auth
 	//ivxv:modules common/collector/container
@@ -53,11 +56,17 @@ type RPC struct {
 	identify  identity.Identifier
 	q11n      q11n.Qualifiers
 	storage   *storage.Client
+	policies  ratelimit.Policies
+	vtickets  *verifyticket.T // Issuer of verification tickets, nil if disabled.
 
 	// Election start time: all votes registered before this are test
 	// votes and are not counted.
 	start time.Time
 
+	// Verification stop time: verification tickets expire at the latest
+	// at this time.
+	verificationStop time.Time
+
 	skipEligible bool   // Should we skip checking voter eligibility?
 	foreignCode  string // Administrative unit code for foreign voters.
 }
@@ -68,6 +77,16 @@ type Args struct {
 	Choices string         `size:"10"` // Identifier of the choice list used.
 	Type    container.Type `size:"10"` // The type of container that the ballot is encapsulated in.
 	Vote    []byte         // The signed container of the ballot. Size is limited by codec filter.
+
+	// Questions are the identifiers of the choice lists used for each
+	// question. Required for multi-question elections.
+	Questions []QuestionChoices `json:",omitempty"`
+}
+
+// QuestionChoices is the identifier of the choice list used for a question.
+type QuestionChoices struct {
+	Question string
+	Choices  string
 }
 
 // Response is the response returned by RPC.Vote.
@@ -76,15 +95,20 @@ type Response struct {
 	VoteID        []byte          // Generated vote identifier.
 	Qualification q11n.Properties // Qualifying properties for the vote.
 	TestVote      bool            `json:",omitempty"` // Is this a test vote?
+
+	// VerificationTicket is the collector-issued ticket for verifying the
+	// vote, if verification tickets are enabled.
+	VerificationTicket []byte `json:",omitempty"`
 }
 
 // Vote is the remote procedure call performed by clients to submit votes to
 // the collector.
 func (r *RPC) Vote(args Args, resp *Response) error {
 	log.Log(args.Ctx, VoteReq{
-		Choices: args.Choices,
-		Type:    args.Type,
-		Vote:    log.Sensitive(args.Vote),
+		Choices:   args.Choices,
+		Questions: args.Questions,
+		Type:      args.Type,
+		Vote:      log.Sensitive(args.Vote),
 	})
 
 	// Get the voter identifier. If empty, then the request is not
@@ -121,25 +145,17 @@ func (r *RPC) Vote(args Args, resp *Response) error {
 		}
 	}
 
-	// Verify the vote container and get the signer.
-	votec, signer, voterName, version, err := r.verify(args.Ctx, args.Choices, args.Type, args.Vote)
+	// Verify the vote container and get the signer, applying rate limiting
+	// policies.
+	votec, signer, voterName, version, err := r.admit(args.Ctx, auther, args, submitted)
 	if votec != nil {
 		defer votec.Close()
 	}
 	if err != nil {
-		// Errors have already been logged by verify.
+		// Errors have already been logged by admit.
 		return err
 	}
 
-	// Check that the submitter matches the signer.
-	if auther != signer {
-		log.Error(args.Ctx, AuthenticatedSignerMismatchError{
-			Authenticated: auther,
-			Signer:        signer,
-		})
-		return server.ErrIdentityMismatch
-	}
-
 	// Check if an authentication token has already specified the vote
 	// identifier. If not, generate one.
 	resp.VoteID = server.VoteIdentifier(args.Ctx)
@@ -183,32 +199,18 @@ func (r *RPC) Vote(args Args, resp *Response) error {
 	transaction.AutoCommit(args.Ctx, txnOp)
 	log.Debug(args.Ctx, VoteTxnSetAutoCommitToOn{VoteID: resp.VoteID})
 
-	for _, q := range r.q11n {
-		log.Log(args.Ctx, RequestingQualifyingProperty{Protocol: q.Protocol})
-		prop, err := q.Qualifier.Qualify(args.Ctx, votec)
-		if err != nil {
-			if errors.CausedBy(err, new(q11n.BadCertificateStatusError)) != nil {
-				log.Error(args.Ctx, BadSignerCertificateError{Err: err})
-				return server.ErrCertificate
-			}
-			log.Error(args.Ctx, QualifierError{
-				Protocol: q.Protocol,
-				Err:      log.Alert(err),
-			})
-			return server.ErrInternal
-		}
-
+	err = r.q11n.Run(args.Ctx, votec, func(protocol q11n.Protocol, prop []byte) error {
 		log.Log(args.Ctx, QualifyingProperty{
-			Protocol: q.Protocol,
+			Protocol: protocol,
 			Property: log.Sensitive(prop),
 		})
 
-		switch q.Protocol {
+		switch protocol {
 		// Don't store TSPREG response in transaction, instead
 		// store it immediately, this is a requirement!
 		case q11n.TSPREG, q11n.TSP:
-			err = r.storage.StoreQualifyingProperty(
-				args.Ctx, resp.VoteID, q.Protocol, prop)
+			err := r.storage.StoreQualifyingProperty(
+				args.Ctx, resp.VoteID, protocol, prop)
 			if err != nil {
 				log.Error(args.Ctx, StoreQualifyingPropertyError{
 					Err: log.Alert(err),
@@ -217,12 +219,29 @@ func (r *RPC) Vote(args Args, resp *Response) error {
 			}
 		case q11n.OCSP:
 			r.storage.TxnStoreQualifyingProperty(
-				args.Ctx, resp.VoteID, q.Protocol, prop, txnOp)
+				args.Ctx, resp.VoteID, protocol, prop, txnOp)
 		}
 
-		log.Log(args.Ctx, VoteTxnStoreQualifyingProperty{Protocol: q.Protocol})
-		resp.Qualification[q.Protocol] = prop
-		logq11n[q.Protocol] = prop
+		log.Log(args.Ctx, VoteTxnStoreQualifyingProperty{Protocol: protocol})
+		resp.Qualification[protocol] = prop
+		logq11n[protocol] = prop
+		return nil
+	})
+	if err != nil {
+		qerr, ok := errors.CausedBy(err, new(q11n.QualifierError)).(q11n.QualifierError)
+		switch {
+		case !ok:
+			return err // Already logged by the handler.
+		case errors.CausedBy(err, new(q11n.BadCertificateStatusError)) != nil:
+			log.Error(args.Ctx, BadSignerCertificateError{Err: err})
+			return server.ErrCertificate
+		default:
+			log.Error(args.Ctx, QualifierError{
+				Protocol: qerr.Protocol,
+				Err:      log.Alert(qerr.Err),
+			})
+			return server.ErrInternal
+		}
 	}
 
 	ctime := submitted
@@ -267,13 +286,85 @@ func (r *RPC) Vote(args Args, resp *Response) error {
 		// concerned, they voted successfully.
 	}
 
+	// Issue a verification ticket for the stored vote.
+	if r.vtickets != nil {
+		expiry := r.verificationStop
+		if minutes := r.election.Verification.Minutes; minutes > 0 {
+			if limit := submitted.Add(time.Duration(minutes) * time.Minute); limit.Before(expiry) {
+				expiry = limit
+			}
+		}
+		if resp.VerificationTicket, err = r.vtickets.Create(verifyticket.Ticket{
+			Election: r.election.Identifier,
+			VoteID:   resp.VoteID,
+			Expiry:   expiry,
+		}); err != nil {
+			log.Error(args.Ctx, CreateVerificationTicketError{Err: log.Alert(err)})
+			// Do not return an error here: as fas as the voter is
+			// concerned, they voted successfully.
+		}
+	}
+
 	log.Log(args.Ctx, VoteResp{
-		VoteID:        resp.VoteID,
-		Qualification: logq11n,
+		VoteID:             resp.VoteID,
+		Qualification:      logq11n,
+		VerificationTicket: log.Sensitive(resp.VerificationTicket),
 	})
 	return nil
 }
 
+// admit checks the vote submission against the rate limiting policies,
+// verifies the vote container, and checks that it was signed by the
+// authenticated voter. The attempt is recorded by the policies which count all
+// attempts before verifying the container, so that invalid submissions are
+// throttled too. The other policies only record the submission if the vote is
+// valid and allowed by all policies, so that rejected submissions do not count
+// towards the voter's rate limits.
+func (r *RPC) admit(ctx context.Context, auther string, args Args, submitted time.Time) (
+	votec container.Container, signer, voterName, version string, err error) {
+
+	limited := ratelimit.Request{
+		Voter:   auther,
+		Address: server.ClientAddress(ctx),
+		Time:    submitted,
+	}
+	if err = r.policies.Attempt(ctx, limited); err != nil {
+		return nil, "", "", "", policyError(ctx, err)
+	}
+
+	votec, signer, voterName, version, err = r.verify(ctx,
+		args.Choices, args.Questions, args.Type, args.Vote)
+	if err != nil {
+		// Errors have already been logged by verify.
+		return
+	}
+
+	// Check that the submitter matches the signer.
+	if auther != signer {
+		log.Error(ctx, AuthenticatedSignerMismatchError{
+			Authenticated: auther,
+			Signer:        signer,
+		})
+		return votec, "", "", "", server.ErrIdentityMismatch
+	}
+
+	if err = r.policies.Record(ctx, limited); err != nil {
+		return votec, "", "", "", policyError(ctx, err)
+	}
+	return
+}
+
+// policyError logs an error returned by rate limiting policies and returns the
+// error to report to the client.
+func policyError(ctx context.Context, err error) error {
+	if errors.CausedBy(err, new(ratelimit.LimitExceededError)) != nil {
+		log.Error(ctx, RateLimitPolicyAppliedError{Err: err})
+		return server.ErrVotingRateLimit
+	}
+	log.Error(ctx, RateLimitPolicyError{Err: log.Alert(err)})
+	return server.ErrInternal
+}
+
 // ratelimit applies rate limiting to vote submissions by the same voter.
 func (r *RPC) ratelimit(ctx context.Context, voter string, submitted time.Time) error {
 	start := r.election.Voting.RateLimitStart
@@ -327,12 +418,23 @@ func (r *RPC) ratelimit(ctx context.Context, voter string, submitted time.Time)
 }
 
 // verify verifies the vote container, verifies voter eligibility and choice
-// list used, and checks that the contents of the container are sane. It
+// lists used, and checks that the contents of the container are sane. It
 // returns the vote container, voter identifier, and version of the voter list
 // used for eligibility checks.
-func (r *RPC) verify(ctx context.Context, choices string, t container.Type, containerb []byte) (
+func (r *RPC) verify(ctx context.Context, choices string, questions []QuestionChoices,
+	t container.Type, containerb []byte) (
 	votec container.Container, identity, voterName, version string, err error) {
 
+	// Multi-question votes must list the choices used for exactly the
+	// configured questions.
+	if len(r.election.Questions) > 1 || len(questions) > 0 {
+		if err = r.checkQuestions(questions); err != nil {
+			log.Error(ctx, QuestionChoicesError{Err: err})
+			err = server.ErrBadRequest
+			return
+		}
+	}
+
 	// As a special case, disallow the ASiCE alias of BDOC for voting.
 	if t == container.ASiCE {
 		log.Error(ctx, ASiCEVoteNotAllowedError{})
@@ -341,7 +443,9 @@ func (r *RPC) verify(ctx context.Context, choices string, t container.Type, cont
 	}
 
 	// Open the container.
+	_, span := trace.Start(ctx, "container.Open", "type", string(t))
 	votec, err = r.container.Open(t, bytes.NewReader(containerb))
+	span.Finish(err)
 	if err != nil {
 		log.Error(ctx, OpenContainerError{Err: err})
 		votec = nil // Ensure we do not have a half-initialized container.
@@ -388,6 +492,17 @@ func (r *RPC) verify(ctx context.Context, choices string, t container.Type, cont
 			err = server.ErrOutdatedChoices
 			return
 		}
+		for _, q := range questions {
+			if q.Choices != current {
+				log.Error(ctx, OutdatedQuestionChoicesError{
+					Question: q.Question,
+					Choices:  q.Choices,
+					Current:  current,
+				})
+				err = server.ErrOutdatedChoices
+				return
+			}
+		}
 		log.Log(ctx, VoterEligible{Version: version})
 	}
 
@@ -419,6 +534,27 @@ ballots:
 	return
 }
 
+// checkQuestions checks that questions contains the choice list identifiers for
+// each configured question exactly once.
+func (r *RPC) checkQuestions(questions []QuestionChoices) error {
+	if got, want := len(questions), len(r.election.Questions); got != want {
+		return QuestionCountError{Got: got, Want: want}
+	}
+	seen := make(map[string]bool, len(questions))
+	for _, q := range questions {
+		if seen[q.Question] {
+			return DuplicateQuestionError{Question: q.Question}
+		}
+		seen[q.Question] = true
+	}
+	for _, question := range r.election.Questions {
+		if !seen[question] {
+			return MissingQuestionError{Question: question}
+		}
+	}
+	return nil
+}
+
 // findName searches name for oid and returns the value for that oid or an
 // empty string. Panics if the value for the oid is not a string.
 func findName(name *pkix.Name, oid asn1.ObjectIdentifier) string {
@@ -429,6 +565,20 @@ func findName(name *pkix.Name, oid asn1.ObjectIdentifier) string {
 	}
 	return ""
 }
+
+// logRequest wraps a Qualifier to log each request for a qualifying property
+// when it is actually made: with concurrent qualification or cancellation, the
+// qualifiers are not necessarily run in order or at all.
+type logRequest struct {
+	q11n.Qualifier
+	protocol q11n.Protocol
+}
+
+func (l logRequest) Qualify(ctx context.Context, c container.Container) ([]byte, error) {
+	log.Log(ctx, RequestingQualifyingProperty{Protocol: l.protocol})
+	return l.Qualifier.Qualify(ctx, c)
+}
+
 func main() {
 	// Call votemain in a separate function so that it can set up defers
 	// and have them trigger before returning with a non-zero exit code.
@@ -472,6 +622,18 @@ func votemain() (code int) {
 				"bad service stop time:", err)
 		}
 
+		// Configure verification tickets if enabled.
+		if elec.Verification.Ticket {
+			if rpc.verificationStop, err = elec.VerificationStopTime(); err != nil {
+				return c.Error(exit.Config, VerificationStopTimeError{Err: err},
+					"bad verification stop time:", err)
+			}
+			if rpc.vtickets, err = verifyticket.NewFromSystem(); err != nil {
+				return c.Error(exit.Config, VerificationTicketConfError{Err: err},
+					"failed to configure verification tickets:", err)
+			}
+		}
+
 		// Skip voter eligibility if we are told to ignore it.
 		rpc.skipEligible = len(elec.IgnoreVoterList) > 0
 
@@ -487,7 +649,7 @@ func votemain() (code int) {
 
 		// Parse client-authentication configuration.
 		if authConf, err = server.NewAuthConf(
-			elec.Auth, elec.Identity, &elec.Age); err != nil {
+			elec.Auth, elec.Identity, &elec.Age, c.Storage); err != nil {
 
 			return c.Error(exit.Config, ServerAuthConfError{Err: err},
 				"failed to configure client authentication:", err)
@@ -505,11 +667,24 @@ func votemain() (code int) {
 
 		// Configure vote qualifiers.
 		if rpc.q11n, err = q11n.Configure(elec.Qualification,
+			elec.Voting.ConcurrentQualification,
 			conf.Sensitive(c.Service.ID)); err != nil {
 
 			return c.Error(exit.Config, QualificationConfError{Err: err},
 				"failed to configure vote qualifiers:", err)
 		}
+		for i := range rpc.q11n {
+			rpc.q11n[i].Qualifier = logRequest{
+				Qualifier: rpc.q11n[i].Qualifier,
+				protocol:  rpc.q11n[i].Protocol,
+			}
+		}
+
+		// Configure vote submission rate limiting policies.
+		if rpc.policies, err = ratelimit.Configure(elec.Voting.RateLimit, c.Storage); err != nil {
+			return c.Error(exit.Config, RateLimitConfError{Err: err},
+				"failed to configure rate limiting policies:", err)
+		}
 	}
 
 	var s *server.S
@@ -518,12 +693,14 @@ func votemain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)
@@ -2,14 +2,17 @@ package main
 
 import (
 	"context"
+	"net"
 	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"ivxv.ee/common/collector/conf"
 	"ivxv.ee/common/collector/container"
 	"ivxv.ee/common/collector/identity"
 	"ivxv.ee/common/collector/log"
+	"ivxv.ee/common/collector/ratelimit"
 	"ivxv.ee/common/collector/server"
 	"ivxv.ee/common/collector/storage"
 	"ivxv.ee/common/collector/storage/memory"
@@ -49,7 +52,7 @@ func TestBallot(t *testing.T) {
 	// Helper functions to simplify actual tests.
 	ctx := log.TestContext(context.Background())
 	parse := func(choices, encoded string) (string, error) {
-		_, voter, _, _, err := rpc.verify(ctx, choices, container.Dummy, []byte(encoded))
+		_, voter, _, _, err := rpc.verify(ctx, choices, nil, container.Dummy, []byte(encoded))
 		return voter, err
 	}
 
@@ -113,6 +116,208 @@ data:
 	})
 }
 
+func TestMultiQuestionBallot(t *testing.T) {
+	var err error
+	rpc := new(RPC)
+	rpc.election = &conf.Election{
+		Identifier: "voting",
+		Questions:  []string{"first", "second"},
+	}
+	rpc.container, err = container.Configure(container.Conf{container.Dummy: nil})
+	if err != nil {
+		t.Fatal("failed to configure container parser:", err)
+	}
+	rpc.identify, err = identity.Get(identity.CommonName)
+	if err != nil {
+		t.Fatal("failed to get voter identifier:", err)
+	}
+	district := string(storage.EncodeAdminDistrict("100", "1"))
+	rpc.storage = storage.NewWithProtocol(memory.New(map[string]string{
+		"/voters/version":          "0",
+		"/voters/0/eligible voter": district,
+		"/districts/" + district:   "100.1",
+	}))
+
+	ctx := log.TestContext(context.Background())
+	eligible := signer(t, "testdata/eligible.pem")
+	both := `
+signatures:
+  - signer: ` + eligible + `
+data:
+  voting.first.ballot: choice
+  voting.second.ballot: choice`
+
+	for _, test := range []struct {
+		name      string
+		expected  error
+		questions []QuestionChoices
+		encoded   string
+	}{
+		{"no questions", server.ErrBadRequest, nil, both},
+		{"missing question", server.ErrBadRequest, []QuestionChoices{
+			{"first", "100.1"},
+			{"first", "100.1"},
+		}, both},
+		{"unknown question", server.ErrBadRequest, []QuestionChoices{
+			{"first", "100.1"},
+			{"third", "100.1"},
+		}, both},
+		{"outdated question choices", server.ErrOutdatedChoices, []QuestionChoices{
+			{"first", "100.1"},
+			{"second", "200.1"},
+		}, both},
+		{"missing ballot", server.ErrBadRequest, []QuestionChoices{
+			{"first", "100.1"},
+			{"second", "100.1"},
+		}, `
+signatures:
+  - signer: ` + eligible + `
+data:
+  voting.first.ballot: choice`},
+		{"OK", nil, []QuestionChoices{
+			{"second", "100.1"},
+			{"first", "100.1"},
+		}, both},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, _, _, err := rpc.verify(ctx, "100.1", test.questions,
+				container.Dummy, []byte(test.encoded))
+			if err != test.expected {
+				t.Errorf("unexpected error: %v, want %v", err, test.expected)
+			}
+		})
+	}
+}
+
+// newAdmitRPC returns an RPC for testing admit with an eligible voter and a
+// valid vote signed by them.
+func newAdmitRPC(t *testing.T) (rpc *RPC, valid string) {
+	var err error
+	rpc = new(RPC)
+	rpc.election = &conf.Election{
+		Identifier: "voting",
+		Questions:  []string{"test"},
+	}
+	rpc.container, err = container.Configure(container.Conf{container.Dummy: nil})
+	if err != nil {
+		t.Fatal("failed to configure container parser:", err)
+	}
+	rpc.identify, err = identity.Get(identity.CommonName)
+	if err != nil {
+		t.Fatal("failed to get voter identifier:", err)
+	}
+	district := string(storage.EncodeAdminDistrict("100", "1"))
+	rpc.storage = storage.NewWithProtocol(memory.New(map[string]string{
+		"/voters/version":          "0",
+		"/voters/0/eligible voter": district,
+		"/districts/" + district:   "100.1",
+	}))
+
+	valid = `
+signatures:
+  - signer: ` + signer(t, "testdata/eligible.pem") + `
+data:
+  voting.test.ballot: choice`
+	return
+}
+
+// admitter returns a function which submits encoded as a vote by auther to
+// rpc.admit in ctx, one second after the previous submission.
+func admitter(ctx context.Context, rpc *RPC) func(auther, encoded string) error {
+	now := time.Now()
+	return func(auther, encoded string) error {
+		now = now.Add(time.Second)
+		votec, _, _, _, err := rpc.admit(ctx, auther, Args{
+			Choices: "100.1",
+			Type:    container.Dummy,
+			Vote:    []byte(encoded),
+		}, now)
+		if votec != nil {
+			votec.Close()
+		}
+		return err
+	}
+}
+
+func TestAdmitRecordsOnlyValidVotes(t *testing.T) {
+	rpc, valid := newAdmitRPC(t)
+
+	// Allow a single vote per voter in the window.
+	rpc.policies = ratelimit.Policies{
+		ratelimit.NewVoterWindow(rpc.storage, ratelimit.WindowConf{Count: 1, Minutes: 10}),
+	}
+	admit := admitter(log.TestContext(context.Background()), rpc)
+	eligible := signer(t, "testdata/eligible.pem")
+
+	// Invalid votes and votes signed by someone else are rejected without
+	// using up the voter's window.
+	for _, test := range []struct {
+		name     string
+		auther   string
+		encoded  string
+		expected error
+	}{
+		{"invalid", "eligible voter", `
+signatures:
+  - signer: ` + eligible, server.ErrBadRequest},
+		{"other signer", "other voter", valid, server.ErrIdentityMismatch},
+	} {
+		if err := admit(test.auther, test.encoded); err != test.expected {
+			t.Errorf("%s: unexpected error: %v, want %v", test.name, err, test.expected)
+		}
+	}
+
+	// The first valid vote is admitted and recorded.
+	if err := admit("eligible voter", valid); err != nil {
+		t.Fatal("valid vote not admitted:", err)
+	}
+	if err := admit("eligible voter", valid); err != server.ErrVotingRateLimit {
+		t.Errorf("unexpected error for vote over limit: %v, want %v",
+			err, server.ErrVotingRateLimit)
+	}
+}
+
+func TestAdmitThrottlesInvalidAttempts(t *testing.T) {
+	rpc, valid := newAdmitRPC(t)
+
+	// Allow two attempts per address and a vote per voter in the window.
+	var err error
+	if rpc.policies, err = ratelimit.Configure(ratelimit.Conf{
+		Voter:   ratelimit.WindowConf{Count: 1, Minutes: 10},
+		Address: ratelimit.WindowConf{Count: 2, Minutes: 10},
+	}, rpc.storage); err != nil {
+		t.Fatal("failed to configure policies:", err)
+	}
+
+	ctx := log.TestContext(context.Background())
+	abusive := admitter(server.WithClientAddress(ctx,
+		&net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 1000}), rpc)
+	other := admitter(server.WithClientAddress(ctx,
+		&net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 1000}), rpc)
+
+	// Invalid submissions count towards the address window, so repeating
+	// them gets throttled before the container is verified.
+	for i, expected := range []error{
+		server.ErrBadRequest,
+		server.ErrBadRequest,
+		server.ErrVotingRateLimit,
+		server.ErrVotingRateLimit,
+	} {
+		if err := abusive("eligible voter", "garbage"); err != expected {
+			t.Errorf("attempt %d: unexpected error: %v, want %v", i, err, expected)
+		}
+	}
+	if err := abusive("eligible voter", valid); err != server.ErrVotingRateLimit {
+		t.Errorf("unexpected error for valid vote from throttled address: %v, want %v",
+			err, server.ErrVotingRateLimit)
+	}
+
+	// The invalid submissions did not use up the voter's window.
+	if err := other("eligible voter", valid); err != nil {
+		t.Error("valid vote from other address not admitted:", err)
+	}
+}
+
 // signer loads a test certificate from an external file as a literal value and
 // indents all lines to match what is expected of signers.
 func signer(t *testing.T, path string) string {
@@ -5,6 +5,7 @@ import (
 	"os"
 	"time"
 
+	"ivxv.ee/common/collector/age"
 	"ivxv.ee/common/collector/auth"
 	"ivxv.ee/common/collector/auth/ticket"
 	_ "ivxv.ee/common/collector/auth/tls"
@@ -16,6 +17,7 @@ import (
 	"ivxv.ee/common/collector/status/client"
 	internal "ivxv.ee/webeid/internal/sessionstatus/rpc"
 	//ivxv:modules common/collector/container
+	//ivxv:modules common/collector/storage
 )
 
 // RPC is a handler for Web eID service calls.
@@ -89,8 +91,15 @@ func webeidmain() (code int) {
 			return c.Error(exit.Config, TicketAuthError{},
 				"ticket authentication is mandatory for webeid")
 		}
+		// The webeid service has no access to the voter list, so if
+		// dates of birth are imported with it, then voters' age is only
+		// checked by the choices and voting services.
+		ageConf := &elec.Age
+		if ageConf.Method == age.VoterList {
+			ageConf = nil
+		}
 		if authConf, err = server.NewAuthConf(auth.Conf{auth.Ticket: ticketConf},
-			elec.Identity, &elec.Age); err != nil {
+			elec.Identity, ageConf, nil); err != nil {
 			return c.Error(exit.Config, ServerTicketAuthConfError{Err: err},
 				"failed to configure client ticket authentication:", err)
 		}
@@ -103,7 +112,7 @@ func webeidmain() (code int) {
 		}
 		var auther server.AuthConf
 		if auther, err = server.NewAuthConf(auth.Conf{auth.TLS: tlsConf},
-			"", nil); err != nil {
+			"", nil, nil); err != nil {
 			return c.Error(exit.Config, ServerTLSAuthConfError{Err: err},
 				"failed to configure client TLS authentication:", err)
 		}
@@ -118,12 +127,14 @@ func webeidmain() (code int) {
 		// configuration and the RPC handler instance.
 		cert, key := conf.TLS(conf.Sensitive(c.Service.ID))
 		if s, err = server.New(&server.Conf{
-			CertPath: cert,
-			KeyPath:  key,
-			Address:  c.Service.Address,
-			End:      stop,
-			Filter:   &c.Conf.Technical.Filter,
-			Version:  &c.Conf.Version,
+			CertPath:       cert,
+			KeyPath:        key,
+			Address:        c.Service.Address,
+			End:            stop,
+			Filter:         &c.Conf.Technical.Filter,
+			Version:        &c.Conf.Version,
+			MetricsAddress: c.Service.MetricsAddress,
+			TraceFile:      c.Service.TraceFile,
 		}, rpc); err != nil {
 			return c.Error(exit.Config, ServerConfError{Err: err},
 				"failed to configure server:", err)